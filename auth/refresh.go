@@ -0,0 +1,342 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	whttp "github.com/piusalfred/whatsapp/http"
+)
+
+// DefaultRefreshBefore is how long before its expiry the token of a RefreshingTokenSource
+// is refreshed.
+const DefaultRefreshBefore = 10 * time.Minute
+
+type (
+	// RefreshFunc obtains a new token. The current token, nil if there is none, is passed so
+	// it can be exchanged for the new one.
+	RefreshFunc func(ctx context.Context, current *Token) (*Token, error)
+
+	// RefreshingTokenSource returns its current token and obtains a new one with the RefreshFunc
+	// when the current token is about to expire. Concurrent callers wait for a single refresh.
+	//
+	// If the refresh fails while the current token has not expired yet, the current token is
+	// returned and the refresh is attempted again on the next call.
+	RefreshingTokenSource struct {
+		mu            sync.Mutex
+		token         *Token
+		refresh       RefreshFunc
+		refreshBefore time.Duration
+		now           func() time.Time
+	}
+
+	RefreshingOption func(*RefreshingTokenSource)
+
+	// ExpiryCallback is called with the token and the time left before it expires.
+	ExpiryCallback func(ctx context.Context, token *Token, remaining time.Duration)
+
+	expiryNotifier struct {
+		source   TokenSource
+		within   time.Duration
+		callback ExpiryCallback
+		mu       sync.Mutex
+		notified string
+		now      func() time.Time
+	}
+
+	// ExchangeRequest holds the app credentials used to exchange a token for a long-lived one.
+	ExchangeRequest struct {
+		BaseURL     string
+		ApiVersion  string
+		AppID       string
+		AppSecret   string
+		RetryPolicy *whttp.RetryPolicy
+	}
+
+	// SystemUserTokenRequest holds the details needed to generate a system user access token.
+	// Scopes are the permissions of the token, for example whatsapp_business_messaging and
+	// whatsapp_business_management. When ExpiresIn60Days is false the token never expires.
+	SystemUserTokenRequest struct {
+		BaseURL         string
+		ApiVersion      string
+		SystemUserID    string
+		AppID           string
+		AppSecret       string
+		Scopes          []string
+		ExpiresIn60Days bool
+		RetryPolicy     *whttp.RetryPolicy
+	}
+
+	tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type,omitempty"`
+		ExpiresIn   int64  `json:"expires_in,omitempty"`
+	}
+)
+
+// WithRefreshBefore sets how long before its expiry the token is refreshed.
+func WithRefreshBefore(d time.Duration) RefreshingOption {
+	return func(s *RefreshingTokenSource) {
+		s.refreshBefore = d
+	}
+}
+
+// NewRefreshingTokenSource returns a RefreshingTokenSource starting with the initial token,
+// which can be nil to obtain the first token with refresh.
+func NewRefreshingTokenSource(initial *Token, refresh RefreshFunc, options ...RefreshingOption,
+) *RefreshingTokenSource {
+	source := &RefreshingTokenSource{
+		token:         initial,
+		refresh:       refresh,
+		refreshBefore: DefaultRefreshBefore,
+		now:           time.Now,
+	}
+
+	for _, option := range options {
+		option(source)
+	}
+
+	return source
+}
+
+// Token returns the current token, refreshing it first if it is about to expire.
+func (s *RefreshingTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != nil && !s.token.ExpiresWithin(now, s.refreshBefore) {
+		return s.token, nil
+	}
+
+	token, err := s.refreshLocked(ctx)
+	if err != nil {
+		if s.token != nil && !s.token.Expired(now) {
+			return s.token, nil
+		}
+
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Refresh replaces the current token regardless of its expiry if it is the rejected token, or
+// if rejected is empty. Otherwise the token has already been replaced since it was rejected,
+// and the current token is returned.
+func (s *RefreshingTokenSource) Refresh(ctx context.Context, rejected string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && rejected != "" && s.token.AccessToken != rejected {
+		return s.token, nil
+	}
+
+	return s.refreshLocked(ctx)
+}
+
+func (s *RefreshingTokenSource) refreshLocked(ctx context.Context) (*Token, error) {
+	token, err := s.refresh(ctx, s.token)
+	if err != nil {
+		return nil, fmt.Errorf("auth: refresh token: %w", err)
+	}
+
+	if token == nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("auth: refresh token: %w", ErrNoToken)
+	}
+
+	s.token = token
+
+	return token, nil
+}
+
+// NotifyExpiry returns a TokenSource that returns the tokens of source and calls the callback
+// the first time it returns a token that expires in less than within. The callback is called
+// once per token, the returned source refreshes the tokens of source if it is a Refresher.
+func NotifyExpiry(source TokenSource, within time.Duration, callback ExpiryCallback) TokenSource {
+	return &expiryNotifier{
+		source:   source,
+		within:   within,
+		callback: callback,
+		now:      time.Now,
+	}
+}
+
+func (n *expiryNotifier) Token(ctx context.Context) (*Token, error) {
+	token, err := n.source.Token(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	n.check(ctx, token)
+
+	return token, nil
+}
+
+func (n *expiryNotifier) Refresh(ctx context.Context, rejected string) (*Token, error) {
+	token, err := Refresh(ctx, n.source, rejected)
+	if err != nil {
+		return nil, err
+	}
+
+	n.check(ctx, token)
+
+	return token, nil
+}
+
+func (n *expiryNotifier) check(ctx context.Context, token *Token) {
+	now := n.now()
+	if n.callback == nil || !token.ExpiresWithin(now, n.within) {
+		return
+	}
+
+	n.mu.Lock()
+	if n.notified == token.AccessToken {
+		n.mu.Unlock()
+
+		return
+	}
+	n.notified = token.AccessToken
+	n.mu.Unlock()
+
+	n.callback(ctx, token, token.ExpiresAt.Sub(now))
+}
+
+// ExchangeToken exchanges a short-lived or a long-lived user access token for a new long-lived
+// token that expires in about 60 days.
+//
+//	GET /oauth/access_token?grant_type=fb_exchange_token&client_id=APP_ID&client_secret=APP_SECRET
+//		&fb_exchange_token=TOKEN
+func ExchangeToken(ctx context.Context, client *http.Client, request *ExchangeRequest, token string) (
+	*Token, error,
+) {
+	reqCtx := &whttp.RequestContext{
+		Name:       "exchange token",
+		BaseURL:    request.BaseURL,
+		ApiVersion: request.ApiVersion,
+		SenderID:   "oauth",
+		Endpoints:  []string{"access_token"},
+	}
+
+	params := &whttp.Request{
+		Context: reqCtx,
+		Method:  http.MethodGet,
+		Query: map[string]string{
+			"grant_type":        "fb_exchange_token",
+			"client_id":         request.AppID,
+			"client_secret":     request.AppSecret,
+			"fb_exchange_token": token,
+		},
+		Retry: request.RetryPolicy,
+	}
+
+	var resp tokenResponse
+	if err := whttp.Send(ctx, client, params, &resp); err != nil {
+		return nil, fmt.Errorf("exchange token: %w", err)
+	}
+
+	return resp.token(time.Now()), nil
+}
+
+// ExchangeRefresher returns a RefreshFunc that exchanges the current token with ExchangeToken.
+func ExchangeRefresher(client *http.Client, request *ExchangeRequest) RefreshFunc {
+	return func(ctx context.Context, current *Token) (*Token, error) {
+		if current == nil || current.AccessToken == "" {
+			return nil, ErrNoToken
+		}
+
+		return ExchangeToken(ctx, client, request, current.AccessToken)
+	}
+}
+
+// GenerateSystemUserToken generates a new access token for the system user. The token used
+// to make the request must belong to an admin system user of the business.
+//
+//	POST /SYSTEM_USER_ID/access_tokens?business_app=APP_ID&scope=SCOPES&appsecret_proof=PROOF
+func GenerateSystemUserToken(ctx context.Context, client *http.Client, request *SystemUserTokenRequest,
+	token string,
+) (*Token, error) {
+	reqCtx := &whttp.RequestContext{
+		Name:       "generate system user token",
+		BaseURL:    request.BaseURL,
+		ApiVersion: request.ApiVersion,
+		SenderID:   request.SystemUserID,
+		Endpoints:  []string{"access_tokens"},
+	}
+
+	params := &whttp.Request{
+		Context: reqCtx,
+		Method:  http.MethodPost,
+		Bearer:  token,
+		Query: map[string]string{
+			"business_app":                 request.AppID,
+			"scope":                        strings.Join(request.Scopes, ","),
+			"appsecret_proof":              AppSecretProof(token, request.AppSecret),
+			"set_token_expires_in_60_days": strconv.FormatBool(request.ExpiresIn60Days),
+		},
+		Retry: request.RetryPolicy,
+	}
+
+	var resp tokenResponse
+	if err := whttp.Send(ctx, client, params, &resp); err != nil {
+		return nil, fmt.Errorf("generate system user token: %w", err)
+	}
+
+	return resp.token(time.Now()), nil
+}
+
+// SystemUserRefresher returns a RefreshFunc that generates a new token for the system user with
+// GenerateSystemUserToken, using the current token to authenticate the request.
+func SystemUserRefresher(client *http.Client, request *SystemUserTokenRequest) RefreshFunc {
+	return func(ctx context.Context, current *Token) (*Token, error) {
+		if current == nil || current.AccessToken == "" {
+			return nil, ErrNoToken
+		}
+
+		return GenerateSystemUserToken(ctx, client, request, current.AccessToken)
+	}
+}
+
+// AppSecretProof returns the appsecret_proof of the access token, the hex encoded
+// HMAC-SHA256 of the token keyed with the app secret.
+func AppSecretProof(accessToken, appSecret string) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	_, _ = mac.Write([]byte(accessToken))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (r *tokenResponse) token(now time.Time) *Token {
+	token := &Token{AccessToken: r.AccessToken}
+	if r.ExpiresIn > 0 {
+		token.ExpiresAt = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+
+	return token
+}
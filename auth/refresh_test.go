@@ -0,0 +1,227 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshingTokenSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	var (
+		calls int32
+		fail  atomic.Bool
+	)
+	refresh := func(_ context.Context, current *Token) (*Token, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail.Load() {
+			return nil, errors.New("refresh failed")
+		}
+
+		return &Token{AccessToken: current.AccessToken + "+", ExpiresAt: now.Add(time.Hour)}, nil
+	}
+
+	source := NewRefreshingTokenSource(&Token{AccessToken: "t", ExpiresAt: now.Add(time.Hour)}, refresh,
+		WithRefreshBefore(5*time.Minute))
+	source.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := source.Token(ctx); err != nil || token.AccessToken != "t" {
+				t.Errorf("Token() = %v, %v, want t", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 0 {
+		t.Fatalf("refresh called %d times for a valid token", calls)
+	}
+
+	now = now.Add(56 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if token, err := source.Token(ctx); err != nil || token.AccessToken != "t+" {
+			t.Fatalf("Token() = %v, %v, want t+", token, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("refresh called %d times, want 1", calls)
+	}
+
+	fail.Store(true)
+	now = now.Add(58 * time.Minute)
+	if token, err := source.Token(ctx); err != nil || token.AccessToken != "t+" {
+		t.Errorf("Token() = %v, %v, want the current token while it has not expired", token, err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := source.Token(ctx); err == nil {
+		t.Errorf("Token() with an expired token and a failing refresh = nil error")
+	}
+}
+
+func TestRefreshingTokenSource_Refresh(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var calls int32
+	refresh := func(_ context.Context, current *Token) (*Token, error) {
+		atomic.AddInt32(&calls, 1)
+
+		return &Token{AccessToken: current.AccessToken + "+"}, nil
+	}
+	source := NewRefreshingTokenSource(&Token{AccessToken: "t"}, refresh)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := source.Refresh(ctx, "t"); err != nil || token.AccessToken != "t+" {
+				t.Errorf("Refresh(t) = %v, %v, want t+", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("refresh called %d times for one rejected token, want 1", calls)
+	}
+
+	if token, err := source.Refresh(ctx, "t+"); err != nil || token.AccessToken != "t++" || calls != 2 {
+		t.Errorf("Refresh(t+) = %v, %v after %d calls, want t++ after 2", token, err, calls)
+	}
+
+	if token, err := source.Refresh(ctx, ""); err != nil || token.AccessToken != "t+++" || calls != 3 {
+		t.Errorf("Refresh(\"\") = %v, %v after %d calls, want t+++ after 3", token, err, calls)
+	}
+}
+
+func TestNotifyExpiry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	var notified []time.Duration
+	current := &Token{AccessToken: "a", ExpiresAt: now.Add(48 * time.Hour)}
+	source := NotifyExpiry(TokenSourceFunc(func(context.Context) (*Token, error) {
+		return current, nil
+	}), 24*time.Hour, func(_ context.Context, token *Token, remaining time.Duration) {
+		notified = append(notified, remaining)
+	})
+
+	_, _ = source.Token(ctx)
+	if len(notified) != 0 {
+		t.Fatalf("callback called for a token expiring in 48h")
+	}
+
+	current = &Token{AccessToken: "b", ExpiresAt: now.Add(12 * time.Hour)}
+	_, _ = source.Token(ctx)
+	_, _ = source.Token(ctx)
+	if len(notified) != 1 || notified[0] > 12*time.Hour || notified[0] < 11*time.Hour {
+		t.Fatalf("callback calls = %v, want one with about 12h remaining", notified)
+	}
+
+	if _, err := Refresh(ctx, source, "b"); !errors.Is(err, ErrNotRefreshable) {
+		t.Errorf("Refresh() error = %v, want %v", err, ErrNotRefreshable)
+	}
+}
+
+func TestExchangeRefresher(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/v16.0/oauth/access_token" || q.Get("grant_type") != "fb_exchange_token" ||
+			q.Get("client_id") != "app-id" || q.Get("client_secret") != "app-secret" ||
+			q.Get("fb_exchange_token") != "short-lived" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"Invalid OAuth access token","type":"OAuthException","code":190}}`))
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"long-lived","token_type":"bearer","expires_in":5183944}`))
+	}))
+	defer server.Close()
+
+	refresh := ExchangeRefresher(server.Client(), &ExchangeRequest{
+		BaseURL:    server.URL,
+		ApiVersion: "v16.0",
+		AppID:      "app-id",
+		AppSecret:  "app-secret",
+	})
+	source := NewRefreshingTokenSource(&Token{AccessToken: "short-lived", ExpiresAt: time.Now()}, refresh)
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if token.AccessToken != "long-lived" || time.Until(token.ExpiresAt) < 59*24*time.Hour {
+		t.Errorf("Token() = %+v, want long-lived expiring in 60 days", token)
+	}
+
+	_, err = source.Refresh(context.Background(), "long-lived")
+	if !IsInvalidTokenError(err) {
+		t.Errorf("Refresh() error = %v, want an invalid token error", err)
+	}
+}
+
+func TestGenerateSystemUserToken(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/v16.0/1234/access_tokens" || r.Header.Get("Authorization") != "Bearer admin-token" ||
+			q.Get("appsecret_proof") != AppSecretProof("admin-token", "app-secret") ||
+			q.Get("scope") != "whatsapp_business_messaging,whatsapp_business_management" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"system-user-token"}`))
+	}))
+	defer server.Close()
+
+	token, err := GenerateSystemUserToken(context.Background(), server.Client(), &SystemUserTokenRequest{
+		BaseURL:      server.URL,
+		ApiVersion:   "v16.0",
+		SystemUserID: "1234",
+		AppID:        "app-id",
+		AppSecret:    "app-secret",
+		Scopes:       []string{"whatsapp_business_messaging", "whatsapp_business_management"},
+	}, "admin-token")
+	if err != nil {
+		t.Fatalf("GenerateSystemUserToken() error = %v", err)
+	}
+
+	if token.AccessToken != "system-user-token" || !token.ExpiresAt.IsZero() {
+		t.Errorf("GenerateSystemUserToken() = %+v, want a token that never expires", token)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package auth provides the access tokens used to authenticate the requests made to the
+// WhatsApp Cloud API.
+//
+// A TokenSource returns the token to use for a request. StaticTokenSource always returns the
+// same token, EnvTokenSource reads it from an environment variable, FileTokenSource reads it
+// from a file and picks up the changes made to the file, and RefreshingTokenSource obtains a
+// new token with a RefreshFunc before the current one expires.
+//
+// Sources that can replace a token rejected by the API implement Refresher. whatsapp.Client
+// uses it to retry a request once when it fails with an expired or invalidated token (error
+// code 190).
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	whttp "github.com/piusalfred/whatsapp/http"
+)
+
+// ErrorCodeInvalidToken is the code of the OAuthException returned when the access token
+// has expired, has been invalidated or can not be parsed.
+const ErrorCodeInvalidToken = 190
+
+var (
+	ErrNoToken          = errors.New("auth: no access token")
+	ErrNotRefreshable   = errors.New("auth: token source can not be refreshed")
+	ErrEnvVarNotSet     = errors.New("auth: environment variable not set")
+	ErrInvalidTokenFile = errors.New("auth: invalid token file")
+)
+
+type (
+	// Token is an access token. A zero ExpiresAt means the expiry is unknown, as for the system
+	// user tokens that never expire.
+	Token struct {
+		AccessToken string    `json:"access_token"`
+		ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	}
+
+	// TokenSource returns the access token to use for a request. Implementations must be
+	// safe for concurrent use.
+	TokenSource interface {
+		Token(ctx context.Context) (*Token, error)
+	}
+
+	// Refresher is implemented by the sources that can replace the current token, for example
+	// after it has been rejected by the API. rejected is the access token the API rejected: a
+	// source that already holds another token returns it instead of refreshing again, so the
+	// concurrent requests rejected with the same token cause a single refresh. An empty
+	// rejected always refreshes.
+	Refresher interface {
+		Refresh(ctx context.Context, rejected string) (*Token, error)
+	}
+
+	// TokenSourceFunc is a function that implements TokenSource.
+	TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+	staticTokenSource struct {
+		token *Token
+	}
+
+	// EnvTokenSource reads the token from the environment variable on every call, so a
+	// token changed with os.Setenv is used by the next request.
+	EnvTokenSource struct {
+		Name string
+	}
+
+	// FileTokenSource reads the token from a file. The file is read again when its size or
+	// modification time changes, so a token written to the file by another process, for
+	// example a secret mounted by the orchestrator, is used by the next request.
+	//
+	// The file contains either the token alone or a json object with the access_token and
+	// the expires_at fields.
+	FileTokenSource struct {
+		path    string
+		mu      sync.Mutex
+		token   *Token
+		size    int64
+		modTime time.Time
+	}
+)
+
+// Token calls f(ctx).
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// Expired reports whether the token has expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// ExpiresWithin reports whether the token expires in less than d from now.
+func (t *Token) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return !t.ExpiresAt.IsZero() && t.ExpiresAt.Sub(now) < d
+}
+
+// StaticTokenSource returns a TokenSource that always returns the same token.
+func StaticTokenSource(accessToken string) TokenSource {
+	return &staticTokenSource{token: &Token{AccessToken: accessToken}}
+}
+
+func (s *staticTokenSource) Token(_ context.Context) (*Token, error) {
+	return s.token, nil
+}
+
+// Token returns the value of the environment variable.
+func (s *EnvTokenSource) Token(_ context.Context) (*Token, error) {
+	value, ok := os.LookupEnv(s.Name)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("%w: %s", ErrEnvVarNotSet, s.Name)
+	}
+
+	return &Token{AccessToken: value}, nil
+}
+
+// Refresh reads the environment variable again.
+func (s *EnvTokenSource) Refresh(ctx context.Context, _ string) (*Token, error) {
+	return s.Token(ctx)
+}
+
+// NewFileTokenSource returns a FileTokenSource that reads the token from the file at path.
+func NewFileTokenSource(path string) *FileTokenSource {
+	return &FileTokenSource{path: path}
+}
+
+// Token returns the token in the file, reading the file again if it has changed.
+func (s *FileTokenSource) Token(_ context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: token file: %w", err)
+	}
+
+	if s.token != nil && info.Size() == s.size && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	return s.read(info)
+}
+
+// Refresh reads the file again even if it looks unchanged.
+func (s *FileTokenSource) Refresh(_ context.Context, _ string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: token file: %w", err)
+	}
+
+	return s.read(info)
+}
+
+func (s *FileTokenSource) read(info os.FileInfo) (*Token, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: token file: %w", err)
+	}
+
+	token, err := parseToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidTokenFile, s.path, err)
+	}
+
+	s.token, s.size, s.modTime = token, info.Size(), info.ModTime()
+
+	return token, nil
+}
+
+// parseToken parses the content of a token file.
+func parseToken(data []byte) (*Token, error) {
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, "{") {
+		if content == "" {
+			return nil, ErrNoToken
+		}
+
+		return &Token{AccessToken: content}, nil
+	}
+
+	var token Token
+	if err := json.Unmarshal([]byte(content), &token); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if token.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+
+	return &token, nil
+}
+
+// Refresh refreshes the token of the source after the API rejected the token rejected, if the
+// source implements Refresher, otherwise it returns ErrNotRefreshable.
+func Refresh(ctx context.Context, source TokenSource, rejected string) (*Token, error) {
+	refresher, ok := source.(Refresher)
+	if !ok {
+		return nil, ErrNotRefreshable
+	}
+
+	return refresher.Refresh(ctx, rejected)
+}
+
+// IsInvalidTokenError reports whether err is the error returned by the API when the access
+// token has expired or has been invalidated.
+func IsInvalidTokenError(err error) bool {
+	var re *whttp.ResponseError
+	if !errors.As(err, &re) || re.Err == nil {
+		return false
+	}
+
+	return re.Err.Code == ErrorCodeInvalidToken
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+	whttp "github.com/piusalfred/whatsapp/http"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "token")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := NewFileTokenSource(path)
+	if _, err := source.Token(ctx); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Token() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("first-token\n", start)
+	token, err := source.Token(ctx)
+	if err != nil || token.AccessToken != "first-token" {
+		t.Fatalf("Token() = %v, %v, want first-token", token, err)
+	}
+
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	write(`{"access_token": "second-token", "expires_at": "2030-01-02T03:04:05Z"}`, start.Add(time.Minute))
+	token, err = source.Token(ctx)
+	if err != nil || token.AccessToken != "second-token" || !token.ExpiresAt.Equal(expiry) {
+		t.Fatalf("Token() = %v, %v, want second-token expiring at %v", token, err, expiry)
+	}
+
+	write("", start.Add(2*time.Minute))
+	if _, err := source.Token(ctx); !errors.Is(err, ErrInvalidTokenFile) {
+		t.Errorf("Token() error = %v, want %v", err, ErrInvalidTokenFile)
+	}
+}
+
+func TestEnvTokenSource(t *testing.T) {
+	t.Setenv("WHATSAPP_TEST_TOKEN", "env-token")
+	source := &EnvTokenSource{Name: "WHATSAPP_TEST_TOKEN"}
+	token, err := source.Token(context.Background())
+	if err != nil || token.AccessToken != "env-token" {
+		t.Fatalf("Token() = %v, %v, want env-token", token, err)
+	}
+
+	t.Setenv("WHATSAPP_TEST_TOKEN", "rotated-token")
+	token, err = Refresh(context.Background(), source, "env-token")
+	if err != nil || token.AccessToken != "rotated-token" {
+		t.Fatalf("Refresh() = %v, %v, want rotated-token", token, err)
+	}
+
+	source.Name = "WHATSAPP_TEST_TOKEN_UNSET"
+	if _, err := source.Token(context.Background()); !errors.Is(err, ErrEnvVarNotSet) {
+		t.Errorf("Token() error = %v, want %v", err, ErrEnvVarNotSet)
+	}
+}
+
+func TestIsInvalidTokenError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "expired token",
+			err: &whttp.ResponseError{Code: http.StatusUnauthorized, Err: &werrors.Error{
+				Code: ErrorCodeInvalidToken, Subcode: 463, Type: "OAuthException",
+			}},
+			want: true,
+		},
+		{
+			name: "other error",
+			err:  &whttp.ResponseError{Code: http.StatusBadRequest, Err: &werrors.Error{Code: 100}},
+			want: false,
+		},
+		{
+			name: "not a response error",
+			err:  context.DeadlineExceeded,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsInvalidTokenError(tt.err); got != tt.want {
+				t.Errorf("IsInvalidTokenError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Refresh(context.Background(), StaticTokenSource("token"), "token"); !errors.Is(err, ErrNotRefreshable) {
+		t.Errorf("Refresh() error = %v, want %v", err, ErrNotRefreshable)
+	}
+}
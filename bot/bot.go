@@ -0,0 +1,559 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package bot routes the messages received by a webhooks.EventListener to handlers, as a
+// http.ServeMux routes requests:
+//
+//	router := bot.NewRouter(client)
+//	router.Keyword("help", help)
+//	router.Keyword("track {order}", track)
+//	router.Regex(regexp.MustCompile(`^(?i)pay (?P<amount>\d+)$`), pay)
+//	router.ButtonReply("order:{id}:cancel", cancel)
+//	router.Fallback(func(ctx context.Context, request *bot.Request, reply *bot.Reply) error {
+//		return reply.Text(ctx, "Sorry, I did not get that. Send help for the commands.")
+//	})
+//	router.Attach(listener)
+//
+// The text messages are matched by the keyword, prefix and regex routes, the replies to the
+// reply buttons and lists by their IDs and the replies to the quick reply buttons of the
+// templates by their payloads. The routes are tried in the order they are added and the
+// handler of the first that matches is called.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// Kinds of the messages routed.
+const (
+	KindText Kind = iota + 1
+	KindButtonReply
+	KindListReply
+	KindPayload
+)
+
+var ErrInvalidPattern = errors.New("bot: invalid pattern")
+
+type (
+	// Kind is the kind of a message routed.
+	Kind int
+
+	// Request is a message routed to a handler. Text is the body of the text messages, and the
+	// title or text of the replies. ID is the ID of the button or the row replied to, or the
+	// payload of the quick reply button. Params are the parameters of the route pattern, or
+	// the named groups of its regular expression, and Args the words after a prefix or the
+	// submatches of the regular expression.
+	Request struct {
+		Kind                Kind
+		From                string
+		MessageID           string
+		Text                string
+		ID                  string
+		Params              map[string]string
+		Args                []string
+		NotificationContext *webhooks.NotificationContext
+		MessageContext      *webhooks.MessageContext
+		Interactive         *webhooks.Interactive
+		Button              *webhooks.Button
+	}
+
+	// Sender sends the replies, *whatsapp.Client is a Sender.
+	Sender interface {
+		SendTextMessage(ctx context.Context, recipient string, message *whatsapp.TextMessage) (
+			*whatsapp.ResponseMessage, error)
+		Reply(ctx context.Context, recipient string, req *whatsapp.ReplyMessage) (*whatsapp.ResponseMessage, error)
+	}
+
+	// Reply sends messages to the sender of a request.
+	Reply struct {
+		sender    Sender
+		recipient string
+		messageID string
+	}
+
+	// HandlerFunc handles a request, replying with the reply if needed.
+	HandlerFunc func(ctx context.Context, request *Request, reply *Reply) error
+
+	// Middleware wraps the handlers of a router or of a group.
+	Middleware func(next HandlerFunc) HandlerFunc
+
+	// Router routes the messages to the handlers of the routes that match them.
+	Router struct {
+		mu       sync.RWMutex
+		sender   Sender
+		routes   []*route
+		groups   []*Group
+		fallback HandlerFunc
+		root     *Group
+	}
+
+	// Group is a set of routes that share a keyword prefix, middlewares and a fallback. The
+	// keyword and prefix routes of a group only match the text messages that start with its
+	// prefix, the other routes are not prefixed.
+	Group struct {
+		router      *Router
+		parent      *Group
+		prefix      string
+		middlewares []Middleware
+		fallback    HandlerFunc
+	}
+
+	route struct {
+		kind    Kind
+		match   func(request *Request) bool
+		group   *Group
+		handler HandlerFunc
+	}
+)
+
+// NewRouter returns a Router that replies with the sender.
+func NewRouter(sender Sender) *Router {
+	router := &Router{sender: sender}
+	router.root = &Group{router: router}
+
+	return router
+}
+
+// Attach subscribes the router to the text messages, the interactive replies and the button
+// replies received by the listener. The texts quoting a message, dispatched as product
+// enquiries, and the texts with a referral are routed as text messages too.
+func (router *Router) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	unsubscribes := []webhooks.Unsubscribe{
+		listener.OnTextMessage(router.TextMessage),
+		listener.OnProductEnquiry(router.TextMessage),
+		listener.OnReferralMessage(router.ReferralMessage),
+		listener.OnInteractiveMessage(router.InteractiveMessage),
+		listener.OnButtonMessage(router.ButtonMessage),
+	}
+
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// TextMessage routes the text message, it is a webhooks.OnTextMessageHook.
+func (router *Router) TextMessage(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, text *webhooks.Text,
+) error {
+	return router.Route(ctx, newRequest(KindText, nctx, mctx, text.Body, ""))
+}
+
+// ReferralMessage routes the text message with a referral, from an ad for example, it is a
+// webhooks.OnReferralMessageHook.
+func (router *Router) ReferralMessage(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, text *webhooks.Text, _ *webhooks.Referral,
+) error {
+	if text == nil {
+		return nil
+	}
+
+	return router.TextMessage(ctx, nctx, mctx, text)
+}
+
+// InteractiveMessage routes the reply to a reply button or list, it is a
+// webhooks.OnInteractiveMessageHook.
+func (router *Router) InteractiveMessage(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, interactive *webhooks.Interactive,
+) error {
+	var request *Request
+	switch {
+	case interactive.ButtonReply != nil:
+		request = newRequest(KindButtonReply, nctx, mctx, interactive.ButtonReply.Title, interactive.ButtonReply.ID)
+	case interactive.ListReply != nil:
+		request = newRequest(KindListReply, nctx, mctx, interactive.ListReply.Title, interactive.ListReply.ID)
+	default:
+		return nil
+	}
+	request.Interactive = interactive
+
+	return router.Route(ctx, request)
+}
+
+// ButtonMessage routes the reply to a quick reply button, it is a webhooks.OnButtonMessageHook.
+func (router *Router) ButtonMessage(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, button *webhooks.Button,
+) error {
+	request := newRequest(KindPayload, nctx, mctx, button.Text, button.Payload)
+	request.Button = button
+
+	return router.Route(ctx, request)
+}
+
+func newRequest(kind Kind, nctx *webhooks.NotificationContext, mctx *webhooks.MessageContext,
+	text, id string,
+) *Request {
+	request := &Request{
+		Kind:                kind,
+		Text:                text,
+		ID:                  id,
+		NotificationContext: nctx,
+		MessageContext:      mctx,
+	}
+	if mctx != nil {
+		request.From = mctx.From
+		request.MessageID = mctx.ID
+	}
+
+	return request
+}
+
+// Route calls the handler of the first route that matches the request, or the fallback of
+// the innermost group whose prefix the text starts with, or the fallback of the router. The
+// request is ignored if there is none.
+func (router *Router) Route(ctx context.Context, request *Request) error {
+	router.mu.RLock()
+	routes, groups, fallback := router.routes, router.groups, router.fallback
+	router.mu.RUnlock()
+
+	reply := &Reply{sender: router.sender, recipient: request.From, messageID: request.MessageID}
+	for _, route := range routes {
+		if route.kind == request.Kind && route.match(request) {
+			return route.group.wrap(route.handler)(ctx, request, reply)
+		}
+	}
+
+	if group := fallbackGroup(groups, request); group != nil {
+		return group.wrap(group.fallback)(ctx, request, reply)
+	}
+
+	if fallback == nil {
+		return nil
+	}
+
+	return router.root.wrap(fallback)(ctx, request, reply)
+}
+
+// Fallback sets the handler of the messages that match no route.
+func (router *Router) Fallback(handler HandlerFunc) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	router.fallback = handler
+}
+
+// Use adds middlewares to all the handlers.
+func (router *Router) Use(middlewares ...Middleware) {
+	router.root.Use(middlewares...)
+}
+
+// Group returns a group of the routes whose keywords and prefixes start with the prefix.
+func (router *Router) Group(prefix string, middlewares ...Middleware) *Group {
+	return router.root.Group(prefix, middlewares...)
+}
+
+// Keyword routes the text messages that are the pattern, see Group.Keyword.
+func (router *Router) Keyword(pattern string, handler HandlerFunc) {
+	router.root.Keyword(pattern, handler)
+}
+
+// Prefix routes the text messages that start with the prefix, see Group.Prefix.
+func (router *Router) Prefix(prefix string, handler HandlerFunc) {
+	router.root.Prefix(prefix, handler)
+}
+
+// Regex routes the text messages that match the regular expression, see Group.Regex.
+func (router *Router) Regex(re *regexp.Regexp, handler HandlerFunc) {
+	router.root.Regex(re, handler)
+}
+
+// ButtonReply routes the replies to the reply buttons with the ID, see Group.ButtonReply.
+func (router *Router) ButtonReply(pattern string, handler HandlerFunc) {
+	router.root.ButtonReply(pattern, handler)
+}
+
+// ListReply routes the replies to the list rows with the ID, see Group.ListReply.
+func (router *Router) ListReply(pattern string, handler HandlerFunc) {
+	router.root.ListReply(pattern, handler)
+}
+
+// Payload routes the replies to the quick reply buttons with the payload, see Group.Payload.
+func (router *Router) Payload(pattern string, handler HandlerFunc) {
+	router.root.Payload(pattern, handler)
+}
+
+// fallbackGroup returns the group with the longest prefix the text of the request starts with
+// that has a fallback.
+func fallbackGroup(groups []*Group, request *Request) *Group {
+	if request.Kind != KindText {
+		return nil
+	}
+
+	var found *Group
+	for _, group := range groups {
+		prefix := group.fullPrefix()
+		if group.fallback != nil && hasWordPrefix(request.Text, prefix) &&
+			(found == nil || len(prefix) > len(found.fullPrefix())) {
+			found = group
+		}
+	}
+
+	return found
+}
+
+func (router *Router) add(route *route) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	router.routes = append(router.routes, route)
+}
+
+// Group returns a group of the routes whose keywords and prefixes start with the prefix of
+// this group and then the prefix.
+func (group *Group) Group(prefix string, middlewares ...Middleware) *Group {
+	child := &Group{
+		router:      group.router,
+		parent:      group,
+		prefix:      strings.Join(strings.Fields(prefix), " "),
+		middlewares: middlewares,
+	}
+	group.router.mu.Lock()
+	group.router.groups = append(group.router.groups, child)
+	group.router.mu.Unlock()
+
+	return child
+}
+
+// Use adds middlewares to the handlers of the group.
+func (group *Group) Use(middlewares ...Middleware) {
+	group.router.mu.Lock()
+	defer group.router.mu.Unlock()
+	group.middlewares = append(group.middlewares, middlewares...)
+}
+
+// Fallback sets the handler of the text messages that start with the prefix of the group and
+// match no route.
+func (group *Group) Fallback(handler HandlerFunc) {
+	group.router.mu.Lock()
+	defer group.router.mu.Unlock()
+	group.fallback = handler
+}
+
+// Keyword routes the text messages that are the pattern, ignoring the case and the spaces.
+// The words of the pattern in braces are parameters that match a word, or the rest of the
+// message for the last word: "track {order}" matches "Track 1234" with the parameter order
+// set to "1234". It panics if the pattern is invalid.
+func (group *Group) Keyword(pattern string, handler HandlerFunc) {
+	re := mustCompile(joinPrefix(group.fullPrefix(), pattern), true)
+	group.add(KindText, func(request *Request) bool {
+		return matchPattern(re, normalize(request.Text), request)
+	}, handler)
+}
+
+// Prefix routes the text messages whose first words are the prefix, ignoring the case. The
+// remaining words are set as the arguments of the request.
+func (group *Group) Prefix(prefix string, handler HandlerFunc) {
+	prefix = joinPrefix(group.fullPrefix(), prefix)
+	group.add(KindText, func(request *Request) bool {
+		text := normalize(request.Text)
+		if !hasWordPrefix(text, prefix) {
+			return false
+		}
+		request.Args = strings.Fields(text[len(prefix):])
+
+		return true
+	}, handler)
+}
+
+// Regex routes the text messages that match the regular expression. The named groups are set
+// as the parameters of the request and all the submatches as its arguments.
+func (group *Group) Regex(re *regexp.Regexp, handler HandlerFunc) {
+	group.add(KindText, func(request *Request) bool {
+		return matchPattern(re, strings.TrimSpace(request.Text), request)
+	}, handler)
+}
+
+// ButtonReply routes the replies to the reply buttons whose ID matches the pattern. Parts of
+// the pattern in braces are parameters: "order:{id}:cancel" matches "order:1234:cancel" with
+// the parameter id set to "1234". It panics if the pattern is invalid.
+func (group *Group) ButtonReply(pattern string, handler HandlerFunc) {
+	group.addID(KindButtonReply, pattern, handler)
+}
+
+// ListReply routes the replies to the list rows whose ID matches the pattern, as ButtonReply.
+func (group *Group) ListReply(pattern string, handler HandlerFunc) {
+	group.addID(KindListReply, pattern, handler)
+}
+
+// Payload routes the replies to the quick reply buttons whose payload matches the pattern, as
+// ButtonReply.
+func (group *Group) Payload(pattern string, handler HandlerFunc) {
+	group.addID(KindPayload, pattern, handler)
+}
+
+func (group *Group) addID(kind Kind, pattern string, handler HandlerFunc) {
+	re := mustCompile(pattern, false)
+	group.add(kind, func(request *Request) bool {
+		return matchPattern(re, request.ID, request)
+	}, handler)
+}
+
+func (group *Group) add(kind Kind, match func(request *Request) bool, handler HandlerFunc) {
+	group.router.add(&route{kind: kind, match: match, group: group, handler: handler})
+}
+
+func (group *Group) fullPrefix() string {
+	if group == nil {
+		return ""
+	}
+
+	return joinPrefix(group.parent.fullPrefix(), group.prefix)
+}
+
+// wrap wraps the handler with the middlewares of the group and of its parents, the
+// middlewares of the router first.
+func (group *Group) wrap(handler HandlerFunc) HandlerFunc {
+	group.router.mu.RLock()
+	defer group.router.mu.RUnlock()
+	for g := group; g != nil; g = g.parent {
+		for i := len(g.middlewares) - 1; i >= 0; i-- {
+			handler = g.middlewares[i](handler)
+		}
+	}
+
+	return handler
+}
+
+// Recipient returns the WhatsApp ID of the sender of the request.
+func (reply *Reply) Recipient() string {
+	return reply.recipient
+}
+
+// Text sends a text message to the sender of the request.
+func (reply *Reply) Text(ctx context.Context, text string) error {
+	if _, err := reply.sender.SendTextMessage(ctx, reply.recipient, &whatsapp.TextMessage{Message: text}); err != nil {
+		return fmt.Errorf("bot: reply: %w", err)
+	}
+
+	return nil
+}
+
+// Quote sends a text message to the sender of the request, in reply to the message of the
+// request.
+func (reply *Reply) Quote(ctx context.Context, text string) error {
+	return reply.Send(ctx, whatsapp.TextMessageType, &models.Text{Body: text})
+}
+
+// Send sends the content, a message of the type, to the sender of the request in reply to
+// the message of the request.
+func (reply *Reply) Send(ctx context.Context, messageType whatsapp.MessageType, content any) error {
+	if _, err := reply.sender.Reply(ctx, reply.recipient, &whatsapp.ReplyMessage{
+		Context: reply.messageID,
+		Type:    messageType,
+		Content: content,
+	}); err != nil {
+		return fmt.Errorf("bot: reply: %w", err)
+	}
+
+	return nil
+}
+
+var paramPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// mustCompile compiles a pattern with parameters in braces to an anchored regular expression.
+// The parameters of a keyword match a word, but the last that matches the rest of the text.
+func mustCompile(pattern string, keyword bool) *regexp.Regexp {
+	var (
+		expr   strings.Builder
+		last   int
+		params = paramPattern.FindAllStringSubmatchIndex(pattern, -1)
+	)
+	if keyword {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for i, loc := range params {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		name := pattern[loc[2]:loc[3]]
+		switch {
+		case keyword && i == len(params)-1 && loc[1] == len(pattern):
+			fmt.Fprintf(&expr, "(?P<%s>.+)", name)
+		case keyword:
+			fmt.Fprintf(&expr, `(?P<%s>\S+)`, name)
+		default:
+			fmt.Fprintf(&expr, "(?P<%s>.+?)", name)
+		}
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		panic(fmt.Errorf("%w %q: %v", ErrInvalidPattern, pattern, err)) //nolint:errorlint
+	}
+
+	return re
+}
+
+// matchPattern reports whether the text matches the regular expression and sets the
+// parameters and arguments of the request.
+func matchPattern(re *regexp.Regexp, text string, request *Request) bool {
+	submatches := re.FindStringSubmatch(text)
+	if submatches == nil {
+		return false
+	}
+
+	request.Params = make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i > 0 && name != "" {
+			request.Params[name] = submatches[i]
+		}
+	}
+	request.Args = submatches[1:]
+
+	return true
+}
+
+// normalize returns the text with single spaces between the words.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func hasWordPrefix(text, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	text = normalize(text)
+	if len(text) < len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+		return false
+	}
+
+	return len(text) == len(prefix) || text[len(prefix)] == ' '
+}
+
+func joinPrefix(prefix, pattern string) string {
+	pattern = strings.Join(strings.Fields(pattern), " ")
+	if prefix == "" {
+		return pattern
+	}
+	if pattern == "" {
+		return prefix
+	}
+
+	return prefix + " " + pattern
+}
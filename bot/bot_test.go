@@ -0,0 +1,148 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+type sender struct {
+	sent []string
+}
+
+func (s *sender) SendTextMessage(_ context.Context, recipient string, message *whatsapp.TextMessage) (
+	*whatsapp.ResponseMessage, error,
+) {
+	s.sent = append(s.sent, recipient+": "+message.Message)
+
+	return &whatsapp.ResponseMessage{}, nil
+}
+
+func (s *sender) Reply(_ context.Context, recipient string, req *whatsapp.ReplyMessage) (
+	*whatsapp.ResponseMessage, error,
+) {
+	text, _ := req.Content.(*models.Text)
+	s.sent = append(s.sent, fmt.Sprintf("%s: re %s %s", recipient, req.Context, text.Body))
+
+	return &whatsapp.ResponseMessage{}, nil
+}
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+	s := &sender{}
+	router := NewRouter(s)
+	echo := func(name string) HandlerFunc {
+		return func(ctx context.Context, request *Request, reply *Reply) error {
+			return reply.Text(ctx, fmt.Sprintf("%s %v %v", name, request.Params, request.Args))
+		}
+	}
+
+	router.Keyword("help", echo("help"))
+	router.Keyword("track {order}", echo("track"))
+	router.Keyword("note {title} {body}", echo("note"))
+	router.Prefix("search", echo("search"))
+	router.Regex(regexp.MustCompile(`^(?i)pay (?P<amount>\d+)$`), echo("pay"))
+	router.ButtonReply("order:{id}:cancel", echo("cancel"))
+	router.ListReply("size_{size}", echo("size"))
+	router.Payload("STOP", echo("stop"))
+	router.Fallback(func(ctx context.Context, request *Request, reply *Reply) error {
+		return reply.Quote(ctx, "unknown "+request.Text)
+	})
+
+	var admins []string
+	admin := router.Group("admin", func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request *Request, reply *Reply) error {
+			admins = append(admins, request.Text)
+			if request.From != "admin" {
+				return reply.Text(ctx, "forbidden")
+			}
+
+			return next(ctx, request, reply)
+		}
+	})
+	admin.Keyword("ban {user}", echo("ban"))
+	admin.Fallback(echo("admin help"))
+
+	listener := webhooks.NewEventListener()
+	router.Attach(listener)
+	handler := listener.NotificationHandler()
+	notify := func(from, message string) {
+		body := `{"object":"whatsapp_business_account","entry":[{"changes":[{"field":"messages","value":{` +
+			`"messages":[{"from":"` + from + `","id":"wamid.1",` + message + `}]}}]}]}`
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("notification %s: status = %d", message, recorder.Code)
+		}
+	}
+	text := func(body string) string {
+		return `"type":"text","text":{"body":"` + body + `"}`
+	}
+
+	notify("1", text(" HELP "))
+	notify("1", text("Track AB-12"))
+	notify("1", text("note groceries milk and eggs"))
+	notify("1", text("search red   shoes"))
+	notify("1", text("pay 100"))
+	notify("1", `"type":"interactive","interactive":{"type":"button_reply",`+
+		`"button_reply":{"id":"order:12:cancel","title":"Cancel"}}`)
+	notify("1", `"type":"interactive","interactive":{"type":"list_reply","list_reply":{"id":"size_xl","title":"XL"}}`)
+	notify("1", `"type":"button","button":{"payload":"STOP","text":"Stop promotions"}`)
+	notify("1", text("helpme"))
+	notify("admin", text("admin ban 2"))
+	notify("admin", text("admin unban 2"))
+	notify("1", text("admin ban 2"))
+	notify("1", text("help")+`,"context":{"from":"255700000000","id":"wamid.0"}`)
+	notify("1", text("track CD-34")+`,"referral":{"source_url":"https://fb.me/ad","source_type":"ad"}`)
+
+	want := []string{
+		"1: help map[] []",
+		"1: track map[order:AB-12] [AB-12]",
+		"1: note map[body:milk and eggs title:groceries] [groceries milk and eggs]",
+		"1: search map[] [red shoes]",
+		"1: pay map[amount:100] [100]",
+		"1: cancel map[id:12] [12]",
+		"1: size map[size:xl] [xl]",
+		"1: stop map[] []",
+		"1: re wamid.1 unknown helpme",
+		"admin: ban map[user:2] [2]",
+		"admin: admin help map[] []",
+		"1: forbidden",
+		"1: help map[] []",
+		"1: track map[order:CD-34] [CD-34]",
+	}
+	if strings.Join(s.sent, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent:\n%s\nwant:\n%s", strings.Join(s.sent, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(admins) != 3 {
+		t.Errorf("admin middleware called %d times, want 3", len(admins))
+	}
+}
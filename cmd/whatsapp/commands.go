@@ -0,0 +1,495 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/qrcodes"
+)
+
+var ErrInvalidFlag = errors.New("invalid flag value")
+
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+
+	return nil
+}
+
+// readJSON decodes the json file at path into v, "-" reads from stdin.
+func readJSON(path string, v any) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func mediaType(value string) (whatsapp.MediaType, error) {
+	switch t := whatsapp.MediaType(value); t {
+	case whatsapp.MediaTypeAudio, whatsapp.MediaTypeDocument, whatsapp.MediaTypeImage,
+		whatsapp.MediaTypeSticker, whatsapp.MediaTypeVideo:
+		return t, nil
+	default:
+		return "", fmt.Errorf("%w: unknown media type %q", ErrInvalidFlag, value)
+	}
+}
+
+// upload uploads the file at path and returns the media id.
+func (a *app) upload(ctx context.Context, typ whatsapp.MediaType, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	resp, err := a.client.UploadMedia(ctx, typ, filepath.Base(path), file)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return resp.ID, nil
+}
+
+//////////////////////////////////////////////
+// SEND
+
+func sendText(ctx context.Context, a *app, args []string) error {
+	var (
+		to, text   string
+		previewURL bool
+	)
+	fs := a.newFlagSet("send text")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.StringVar(&text, "text", "", "message body")
+	fs.BoolVar(&previewURL, "preview-url", false, "render a preview of the first url in the body")
+	if err := parse(fs, args, "to", "text"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.SendTextMessage(ctx, to, &whatsapp.TextMessage{Message: text, PreviewURL: previewURL})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func sendMedia(ctx context.Context, a *app, args []string) error {
+	var to, typ, file string
+	message := &whatsapp.MediaMessage{}
+	fs := a.newFlagSet("send media")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.StringVar(&typ, "type", "", "media type: image, audio, video, document or sticker")
+	fs.StringVar(&message.MediaID, "id", "", "id of an uploaded media")
+	fs.StringVar(&message.MediaLink, "link", "", "public url of the media")
+	fs.StringVar(&file, "file", "", "local file to upload and send")
+	fs.StringVar(&message.Caption, "caption", "", "caption of an image, video or document")
+	fs.StringVar(&message.Filename, "filename", "", "filename shown for a document")
+	if err := parse(fs, args, "to", "type"); err != nil {
+		return err
+	}
+
+	var err error
+	if message.Type, err = mediaType(typ); err != nil {
+		return err
+	}
+
+	set := 0
+	for _, v := range []string{message.MediaID, message.MediaLink, file} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%w: exactly one of -id, -link and -file is required", ErrUsage)
+	}
+
+	if file != "" {
+		if message.MediaID, err = a.upload(ctx, message.Type, file); err != nil {
+			return err
+		}
+		if message.Type == whatsapp.MediaTypeDocument && message.Filename == "" {
+			message.Filename = filepath.Base(file)
+		}
+	}
+
+	resp, err := a.client.SendMedia(ctx, to, message, nil)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func sendTemplate(ctx context.Context, a *app, args []string) error {
+	var (
+		to, components string
+		params         stringsFlag
+	)
+	template := &whatsapp.Template{}
+	fs := a.newFlagSet("send template")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.StringVar(&template.Name, "name", "", "template name")
+	fs.StringVar(&template.LanguageCode, "language", "en_US", "template language code")
+	fs.StringVar(&template.LanguagePolicy, "policy", "deterministic", "language policy")
+	fs.StringVar(&components, "components", "", "json file with the template components, - for stdin")
+	fs.Var(&params, "param", "body text parameter, repeat for each variable in order")
+	if err := parse(fs, args, "to", "name"); err != nil {
+		return err
+	}
+
+	if components != "" && len(params) > 0 {
+		return fmt.Errorf("%w: -components and -param are mutually exclusive", ErrUsage)
+	}
+
+	if components != "" {
+		if err := readJSON(components, &template.Components); err != nil {
+			return err
+		}
+	}
+
+	if len(params) > 0 {
+		body := &models.TemplateComponent{Type: "body"}
+		for _, p := range params {
+			body.Parameters = append(body.Parameters, &models.TemplateParameter{Type: "text", Text: p})
+		}
+		template.Components = []*models.TemplateComponent{body}
+	}
+
+	resp, err := a.client.SendTemplate(ctx, to, template)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func sendLocation(ctx context.Context, a *app, args []string) error {
+	var to string
+	location := &models.Location{}
+	fs := a.newFlagSet("send location")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.Float64Var(&location.Latitude, "lat", 0, "latitude")
+	fs.Float64Var(&location.Longitude, "long", 0, "longitude")
+	fs.StringVar(&location.Name, "name", "", "name of the location")
+	fs.StringVar(&location.Address, "address", "", "address of the location")
+	if err := parse(fs, args, "to"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.SendLocationMessage(ctx, to, location)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func sendContacts(ctx context.Context, a *app, args []string) error {
+	var to, file string
+	fs := a.newFlagSet("send contacts")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.StringVar(&file, "file", "", "json file with the array of contacts, - for stdin")
+	if err := parse(fs, args, "to", "file"); err != nil {
+		return err
+	}
+
+	var contacts models.Contacts
+	if err := readJSON(file, &contacts); err != nil {
+		return err
+	}
+
+	resp, err := a.client.SendContacts(ctx, to, &contacts)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func sendReaction(ctx context.Context, a *app, args []string) error {
+	var to string
+	reaction := &whatsapp.ReactMessage{}
+	fs := a.newFlagSet("send reaction")
+	fs.StringVar(&to, "to", "", "recipient phone number")
+	fs.StringVar(&reaction.MessageID, "message-id", "", "id of the message to react to")
+	fs.StringVar(&reaction.Emoji, "emoji", "", "emoji, empty removes the reaction")
+	if err := parse(fs, args, "to", "message-id"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.React(ctx, to, reaction)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+//////////////////////////////////////////////
+// MEDIA
+
+func uploadMedia(ctx context.Context, a *app, args []string) error {
+	var typ, file string
+	fs := a.newFlagSet("media upload")
+	fs.StringVar(&typ, "type", "", "media type: image, audio, video, document or sticker")
+	fs.StringVar(&file, "file", "", "file to upload")
+	if err := parse(fs, args, "type", "file"); err != nil {
+		return err
+	}
+
+	t, err := mediaType(typ)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.upload(ctx, t, file)
+	if err != nil {
+		return err
+	}
+
+	return a.print(&whatsapp.UploadMediaResponse{ID: id})
+}
+
+func getMedia(ctx context.Context, a *app, args []string) error {
+	var id string
+	fs := a.newFlagSet("media get")
+	fs.StringVar(&id, "id", "", "media id")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+
+	media, err := a.client.GetMedia(ctx, id)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(media)
+}
+
+func downloadMedia(ctx context.Context, a *app, args []string) error {
+	var id, output string
+	fs := a.newFlagSet("media download")
+	fs.StringVar(&id, "id", "", "media id")
+	fs.StringVar(&output, "o", "", "output file, stdout if empty")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err := a.client.DownloadMediaTo(ctx, id, a.stdout)
+
+		return err //nolint:wrapcheck
+	}
+
+	media, err := a.client.DownloadMediaToFile(ctx, id, output)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(media)
+}
+
+func deleteMedia(ctx context.Context, a *app, args []string) error {
+	var id string
+	fs := a.newFlagSet("media delete")
+	fs.StringVar(&id, "id", "", "media id")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.DeleteMedia(ctx, id)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+//////////////////////////////////////////////
+// QR CODES
+
+func qrFlags(fs *flag.FlagSet, req *qrcodes.CreateRequest) {
+	fs.StringVar(&req.PrefilledMessage, "message", "", "prefilled message")
+	fs.Func("format", "image format: PNG or SVG (default PNG)", func(value string) error {
+		switch f := qrcodes.ImageFormat(strings.ToUpper(value)); f {
+		case qrcodes.ImageFormatPNG, qrcodes.ImageFormatSVG:
+			req.ImageFormat = f
+
+			return nil
+		default:
+			return fmt.Errorf("%w: unknown image format %q", ErrInvalidFlag, value)
+		}
+	})
+}
+
+func createQrCode(ctx context.Context, a *app, args []string) error {
+	req := &qrcodes.CreateRequest{ImageFormat: qrcodes.ImageFormatPNG}
+	fs := a.newFlagSet("qr create")
+	qrFlags(fs, req)
+	if err := parse(fs, args, "message"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.CreateQrCode(ctx, req)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func listQrCodes(ctx context.Context, a *app, args []string) error {
+	if err := parse(a.newFlagSet("qr list"), args); err != nil {
+		return err
+	}
+
+	resp, err := a.client.ListQrCodes(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func getQrCode(ctx context.Context, a *app, args []string) error {
+	var id string
+	fs := a.newFlagSet("qr get")
+	fs.StringVar(&id, "id", "", "qr code id")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.GetQrCode(ctx, id)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func updateQrCode(ctx context.Context, a *app, args []string) error {
+	var id string
+	req := &qrcodes.CreateRequest{ImageFormat: qrcodes.ImageFormatPNG}
+	fs := a.newFlagSet("qr update")
+	fs.StringVar(&id, "id", "", "qr code id")
+	qrFlags(fs, req)
+	if err := parse(fs, args, "id", "message"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.UpdateQrCode(ctx, id, req)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func deleteQrCode(ctx context.Context, a *app, args []string) error {
+	var id string
+	fs := a.newFlagSet("qr delete")
+	fs.StringVar(&id, "id", "", "qr code id")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+
+	resp, err := a.client.DeleteQrCode(ctx, id)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+//////////////////////////////////////////////
+// PHONE NUMBERS
+
+func listPhoneNumbers(ctx context.Context, a *app, args []string) error {
+	if err := parse(a.newFlagSet("phone-numbers list"), args); err != nil {
+		return err
+	}
+
+	resp, err := a.client.ListPhoneNumbers(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(resp)
+}
+
+func requestCode(ctx context.Context, a *app, args []string) error {
+	var method, language string
+	fs := a.newFlagSet("code request")
+	fs.StringVar(&method, "method", "SMS", "delivery method: SMS or VOICE")
+	fs.StringVar(&language, "language", "en", "language of the message")
+	if err := parse(fs, args, "method", "language"); err != nil {
+		return err
+	}
+
+	if err := a.client.RequestVerificationCode(ctx, strings.ToUpper(method), language); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(map[string]bool{"success": true})
+}
+
+func verifyCode(ctx context.Context, a *app, args []string) error {
+	var code string
+	fs := a.newFlagSet("code verify")
+	fs.StringVar(&code, "code", "", "the code received")
+	if err := parse(fs, args, "code"); err != nil {
+		return err
+	}
+
+	if err := a.client.VerifyCode(ctx, code); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return a.print(map[string]bool{"success": true})
+}
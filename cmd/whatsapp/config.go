@@ -0,0 +1,189 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/piusalfred/whatsapp"
+)
+
+// Environment variables read by the CLI. They override the values of the profile and are
+// overridden by the flags.
+const (
+	EnvConfig            = "WHATSAPP_CONFIG"
+	EnvProfile           = "WHATSAPP_PROFILE"
+	EnvBaseURL           = "WHATSAPP_BASE_URL"
+	EnvAPIVersion        = "WHATSAPP_API_VERSION"
+	EnvAccessToken       = "WHATSAPP_ACCESS_TOKEN"
+	EnvPhoneNumberID     = "WHATSAPP_PHONE_NUMBER_ID"
+	EnvBusinessAccountID = "WHATSAPP_BUSINESS_ACCOUNT_ID"
+	EnvAppSecret         = "WHATSAPP_APP_SECRET"
+	EnvVerifyToken       = "WHATSAPP_VERIFY_TOKEN"
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+type (
+	// Profile is a named set of settings, for example the test and the production numbers.
+	Profile struct {
+		BaseURL           string `json:"base_url,omitempty"`
+		APIVersion        string `json:"api_version,omitempty"`
+		AccessToken       string `json:"access_token,omitempty"`
+		PhoneNumberID     string `json:"phone_number_id,omitempty"`
+		BusinessAccountID string `json:"business_account_id,omitempty"`
+		AppSecret         string `json:"app_secret,omitempty"`
+		VerifyToken       string `json:"verify_token,omitempty"`
+	}
+
+	// ConfigFile is the content of the config file.
+	//
+	//	{
+	//	  "default_profile": "test",
+	//	  "profiles": {
+	//	    "test": {"access_token": "...", "phone_number_id": "...", "business_account_id": "..."},
+	//	    "production": {"access_token": "...", "phone_number_id": "...", "business_account_id": "..."}
+	//	  }
+	//	}
+	ConfigFile struct {
+		DefaultProfile string              `json:"default_profile,omitempty"`
+		Profiles       map[string]*Profile `json:"profiles,omitempty"`
+	}
+
+	// globalFlags are the flags accepted before the command.
+	globalFlags struct {
+		config  string
+		profile string
+		values  Profile
+	}
+)
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.config, "config", "", "path of the config file (env "+EnvConfig+")")
+	fs.StringVar(&g.profile, "profile", "", "name of the profile in the config file (env "+EnvProfile+")")
+	fs.StringVar(&g.values.BaseURL, "base-url", "", "graph api base url (env "+EnvBaseURL+")")
+	fs.StringVar(&g.values.APIVersion, "api-version", "", "graph api version (env "+EnvAPIVersion+")")
+	fs.StringVar(&g.values.AccessToken, "token", "", "access token (env "+EnvAccessToken+")")
+	fs.StringVar(&g.values.PhoneNumberID, "phone-id", "", "phone number id (env "+EnvPhoneNumberID+")")
+	fs.StringVar(&g.values.BusinessAccountID, "waba-id", "",
+		"whatsapp business account id (env "+EnvBusinessAccountID+")")
+	fs.StringVar(&g.values.AppSecret, "app-secret", "", "app secret used to verify webhooks (env "+EnvAppSecret+")")
+	fs.StringVar(&g.values.VerifyToken, "verify-token", "",
+		"webhook subscription verify token (env "+EnvVerifyToken+")")
+}
+
+// loadProfile resolves the settings. The flags take precedence over the environment variables
+// which take precedence over the profile of the config file.
+func loadProfile(g *globalFlags, getenv func(string) string) (*Profile, error) {
+	path, explicit := g.config, true
+	if path == "" {
+		path = getenv(EnvConfig)
+	}
+	if path == "" {
+		explicit = false
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "whatsapp", "config.json")
+		}
+	}
+
+	var file ConfigFile
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("config file %s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+	}
+
+	name := first(g.profile, getenv(EnvProfile), file.DefaultProfile)
+	profile := &Profile{}
+	if name != "" {
+		p, ok := file.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+		}
+		*profile = *p
+	}
+
+	profile.BaseURL = first(g.values.BaseURL, getenv(EnvBaseURL), profile.BaseURL, whatsapp.BaseURL)
+	profile.APIVersion = first(g.values.APIVersion, getenv(EnvAPIVersion), profile.APIVersion,
+		whatsapp.LowestSupportedVersion)
+	profile.AccessToken = first(g.values.AccessToken, getenv(EnvAccessToken), profile.AccessToken)
+	profile.PhoneNumberID = first(g.values.PhoneNumberID, getenv(EnvPhoneNumberID), profile.PhoneNumberID)
+	profile.BusinessAccountID = first(g.values.BusinessAccountID, getenv(EnvBusinessAccountID),
+		profile.BusinessAccountID)
+	profile.AppSecret = first(g.values.AppSecret, getenv(EnvAppSecret), profile.AppSecret)
+	profile.VerifyToken = first(g.values.VerifyToken, getenv(EnvVerifyToken), profile.VerifyToken)
+
+	return profile, nil
+}
+
+// client returns a whatsapp.Client configured with the profile.
+func (p *Profile) client() *whatsapp.Client {
+	return whatsapp.NewClient(
+		whatsapp.WithBaseURL(p.BaseURL),
+		whatsapp.WithVersion(p.APIVersion),
+		whatsapp.WithAccessToken(p.AccessToken),
+		whatsapp.WithPhoneNumberID(p.PhoneNumberID),
+		whatsapp.WithBusinessAccountID(p.BusinessAccountID),
+	)
+}
+
+// masked returns a copy of the profile with the secrets hidden, for printing.
+func (p *Profile) masked() *Profile {
+	m := *p
+	m.AccessToken = mask(m.AccessToken)
+	m.AppSecret = mask(m.AppSecret)
+	m.VerifyToken = mask(m.VerifyToken)
+
+	return &m
+}
+
+func mask(secret string) string {
+	if len(secret) <= 8 {
+		if secret == "" {
+			return ""
+		}
+
+		return "********"
+	}
+
+	return secret[:4] + "..." + secret[len(secret)-4:]
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+var (
+	ErrInvalidVerifyToken = errors.New("invalid verify token")
+	ErrNoVerifyToken      = errors.New("no verify token configured, subscription verification refused")
+)
+
+// listen runs a webhook listener that prints every notification it receives. The subscription
+// verification requests are answered with the configured verify token, and refused when there
+// is none, and when the app secret is set the notifications with an invalid signature are
+// rejected.
+func listen(ctx context.Context, a *app, args []string) error {
+	var addr, path string
+	fs := a.newFlagSet("listen")
+	fs.StringVar(&addr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&path, "path", "/webhooks", "path of the webhook endpoint")
+	if err := parse(fs, args, "addr", "path"); err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           a.webhookHandler(path),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(a.stderr, "listening on %s%s\n", addr, path)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err //nolint:wrapcheck
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return server.Shutdown(shutdownCtx) //nolint:contextcheck,wrapcheck
+	}
+}
+
+func (a *app) webhookHandler(path string) http.Handler {
+	listener := webhooks.NewEventListener(
+		webhooks.WithSubscriptionVerifier(func(_ context.Context, request *webhooks.VerificationRequest) error {
+			if a.profile.VerifyToken == "" {
+				return ErrNoVerifyToken
+			}
+
+			if request.Mode != "subscribe" || request.Token != a.profile.VerifyToken {
+				return ErrInvalidVerifyToken
+			}
+
+			return nil
+		}),
+		webhooks.WithGenericNotificationHandler(
+			func(_ context.Context, _ http.ResponseWriter, notification *webhooks.Notification) error {
+				return a.print(notification)
+			}),
+		webhooks.WithNotificationErrorHandler(
+			func(_ context.Context, _ *http.Request, err error) *webhooks.Response {
+				fmt.Fprintln(a.stderr, "webhook:", err)
+				if errors.Is(err, webhooks.ErrInvalidSignature) {
+					return &webhooks.Response{StatusCode: http.StatusUnauthorized}
+				}
+
+				return &webhooks.Response{StatusCode: http.StatusBadRequest}
+			}),
+		webhooks.WithHandlerOptions(&webhooks.HandlerOptions{
+			ValidateSignature: a.profile.AppSecret != "",
+			Secret:            a.profile.AppSecret,
+		}),
+	)
+
+	verify, notify := listener.SubscriptionVerificationHandler(), listener.GenericHandler()
+	mux := http.NewServeMux()
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			verify.ServeHTTP(w, r)
+		case http.MethodPost:
+			notify.ServeHTTP(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	return mux
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Command whatsapp is a command-line client of the WhatsApp Cloud API built on whatsapp.Client.
+//
+//	whatsapp [global flags] <command> [subcommand] [flags]
+//
+// Run whatsapp -h for the list of commands and global flags. The settings are read from the
+// flags, the WHATSAPP_* environment variables and a profile of the config file, in that order.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/piusalfred/whatsapp"
+)
+
+var ErrUsage = errors.New("usage error")
+
+type (
+	// app is the state shared by the commands.
+	app struct {
+		profile *Profile
+		client  *whatsapp.Client
+		stdout  io.Writer
+		stderr  io.Writer
+	}
+
+	// command is a command or a group of subcommands.
+	command struct {
+		name        string
+		summary     string
+		run         func(ctx context.Context, a *app, args []string) error
+		subcommands []*command
+	}
+)
+
+func commands() []*command {
+	return []*command{
+		{name: "send", summary: "send messages", subcommands: []*command{
+			{name: "text", summary: "send a text message", run: sendText},
+			{name: "media", summary: "send an image, audio, video, document or sticker", run: sendMedia},
+			{name: "template", summary: "send a template message", run: sendTemplate},
+			{name: "location", summary: "send a location", run: sendLocation},
+			{name: "contacts", summary: "send contacts read from a json file", run: sendContacts},
+			{name: "reaction", summary: "react to a message", run: sendReaction},
+		}},
+		{name: "media", summary: "manage media", subcommands: []*command{
+			{name: "upload", summary: "upload a file", run: uploadMedia},
+			{name: "get", summary: "show the url and details of a media", run: getMedia},
+			{name: "download", summary: "download and verify a media to a file or stdout", run: downloadMedia},
+			{name: "delete", summary: "delete a media", run: deleteMedia},
+		}},
+		{name: "qr", summary: "manage qr codes", subcommands: []*command{
+			{name: "create", summary: "create a qr code", run: createQrCode},
+			{name: "list", summary: "list the qr codes", run: listQrCodes},
+			{name: "get", summary: "show a qr code", run: getQrCode},
+			{name: "update", summary: "change the prefilled message of a qr code", run: updateQrCode},
+			{name: "delete", summary: "delete a qr code", run: deleteQrCode},
+		}},
+		{name: "phone-numbers", summary: "manage phone numbers", subcommands: []*command{
+			{name: "list", summary: "list the phone numbers of the business account", run: listPhoneNumbers},
+		}},
+		{name: "code", summary: "verify the phone number", subcommands: []*command{
+			{name: "request", summary: "request a verification code", run: requestCode},
+			{name: "verify", summary: "verify the phone number with the code received", run: verifyCode},
+		}},
+		{name: "listen", summary: "run a local webhook listener that prints the notifications", run: listen},
+		{name: "config", summary: "show the resolved settings", subcommands: []*command{
+			{name: "show", summary: "print the settings, secrets are masked", run: showConfig},
+		}},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	stop()
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "whatsapp:", err)
+		if errors.Is(err, ErrUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and runs the command named by the remaining arguments.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) error {
+	var g globalFlags
+	fs := flag.NewFlagSet("whatsapp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	g.register(fs)
+	cmds := commands()
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: whatsapp [global flags] <command> [subcommand] [flags]")
+		printCommands(stderr, "", cmds)
+		fmt.Fprintln(stderr, "\nglobal flags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	cmd, rest, name, err := lookup(cmds, fs.Args())
+	if err != nil {
+		fs.Usage()
+
+		return err
+	}
+
+	profile, err := loadProfile(&g, getenv)
+	if err != nil {
+		return err
+	}
+
+	a := &app{profile: profile, client: profile.client(), stdout: stdout, stderr: stderr}
+	if err := cmd.run(ctx, a, rest); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// lookup finds the command named by the first arguments and returns it with the rest of
+// the arguments and its full name.
+func lookup(cmds []*command, args []string) (*command, []string, string, error) {
+	var names []string
+	for {
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			if len(names) == 0 {
+				return nil, nil, "", fmt.Errorf("%w: missing command", ErrUsage)
+			}
+
+			return nil, nil, "", fmt.Errorf("%w: missing subcommand of %s", ErrUsage, strings.Join(names, " "))
+		}
+
+		var found *command
+		for _, cmd := range cmds {
+			if cmd.name == args[0] {
+				found = cmd
+			}
+		}
+
+		if found == nil {
+			return nil, nil, "", fmt.Errorf("%w: unknown command %q", ErrUsage, strings.Join(append(names, args[0]), " "))
+		}
+
+		names, args = append(names, found.name), args[1:]
+		if found.run != nil {
+			return found, args, strings.Join(names, " "), nil
+		}
+		cmds = found.subcommands
+	}
+}
+
+func printCommands(w io.Writer, prefix string, cmds []*command) {
+	sorted := append([]*command(nil), cmds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	if prefix == "" {
+		fmt.Fprintln(w, "\ncommands:")
+	}
+
+	for _, cmd := range sorted {
+		if cmd.run != nil {
+			fmt.Fprintf(w, "  %-24s %s\n", strings.TrimSpace(prefix+" "+cmd.name), cmd.summary)
+
+			continue
+		}
+		printCommands(w, strings.TrimSpace(prefix+" "+cmd.name), cmd.subcommands)
+	}
+}
+
+// newFlagSet returns the flag set of a command.
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+
+	return fs
+}
+
+// parse parses the flags and checks that the required flags are set.
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %v", ErrUsage, fs.Args())
+	}
+
+	for _, name := range required {
+		if f := fs.Lookup(name); f != nil && f.Value.String() == "" {
+			return fmt.Errorf("%w: flag -%s is required", ErrUsage, name)
+		}
+	}
+
+	return nil
+}
+
+// print writes v as indented JSON.
+func (a *app) print(v any) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	return encoder.Encode(v) //nolint:wrapcheck
+}
+
+func showConfig(_ context.Context, a *app, args []string) error {
+	if err := parse(a.newFlagSet("config show"), args); err != nil {
+		return err
+	}
+
+	return a.print(a.profile.masked())
+}
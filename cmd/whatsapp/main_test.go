@@ -0,0 +1,244 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/webhooks"
+	"github.com/piusalfred/whatsapp/whatsapptest"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"default_profile": "test",
+		"profiles": {
+			"test": {"access_token": "test-token", "phone_number_id": "111", "business_account_id": "222"},
+			"production": {"access_token": "prod-token", "phone_number_id": "333", "api_version": "v17.0"}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   globalFlags
+		env     map[string]string
+		want    Profile
+		wantErr error
+	}{
+		{
+			name:  "default profile",
+			flags: globalFlags{config: path},
+			want: Profile{
+				BaseURL: whatsapp.BaseURL, APIVersion: whatsapp.LowestSupportedVersion,
+				AccessToken: "test-token", PhoneNumberID: "111", BusinessAccountID: "222",
+			},
+		},
+		{
+			name:  "profile from env, token from flag",
+			flags: globalFlags{config: path, values: Profile{AccessToken: "flag-token"}},
+			env:   map[string]string{EnvProfile: "production", EnvAccessToken: "env-token", EnvPhoneNumberID: "444"},
+			want: Profile{
+				BaseURL: whatsapp.BaseURL, APIVersion: "v17.0",
+				AccessToken: "flag-token", PhoneNumberID: "444",
+			},
+		},
+		{
+			name:    "unknown profile",
+			flags:   globalFlags{config: path, profile: "staging"},
+			wantErr: ErrUnknownProfile,
+		},
+		{
+			name:    "missing config file",
+			flags:   globalFlags{config: filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: os.ErrNotExist,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := loadProfile(&tt.flags, env(tt.env))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loadProfile() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && *got != tt.want {
+				t.Errorf("loadProfile() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server := whatsapptest.NewServer()
+	t.Cleanup(server.Close)
+
+	file := filepath.Join(t.TempDir(), "invoice.pdf")
+	if err := os.WriteFile(file, []byte("%PDF-1.4 invoice"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := env(map[string]string{
+		EnvBaseURL:           server.URL,
+		EnvAccessToken:       whatsapptest.DefaultAccessToken,
+		EnvPhoneNumberID:     whatsapptest.DefaultPhoneNumberID,
+		EnvBusinessAccountID: whatsapptest.DefaultBusinessAccountID,
+	})
+	empty := filepath.Join(t.TempDir(), "empty.json")
+	if err := os.WriteFile(empty, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "send text",
+			args: []string{"send", "text", "-to", "255712345678", "-text", "hello"},
+			want: `"wa_id": "255712345678"`,
+		},
+		{
+			name: "send document from file",
+			args: []string{"send", "media", "-to", "255712345678", "-type", "document", "-file", file},
+			want: `"messages"`,
+		},
+		{
+			name: "list phone numbers",
+			args: []string{"phone-numbers", "list"},
+			want: whatsapptest.DefaultPhoneNumberID,
+		},
+		{
+			name: "config show masks the token",
+			args: []string{"config", "show"},
+			want: `"access_token": "what...oken"`,
+		},
+		{
+			name:    "missing required flag",
+			args:    []string{"send", "text", "-to", "255712345678"},
+			wantErr: ErrUsage,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"send", "fax"},
+			wantErr: ErrUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-config", empty}, tt.args...)
+			err := run(context.Background(), args, vars, &stdout, &stderr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("run() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(stdout.String(), tt.want) {
+				t.Errorf("run() output = %s, want it to contain %s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	t.Parallel()
+	var stdout bytes.Buffer
+	a := &app{
+		profile: &Profile{AppSecret: "app-secret", VerifyToken: "verify-me"},
+		stdout:  &stdout,
+		stderr:  &bytes.Buffer{},
+	}
+	handler := a.webhookHandler("/webhooks")
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+			"/webhooks?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token="+token, nil))
+
+		return recorder
+	}
+
+	if rec := verify("verify-me"); rec.Code != http.StatusOK || rec.Body.String() != "1158201444" {
+		t.Errorf("verify = %d %q, want 200 with the challenge", rec.Code, rec.Body.String())
+	}
+
+	if rec := verify("wrong"); rec.Code != http.StatusBadRequest {
+		t.Errorf("verify with a wrong token = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	unset := (&app{profile: &Profile{}, stdout: &bytes.Buffer{}, stderr: &bytes.Buffer{}}).webhookHandler("/webhooks")
+	recorder := httptest.NewRecorder()
+	unset.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/webhooks?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token=", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("verify without a configured token = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	body := []byte(`{"object":"whatsapp_business_account","entry":[{"id":"102290129340398"}]}`)
+	notify := func(signature string) int {
+		request := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+		request.Header.Set(webhooks.SignatureHeaderKey, signature)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	if code := notify("sha256=" + strings.Repeat("0", 64)); code != http.StatusUnauthorized {
+		t.Errorf("notify with a bad signature = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("notification with a bad signature was printed: %s", stdout.String())
+	}
+
+	if code := notify("sha256=" + whatsapptest.Sign(body, "app-secret")); code != http.StatusOK {
+		t.Errorf("notify = %d, want %d", code, http.StatusOK)
+	}
+
+	if !strings.Contains(stdout.String(), `"object": "whatsapp_business_account"`) {
+		t.Errorf("printed notification = %s", stdout.String())
+	}
+}
@@ -0,0 +1,439 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package conversation tracks the conversations and the customer service windows from the
+// notifications received by a webhooks.EventListener.
+//
+// The conversations, with their pricing category, are opened by the status notifications of
+// the messages sent, and the customer service window by the messages received:
+//
+//	tracker := conversation.NewTracker(conversation.NewMemoryStore())
+//	tracker.Attach(listener)
+//
+//	template, err := tracker.RequiresTemplate(ctx, "255712345678")
+//	client := whatsapp.NewClient(whatsapp.WithWindowGuard(tracker.WindowGuard()))
+//
+//	summaries, err := tracker.Summarize(ctx, from, to)
+//	err = conversation.WriteCSV(os.Stdout, summaries)
+package conversation
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// CustomerServiceWindow is whatsapp.CustomerServiceWindow.
+const CustomerServiceWindow = whatsapp.CustomerServiceWindow
+
+// Pricing categories of the conversations. The first three are from the previous pricing
+// model and are still sent for some accounts.
+const (
+	CategoryBusinessInitiated  = "business_initiated"
+	CategoryUserInitiated      = "user_initiated"
+	CategoryReferralConversion = "referral_conversion"
+	CategoryAuthentication     = "authentication"
+	CategoryMarketing          = "marketing"
+	CategoryUtility            = "utility"
+	CategoryService            = "service"
+)
+
+const summaryDateLayout = "2006-01-02"
+
+var ErrNotFound = errors.New("conversation: not found")
+
+type (
+	// Conversation is a conversation opened with a recipient, with the number of the messages
+	// that were sent in it.
+	Conversation struct {
+		ID            string    `json:"id"`
+		Recipient     string    `json:"recipient"`
+		PhoneNumberID string    `json:"phone_number_id,omitempty"`
+		Origin        string    `json:"origin,omitempty"`
+		Category      string    `json:"category,omitempty"`
+		PricingModel  string    `json:"pricing_model,omitempty"`
+		Billable      bool      `json:"billable"`
+		OpenedAt      time.Time `json:"opened_at"`
+		ExpiresAt     time.Time `json:"expires_at,omitempty"`
+		Messages      int       `json:"messages"`
+	}
+
+	// Filter selects conversations. The zero values match all the conversations, Since and
+	// Until bound Conversation.OpenedAt and OpenAt selects the conversations open at the time.
+	Filter struct {
+		Recipient string
+		Category  string
+		Since     time.Time
+		Until     time.Time
+		OpenAt    time.Time
+	}
+
+	// Summary is the number of conversations opened, and of the messages sent in them, in a
+	// day for a category.
+	Summary struct {
+		Date          string `json:"date"`
+		Category      string `json:"category"`
+		PricingModel  string `json:"pricing_model,omitempty"`
+		Conversations int    `json:"conversations"`
+		Billable      int    `json:"billable"`
+		Messages      int    `json:"messages"`
+	}
+
+	// Store stores the conversations and, as a whatsapp.InboundStore, the time of the last
+	// message received from each customer. Conversation returns ErrNotFound for an unknown
+	// conversation. Implementations must be safe for concurrent use.
+	Store interface {
+		whatsapp.InboundStore
+		Conversation(ctx context.Context, id string) (*Conversation, error)
+		PutConversation(ctx context.Context, conversation *Conversation) error
+		Conversations(ctx context.Context, filter *Filter) ([]*Conversation, error)
+	}
+
+	// Tracker tracks the conversations, and the customer service windows with a
+	// whatsapp.WindowGuard over its store.
+	Tracker struct {
+		store    Store
+		window   *whatsapp.WindowGuard
+		options  []whatsapp.WindowGuardOption
+		mu       sync.Mutex
+		location *time.Location
+		now      func() time.Time
+	}
+
+	TrackerOption func(tracker *Tracker)
+
+	// MemoryStore is a Store that keeps the conversations in memory, and the times of the last
+	// messages received in a whatsapp.MemoryInboundStore.
+	MemoryStore struct {
+		*whatsapp.MemoryInboundStore
+		mu            sync.RWMutex
+		conversations map[string]*Conversation
+	}
+)
+
+// WithLocation sets the location of the days of the summaries, UTC by default.
+func WithLocation(location *time.Location) TrackerOption {
+	return func(tracker *Tracker) {
+		tracker.location = location
+	}
+}
+
+// WithWindowGuardOptions sets the options of the WindowGuard of the tracker, for example the
+// fallback template of the free-form messages sent when the window is closed.
+func WithWindowGuardOptions(options ...whatsapp.WindowGuardOption) TrackerOption {
+	return func(tracker *Tracker) {
+		tracker.options = append(tracker.options, options...)
+	}
+}
+
+// NewTracker returns a Tracker that keeps the conversations in the store.
+func NewTracker(store Store, options ...TrackerOption) *Tracker {
+	tracker := &Tracker{
+		store:    store,
+		location: time.UTC,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(tracker)
+	}
+	tracker.window = whatsapp.NewWindowGuard(store, tracker.options...)
+
+	return tracker
+}
+
+// WindowGuard returns the guard recording the customer service windows of the tracker, to
+// guard the free-form messages sent by a client with whatsapp.WithWindowGuard. It must not be
+// attached to the listener the tracker is attached to.
+func (tracker *Tracker) WindowGuard() *whatsapp.WindowGuard {
+	return tracker.window
+}
+
+// Attach subscribes the tracker to the status notifications and to the messages received by
+// the listener.
+func (tracker *Tracker) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	unsubscribeStatus := listener.OnMessageStatusChange(tracker.StatusChanged)
+	unsubscribeMessage := listener.OnMessageReceived(tracker.MessageReceived)
+
+	return func() {
+		unsubscribeStatus()
+		unsubscribeMessage()
+	}
+}
+
+// MessageReceived opens the customer service window with the sender of the message, it is a
+// webhooks.OnMessageReceivedHook.
+func (tracker *Tracker) MessageReceived(ctx context.Context, nctx *webhooks.NotificationContext,
+	message *webhooks.Message,
+) error {
+	if err := tracker.window.MessageReceived(ctx, nctx, message); err != nil {
+		return fmt.Errorf("conversation: %w", err)
+	}
+
+	return nil
+}
+
+// StatusChanged records the conversation of the status, it is a
+// webhooks.OnMessageStatusChangeHook. The messages are counted with their sent status, as the
+// statuses of a message share its conversation.
+func (tracker *Tracker) StatusChanged(ctx context.Context, nctx *webhooks.NotificationContext,
+	status *webhooks.Status,
+) error {
+	if status.Conversation == nil || status.Conversation.ID == "" {
+		return nil
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	conversation, err := tracker.store.Conversation(ctx, status.Conversation.ID)
+	if errors.Is(err, ErrNotFound) {
+		conversation, err = &Conversation{
+			ID:        status.Conversation.ID,
+			Recipient: status.RecipientID,
+			OpenedAt:  time.Unix(int64(status.Timestamp), 0),
+		}, nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("conversation: %w", err)
+	}
+
+	if nctx != nil && nctx.Metadata != nil {
+		conversation.PhoneNumberID = nctx.Metadata.PhoneNumberID
+	}
+
+	if origin := status.Conversation.Origin; origin != nil && origin.Type != "" {
+		conversation.Origin = origin.Type
+	}
+
+	if status.Conversation.Expiry > 0 {
+		conversation.ExpiresAt = time.Unix(int64(status.Conversation.Expiry), 0)
+	}
+
+	if pricing := status.Pricing; pricing != nil {
+		conversation.Category = pricing.Category
+		conversation.PricingModel = pricing.PricingModel
+		conversation.Billable = pricing.Billable
+	}
+
+	if opened := time.Unix(int64(status.Timestamp), 0); status.Timestamp > 0 && opened.Before(conversation.OpenedAt) {
+		conversation.OpenedAt = opened
+	}
+
+	if status.StatusValue == "sent" {
+		conversation.Messages++
+	}
+
+	if err := tracker.store.PutConversation(ctx, conversation); err != nil {
+		return fmt.Errorf("conversation: %w", err)
+	}
+
+	return nil
+}
+
+// Open returns the conversations open with the recipient, at most one per category.
+func (tracker *Tracker) Open(ctx context.Context, recipient string) ([]*Conversation, error) {
+	conversations, err := tracker.store.Conversations(ctx, &Filter{Recipient: recipient, OpenAt: tracker.now()})
+	if err != nil {
+		return nil, fmt.Errorf("conversation: open: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// WindowExpiry returns when the customer service window with the customer closes, or closed,
+// and the zero time if the customer never sent a message.
+func (tracker *Tracker) WindowExpiry(ctx context.Context, waID string) (time.Time, error) {
+	expiry, err := tracker.window.Expiry(ctx, waID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("conversation: %w", err)
+	}
+
+	return expiry, nil
+}
+
+// RequiresTemplate reports whether a message to the customer must be a template, that is
+// whether the customer service window is closed. A free-form message is allowed otherwise.
+func (tracker *Tracker) RequiresTemplate(ctx context.Context, waID string) (bool, error) {
+	expiry, err := tracker.WindowExpiry(ctx, waID)
+	if err != nil {
+		return false, err
+	}
+
+	return !tracker.now().Before(expiry), nil
+}
+
+// Summarize returns the summaries of the conversations opened from the time until the other,
+// by day and by category.
+func (tracker *Tracker) Summarize(ctx context.Context, from, to time.Time) ([]*Summary, error) {
+	conversations, err := tracker.store.Conversations(ctx, &Filter{Since: from, Until: to})
+	if err != nil {
+		return nil, fmt.Errorf("conversation: summarize: %w", err)
+	}
+
+	return Summarize(conversations, tracker.location), nil
+}
+
+// Summarize returns the summaries of the conversations by day, in the location, and by
+// category, sorted by date and category.
+func Summarize(conversations []*Conversation, location *time.Location) []*Summary {
+	type key struct{ date, category, model string }
+	summaries := make(map[key]*Summary)
+	for _, conversation := range conversations {
+		k := key{
+			date:     conversation.OpenedAt.In(location).Format(summaryDateLayout),
+			category: conversation.Category,
+			model:    conversation.PricingModel,
+		}
+		summary, ok := summaries[k]
+		if !ok {
+			summary = &Summary{Date: k.date, Category: k.category, PricingModel: k.model}
+			summaries[k] = summary
+		}
+		summary.Conversations++
+		summary.Messages += conversation.Messages
+		if conversation.Billable {
+			summary.Billable++
+		}
+	}
+
+	list := make([]*Summary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, summary)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Date != list[j].Date {
+			return list[i].Date < list[j].Date
+		}
+		if list[i].Category != list[j].Category {
+			return list[i].Category < list[j].Category
+		}
+
+		return list[i].PricingModel < list[j].PricingModel
+	})
+
+	return list
+}
+
+// WriteCSV writes the summaries as CSV, with a header.
+func WriteCSV(writer io.Writer, summaries []*Summary) error {
+	w := csv.NewWriter(writer)
+	records := [][]string{{"date", "category", "pricing_model", "conversations", "billable", "messages"}}
+	for _, summary := range summaries {
+		records = append(records, []string{
+			summary.Date, summary.Category, summary.PricingModel, strconv.Itoa(summary.Conversations),
+			strconv.Itoa(summary.Billable), strconv.Itoa(summary.Messages),
+		})
+	}
+
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("conversation: write csv: %w", err)
+	}
+
+	return nil
+}
+
+// WriteJSON writes the summaries as a JSON array.
+func WriteJSON(writer io.Writer, summaries []*Summary) error {
+	if summaries == nil {
+		summaries = []*Summary{}
+	}
+
+	if err := json.NewEncoder(writer).Encode(summaries); err != nil {
+		return fmt.Errorf("conversation: write json: %w", err)
+	}
+
+	return nil
+}
+
+// Match reports whether the conversation matches the filter, a nil filter matches all the
+// conversations.
+func (filter *Filter) Match(conversation *Conversation) bool {
+	if filter == nil {
+		return true
+	}
+
+	return (filter.Recipient == "" || conversation.Recipient == filter.Recipient) &&
+		(filter.Category == "" || conversation.Category == filter.Category) &&
+		(filter.Since.IsZero() || !conversation.OpenedAt.Before(filter.Since)) &&
+		(filter.Until.IsZero() || conversation.OpenedAt.Before(filter.Until)) &&
+		(filter.OpenAt.IsZero() || (!conversation.OpenedAt.After(filter.OpenAt) &&
+			(conversation.ExpiresAt.IsZero() || filter.OpenAt.Before(conversation.ExpiresAt))))
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryInboundStore: whatsapp.NewMemoryInboundStore(),
+		conversations:      make(map[string]*Conversation),
+	}
+}
+
+// Conversation returns a copy of the conversation.
+func (store *MemoryStore) Conversation(_ context.Context, id string) (*Conversation, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	conversation, ok := store.conversations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *conversation
+
+	return &c, nil
+}
+
+// PutConversation saves a copy of the conversation.
+func (store *MemoryStore) PutConversation(_ context.Context, conversation *Conversation) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := *conversation
+	store.conversations[conversation.ID] = &c
+
+	return nil
+}
+
+// Conversations returns copies of the conversations matching the filter, the first opened
+// first.
+func (store *MemoryStore) Conversations(_ context.Context, filter *Filter) ([]*Conversation, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var conversations []*Conversation
+	for _, conversation := range store.conversations {
+		if filter.Match(conversation) {
+			c := *conversation
+			conversations = append(conversations, &c)
+		}
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].OpenedAt.Before(conversations[j].OpenedAt)
+	})
+
+	return conversations, nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2023, 6, 2, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(NewMemoryStore())
+	tracker.now = func() time.Time { return now }
+	listener := webhooks.NewEventListener()
+	tracker.Attach(listener)
+	handler := listener.NotificationHandler()
+	notify := func(value *webhooks.Value) {
+		body, _ := json.Marshal(&webhooks.Notification{Entry: []*webhooks.Entry{{Changes: []*webhooks.Change{{
+			Field: "messages", Value: value,
+		}}}}})
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+	}
+	status := func(id, recipient, value string, at time.Time, conversation, category string) *webhooks.Status {
+		return &webhooks.Status{
+			ID: id, RecipientID: recipient, StatusValue: value, Timestamp: int(at.Unix()),
+			Conversation: &webhooks.Conversation{
+				ID: conversation, Origin: &webhooks.ConversationOrigin{Type: category},
+				Expiry: int(at.Add(24 * time.Hour).Unix()),
+			},
+			Pricing: &webhooks.Pricing{Billable: true, Category: category, PricingModel: "CBP"},
+		}
+	}
+
+	// a customer wrote two hours ago, and another one yesterday
+	received := func(from string, at time.Time) *webhooks.Message {
+		return &webhooks.Message{From: from, ID: "wamid." + from, Type: "text", Timestamp: strconv.FormatInt(at.Unix(), 10)}
+	}
+	notify(&webhooks.Value{Messages: []*webhooks.Message{
+		received("255700000001", now.Add(-2*time.Hour)),
+		received("255700000002", now.Add(-30*time.Hour)),
+	}})
+
+	notify(&webhooks.Value{Statuses: []*webhooks.Status{
+		status("wamid.1", "255700000001", "sent", now.Add(-time.Hour), "c1", CategoryService),
+		status("wamid.1", "255700000001", "delivered", now.Add(-time.Hour), "c1", CategoryService),
+		status("wamid.2", "255700000001", "sent", now.Add(-time.Hour), "c1", CategoryService),
+		status("wamid.3", "255700000002", "sent", now.Add(-30*time.Hour), "c2", CategoryMarketing),
+		status("wamid.4", "255700000002", "sent", now.Add(-time.Hour), "c3", CategoryMarketing),
+	}})
+
+	tests := []struct {
+		recipient string
+		want      bool
+	}{
+		{recipient: "255700000001", want: false},
+		{recipient: "255700000002", want: true},
+		{recipient: "255700000003", want: true},
+	}
+	for _, tt := range tests {
+		if got, err := tracker.RequiresTemplate(ctx, tt.recipient); err != nil || got != tt.want {
+			t.Errorf("RequiresTemplate(%s) = %v, %v, want %v", tt.recipient, got, err, tt.want)
+		}
+	}
+
+	open, err := tracker.Open(ctx, "255700000002")
+	if err != nil || len(open) != 1 || open[0].ID != "c3" || open[0].Category != CategoryMarketing {
+		t.Errorf("Open() = %+v, %v, want the conversation c3", open, err)
+	}
+
+	summaries, err := tracker.Summarize(ctx, now.Add(-48*time.Hour), now)
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, summaries); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+
+	want := "date,category,pricing_model,conversations,billable,messages\n" +
+		"2023-06-01,marketing,CBP,1,1,1\n" +
+		"2023-06-02,marketing,CBP,1,1,1\n" +
+		"2023-06-02,service,CBP,1,1,2\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV() = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, summaries[:1]); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	wantJSON := `[{"date":"2023-06-01","category":"marketing","pricing_model":"CBP","conversations":1,` +
+		`"billable":1,"messages":1}]` + "\n"
+	if buf.String() != wantJSON {
+		t.Errorf("WriteJSON() = %s, want %s", buf.String(), wantJSON)
+	}
+}
+
+func TestTracker_WindowGuard(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tracker := NewTracker(NewMemoryStore())
+	listener := webhooks.NewEventListener()
+	tracker.Attach(listener)
+
+	body, _ := json.Marshal(&webhooks.Notification{Entry: []*webhooks.Entry{{Changes: []*webhooks.Change{{
+		Field: "messages", Value: &webhooks.Value{Messages: []*webhooks.Message{{
+			From: "+255 700 000 001", ID: "wamid.1", Type: "text",
+			Timestamp: strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10),
+		}}},
+	}}}}})
+	listener.NotificationHandler().ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+
+	// the window is shared with the guard of the clients, by normalized wa_id
+	if got, err := tracker.RequiresTemplate(ctx, "255700000001"); err != nil || got {
+		t.Errorf("RequiresTemplate() = %v, %v, want false", got, err)
+	}
+
+	if err := tracker.WindowGuard().Check(ctx, "+255700000001", "text"); err != nil {
+		t.Errorf("WindowGuard().Check() error = %v, want nil", err)
+	}
+
+	if err := tracker.WindowGuard().Check(ctx, "255700000002", "text"); !errors.Is(err, whatsapp.ErrWindowClosed) {
+		t.Errorf("WindowGuard().Check() error = %v, want %v", err, whatsapp.ErrWindowClosed)
+	}
+}
@@ -0,0 +1,494 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package delivery tracks the delivery of the messages sent by a whatsapp.Client with the
+// status notifications received by a webhooks.EventListener.
+//
+// A Tracker records the messages sent, set as the whatsapp.MessageSentHook of the client, and
+// updates their State with the status notifications:
+//
+//	tracker := delivery.NewTracker(delivery.NewMemoryStore())
+//	client := whatsapp.NewClient(whatsapp.WithMessageSentHook(tracker.MessageSent))
+//	tracker.Attach(listener)
+//
+//	tracker.OnState(delivery.StateFailed, func(ctx context.Context, message *delivery.Message) {
+//		log.Printf("message %s to %s failed: %v", message.ID, message.Recipient, message.Errors)
+//	})
+//
+// The state only moves forward, accepted, sent, delivered and then read, so the statuses
+// received out of order do not move a message back. A message fails unless it has already
+// been delivered. The statuses received before the message is recorded as sent are kept.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// States of a message, in the order they are reached.
+const (
+	StateAccepted State = iota + 1
+	StateSent
+	StateDelivered
+	StateRead
+	StateFailed
+)
+
+var ErrNotFound = errors.New("delivery: message not found")
+
+type (
+	// State is the delivery state of a message. The zero State is used by the statuses of the
+	// messages that have not been recorded as sent.
+	State int
+
+	// Message is a message sent and its delivery state, with the time each state was reached.
+	Message struct {
+		ID            string           `json:"id"`
+		PhoneNumberID string           `json:"phone_number_id,omitempty"`
+		Recipient     string           `json:"recipient,omitempty"`
+		Type          string           `json:"type,omitempty"`
+		State         State            `json:"state"`
+		AcceptedAt    time.Time        `json:"accepted_at,omitempty"`
+		SentAt        time.Time        `json:"sent_at,omitempty"`
+		DeliveredAt   time.Time        `json:"delivered_at,omitempty"`
+		ReadAt        time.Time        `json:"read_at,omitempty"`
+		FailedAt      time.Time        `json:"failed_at,omitempty"`
+		Errors        []*werrors.Error `json:"errors,omitempty"`
+		UpdatedAt     time.Time        `json:"updated_at"`
+	}
+
+	// Filter selects messages. The zero values match all the messages, Since and Until bound
+	// Message.UpdatedAt.
+	Filter struct {
+		State     State
+		Recipient string
+		Since     time.Time
+		Until     time.Time
+	}
+
+	// Store stores the messages. Get returns ErrNotFound for an unknown message and List the
+	// messages matching the filter by UpdatedAt. Implementations must be safe for concurrent
+	// use.
+	Store interface {
+		Get(ctx context.Context, id string) (*Message, error)
+		Put(ctx context.Context, message *Message) error
+		List(ctx context.Context, filter *Filter) ([]*Message, error)
+	}
+
+	// Callback is called with the message that reached a state.
+	Callback func(ctx context.Context, message *Message)
+
+	// Tracker tracks the delivery state of the messages.
+	Tracker struct {
+		store   Store
+		mu      sync.Mutex
+		lastID  uint64
+		onState map[State][]*callback
+		waiting map[string][]*callback
+		now     func() time.Time
+	}
+
+	callback struct {
+		id    uint64
+		state State
+		fn    Callback
+	}
+
+	// MemoryStore is a Store that keeps the messages in memory until they are pruned, see
+	// Prune.
+	MemoryStore struct {
+		mu       sync.RWMutex
+		messages map[string]*Message
+	}
+)
+
+// String returns the name of the state as in the status notifications.
+func (state State) String() string {
+	switch state {
+	case StateAccepted:
+		return "accepted"
+	case StateSent:
+		return whatsappStatusSent
+	case StateDelivered:
+		return whatsappStatusDelivered
+	case StateRead:
+		return whatsappStatusRead
+	case StateFailed:
+		return whatsappStatusFailed
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	whatsappStatusSent      = "sent"
+	whatsappStatusDelivered = "delivered"
+	whatsappStatusRead      = "read"
+	whatsappStatusFailed    = "failed"
+)
+
+// ParseState returns the state of the status of a status notification, 0 if unknown.
+func ParseState(status string) State {
+	switch strings.ToLower(status) {
+	case whatsappStatusSent:
+		return StateSent
+	case whatsappStatusDelivered:
+		return StateDelivered
+	case whatsappStatusRead:
+		return StateRead
+	case whatsappStatusFailed:
+		return StateFailed
+	default:
+		return 0
+	}
+}
+
+// NewTracker returns a Tracker that keeps the messages in the store.
+func NewTracker(store Store) *Tracker {
+	return &Tracker{
+		store:   store,
+		onState: make(map[State][]*callback),
+		waiting: make(map[string][]*callback),
+		now:     time.Now,
+	}
+}
+
+// Attach subscribes the tracker to the status notifications of the listener.
+func (tracker *Tracker) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	return listener.OnMessageStatusChange(tracker.StatusChanged)
+}
+
+// MessageSent records the message as accepted, it is a whatsapp.MessageSentHook.
+func (tracker *Tracker) MessageSent(ctx context.Context, sent *whatsapp.SentMessage) {
+	_, _ = tracker.update(ctx, sent.ID, func(message *Message) bool {
+		message.PhoneNumberID = sent.PhoneNumberID
+		message.Recipient = sent.Recipient
+		if sent.WaID != "" {
+			message.Recipient = sent.WaID
+		}
+		message.Type = sent.Type
+		message.AcceptedAt = sent.SentAt
+		if message.State == 0 {
+			message.State = StateAccepted
+
+			return true
+		}
+
+		return false
+	})
+}
+
+// StatusChanged updates the state of the message of the status, it is a
+// webhooks.OnMessageStatusChangeHook.
+func (tracker *Tracker) StatusChanged(ctx context.Context, nctx *webhooks.NotificationContext,
+	status *webhooks.Status,
+) error {
+	state := ParseState(status.StatusValue)
+	if status.ID == "" || state == 0 {
+		return nil
+	}
+
+	at := time.Unix(int64(status.Timestamp), 0)
+	_, err := tracker.update(ctx, status.ID, func(message *Message) bool {
+		if message.Recipient == "" {
+			message.Recipient = status.RecipientID
+		}
+		if message.PhoneNumberID == "" && nctx != nil && nctx.Metadata != nil {
+			message.PhoneNumberID = nctx.Metadata.PhoneNumberID
+		}
+
+		return transition(message, state, at, status.Errors)
+	})
+
+	return err
+}
+
+// transition records the time of the state and moves the message to it unless it is already
+// further, and reports whether it moved. The statuses implied by a later one, delivered by
+// read for example, may never be received.
+func transition(message *Message, state State, at time.Time, errs []*werrors.Error) bool {
+	switch state { //nolint:exhaustive
+	case StateSent:
+		message.SentAt = at
+	case StateDelivered:
+		message.DeliveredAt = at
+	case StateRead:
+		message.ReadAt = at
+	case StateFailed:
+		message.FailedAt = at
+		message.Errors = errs
+		if message.State == StateDelivered || message.State == StateRead || message.State == StateFailed {
+			return false
+		}
+		message.State = StateFailed
+
+		return true
+	}
+
+	if message.State == StateFailed || message.State >= state {
+		return false
+	}
+	message.State = state
+
+	return true
+}
+
+// Get returns the message with the ID.
+func (tracker *Tracker) Get(ctx context.Context, id string) (*Message, error) {
+	return tracker.store.Get(ctx, id) //nolint:wrapcheck
+}
+
+// List returns the messages matching the filter.
+func (tracker *Tracker) List(ctx context.Context, filter *Filter) ([]*Message, error) {
+	return tracker.store.List(ctx, filter) //nolint:wrapcheck
+}
+
+// Failed returns the messages that failed since the time.
+func (tracker *Tracker) Failed(ctx context.Context, since time.Time) ([]*Message, error) {
+	return tracker.store.List(ctx, &Filter{State: StateFailed, Since: since}) //nolint:wrapcheck
+}
+
+// OnState calls the callback whenever a message reaches the state. The returned function
+// removes the callback.
+func (tracker *Tracker) OnState(state State, fn Callback) func() {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.lastID++
+	cb := &callback{id: tracker.lastID, state: state, fn: fn}
+	tracker.onState[state] = append(tracker.onState[state], cb)
+
+	return func() {
+		tracker.mu.Lock()
+		defer tracker.mu.Unlock()
+		tracker.onState[state] = removeCallback(tracker.onState[state], cb.id)
+	}
+}
+
+// Notify calls the callback once, when the message reaches the state or a later one, or
+// fails. It is called right away if the message has already done so.
+func (tracker *Tracker) Notify(ctx context.Context, id string, state State, fn Callback) error {
+	_, err := tracker.notify(ctx, id, state, fn)
+
+	return err
+}
+
+// Await waits for the message to reach the state, or a later one, or to fail. The callback
+// waiting for the message is removed when ctx is done first.
+func (tracker *Tracker) Await(ctx context.Context, id string, state State) (*Message, error) {
+	done := make(chan *Message, 1)
+	cbID, err := tracker.notify(ctx, id, state, func(_ context.Context, message *Message) {
+		done <- message
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case message := <-done:
+		return message, nil
+	case <-ctx.Done():
+		tracker.mu.Lock()
+		waiting := removeCallback(tracker.waiting[id], cbID)
+		if len(waiting) == 0 {
+			delete(tracker.waiting, id)
+		} else {
+			tracker.waiting[id] = waiting
+		}
+		tracker.mu.Unlock()
+
+		return nil, fmt.Errorf("delivery: await %s: %w", id, ctx.Err())
+	}
+}
+
+// notify is Notify returning the id of the callback left waiting, zero if it has been called
+// right away.
+func (tracker *Tracker) notify(ctx context.Context, id string, state State, fn Callback) (uint64, error) {
+	tracker.mu.Lock()
+	message, err := tracker.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		tracker.mu.Unlock()
+
+		return 0, fmt.Errorf("delivery: notify: %w", err)
+	}
+
+	if message != nil && reached(message.State, state) {
+		tracker.mu.Unlock()
+		fn(ctx, message)
+
+		return 0, nil
+	}
+	tracker.lastID++
+	cbID := tracker.lastID
+	tracker.waiting[id] = append(tracker.waiting[id], &callback{id: cbID, state: state, fn: fn})
+	tracker.mu.Unlock()
+
+	return cbID, nil
+}
+
+func reached(current, want State) bool {
+	return current == StateFailed || (current != 0 && current >= want)
+}
+
+// update applies change to the message, created if it does not exist yet, saves it and
+// calls the callbacks if change reports that the state moved.
+func (tracker *Tracker) update(ctx context.Context, id string, change func(message *Message) bool) (
+	*Message, error,
+) {
+	tracker.mu.Lock()
+	message, err := tracker.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		message, err = &Message{ID: id}, nil
+	}
+
+	if err != nil {
+		tracker.mu.Unlock()
+
+		return nil, fmt.Errorf("delivery: %w", err)
+	}
+
+	moved := change(message)
+	message.UpdatedAt = tracker.now()
+	if err := tracker.store.Put(ctx, message); err != nil {
+		tracker.mu.Unlock()
+
+		return nil, fmt.Errorf("delivery: %w", err)
+	}
+
+	var callbacks []*callback
+	if moved {
+		callbacks = append(callbacks, tracker.onState[message.State]...)
+		var waiting []*callback
+		for _, cb := range tracker.waiting[id] {
+			if reached(message.State, cb.state) {
+				callbacks = append(callbacks, cb)
+			} else {
+				waiting = append(waiting, cb)
+			}
+		}
+		tracker.waiting[id] = waiting
+		if len(waiting) == 0 {
+			delete(tracker.waiting, id)
+		}
+	}
+	tracker.mu.Unlock()
+
+	for _, cb := range callbacks {
+		snapshot := *message
+		cb.fn(ctx, &snapshot)
+	}
+
+	return message, nil
+}
+
+func removeCallback(callbacks []*callback, id uint64) []*callback {
+	kept := make([]*callback, 0, len(callbacks))
+	for _, cb := range callbacks {
+		if cb.id != id {
+			kept = append(kept, cb)
+		}
+	}
+
+	return kept
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]*Message)}
+}
+
+// Get returns a copy of the message.
+func (store *MemoryStore) Get(_ context.Context, id string) (*Message, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	message, ok := store.messages[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *message
+
+	return &c, nil
+}
+
+// Put saves a copy of the message.
+func (store *MemoryStore) Put(_ context.Context, message *Message) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := *message
+	store.messages[message.ID] = &c
+
+	return nil
+}
+
+// Prune removes the messages in a terminal state, read or failed, that were last updated
+// before the time, and returns how many were removed. The delivered messages are kept since
+// they can still be read. A long-running sender calls it periodically so that the store does
+// not grow with every message sent.
+func (store *MemoryStore) Prune(before time.Time) int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	removed := 0
+	for id, message := range store.messages {
+		if (message.State == StateRead || message.State == StateFailed) && message.UpdatedAt.Before(before) {
+			delete(store.messages, id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// List returns copies of the messages matching the filter, the least recently updated first.
+func (store *MemoryStore) List(_ context.Context, filter *Filter) ([]*Message, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var messages []*Message
+	for _, message := range store.messages {
+		if filter.Match(message) {
+			c := *message
+			messages = append(messages, &c)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].UpdatedAt.Before(messages[j].UpdatedAt)
+	})
+
+	return messages, nil
+}
+
+// Match reports whether the message matches the filter, a nil filter matches all messages.
+func (filter *Filter) Match(message *Message) bool {
+	if filter == nil {
+		return true
+	}
+
+	return (filter.State == 0 || message.State == filter.State) &&
+		(filter.Recipient == "" || message.Recipient == filter.Recipient) &&
+		(filter.Since.IsZero() || !message.UpdatedAt.Before(filter.Since)) &&
+		(filter.Until.IsZero() || message.UpdatedAt.Before(filter.Until))
+}
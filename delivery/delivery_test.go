@@ -0,0 +1,203 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","contacts":[{"input":"+255712345678",` +
+			`"wa_id":"255712345678"}],"messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	tracker := NewTracker(NewMemoryStore())
+	client := whatsapp.NewClient(
+		whatsapp.WithBaseURL(server.URL),
+		whatsapp.WithPhoneNumberID("1234"),
+		whatsapp.WithAccessToken("token"),
+		whatsapp.WithMessageSentHook(tracker.MessageSent),
+	)
+	listener := webhooks.NewEventListener()
+	tracker.Attach(listener)
+	handler := listener.NotificationHandler()
+	notify := func(statuses ...*webhooks.Status) {
+		body, _ := json.Marshal(&webhooks.Notification{Entry: []*webhooks.Entry{{Changes: []*webhooks.Change{{
+			Field: "messages", Value: &webhooks.Value{Statuses: statuses},
+		}}}}})
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+	}
+
+	var read []string
+	tracker.OnState(StateRead, func(_ context.Context, message *Message) {
+		read = append(read, message.ID)
+	})
+
+	var notified *Message
+	if err := tracker.Notify(ctx, "wamid.1", StateDelivered, func(_ context.Context, message *Message) {
+		notified = message
+	}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if _, err := client.SendTextMessage(ctx, "+255712345678", &whatsapp.TextMessage{Message: "hi"}); err != nil {
+		t.Fatalf("SendTextMessage() error = %v", err)
+	}
+
+	message, err := tracker.Get(ctx, "wamid.1")
+	if err != nil || message.State != StateAccepted || message.Recipient != "255712345678" ||
+		message.PhoneNumberID != "1234" || message.Type != "text" {
+		t.Fatalf("Get() = %+v, %v, want an accepted text message", message, err)
+	}
+
+	// read arrives before delivered and sent, which must not move the message back
+	notify(&webhooks.Status{ID: "wamid.1", StatusValue: "read", Timestamp: 30})
+	notify(&webhooks.Status{ID: "wamid.1", StatusValue: "delivered", Timestamp: 20},
+		&webhooks.Status{ID: "wamid.1", StatusValue: "sent", Timestamp: 10})
+
+	message, _ = tracker.Get(ctx, "wamid.1")
+	if message.State != StateRead || message.SentAt.Unix() != 10 || message.DeliveredAt.Unix() != 20 ||
+		message.ReadAt.Unix() != 30 {
+		t.Errorf("Get() = %+v, want read with the time of every status", message)
+	}
+
+	if notified == nil || notified.State != StateRead {
+		t.Errorf("Notify() callback got %+v, want the read message", notified)
+	}
+
+	if len(read) != 1 || read[0] != "wamid.1" {
+		t.Errorf("OnState(read) callback got %v, want [wamid.1]", read)
+	}
+
+	// the status of a message that was not recorded as sent, and a failure after it
+	notify(&webhooks.Status{ID: "wamid.2", RecipientID: "255700000000", StatusValue: "sent", Timestamp: 10})
+	notify(&webhooks.Status{ID: "wamid.2", StatusValue: "failed", Timestamp: 20, Errors: []*werrors.Error{
+		{Code: 131026, Message: "Message undeliverable"},
+	}})
+
+	// a failure after the message is delivered is ignored
+	notify(&webhooks.Status{ID: "wamid.1", StatusValue: "failed", Timestamp: 40})
+
+	failed, err := tracker.Failed(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(failed) != 1 || failed[0].ID != "wamid.2" || failed[0].Recipient != "255700000000" ||
+		len(failed[0].Errors) != 1 || failed[0].Errors[0].Code != 131026 {
+		t.Fatalf("Failed() = %+v, %v, want wamid.2 with its error", failed, err)
+	}
+
+	message, err = tracker.Await(ctx, "wamid.2", StateRead)
+	if err != nil || message.State != StateFailed {
+		t.Errorf("Await() = %+v, %v, want the failed message", message, err)
+	}
+
+	// a cancelled Await no longer waits for the message
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := tracker.Await(cctx, "wamid.3", StateDelivered); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Await() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	tracker.mu.Lock()
+	waiting := len(tracker.waiting)
+	tracker.mu.Unlock()
+	if waiting != 0 {
+		t.Errorf("%d messages waited for after the Await was cancelled, want 0", waiting)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		from   State
+		to     State
+		want   State
+		wantOk bool
+	}{
+		{name: "sent", from: StateAccepted, to: StateSent, want: StateSent, wantOk: true},
+		{name: "read skips delivered", from: StateSent, to: StateRead, want: StateRead, wantOk: true},
+		{name: "delivered after read", from: StateRead, to: StateDelivered, want: StateRead},
+		{name: "failed before delivery", from: StateSent, to: StateFailed, want: StateFailed, wantOk: true},
+		{name: "failed after delivery", from: StateDelivered, to: StateFailed, want: StateDelivered},
+		{name: "read after failure", from: StateFailed, to: StateRead, want: StateFailed},
+		{name: "unknown message", from: 0, to: StateDelivered, want: StateDelivered, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			message := &Message{ID: "wamid.1", State: tt.from}
+			if ok := transition(message, tt.to, time.Now(), nil); ok != tt.wantOk || message.State != tt.want {
+				t.Errorf("transition(%s, %s) = %s, %v, want %s, %v", tt.from, tt.to, message.State, ok,
+					tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	for _, message := range []*Message{
+		{ID: "old-read", State: StateRead, UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "old-failed", State: StateFailed, UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "old-delivered", State: StateDelivered, UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "old-sent", State: StateSent, UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "new-read", State: StateRead, UpdatedAt: now},
+	} {
+		if err := store.Put(ctx, message); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if removed := store.Prune(now.Add(-time.Hour)); removed != 2 {
+		t.Errorf("Prune() = %d, want 2", removed)
+	}
+
+	for _, id := range []string{"old-read", "old-failed"} {
+		if _, err := store.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want %v", id, err, ErrNotFound)
+		}
+	}
+
+	for _, id := range []string{"old-delivered", "old-sent", "new-read"} {
+		if message, err := store.Get(ctx, id); err != nil || message == nil {
+			t.Errorf("Get(%q) = %+v, %v, want it kept", id, message, err)
+		}
+	}
+}
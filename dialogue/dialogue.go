@@ -0,0 +1,634 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package dialogue runs multi-step conversations, like onboarding or order tracking, as state
+// machines driven by the messages received by a webhooks.EventListener.
+//
+// Each user, by WhatsApp ID, has a Session with the current state and the data collected so
+// far. Entering a state sends its prompt, as reply buttons, a list or a text, and the replies
+// move the session to the next state:
+//
+//	machine, err := dialogue.NewMachine("menu", []*dialogue.State{
+//		{
+//			Name:    "menu",
+//			Prompt:  "How can we help?",
+//			Buttons: []*models.InteractiveReplyButton{{ID: "track", Title: "Track an order"}},
+//			Transitions: map[string]string{"track": "order_number"},
+//		},
+//		{
+//			Name:    "order_number",
+//			Prompt:  "What is your order number?",
+//			Timeout: 10 * time.Minute,
+//			Handle: func(ctx context.Context, session *dialogue.Session, input *dialogue.Input) (string, error) {
+//				session.Data["order"] = input.Text
+//				return "done", nil
+//			},
+//		},
+//		{Name: "done", Prompt: "Thanks, we will get back to you.", Final: true},
+//	}, dialogue.NewMemoryStore(), client)
+//	machine.Attach(listener)
+//
+// A session expires with the customer service window, 24 hours after the last message of the
+// user, as the prompts can not be sent after that. A state with a Timeout moves the session to
+// its TimeoutState, or restarts it, once the timeout passes. Expire does it and sends the new
+// prompt, it is run periodically by the caller:
+//
+//	ticker := time.NewTicker(time.Minute)
+//	defer ticker.Stop()
+//	for range ticker.C {
+//		if _, err := machine.Expire(ctx); err != nil {
+//			log.Printf("expire dialogues: %v", err)
+//		}
+//	}
+//
+// A session that timed out and was not moved by Expire is moved when the user sends the next
+// message, which is then not handled.
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// SessionWindow is how long a session lasts after the last message of the user, the customer
+// service window.
+const SessionWindow = 24 * time.Hour
+
+var (
+	ErrNotFound     = errors.New("dialogue: session not found")
+	ErrUnknownState = errors.New("dialogue: unknown state")
+)
+
+type (
+	// Session is the state of the dialogue with a user. Data holds the values collected by the
+	// states. StepDeadline is when the current state times out, zero if it does not, and
+	// ExpiresAt when the session expires.
+	Session struct {
+		WaID         string            `json:"wa_id"`
+		State        string            `json:"state"`
+		Data         map[string]string `json:"data,omitempty"`
+		StartedAt    time.Time         `json:"started_at"`
+		UpdatedAt    time.Time         `json:"updated_at"`
+		StepDeadline time.Time         `json:"step_deadline,omitempty"`
+		ExpiresAt    time.Time         `json:"expires_at"`
+	}
+
+	// Input is a message received from the user. ID is the ID of the reply button or of the
+	// list row selected, or the payload of the quick reply button, and Text the text of the
+	// message or the title of the reply.
+	Input struct {
+		WaID                string
+		MessageID           string
+		Text                string
+		ID                  string
+		NotificationContext *webhooks.NotificationContext
+		MessageContext      *webhooks.MessageContext
+	}
+
+	// HandleFunc handles the input of the user in a state, and returns the next state. An
+	// empty state keeps the session in the current state without prompting again.
+	HandleFunc func(ctx context.Context, session *Session, input *Input) (string, error)
+
+	// EnterFunc is called when a session enters a state, before the prompt is sent.
+	EnterFunc func(ctx context.Context, session *Session) error
+
+	// State is a step of the dialogue.
+	//
+	// Prompt is sent when the session enters the state: as the body of reply buttons if there
+	// are Buttons, of a list opened with ListButton if there are Sections, or as a text.
+	//
+	// The input moves the session to the state of Transitions keyed by the ID of the reply, or
+	// else by the text of the message, ignoring the case. Handle is called for the input that
+	// matches no transition, and the prompt is sent again if there is no Handle.
+	//
+	// Timeout is how long the state waits for the input, after which the session moves to
+	// TimeoutState, or restarts from the initial state, see Machine.Expire. A Final state ends
+	// the session.
+	State struct {
+		Name         string
+		Prompt       string
+		Buttons      []*models.InteractiveReplyButton
+		ListButton   string
+		Sections     []*models.InteractiveSection
+		Transitions  map[string]string
+		Handle       HandleFunc
+		OnEnter      EnterFunc
+		Timeout      time.Duration
+		TimeoutState string
+		Final        bool
+	}
+
+	// Store stores the sessions by WhatsApp ID. Get returns ErrNotFound if there is no session
+	// and List returns all the sessions, expired or not. Implementations must be safe for
+	// concurrent use.
+	Store interface {
+		Get(ctx context.Context, waID string) (*Session, error)
+		Put(ctx context.Context, session *Session) error
+		Delete(ctx context.Context, waID string) error
+		List(ctx context.Context) ([]*Session, error)
+	}
+
+	// Sender sends the prompts, *whatsapp.Client is a Sender.
+	Sender interface {
+		SendTextMessage(ctx context.Context, recipient string, message *whatsapp.TextMessage) (
+			*whatsapp.ResponseMessage, error)
+		SendReplyButtons(ctx context.Context, recipient string, message *whatsapp.ReplyButtonsMessage) (
+			*whatsapp.ResponseMessage, error)
+		SendList(ctx context.Context, recipient string, message *whatsapp.ListMessage) (
+			*whatsapp.ResponseMessage, error)
+	}
+
+	// Machine runs the dialogues of the users. The inputs of a user are handled one at a time,
+	// the inputs of different users concurrently.
+	Machine struct {
+		initial  string
+		states   map[string]*State
+		triggers map[string]string
+		store    Store
+		sender   Sender
+		window   time.Duration
+		now      func() time.Time
+		locks    keyedMutex
+	}
+
+	MachineOption func(machine *Machine)
+
+	// keyedMutex is a mutex per key. The mutex of a key is removed once it is unlocked and no
+	// other goroutine waits for it.
+	keyedMutex struct {
+		mu    sync.Mutex
+		locks map[string]*keyedLock
+	}
+
+	keyedLock struct {
+		mu   sync.Mutex
+		refs int
+	}
+)
+
+// WithTrigger starts the dialogue from the state when a user sends the keyword, ignoring the
+// case, even in the middle of another state. "menu" or "cancel" are common triggers.
+func WithTrigger(keyword, state string) MachineOption {
+	return func(machine *Machine) {
+		machine.triggers[normalize(keyword)] = state
+	}
+}
+
+// WithSessionWindow sets how long a session lasts after the last message of the user,
+// SessionWindow by default.
+func WithSessionWindow(window time.Duration) MachineOption {
+	return func(machine *Machine) {
+		machine.window = window
+	}
+}
+
+// NewMachine returns a Machine of the states that starts the dialogues from the initial state.
+// It returns ErrUnknownState if a state refers to a state that does not exist.
+func NewMachine(initial string, states []*State, store Store, sender Sender, options ...MachineOption) (
+	*Machine, error,
+) {
+	machine := &Machine{
+		initial:  initial,
+		states:   make(map[string]*State, len(states)),
+		triggers: make(map[string]string),
+		store:    store,
+		sender:   sender,
+		window:   SessionWindow,
+		now:      time.Now,
+	}
+	for _, state := range states {
+		machine.states[state.Name] = state
+	}
+
+	for _, option := range options {
+		option(machine)
+	}
+
+	if err := machine.validate(); err != nil {
+		return nil, err
+	}
+
+	return machine, nil
+}
+
+func (machine *Machine) validate() error {
+	check := func(from, to string) error {
+		if _, ok := machine.states[to]; !ok {
+			return fmt.Errorf("%w: %q from %q", ErrUnknownState, to, from)
+		}
+
+		return nil
+	}
+
+	if err := check("initial", machine.initial); err != nil {
+		return err
+	}
+
+	for _, state := range machine.states {
+		for _, to := range state.Transitions {
+			if err := check(state.Name, to); err != nil {
+				return err
+			}
+		}
+
+		if state.TimeoutState != "" {
+			if err := check(state.Name, state.TimeoutState); err != nil {
+				return err
+			}
+		}
+	}
+
+	for keyword, to := range machine.triggers {
+		if err := check("trigger "+keyword, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Attach subscribes the machine to the text messages, the interactive replies and the button
+// replies received by the listener. The texts quoting a message, dispatched as product
+// enquiries, and the texts with a referral are handled as text messages too.
+func (machine *Machine) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	text := func(ctx context.Context, nctx *webhooks.NotificationContext, mctx *webhooks.MessageContext,
+		text *webhooks.Text,
+	) error {
+		if text == nil {
+			return nil
+		}
+
+		return machine.Handle(ctx, newInput(nctx, mctx, text.Body, ""))
+	}
+	unsubscribes := []webhooks.Unsubscribe{
+		listener.OnTextMessage(text),
+		listener.OnProductEnquiry(text),
+		listener.OnReferralMessage(func(ctx context.Context, nctx *webhooks.NotificationContext,
+			mctx *webhooks.MessageContext, body *webhooks.Text, _ *webhooks.Referral,
+		) error {
+			return text(ctx, nctx, mctx, body)
+		}),
+		listener.OnInteractiveMessage(func(ctx context.Context, nctx *webhooks.NotificationContext,
+			mctx *webhooks.MessageContext, interactive *webhooks.Interactive,
+		) error {
+			switch {
+			case interactive.ButtonReply != nil:
+				reply := interactive.ButtonReply
+
+				return machine.Handle(ctx, newInput(nctx, mctx, reply.Title, reply.ID))
+			case interactive.ListReply != nil:
+				reply := interactive.ListReply
+
+				return machine.Handle(ctx, newInput(nctx, mctx, reply.Title, reply.ID))
+			default:
+				return nil
+			}
+		}),
+		listener.OnButtonMessage(func(ctx context.Context, nctx *webhooks.NotificationContext,
+			mctx *webhooks.MessageContext, button *webhooks.Button,
+		) error {
+			return machine.Handle(ctx, newInput(nctx, mctx, button.Text, button.Payload))
+		}),
+	}
+
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+func newInput(nctx *webhooks.NotificationContext, mctx *webhooks.MessageContext, text, id string) *Input {
+	input := &Input{Text: text, ID: id, NotificationContext: nctx, MessageContext: mctx}
+	if mctx != nil {
+		input.WaID = mctx.From
+		input.MessageID = mctx.ID
+	}
+
+	return input
+}
+
+// Handle moves the session of the user with the input. A user without a session, or whose
+// session expired, starts from the initial state.
+func (machine *Machine) Handle(ctx context.Context, input *Input) error {
+	if input.WaID == "" {
+		return nil
+	}
+
+	defer machine.locks.lock(input.WaID)()
+	now := machine.now()
+	session, err := machine.store.Get(ctx, input.WaID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("dialogue: get session: %w", err)
+	}
+
+	if session != nil && !now.Before(session.ExpiresAt) {
+		session = nil
+	}
+
+	if to, ok := machine.triggers[normalize(input.Text)]; ok {
+		return machine.enter(ctx, machine.newSession(input.WaID, now, session), to)
+	}
+
+	if session == nil {
+		return machine.enter(ctx, machine.newSession(input.WaID, now, nil), machine.initial)
+	}
+	session.ExpiresAt = now.Add(machine.window)
+
+	state, ok := machine.states[session.State]
+	if !ok {
+		return machine.enter(ctx, session, machine.initial)
+	}
+
+	if timedOut(session, now) {
+		return machine.timeout(ctx, session)
+	}
+
+	return machine.handle(ctx, session, state, input)
+}
+
+// Expire moves the sessions whose state timed out to the TimeoutState of the state, or
+// restarts them from the initial state, and sends the prompt of the new state without waiting
+// for the next message of the user. The expired sessions are left alone. It returns the number
+// of sessions moved, and the errors of the sessions that could not be moved.
+func (machine *Machine) Expire(ctx context.Context) (int, error) {
+	sessions, err := machine.store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("dialogue: list sessions: %w", err)
+	}
+
+	moved := 0
+	var errs []error
+	for _, session := range sessions {
+		if !timedOut(session, machine.now()) {
+			continue
+		}
+
+		ok, err := machine.expire(ctx, session.WaID)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			moved++
+		}
+	}
+
+	return moved, errors.Join(errs...)
+}
+
+// expire moves the session of the user if it still timed out once it is locked.
+func (machine *Machine) expire(ctx context.Context, waID string) (bool, error) {
+	defer machine.locks.lock(waID)()
+	session, err := machine.store.Get(ctx, waID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("dialogue: get session: %w", err)
+	}
+
+	now := machine.now()
+	if !now.Before(session.ExpiresAt) || !timedOut(session, now) {
+		return false, nil
+	}
+
+	return true, machine.timeout(ctx, session)
+}
+
+func timedOut(session *Session, now time.Time) bool {
+	return !session.StepDeadline.IsZero() && !now.Before(session.StepDeadline)
+}
+
+// timeout moves the session to the TimeoutState of its state, or to the initial state.
+func (machine *Machine) timeout(ctx context.Context, session *Session) error {
+	to := machine.initial
+	if state, ok := machine.states[session.State]; ok && state.TimeoutState != "" {
+		to = state.TimeoutState
+	}
+
+	return machine.enter(ctx, session, to)
+}
+
+// handle moves the session in the state with the input.
+func (machine *Machine) handle(ctx context.Context, session *Session, state *State, input *Input) error {
+	if to, ok := transition(state.Transitions, input); ok {
+		return machine.enter(ctx, session, to)
+	}
+
+	if state.Handle == nil {
+		return machine.enter(ctx, session, state.Name)
+	}
+
+	to, err := state.Handle(ctx, session, input)
+	if err != nil {
+		return fmt.Errorf("dialogue: state %s: %w", state.Name, err)
+	}
+
+	if to == "" {
+		return machine.save(ctx, session)
+	}
+
+	if _, ok := machine.states[to]; !ok {
+		return fmt.Errorf("%w: %q from %q", ErrUnknownState, to, state.Name)
+	}
+
+	return machine.enter(ctx, session, to)
+}
+
+func transition(transitions map[string]string, input *Input) (string, bool) {
+	if input.ID != "" {
+		if to, ok := transitions[input.ID]; ok {
+			return to, true
+		}
+	}
+
+	text := normalize(input.Text)
+	for key, to := range transitions {
+		if normalize(key) == text {
+			return to, true
+		}
+	}
+
+	return "", false
+}
+
+// Start starts the dialogue of the user from the state, replacing the session, if any. The
+// dialogues are usually started by the users, but a dialogue can be started after a template
+// message that opened the customer service window, for example.
+func (machine *Machine) Start(ctx context.Context, waID, state string) error {
+	if _, ok := machine.states[state]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownState, state)
+	}
+
+	defer machine.locks.lock(waID)()
+
+	return machine.enter(ctx, machine.newSession(waID, machine.now(), nil), state)
+}
+
+// Session returns the session of the user, ErrNotFound if there is none or it expired.
+func (machine *Machine) Session(ctx context.Context, waID string) (*Session, error) {
+	session, err := machine.store.Get(ctx, waID)
+	if err != nil {
+		return nil, fmt.Errorf("dialogue: get session: %w", err)
+	}
+
+	if !machine.now().Before(session.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return session, nil
+}
+
+// Reset ends the session of the user.
+func (machine *Machine) Reset(ctx context.Context, waID string) error {
+	defer machine.locks.lock(waID)()
+	if err := machine.store.Delete(ctx, waID); err != nil {
+		return fmt.Errorf("dialogue: delete session: %w", err)
+	}
+
+	return nil
+}
+
+// newSession returns a new session of the user, keeping the data of the previous session if
+// it has not expired.
+func (machine *Machine) newSession(waID string, now time.Time, previous *Session) *Session {
+	session := &Session{
+		WaID:      waID,
+		Data:      make(map[string]string),
+		StartedAt: now,
+		ExpiresAt: now.Add(machine.window),
+	}
+	if previous != nil {
+		session.Data = previous.Data
+	}
+
+	return session
+}
+
+// enter moves the session to the state, calls its OnEnter, sends its prompt and saves the
+// session, or deletes it if the state is final.
+func (machine *Machine) enter(ctx context.Context, session *Session, name string) error {
+	state, ok := machine.states[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownState, name)
+	}
+
+	now := machine.now()
+	session.State = state.Name
+	session.StepDeadline = time.Time{}
+	if state.Timeout > 0 {
+		session.StepDeadline = now.Add(state.Timeout)
+	}
+
+	if session.Data == nil {
+		session.Data = make(map[string]string)
+	}
+
+	if state.OnEnter != nil {
+		if err := state.OnEnter(ctx, session); err != nil {
+			return fmt.Errorf("dialogue: enter %s: %w", state.Name, err)
+		}
+	}
+
+	if err := machine.prompt(ctx, session.WaID, state); err != nil {
+		return fmt.Errorf("dialogue: prompt %s: %w", state.Name, err)
+	}
+
+	if state.Final {
+		if err := machine.store.Delete(ctx, session.WaID); err != nil {
+			return fmt.Errorf("dialogue: delete session: %w", err)
+		}
+
+		return nil
+	}
+
+	return machine.save(ctx, session)
+}
+
+func (machine *Machine) save(ctx context.Context, session *Session) error {
+	session.UpdatedAt = machine.now()
+	if err := machine.store.Put(ctx, session); err != nil {
+		return fmt.Errorf("dialogue: save session: %w", err)
+	}
+
+	return nil
+}
+
+// prompt sends the prompt of the state to the user.
+func (machine *Machine) prompt(ctx context.Context, waID string, state *State) error {
+	var err error
+	switch {
+	case state.Prompt == "":
+		return nil
+	case len(state.Buttons) > 0:
+		_, err = machine.sender.SendReplyButtons(ctx, waID, &whatsapp.ReplyButtonsMessage{
+			Body:    state.Prompt,
+			Buttons: state.Buttons,
+		})
+	case len(state.Sections) > 0:
+		_, err = machine.sender.SendList(ctx, waID, &whatsapp.ListMessage{
+			Body:     state.Prompt,
+			Button:   state.ListButton,
+			Sections: state.Sections,
+		})
+	default:
+		_, err = machine.sender.SendTextMessage(ctx, waID, &whatsapp.TextMessage{Message: state.Prompt})
+	}
+
+	return err //nolint:wrapcheck
+}
+
+func normalize(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// lock locks the mutex of the key and returns the function that unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
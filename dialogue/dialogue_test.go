@@ -0,0 +1,345 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+type sender struct {
+	sent []string
+}
+
+func (s *sender) SendTextMessage(_ context.Context, recipient string, message *whatsapp.TextMessage) (
+	*whatsapp.ResponseMessage, error,
+) {
+	s.sent = append(s.sent, fmt.Sprintf("%s text %s", recipient, message.Message))
+
+	return &whatsapp.ResponseMessage{}, nil
+}
+
+func (s *sender) SendReplyButtons(_ context.Context, recipient string, message *whatsapp.ReplyButtonsMessage) (
+	*whatsapp.ResponseMessage, error,
+) {
+	s.sent = append(s.sent, fmt.Sprintf("%s buttons %s", recipient, message.Body))
+
+	return &whatsapp.ResponseMessage{}, nil
+}
+
+func (s *sender) SendList(_ context.Context, recipient string, message *whatsapp.ListMessage) (
+	*whatsapp.ResponseMessage, error,
+) {
+	s.sent = append(s.sent, fmt.Sprintf("%s list %s", recipient, message.Body))
+
+	return &whatsapp.ResponseMessage{}, nil
+}
+
+func testStates() []*State {
+	return []*State{
+		{
+			Name:        "menu",
+			Prompt:      "How can we help?",
+			Buttons:     []*models.InteractiveReplyButton{{ID: "track", Title: "Track an order"}},
+			Transitions: map[string]string{"track": "order_number", "sizes": "size"},
+		},
+		{
+			Name:    "order_number",
+			Prompt:  "What is your order number?",
+			Timeout: 10 * time.Minute,
+			Handle: func(_ context.Context, session *Session, input *Input) (string, error) {
+				if !strings.HasPrefix(input.Text, "#") {
+					return "", nil
+				}
+				session.Data["order"] = input.Text
+
+				return "done", nil
+			},
+		},
+		{
+			Name:       "size",
+			Prompt:     "Pick a size",
+			ListButton: "Sizes",
+			Sections: []*models.InteractiveSection{{Rows: []*models.InteractiveSectionRow{
+				{ID: "m", Title: "M"},
+			}}},
+			Transitions: map[string]string{"m": "done"},
+		},
+		{Name: "done", Prompt: "Thanks", Final: true},
+	}
+}
+
+func TestMachine(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	s := &sender{}
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "sessions.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	machine, err := NewMachine("menu", testStates(), store, s, WithTrigger("Menu", "menu"))
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+	machine.now = func() time.Time { return now }
+
+	steps := []struct {
+		text, id string
+		advance  time.Duration
+		want     string
+	}{
+		{text: "hi", want: "buttons How can we help?"},
+		{text: "Track an order", id: "track", want: "text What is your order number?"},
+		{text: "I don't know", want: ""},
+		{text: "#12", advance: 11 * time.Minute, want: "buttons How can we help?"},
+		{text: " SIZES ", want: "list Pick a size"},
+		{text: "nothing", want: "list Pick a size"},
+		{text: "menu", want: "buttons How can we help?"},
+		{text: "track", want: "text What is your order number?"},
+		{text: "#12", want: "text Thanks"},
+		{text: "hello", advance: time.Hour, want: "buttons How can we help?"},
+		{text: "track", advance: 25 * time.Hour, want: "buttons How can we help?"},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		s.sent = nil
+		if err := machine.Handle(ctx, &Input{WaID: "255700000001", Text: step.text, ID: step.id}); err != nil {
+			t.Fatalf("step %d: Handle() error = %v", i, err)
+		}
+
+		got := strings.TrimPrefix(strings.Join(s.sent, ","), "255700000001 ")
+		if got != step.want {
+			t.Errorf("step %d (%s): sent %q, want %q", i, step.text, got, step.want)
+		}
+
+		if i == 7 {
+			reloaded, err := NewFileStore(store.path)
+			if err != nil {
+				t.Fatalf("NewFileStore() error = %v", err)
+			}
+
+			if session, err := reloaded.Get(ctx, "255700000001"); err != nil || session.State != "order_number" {
+				t.Errorf("reloaded session = %+v, %v, want the order_number state", session, err)
+			}
+		}
+
+		if i == 8 {
+			if _, err := machine.Session(ctx, "255700000001"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Session() error = %v after the final state, want ErrNotFound", err)
+			}
+		}
+	}
+}
+
+func TestMachine_Attach(t *testing.T) {
+	t.Parallel()
+	s := &sender{}
+	machine, err := NewMachine("menu", testStates(), NewMemoryStore(), s)
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+
+	listener := webhooks.NewEventListener()
+	machine.Attach(listener)
+	handler := listener.NotificationHandler()
+	notify := func(message string) {
+		body := `{"object":"whatsapp_business_account","entry":[{"changes":[{"field":"messages","value":{` +
+			`"messages":[{"from":"255700000001","id":"wamid.1","type":"text",` + message + `}]}}]}]}`
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("notification %s: status = %d", message, recorder.Code)
+		}
+	}
+
+	// a reply quoting the prompt, and a text with a referral
+	notify(`"text":{"body":"hi"},"context":{"from":"255700000000","id":"wamid.0"}`)
+	notify(`"text":{"body":"track"},"referral":{"source_url":"https://fb.me/ad","source_type":"ad"}`)
+
+	want := "255700000001 buttons How can we help?,255700000001 text What is your order number?"
+	if got := strings.Join(s.sent, ","); got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestMachine_ConcurrentUsers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	s := &sender{}
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	states := []*State{{
+		Name:   "start",
+		Prompt: "Welcome",
+		Final:  true,
+		OnEnter: func(_ context.Context, session *Session) error {
+			if session.WaID == "255700000001" {
+				close(entered)
+				<-proceed
+			}
+
+			return nil
+		},
+	}}
+	machine, err := NewMachine("start", states, NewMemoryStore(), s)
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- machine.Handle(ctx, &Input{WaID: "255700000001", Text: "hi"}) }()
+
+	// the input of another user is handled while the first one is blocked
+	<-entered
+	if err := machine.Handle(ctx, &Input{WaID: "255700000002", Text: "hi"}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	close(proceed)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	want := "255700000002 text Welcome,255700000001 text Welcome"
+	if got := strings.Join(s.sent, ","); got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	if len(machine.locks.locks) != 0 {
+		t.Errorf("%d locks left after the inputs were handled, want 0", len(machine.locks.locks))
+	}
+}
+
+func TestNewMachine_UnknownState(t *testing.T) {
+	t.Parallel()
+	states := testStates()
+	states[0].Transitions["help"] = "help"
+	if _, err := NewMachine("menu", states, NewMemoryStore(), &sender{}); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("NewMachine() error = %v, want ErrUnknownState", err)
+	}
+}
+
+func TestFileStore_Expired(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "sessions.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	sessions := []*Session{
+		{WaID: "255700000001", State: "menu", ExpiresAt: now.Add(-time.Minute)},
+		{WaID: "255700000002", State: "menu", ExpiresAt: now.Add(time.Minute)},
+	}
+	for _, session := range sessions {
+		if err := store.Put(ctx, session); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	reloaded, err := NewFileStore(store.path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	if _, err := reloaded.Get(ctx, "255700000001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v for the expired session, want ErrNotFound", err)
+	}
+
+	if _, err := reloaded.Get(ctx, "255700000002"); err != nil {
+		t.Errorf("Get() error = %v for the live session", err)
+	}
+}
+
+func TestMachine_Expire(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	s := &sender{}
+	states := testStates()
+	states = append(states, &State{Name: "late", Prompt: "Still there?", Transitions: map[string]string{"yes": "menu"}})
+	states[1].TimeoutState = "late"
+	machine, err := NewMachine("menu", states, NewMemoryStore(), s)
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+	machine.now = func() time.Time { return now }
+
+	for _, waID := range []string{"255700000001", "255700000002"} {
+		if err := machine.Start(ctx, waID, "order_number"); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+
+	if err := machine.Start(ctx, "255700000003", "menu"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	now = now.Add(5 * time.Minute)
+	if err := machine.Handle(ctx, &Input{WaID: "255700000002", Text: "I don't know"}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	now = now.Add(6 * time.Minute)
+	s.sent = nil
+	moved, err := machine.Expire(ctx)
+	if err != nil || moved != 2 {
+		t.Fatalf("Expire() = %d, %v, want 2 sessions moved", moved, err)
+	}
+
+	if got := strings.Join(s.sent, ","); !strings.Contains(got, "255700000001 text Still there?") ||
+		!strings.Contains(got, "255700000002 text Still there?") || len(s.sent) != 2 {
+		t.Errorf("Expire() sent %q, want the timeout prompt to the timed out users", got)
+	}
+
+	session, err := machine.Session(ctx, "255700000003")
+	if err != nil || session.State != "menu" {
+		t.Errorf("Session() = %+v, %v, want the menu state without a timeout", session, err)
+	}
+
+	// the next message is handled in the timeout state
+	s.sent = nil
+	if err := machine.Handle(ctx, &Input{WaID: "255700000001", Text: "yes"}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	if got := strings.Join(s.sent, ","); got != "255700000001 buttons How can we help?" {
+		t.Errorf("Handle() sent %q after the timeout, want the menu", got)
+	}
+
+	if moved, err := machine.Expire(ctx); err != nil || moved != 0 {
+		t.Errorf("Expire() = %d, %v, want nothing moved", moved, err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp/internal/atomicfile"
+)
+
+type (
+	// MemoryStore is a Store that keeps the sessions in memory.
+	MemoryStore struct {
+		mu       sync.RWMutex
+		sessions map[string]*Session
+	}
+
+	// FileStore is a Store that keeps the sessions in memory and saves them to a json file
+	// after every change, so the dialogues survive restarts. The expired sessions are dropped
+	// when the file is saved.
+	//
+	// Put and Delete rewrite the whole file, with every session, and every message of a user
+	// calls one of them: it suits a few hundred active users, a Store backed by a database is
+	// better for more.
+	FileStore struct {
+		path  string
+		mu    sync.Mutex
+		store *MemoryStore
+		now   func() time.Time
+	}
+)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+// Get returns a copy of the session of the user.
+func (s *MemoryStore) Get(_ context.Context, waID string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[waID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return session.clone(), nil
+}
+
+// Put saves a copy of the session.
+func (s *MemoryStore) Put(_ context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.WaID] = session.clone()
+
+	return nil
+}
+
+// Delete deletes the session of the user.
+func (s *MemoryStore) Delete(_ context.Context, waID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, waID)
+
+	return nil
+}
+
+// List returns copies of all the sessions.
+func (s *MemoryStore) List(context.Context) ([]*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session.clone())
+	}
+
+	return sessions, nil
+}
+
+// snapshot returns the sessions that have not expired at the time.
+func (s *MemoryStore) snapshot(now time.Time) map[string]*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make(map[string]*Session, len(s.sessions))
+	for waID, session := range s.sessions {
+		if now.Before(session.ExpiresAt) {
+			sessions[waID] = session
+		}
+	}
+
+	return sessions
+}
+
+func (session *Session) clone() *Session {
+	c := *session
+	c.Data = make(map[string]string, len(session.Data))
+	for k, v := range session.Data {
+		c.Data[k] = v
+	}
+
+	return &c
+}
+
+// NewFileStore returns a FileStore that saves the sessions to the file at path, loading the
+// sessions already saved to it.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path, store: NewMemoryStore(), now: time.Now}
+	if err := atomicfile.ReadJSON(path, &store.store.sessions); err != nil {
+		return nil, fmt.Errorf("dialogue: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, waID string) (*Session, error) {
+	return s.store.Get(ctx, waID)
+}
+
+func (s *FileStore) Put(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Put(ctx, session); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) List(ctx context.Context) ([]*Session, error) {
+	return s.store.List(ctx)
+}
+
+func (s *FileStore) Delete(ctx context.Context, waID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Delete(ctx, waID); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// save replaces the store file with the sessions that have not expired.
+func (s *FileStore) save() error {
+	if err := atomicfile.WriteJSON(s.path, s.store.snapshot(s.now())); err != nil {
+		return fmt.Errorf("dialogue: %w", err)
+	}
+
+	return nil
+}
@@ -38,6 +38,7 @@ type (
 	// UserMessage: The message to display to the user. The language of the message is based on the locale of the API request.
 	// UserTitle: The title of the dialog, if shown. The language of the message is based on the locale of the API request.
 	// FbTraceID: Internal support identifier. When reporting a bug related to a Graph API call, include the fbtrace_id to help us find log data for debugging.
+	// IsTransient: Set by the API when the error is temporary and the request can be retried.
 	// Example of error response
 	//
 	//	"error": {
@@ -54,14 +55,15 @@ type (
 	//	        "fbtrace_id": "AI5Ob2z72R0JAUB5zOF-nao"
 	//	}
 	Error struct {
-		Message   string     `json:"message,omitempty"`
-		Type      string     `json:"type,omitempty"`
-		Code      int        `json:"code,omitempty"`
-		Data      *ErrorData `json:"error_data,omitempty"`
-		Subcode   int        `json:"error_subcode,omitempty"`
-		UserTitle string     `json:"error_user_title,omitempty"`
-		UserMsg   string     `json:"error_user_msg,omitempty"`
-		FBTraceID string     `json:"fbtrace_id,omitempty"`
+		Message     string     `json:"message,omitempty"`
+		Type        string     `json:"type,omitempty"`
+		Code        int        `json:"code,omitempty"`
+		Data        *ErrorData `json:"error_data,omitempty"`
+		Subcode     int        `json:"error_subcode,omitempty"`
+		UserTitle   string     `json:"error_user_title,omitempty"`
+		UserMsg     string     `json:"error_user_msg,omitempty"`
+		FBTraceID   string     `json:"fbtrace_id,omitempty"`
+		IsTransient bool       `json:"is_transient,omitempty"`
 	}
 
 	// ErrorData represents additional information about the error.
@@ -136,6 +138,10 @@ func (e *Error) String() string {
 			b.WriteString(", FBTraceID: " + e.FBTraceID)
 		}
 
+		if e.IsTransient {
+			b.WriteString(", IsTransient: true")
+		}
+
 		return b.String()
 	}
 }
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package flows
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ivSize is the size of the initialization vectors of the requests, WhatsApp uses 16 bytes
+// nonces with AES-GCM rather than the standard 12.
+const ivSize = 16
+
+var (
+	ErrDecryption    = errors.New("flows: decryption failed")
+	ErrInvalidKey    = errors.New("flows: invalid private key")
+	errInvalidAESKey = errors.New("invalid aes key size")
+)
+
+type (
+	// EncryptedRequest is the body of a request of a flow. The flow data is encrypted with
+	// AES-GCM, with a key encrypted with the public key of the business with RSA-OAEP.
+	EncryptedRequest struct {
+		EncryptedFlowData string `json:"encrypted_flow_data"`
+		EncryptedAESKey   string `json:"encrypted_aes_key"`
+		InitialVector     string `json:"initial_vector"`
+	}
+
+	// Cipher encrypts the response of a request with the AES key and the initial vector of the
+	// request.
+	Cipher struct {
+		key []byte
+		iv  []byte
+	}
+)
+
+// ParsePrivateKey parses a PEM encoded RSA private key, in PKCS #1 or PKCS #8 form.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err) //nolint:errorlint
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not an RSA key", ErrInvalidKey, parsed)
+	}
+
+	return key, nil
+}
+
+// DecryptRequest decrypts the flow data of the request with the private key, and returns it
+// with the Cipher of the response. The errors match ErrDecryption.
+func DecryptRequest(privateKey *rsa.PrivateKey, request *EncryptedRequest) ([]byte, *Cipher, error) {
+	encryptedKey, err := base64.StdEncoding.DecodeString(request.EncryptedAESKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: aes key: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(request.InitialVector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: initial vector: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	data, err := base64.StdEncoding.DecodeString(request.EncryptedFlowData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: flow data: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: aes key: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	if len(iv) != gcm.NonceSize() {
+		return nil, nil, fmt.Errorf("%w: initial vector is %d bytes, want %d", ErrDecryption, len(iv),
+			gcm.NonceSize())
+	}
+
+	plaintext, err := gcm.Open(nil, iv, data, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: flow data: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	return plaintext, &Cipher{key: key, iv: iv}, nil
+}
+
+// EncryptRequest encrypts the flow data with a new AES key, encrypted with the public key, as
+// WhatsApp does. It is meant for testing the endpoints locally, with the returned Cipher to
+// decrypt the responses.
+func EncryptRequest(publicKey *rsa.PublicKey, flowData []byte) (*EncryptedRequest, *Cipher, error) {
+	key := make([]byte, 16) //nolint:gomnd
+	iv := make([]byte, ivSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("flows: encrypt request: %w", err)
+	}
+
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, fmt.Errorf("flows: encrypt request: %w", err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("flows: encrypt request: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("flows: encrypt request: %w", err)
+	}
+
+	return &EncryptedRequest{
+		EncryptedFlowData: base64.StdEncoding.EncodeToString(gcm.Seal(nil, iv, flowData, nil)),
+		EncryptedAESKey:   base64.StdEncoding.EncodeToString(encryptedKey),
+		InitialVector:     base64.StdEncoding.EncodeToString(iv),
+	}, &Cipher{key: key, iv: iv}, nil
+}
+
+// Encrypt encodes the response as JSON and encrypts it with the AES key of the request and
+// the bits of its initial vector flipped. It returns the base64 encoded ciphertext, the body
+// of the response.
+func (c *Cipher) Encrypt(response any) (string, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("flows: encrypt response: %w", err)
+	}
+
+	gcm, err := newGCM(c.key)
+	if err != nil {
+		return "", fmt.Errorf("flows: encrypt response: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nil, c.flippedIV(), data, nil)), nil
+}
+
+// Decrypt decrypts the body of a response encrypted by Encrypt and decodes it into v.
+func (c *Cipher) Decrypt(body string, v any) error {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return fmt.Errorf("%w: response: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	gcm, err := newGCM(c.key)
+	if err != nil {
+		return fmt.Errorf("%w: response: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	plaintext, err := gcm.Open(nil, c.flippedIV(), data, nil)
+	if err != nil {
+		return fmt.Errorf("%w: response: %v", ErrDecryption, err) //nolint:errorlint
+	}
+
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return fmt.Errorf("flows: decode response: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cipher) flippedIV() []byte {
+	flipped := make([]byte, len(c.iv))
+	for i, b := range c.iv {
+		flipped[i] = ^b
+	}
+
+	return flipped
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32: //nolint:gomnd
+	default:
+		return nil, fmt.Errorf("%w: %d", errInvalidAESKey, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return cipher.NewGCMWithNonceSize(block, ivSize) //nolint:wrapcheck
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package flows implements the data exchange endpoint of WhatsApp Flows. The Flows call the
+// endpoint when a screen needs data from the business, the requests and the responses are
+// encrypted with the keys of the business:
+//
+//	key, err := flows.ParsePrivateKey(pemBytes)
+//	handler := flows.NewHandler(key,
+//		flows.WithAppSecret(appSecret),
+//		flows.WithInit(func(ctx context.Context, request *flows.Request) (*flows.Response, error) {
+//			return &flows.Response{Screen: "APPOINTMENT", Data: map[string]any{"slots": slots}}, nil
+//		}),
+//		flows.WithDataExchange(exchange),
+//	)
+//	http.Handle("/flows", handler)
+//
+// The health checks, ping requests, are answered by the handler. EncryptRequest and the
+// returned Cipher encrypt the requests and decrypt the responses as WhatsApp does, to test
+// the endpoint locally with a generated key.
+package flows
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// Actions of the requests.
+const (
+	ActionPing         Action = "ping"
+	ActionInit         Action = "INIT"
+	ActionDataExchange Action = "data_exchange"
+	ActionBack         Action = "BACK"
+)
+
+// Status codes of the responses expected by WhatsApp. StatusDecryptionFailed makes the client
+// download the public key again, StatusInvalidFlowToken shows an error to the user.
+const (
+	StatusDecryptionFailed = http.StatusMisdirectedRequest
+	StatusInvalidFlowToken = 427
+	StatusInvalidSignature = 432
+)
+
+// SuccessScreen is the name of the screen of the response that closes the flow.
+const SuccessScreen = "SUCCESS"
+
+// MaxRequestSize is the largest request body, in bytes, read by the Handler. The requests of
+// WhatsApp are a few kilobytes, a larger body is answered with 413 Request Entity Too Large
+// before it is authenticated or decrypted.
+const MaxRequestSize = 1 << 20
+
+var (
+	ErrInvalidSignature = errors.New("flows: invalid signature")
+	ErrInvalidFlowToken = errors.New("flows: invalid flow token")
+	ErrUnknownAction    = errors.New("flows: unknown action")
+	ErrNoHandler        = errors.New("flows: no handler for the action")
+	ErrNoResponse       = errors.New("flows: no response")
+)
+
+type (
+	// Action is the action of a request, the reason the endpoint is called.
+	Action string
+
+	// Request is a decrypted request. Screen is the screen that made the request and Data its
+	// data, that DecodeData decodes.
+	Request struct {
+		Version   string          `json:"version"`
+		Action    Action          `json:"action"`
+		Screen    string          `json:"screen,omitempty"`
+		Data      json.RawMessage `json:"data,omitempty"`
+		FlowToken string          `json:"flow_token,omitempty"`
+	}
+
+	// ErrorNotification is the data of a request that notifies the endpoint that the client
+	// could not handle a previous response. It is sent with the INIT or data_exchange action,
+	// and its data has the error and error_message fields only.
+	ErrorNotification struct {
+		Error        string `json:"error"`
+		ErrorKey     string `json:"error_key,omitempty"`
+		ErrorMessage string `json:"error_message,omitempty"`
+	}
+
+	// Response is the response to a request, the next screen and its data.
+	Response struct {
+		Screen string `json:"screen,omitempty"`
+		Data   any    `json:"data"`
+	}
+
+	// HandlerFunc handles the requests of an action. Returning ErrInvalidFlowToken responds
+	// with StatusInvalidFlowToken, returning a nil response responds with an internal error.
+	HandlerFunc func(ctx context.Context, request *Request) (*Response, error)
+
+	// ErrorNotificationHandler handles the error notifications, which are acknowledged.
+	ErrorNotificationHandler func(ctx context.Context, request *Request, notification *ErrorNotification) error
+
+	// FlowTokenValidator validates the flow token of the requests, but for pings. Returning an
+	// error responds with StatusInvalidFlowToken.
+	FlowTokenValidator func(ctx context.Context, flowToken string) error
+
+	// ErrorHook is called with the errors of the requests, before the error response is sent.
+	ErrorHook func(ctx context.Context, request *http.Request, err error)
+
+	// Handler is the http.Handler of the data exchange endpoint.
+	Handler struct {
+		privateKey *rsa.PrivateKey
+		secret     string
+		handlers   map[Action]HandlerFunc
+		onError    ErrorNotificationHandler
+		validate   FlowTokenValidator
+		errorHook  ErrorHook
+	}
+
+	HandlerOption func(handler *Handler)
+)
+
+// DecodeData decodes the data of the request into v.
+func (request *Request) DecodeData(v any) error {
+	if len(request.Data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(request.Data, v); err != nil {
+		return fmt.Errorf("flows: decode data: %w", err)
+	}
+
+	return nil
+}
+
+// ErrorNotification returns the error notification of the request, nil if the request is
+// not one. The data of a screen that has an error field is not a notification, the data of
+// a notification has no other fields.
+func (request *Request) ErrorNotification() *ErrorNotification {
+	if request.Action != ActionInit && request.Action != ActionDataExchange {
+		return nil
+	}
+
+	var notification ErrorNotification
+	decoder := json.NewDecoder(bytes.NewReader(request.Data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&notification); err != nil {
+		return nil
+	}
+
+	if notification.Error == "" || notification.ErrorMessage == "" {
+		return nil
+	}
+
+	return &notification
+}
+
+// CloseFlow returns the response that closes the flow with the flow token, and sends the
+// parameters to the business in the message of the flow response.
+func CloseFlow(flowToken string, params map[string]any) *Response {
+	if params == nil {
+		params = make(map[string]any)
+	}
+	params["flow_token"] = flowToken
+
+	return &Response{
+		Screen: SuccessScreen,
+		Data: map[string]any{
+			"extension_message_response": map[string]any{"params": params},
+		},
+	}
+}
+
+// WithAppSecret validates the X-Hub-Signature-256 signature of the requests with the app
+// secret, as webhooks.ValidateSignature.
+func WithAppSecret(secret string) HandlerOption {
+	return func(handler *Handler) {
+		handler.secret = secret
+	}
+}
+
+// WithInit sets the handler of the requests made when the flow is opened.
+func WithInit(fn HandlerFunc) HandlerOption {
+	return func(handler *Handler) {
+		handler.handlers[ActionInit] = fn
+	}
+}
+
+// WithDataExchange sets the handler of the requests made when a screen is submitted.
+func WithDataExchange(fn HandlerFunc) HandlerOption {
+	return func(handler *Handler) {
+		handler.handlers[ActionDataExchange] = fn
+	}
+}
+
+// WithBack sets the handler of the requests made when the user goes back to a screen that
+// refreshes on back.
+func WithBack(fn HandlerFunc) HandlerOption {
+	return func(handler *Handler) {
+		handler.handlers[ActionBack] = fn
+	}
+}
+
+// WithErrorNotification sets the handler of the error notifications.
+func WithErrorNotification(fn ErrorNotificationHandler) HandlerOption {
+	return func(handler *Handler) {
+		handler.onError = fn
+	}
+}
+
+// WithFlowTokenValidator sets the validator of the flow tokens.
+func WithFlowTokenValidator(validate FlowTokenValidator) HandlerOption {
+	return func(handler *Handler) {
+		handler.validate = validate
+	}
+}
+
+// WithErrorHook sets the hook called with the errors of the requests, to log them for example.
+func WithErrorHook(hook ErrorHook) HandlerOption {
+	return func(handler *Handler) {
+		handler.errorHook = hook
+	}
+}
+
+// NewHandler returns a Handler that decrypts the requests with the private key.
+func NewHandler(privateKey *rsa.PrivateKey, options ...HandlerOption) *Handler {
+	handler := &Handler{
+		privateKey: privateKey,
+		handlers:   make(map[Action]HandlerFunc),
+	}
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// ServeHTTP decrypts the request, calls the handler of its action and responds with the
+// encrypted response.
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	body, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, MaxRequestSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		handler.fail(writer, request, status, fmt.Errorf("flows: read request: %w", err))
+
+		return
+	}
+
+	if handler.secret != "" {
+		signature, _ := webhooks.ExtractSignatureFromHeader(request.Header)
+		if !webhooks.ValidateSignature(body, signature, handler.secret) {
+			handler.fail(writer, request, StatusInvalidSignature, ErrInvalidSignature)
+
+			return
+		}
+	}
+
+	var encrypted EncryptedRequest
+	if err := json.Unmarshal(body, &encrypted); err != nil {
+		handler.fail(writer, request, http.StatusBadRequest, fmt.Errorf("flows: decode request: %w", err))
+
+		return
+	}
+
+	data, cipher, err := DecryptRequest(handler.privateKey, &encrypted)
+	if err != nil {
+		handler.fail(writer, request, StatusDecryptionFailed, err)
+
+		return
+	}
+
+	var flowRequest Request
+	if err := json.Unmarshal(data, &flowRequest); err != nil {
+		handler.fail(writer, request, http.StatusBadRequest, fmt.Errorf("flows: decode flow data: %w", err))
+
+		return
+	}
+
+	response, err := handler.handle(ctx, &flowRequest)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidFlowToken):
+			status = StatusInvalidFlowToken
+		case errors.Is(err, ErrUnknownAction):
+			status = http.StatusBadRequest
+		}
+		handler.fail(writer, request, status, err)
+
+		return
+	}
+
+	encryptedResponse, err := cipher.Encrypt(response)
+	if err != nil {
+		handler.fail(writer, request, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write([]byte(encryptedResponse))
+}
+
+// handle dispatches the request to the handler of its action.
+func (handler *Handler) handle(ctx context.Context, request *Request) (*Response, error) {
+	if request.Action == ActionPing {
+		return &Response{Data: map[string]string{"status": "active"}}, nil
+	}
+
+	if handler.validate != nil {
+		if err := handler.validate(ctx, request.FlowToken); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFlowToken, err) //nolint:errorlint
+		}
+	}
+
+	if notification := request.ErrorNotification(); notification != nil {
+		if handler.onError != nil {
+			if err := handler.onError(ctx, request, notification); err != nil {
+				return nil, fmt.Errorf("flows: error notification: %w", err)
+			}
+		}
+
+		return &Response{Data: map[string]bool{"acknowledged": true}}, nil
+	}
+
+	switch request.Action {
+	case ActionInit, ActionDataExchange, ActionBack:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAction, request.Action)
+	}
+
+	fn, ok := handler.handlers[request.Action]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoHandler, request.Action)
+	}
+
+	response, err := fn(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("flows: %s: %w", request.Action, err)
+	}
+
+	if response == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoResponse, request.Action)
+	}
+
+	return response, nil
+}
+
+func (handler *Handler) fail(writer http.ResponseWriter, request *http.Request, status int, err error) {
+	if handler.errorHook != nil {
+		handler.errorHook(request.Context(), request, err)
+	}
+	writer.WriteHeader(status)
+}
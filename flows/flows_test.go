@@ -0,0 +1,326 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package flows
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	const secret = "app-secret"
+	var notified *ErrorNotification
+	handler := NewHandler(key,
+		WithAppSecret(secret),
+		WithFlowTokenValidator(func(_ context.Context, flowToken string) error {
+			if flowToken != "token" {
+				return errors.New("expired")
+			}
+
+			return nil
+		}),
+		WithInit(func(_ context.Context, request *Request) (*Response, error) {
+			if request.Screen == "EMPTY" {
+				return nil, nil //nolint:nilnil
+			}
+
+			return &Response{Screen: "DETAILS", Data: map[string]any{"name": "init"}}, nil
+		}),
+		WithDataExchange(func(_ context.Context, request *Request) (*Response, error) {
+			var data struct {
+				Name string `json:"name"`
+			}
+			if err := request.DecodeData(&data); err != nil {
+				return nil, err
+			}
+
+			return CloseFlow(request.FlowToken, map[string]any{"name": data.Name}), nil
+		}),
+		WithErrorNotification(func(_ context.Context, _ *Request, notification *ErrorNotification) error {
+			notified = notification
+
+			return nil
+		}),
+	)
+
+	tests := []struct {
+		name       string
+		request    string
+		publicKey  *rsa.PublicKey
+		signature  string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "ping",
+			request:    `{"version":"3.0","action":"ping"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"status":"active"}}`,
+		},
+		{
+			name:       "init",
+			request:    `{"version":"3.0","action":"INIT","flow_token":"token"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"screen":"DETAILS","data":{"name":"init"}}`,
+		},
+		{
+			name: "data exchange",
+			request: `{"version":"3.0","action":"data_exchange","screen":"DETAILS","flow_token":"token",` +
+				`"data":{"name":"Pius"}}`,
+			wantStatus: http.StatusOK,
+			want: `{"screen":"SUCCESS","data":{"extension_message_response":{"params":` +
+				`{"flow_token":"token","name":"Pius"}}}}`,
+		},
+		{
+			name:       "back without handler",
+			request:    `{"version":"3.0","action":"BACK","flow_token":"token"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "error notification",
+			request: `{"version":"3.0","action":"data_exchange","flow_token":"token",` +
+				`"data":{"error":"invalid-screen-transition","error_message":"no such screen"}}`,
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"acknowledged":true}}`,
+		},
+		{
+			name: "screen data with an error field",
+			request: `{"version":"3.0","action":"data_exchange","screen":"DETAILS","flow_token":"token",` +
+				`"data":{"name":"Pius","error":"none"}}`,
+			wantStatus: http.StatusOK,
+			want: `{"screen":"SUCCESS","data":{"extension_message_response":{"params":` +
+				`{"flow_token":"token","name":"Pius"}}}}`,
+		},
+		{
+			name:       "nil response",
+			request:    `{"version":"3.0","action":"INIT","screen":"EMPTY","flow_token":"token"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "invalid flow token",
+			request:    `{"version":"3.0","action":"INIT","flow_token":"old"}`,
+			wantStatus: StatusInvalidFlowToken,
+		},
+		{
+			name:       "unknown action",
+			request:    `{"version":"3.0","action":"CLOSE","flow_token":"token"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "encrypted with another key",
+			request:    `{"version":"3.0","action":"ping"}`,
+			publicKey:  &otherKey.PublicKey,
+			wantStatus: StatusDecryptionFailed,
+		},
+		{
+			name:       "invalid signature",
+			request:    `{"version":"3.0","action":"ping"}`,
+			signature:  "sha256=00",
+			wantStatus: StatusInvalidSignature,
+		},
+		{
+			name:       "too large",
+			request:    `{"version":"3.0","action":"ping","data":{"pad":"` + strings.Repeat("a", MaxRequestSize) + `"}}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			publicKey := &key.PublicKey
+			if tt.publicKey != nil {
+				publicKey = tt.publicKey
+			}
+
+			encrypted, cipher, err := EncryptRequest(publicKey, []byte(tt.request))
+			if err != nil {
+				t.Fatalf("EncryptRequest() error = %v", err)
+			}
+
+			body, _ := json.Marshal(encrypted)
+			request := httptest.NewRequest(http.MethodPost, "/flows", bytes.NewReader(body))
+			signature := tt.signature
+			if signature == "" {
+				mac := hmac.New(sha256.New, []byte(secret))
+				mac.Write(body)
+				signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			}
+			request.Header.Set(webhooks.SignatureHeaderKey, signature)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tt.want == "" {
+				return
+			}
+
+			var response json.RawMessage
+			if err := cipher.Decrypt(recorder.Body.String(), &response); err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+
+			if string(response) != tt.want {
+				t.Errorf("response = %s, want %s", response, tt.want)
+			}
+		})
+	}
+
+	t.Cleanup(func() {
+		if notified == nil || notified.Error != "invalid-screen-transition" {
+			t.Errorf("error notification = %+v, want invalid-screen-transition", notified)
+		}
+	})
+}
+
+func TestRequest_ErrorNotification(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		request string
+		want    *ErrorNotification
+	}{
+		{
+			name: "data exchange",
+			request: `{"action":"data_exchange","data":{"error":"invalid-screen-transition",` +
+				`"error_message":"no such screen"}}`,
+			want: &ErrorNotification{Error: "invalid-screen-transition", ErrorMessage: "no such screen"},
+		},
+		{
+			name:    "init with error key",
+			request: `{"action":"INIT","data":{"error":"e","error_key":"k","error_message":"m"}}`,
+			want:    &ErrorNotification{Error: "e", ErrorKey: "k", ErrorMessage: "m"},
+		},
+		{
+			name:    "screen data with an error field",
+			request: `{"action":"data_exchange","data":{"error":"e","error_message":"m","name":"Pius"}}`,
+		},
+		{
+			name:    "error without a message",
+			request: `{"action":"data_exchange","data":{"error":"e"}}`,
+		},
+		{
+			name:    "not a string",
+			request: `{"action":"data_exchange","data":{"error":true,"error_message":"m"}}`,
+		},
+		{
+			name:    "back",
+			request: `{"action":"BACK","data":{"error":"e","error_message":"m"}}`,
+		},
+		{
+			name:    "no data",
+			request: `{"action":"INIT"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var request Request
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			got := request.ErrorNotification()
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ErrorNotification() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "pkcs1",
+			data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		},
+		{
+			name: "pkcs8",
+			data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		{
+			name:    "not pem",
+			data:    []byte("key"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parsed, err := ParsePrivateKey(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !parsed.Equal(key) {
+				t.Errorf("ParsePrivateKey() returned a different key")
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 
@@ -41,6 +42,8 @@ type (
 	// It contains Payload which is an interface that can be used to pass any data type
 	// to the Send function. Payload is expected to be a struct that can be marshalled
 	// to json, or a slice of bytes or an io.Reader.
+	// Retry is the optional RetryPolicy applied by Send, a nil Retry means the request is
+	// sent only once.
 	Request struct {
 		Context *RequestContext
 		Method  string
@@ -49,6 +52,7 @@ type (
 		Bearer  string
 		Form    map[string]string
 		Payload any
+		Retry   *RetryPolicy
 	}
 
 	RequestOption func(*Request)
@@ -156,7 +160,6 @@ func NewRequestWithContext(ctx context.Context, request *Request) (*http.Request
 			form.Add(key, value)
 		}
 		body = strings.NewReader(form.Encode())
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	} else if request.Payload != nil {
 		rdr, err := extractPayloadFromRequest(request.Payload)
 		if err != nil {
@@ -177,6 +180,10 @@ func NewRequestWithContext(ctx context.Context, request *Request) (*http.Request
 		return nil, fmt.Errorf("failed to create new request: %w", err)
 	}
 
+	if request.Form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
 	// Set the request headers
 	if request.Headers != nil {
 		for key, value := range request.Headers {
@@ -228,15 +235,49 @@ func extractPayloadFromRequest(payload interface{}) (io.Reader, error) {
 	return nil, nil
 }
 
+// Send sends the request and decodes the response body into v. If the request has a RetryPolicy
+// the request is retried on transient failures as described by the policy. The hooks are executed
+// for every response received.
 func Send(ctx context.Context, client *http.Client, request *Request, v any, hooks ...ResponseHook) error {
+	attempts := request.Retry.attempts(request)
+	for i := 1; ; i++ {
+		outcome, err := send(ctx, client, request, v, hooks...)
+		if i >= attempts || !request.Retry.retryable(ctx, request, outcome, err) {
+			return err
+		}
+
+		if serr := sleep(ctx, request.Retry.delay(outcome, i)); serr != nil {
+			return fmt.Errorf("http send: retry aborted: %w: %w", serr, err)
+		}
+
+		if terr := throttle(ctx); terr != nil {
+			return fmt.Errorf("http send: retry aborted: %w: %w", terr, err)
+		}
+	}
+}
+
+// send makes a single attempt to send the request.
+func send(ctx context.Context, client *http.Client, request *Request, v any, hooks ...ResponseHook) (
+	*attempt, error,
+) {
+	outcome := &attempt{}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				outcome.written.Store(true)
+			}
+		},
+	})
 	req, err := NewRequestWithContext(ctx, request)
 	if err != nil {
-		return fmt.Errorf("http send: %w", err)
+		return outcome, fmt.Errorf("http send: %w", err)
 	}
 
 	response, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("http send: %w", err)
+		outcome.transport = true
+
+		return outcome, fmt.Errorf("http send: %w", err)
 	}
 	defer func() {
 		if response != nil && response.Body != nil {
@@ -246,14 +287,16 @@ func Send(ctx context.Context, client *http.Client, request *Request, v any, hoo
 
 	defer executeResponseHooks(ctx, response, hooks)
 
+	outcome.status, outcome.header = response.StatusCode, response.Header
+
 	if response.Body == nil && v == nil {
-		return nil
+		return outcome, nil
 	}
 
 	buff := new(bytes.Buffer)
 	_, err = io.Copy(buff, response.Body)
 	if err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("http send: %w", err)
+		return outcome, fmt.Errorf("http send: %w", err)
 	}
 	bodyBytes := buff.Bytes()
 
@@ -262,28 +305,34 @@ func Send(ctx context.Context, client *http.Client, request *Request, v any, hoo
 	// check the status code and the body to determine if there is an error
 	isResponseOk := response.StatusCode >= 200 && response.StatusCode <= 299
 	bodyIsEmpty := len(bodyBytes) == 0
+	if !isResponseOk && bodyIsEmpty {
+		return outcome, &ResponseError{Code: response.StatusCode}
+	}
+
 	if !isResponseOk && !bodyIsEmpty {
 		var errResponse ResponseError
 		if err = json.NewDecoder(bytes.NewBuffer(bodyBytes)).Decode(&errResponse); err != nil {
-			return fmt.Errorf("http send: status (%d): body (%s): %w", response.StatusCode, string(bodyBytes), err)
+			return outcome, fmt.Errorf("http send: status (%d): body (%s): %w",
+				response.StatusCode, string(bodyBytes), err)
 		}
 		errResponse.Code = response.StatusCode
 
-		return &errResponse
+		return outcome, &errResponse
 	}
 
 	// Response is OK and the body is available
 	if isResponseOk && !bodyIsEmpty {
 		if v != nil {
 			if err = json.NewDecoder(bytes.NewBuffer(bodyBytes)).Decode(v); err != nil {
-				return fmt.Errorf("http send: status (%d): body (%s): %w", response.StatusCode, string(bodyBytes), err)
+				return outcome, fmt.Errorf("http send: status (%d): body (%s): %w",
+					response.StatusCode, string(bodyBytes), err)
 			}
 
-			return nil
+			return outcome, nil
 		}
 	}
 
-	return nil
+	return outcome, nil
 }
 
 type ResponseError struct {
@@ -214,3 +214,26 @@ func TestJoinUrlParts(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRequestWithContext_Form(t *testing.T) {
+	t.Parallel()
+	request := &Request{
+		Context: &RequestContext{Name: "register", BaseURL: BaseURL, ApiVersion: "v16.0", Endpoints: []string{"code"}},
+		Method:  http.MethodPost,
+		Headers: map[string]string{"Accept": "application/json"},
+		Form:    map[string]string{"code_method": "SMS", "language": "en_US"},
+	}
+
+	req, err := NewRequestWithContext(context.Background(), request)
+	if err != nil {
+		t.Fatalf("NewRequestWithContext() error = %v", err)
+	}
+
+	if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q, want application/x-www-form-urlencoded", got)
+	}
+
+	if err := req.ParseForm(); err != nil || req.PostForm.Get("code_method") != "SMS" {
+		t.Errorf("form = %v, %v, want code_method=SMS", req.PostForm, err)
+	}
+}
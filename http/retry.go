@@ -0,0 +1,314 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts made by DefaultRetryPolicy, the first
+	// attempt included.
+	DefaultMaxAttempts = 3
+
+	// DefaultInitialBackoff is the delay before the first retry of DefaultRetryPolicy.
+	DefaultInitialBackoff = 500 * time.Millisecond
+
+	// DefaultMaxBackoff is the upper bound of the computed backoff of DefaultRetryPolicy.
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// DefaultRetryableErrorCodes are the Graph API error codes that are considered transient. They
+// are retried by a RetryPolicy that does not specify its own RetryableErrorCodes.
+//
+//   - 1 API Unknown, possibly a temporary issue due to downtime.
+//   - 2 API Service, temporary issue due to downtime.
+//   - 4 API Too Many Calls, the app has reached its API call rate limit.
+//   - 17 API User Too Many Calls, the app has reached its API call rate limit.
+//   - 80007 Rate limit issues, the WhatsApp Business Account has reached its rate limit.
+//   - 130429 Rate limit hit, Cloud API message throughput has been reached.
+//   - 131000 Something went wrong, message failed to send because of an unknown error.
+//   - 131016 Service unavailable, a service is temporarily unavailable.
+//   - 131056 Pair rate limit hit, too many messages sent from the sender to the same recipient.
+//   - 133004 Server temporarily unavailable.
+var DefaultRetryableErrorCodes = []int{ //nolint:gochecknoglobals
+	1, 2, 4, 17, 80007, 130429, 131000, 131016, 131056, 133004,
+}
+
+// unprocessedErrorCodes are the retryable error codes that confirm the request was rejected
+// before it was processed: the rate limits and the unavailable services.
+var unprocessedErrorCodes = []int{ //nolint:gochecknoglobals
+	4, 17, 80007, 130429, 131016, 131056, 133004,
+}
+
+// RetryPolicy describes how Send retries a request that failed with a transient error.
+//
+// A request is retried when the transport fails before a response is received, when the
+// response status is 429 or 5xx, or when the Graph API error returned has a code listed in
+// RetryableErrorCodes or is flagged as transient by the API. Any other error is returned
+// immediately.
+//
+// The delay between attempts grows exponentially from InitialBackoff by Multiplier up to
+// MaxBackoff, and is randomized by Jitter which is a fraction (0 to 1) of the delay. When
+// the response carries a Retry-After header its value is used instead of the computed delay.
+// Waiting is aborted as soon as the request context is done.
+//
+// The delay of a Retry-After header is capped by MaxBackoff as well.
+//
+// Requests whose payload is an io.Reader can not be replayed, so they are sent once. Multipart
+// requests (media uploads) are not idempotent, each successful attempt creates a new media
+// object, so they are only retried when RetryUploads is true. For the same reason a transport
+// failure after a POST request was written, when the request may have reached the API but its
+// response was lost, is not retried: retrying a message send would deliver it twice. Only the
+// failures to connect and to write the request are retried for the non-idempotent methods.
+// A 5xx response to a non-idempotent request can be sent after the request was processed as
+// well, so it is only retried when its error is flagged as transient or its code confirms that
+// the request was not processed, like the rate limit codes. A 429 response is always retried.
+//
+// The retries of a request sent with a context returned by WithThrottle wait for its throttle
+// first, so that the retries of the rate limit errors honor a client side rate limiter.
+type RetryPolicy struct {
+	MaxAttempts         int
+	InitialBackoff      time.Duration
+	MaxBackoff          time.Duration
+	Multiplier          float64
+	Jitter              float64
+	RetryableErrorCodes []int
+	RetryUploads        bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy that makes up to DefaultMaxAttempts attempts,
+// starting with a DefaultInitialBackoff delay that doubles on each retry up to DefaultMaxBackoff.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:         DefaultMaxAttempts,
+		InitialBackoff:      DefaultInitialBackoff,
+		MaxBackoff:          DefaultMaxBackoff,
+		Multiplier:          2,
+		Jitter:              0.2,
+		RetryableErrorCodes: DefaultRetryableErrorCodes,
+		RetryUploads:        false,
+	}
+}
+
+// attempts returns the number of attempts allowed for the request.
+func (policy *RetryPolicy) attempts(request *Request) int {
+	if policy == nil || policy.MaxAttempts <= 1 || request == nil {
+		return 1
+	}
+
+	if _, ok := request.Payload.(io.Reader); ok {
+		return 1
+	}
+
+	if isMultipartRequest(request) && !policy.RetryUploads {
+		return 1
+	}
+
+	return policy.MaxAttempts
+}
+
+// backoff returns the delay before the retry that follows the given attempt. Attempts are
+// counted from 1.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		jitter := math.Min(policy.Jitter, 1)
+		delay += delay * jitter * (2*rand.Float64() - 1) //nolint:gosec
+	}
+
+	return time.Duration(delay)
+}
+
+// delay returns the delay before the retry that follows the given attempt, the delay of the
+// Retry-After header of the response if any.
+func (policy *RetryPolicy) delay(outcome *attempt, attempt int) time.Duration {
+	delay, ok := retryAfter(outcome.header, time.Now())
+	if !ok {
+		return policy.backoff(attempt)
+	}
+
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+
+	return delay
+}
+
+// retryable reports whether the outcome of an attempt of the request is worth another attempt.
+func (policy *RetryPolicy) retryable(ctx context.Context, request *Request, outcome *attempt, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	if outcome.transport {
+		if outcome.written.Load() && !isIdempotent(request.Method) {
+			return false
+		}
+
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	if outcome.status == http.StatusTooManyRequests {
+		return true
+	}
+
+	// a non-idempotent request answered with a 5xx may have been processed all the same
+	replayable := outcome.status < http.StatusInternalServerError || isIdempotent(request.Method)
+	if replayable && outcome.status >= http.StatusInternalServerError {
+		return true
+	}
+
+	var re *ResponseError
+	if !errors.As(err, &re) || re.Err == nil {
+		return false
+	}
+
+	if re.Err.IsTransient {
+		return true
+	}
+
+	codes := policy.RetryableErrorCodes
+	if codes == nil {
+		codes = DefaultRetryableErrorCodes
+	}
+
+	return hasCode(codes, re.Err.Code) && (replayable || hasCode(unprocessedErrorCodes, re.Err.Code))
+}
+
+func hasCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// attempt is the outcome of a single request made by Send.
+type attempt struct {
+	status    int
+	header    http.Header
+	transport bool        // true if no response was received
+	written   atomic.Bool // true if the request was written to the connection
+}
+
+type throttleKey struct{}
+
+// WithThrottle returns a context that makes Send wait for the throttle before each retry of
+// the requests sent with it. The first attempt is not throttled, it is up to the caller.
+func WithThrottle(ctx context.Context, throttle func(ctx context.Context) error) context.Context {
+	return context.WithValue(ctx, throttleKey{}, throttle)
+}
+
+// throttle waits for the throttle of the context, if any.
+func throttle(ctx context.Context) error {
+	fn, ok := ctx.Value(throttleKey{}).(func(ctx context.Context) error)
+	if !ok || fn == nil {
+		return nil
+	}
+
+	return fn(ctx)
+}
+
+// retryAfter parses the Retry-After header which can either be a number of seconds
+// or an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+
+	return 0, true
+}
+
+// sleep waits for the given duration or until the context is done.
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isIdempotent reports whether requests with the method can be sent again safely.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, "":
+		return true
+	default:
+		return false
+	}
+}
+
+func isMultipartRequest(request *Request) bool {
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, "Content-Type") &&
+			strings.HasPrefix(strings.ToLower(value), "multipart/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,379 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer returns a server that responds with the given status codes and bodies in turn
+// and then with 200 OK. It returns the number of requests it received.
+func flakyServer(t *testing.T, header http.Header, statuses []int, bodies []string) (*httptest.Server, *int32) {
+	t.Helper()
+	var count int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&count, 1)) - 1
+		if n >= len(statuses) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"name":"Pius Alfred","age":77,"male":true}`))
+
+			return
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[n])
+		_, _ = w.Write([]byte(bodies[n]))
+	})
+
+	return httptest.NewServer(handler), &count
+}
+
+func TestSend_Retry(t *testing.T) {
+	t.Parallel()
+	policy := &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	tests := []struct {
+		name      string
+		policy    *RetryPolicy
+		method    string
+		headers   map[string]string
+		payload   any
+		statuses  []int
+		bodies    []string
+		wantErr   bool
+		wantCalls int32
+	}{
+		{
+			name:      "no policy",
+			policy:    nil,
+			statuses:  []int{http.StatusServiceUnavailable},
+			bodies:    []string{""},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "server errors then success",
+			policy:    policy,
+			method:    http.MethodGet,
+			statuses:  []int{http.StatusInternalServerError, http.StatusBadGateway},
+			bodies:    []string{"", ""},
+			wantErr:   false,
+			wantCalls: 3,
+		},
+		{
+			name:      "server error to a post",
+			policy:    policy,
+			statuses:  []int{http.StatusInternalServerError},
+			bodies:    []string{""},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:     "server error to a post with an unknown error code",
+			policy:   policy,
+			statuses: []int{http.StatusInternalServerError},
+			bodies: []string{
+				`{"error":{"message":"(#131000) Something went wrong","code":131000}}`,
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:     "server error to a post with a rate limit code",
+			policy:   policy,
+			statuses: []int{http.StatusServiceUnavailable},
+			bodies: []string{
+				`{"error":{"message":"(#130429) Rate limit hit","code":130429}}`,
+			},
+			wantErr:   false,
+			wantCalls: 2,
+		},
+		{
+			name:     "server error to a post flagged as transient",
+			policy:   policy,
+			statuses: []int{http.StatusInternalServerError},
+			bodies: []string{
+				`{"error":{"message":"Service temporarily unavailable","code":9999,"is_transient":true}}`,
+			},
+			wantErr:   false,
+			wantCalls: 2,
+		},
+		{
+			name:     "transient graph error code",
+			policy:   policy,
+			statuses: []int{http.StatusBadRequest},
+			bodies: []string{
+				`{"error":{"message":"(#131056) Pair rate limit hit","code":131056}}`,
+			},
+			wantErr:   false,
+			wantCalls: 2,
+		},
+		{
+			name:     "error flagged as transient",
+			policy:   policy,
+			statuses: []int{http.StatusBadRequest},
+			bodies: []string{
+				`{"error":{"message":"Service temporarily unavailable","code":9999,"is_transient":true}}`,
+			},
+			wantErr:   false,
+			wantCalls: 2,
+		},
+		{
+			name:     "permanent graph error code",
+			policy:   policy,
+			statuses: []int{http.StatusBadRequest},
+			bodies: []string{
+				`{"error":{"message":"(#131030) Recipient phone number not in allowed list","code":131030}}`,
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:   "attempts exhausted",
+			policy: policy,
+			statuses: []int{
+				http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests,
+			},
+			bodies:    []string{"", "", ""},
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name:      "uploads are not retried",
+			policy:    policy,
+			headers:   map[string]string{"Content-Type": "multipart/form-data; boundary=xyz"},
+			payload:   []byte("--xyz--"),
+			statuses:  []int{http.StatusServiceUnavailable},
+			bodies:    []string{""},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "readers are not retried",
+			policy:    policy,
+			payload:   strings.NewReader(`{"name":"Pius Alfred"}`),
+			statuses:  []int{http.StatusServiceUnavailable},
+			bodies:    []string{""},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server, calls := flakyServer(t, nil, tt.statuses, tt.bodies)
+			defer server.Close()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			request := &Request{
+				Context: &RequestContext{Name: "test", BaseURL: server.URL},
+				Method:  method,
+				Headers: tt.headers,
+				Payload: tt.payload,
+				Retry:   tt.policy,
+			}
+
+			var user User
+			err := Send(context.TODO(), http.DefaultClient, request, &user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("Send() made %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSend_RetryAfter(t *testing.T) {
+	t.Parallel()
+	header := http.Header{"Retry-After": []string{"1"}}
+	server, _ := flakyServer(t, header, []int{http.StatusTooManyRequests}, []string{""})
+	defer server.Close()
+
+	request := &Request{
+		Context: &RequestContext{Name: "test", BaseURL: server.URL},
+		Method:  http.MethodGet,
+		Retry:   &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := Send(ctx, http.DefaultClient, request, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send() error = %v, want retry aborted by context", err)
+	}
+
+	var re *ResponseError
+	if !errors.As(err, &re) || re.Code != http.StatusTooManyRequests {
+		t.Errorf("Send() error = %v, want the last response error", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "empty", value: "", want: 0, wantOk: false},
+		{name: "seconds", value: "120", want: 2 * time.Minute, wantOk: true},
+		{name: "date", value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOk: true},
+		{name: "invalid", value: "soon", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := retryAfter(http.Header{"Retry-After": []string{tt.value}}, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("retryAfter() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestSend_RetryTransportErrors(t *testing.T) {
+	t.Parallel()
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		method    string
+		written   bool
+		wantCalls int32
+	}{
+		{name: "post lost after it was written", method: http.MethodPost, written: true, wantCalls: 1},
+		{name: "get lost after it was written", method: http.MethodGet, written: true, wantCalls: 3},
+		{name: "post that failed to connect", method: http.MethodPost, written: false, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+			}))
+			defer server.Close()
+
+			client := server.Client()
+			if !tt.written {
+				client = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+					atomic.AddInt32(&calls, 1)
+
+					return nil, errors.New("dial tcp: connection refused")
+				})}
+			}
+
+			request := &Request{
+				Context: &RequestContext{Name: "test", BaseURL: server.URL},
+				Method:  tt.method,
+				Payload: []byte(`{"to":"255700000000"}`),
+				Retry:   policy,
+			}
+
+			if err := Send(context.Background(), client, request, nil); err == nil {
+				t.Fatalf("Send() error = nil, want the transport error")
+			}
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("Send() made %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return fn(request)
+}
+
+func TestSend_RetryThrottleAndMaxBackoff(t *testing.T) {
+	t.Parallel()
+	header := http.Header{"Retry-After": []string{"60"}}
+	server, calls := flakyServer(t, header, []int{http.StatusTooManyRequests, http.StatusTooManyRequests},
+		[]string{"", ""})
+	defer server.Close()
+
+	request := &Request{
+		Context: &RequestContext{Name: "test", BaseURL: server.URL},
+		Method:  http.MethodPost,
+		Retry:   &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+	}
+
+	var throttled int32
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = WithThrottle(ctx, func(context.Context) error {
+		atomic.AddInt32(&throttled, 1)
+
+		return nil
+	})
+
+	if err := Send(ctx, http.DefaultClient, request, nil); err != nil {
+		t.Fatalf("Send() error = %v, want the Retry-After delay capped by MaxBackoff", err)
+	}
+
+	if got, want := atomic.LoadInt32(&throttled), atomic.LoadInt32(calls)-1; got != want {
+		t.Errorf("throttle called %d times, want once per retry (%d)", got, want)
+	}
+
+	limited := errors.New("rate limited")
+	server2, calls2 := flakyServer(t, nil, []int{http.StatusTooManyRequests}, []string{""})
+	defer server2.Close()
+	request.Context.BaseURL = server2.URL
+	err := Send(WithThrottle(context.Background(), func(context.Context) error { return limited }),
+		http.DefaultClient, request, nil)
+	if !errors.Is(err, limited) || atomic.LoadInt32(calls2) != 1 {
+		t.Errorf("Send() error = %v after %d calls, want the throttle error before the retry", err,
+			atomic.LoadInt32(calls2))
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/piusalfred/whatsapp/mediastore"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+var ErrNoMediaInfo = errors.New("inbound media: message has no media")
+
+type (
+	// OnMediaStoredHook is called with the object of a media received in a message once it
+	// has been saved to the store.
+	OnMediaStoredHook func(ctx context.Context, nctx *webhooks.NotificationContext,
+		mctx *webhooks.MessageContext, object *mediastore.Object) error
+
+	// MediaKeyFunc returns the key the media described by the metadata is saved under.
+	MediaKeyFunc func(metadata *mediastore.Metadata) string
+
+	// MediaClientFunc returns the client that downloads the media of a notification, for
+	// example Registry.ClientFor when the listener receives the notifications of many
+	// phone numbers.
+	MediaClientFunc func(nctx *webhooks.NotificationContext) (*Client, error)
+
+	InboundMediaOption func(*InboundMedia)
+
+	// InboundMedia downloads the media received in messages and saves it to a store. The
+	// media is downloaded as soon as the message is received, before it expires, and
+	// verified against its sha256 digest before it is saved.
+	//
+	//	store, err := mediastore.NewFileStore("media")
+	//	inbound := whatsapp.NewInboundMedia(client, store, func(ctx context.Context,
+	//		nctx *webhooks.NotificationContext, mctx *webhooks.MessageContext, object *mediastore.Object,
+	//	) error {
+	//		log.Printf("media of message %s saved to %s", mctx.ID, object.Location)
+	//		return nil
+	//	})
+	//	inbound.Attach(listener)
+	InboundMedia struct {
+		clientFor MediaClientFunc
+		store     mediastore.Store
+		hook      OnMediaStoredHook
+		key       MediaKeyFunc
+		tempDir   string
+	}
+)
+
+// NewInboundMedia returns an InboundMedia that downloads the media with the client, saves
+// it to the store and calls the hook, which can be nil, with the saved object.
+func NewInboundMedia(client *Client, store mediastore.Store, hook OnMediaStoredHook,
+	options ...InboundMediaOption,
+) *InboundMedia {
+	inbound := &InboundMedia{
+		clientFor: func(*webhooks.NotificationContext) (*Client, error) { return client, nil },
+		store:     store,
+		hook:      hook,
+		key:       DefaultMediaKey,
+	}
+
+	for _, option := range options {
+		option(inbound)
+	}
+
+	return inbound
+}
+
+// WithMediaKey sets the function that returns the keys the media is saved under, the
+// default is DefaultMediaKey.
+func WithMediaKey(key MediaKeyFunc) InboundMediaOption {
+	return func(inbound *InboundMedia) {
+		inbound.key = key
+	}
+}
+
+// WithMediaClientFunc sets the function that returns the client of a notification, it
+// replaces the client passed to NewInboundMedia.
+func WithMediaClientFunc(clientFor MediaClientFunc) InboundMediaOption {
+	return func(inbound *InboundMedia) {
+		inbound.clientFor = clientFor
+	}
+}
+
+// WithMediaTempDir sets the directory the media is downloaded to before it is saved, the
+// default is os.TempDir.
+func WithMediaTempDir(dir string) InboundMediaOption {
+	return func(inbound *InboundMedia) {
+		inbound.tempDir = dir
+	}
+}
+
+// DefaultMediaKey returns phone_number_id/from/media_id followed by the extension of the
+// MIME type of the media.
+func DefaultMediaKey(metadata *mediastore.Metadata) string {
+	return path.Join(metadata.PhoneNumberID, metadata.From, metadata.MediaID+MediaExtension(metadata.MimeType))
+}
+
+// Attach subscribes Hook to the messages received by the listener. It is called for the
+// messages of every media type, whether or not the listener also has a hook for the type, like
+// OnImageMessage, or an OnMediaMessage hook.
+func (inbound *InboundMedia) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	return listener.OnMessageReceived(func(ctx context.Context, nctx *webhooks.NotificationContext,
+		message *webhooks.Message,
+	) error {
+		mediaType := webhooks.ParseMessageType(message.Type)
+		media := message.Media(mediaType)
+		if media == nil {
+			return nil
+		}
+
+		return inbound.Hook(ctx, nctx, &webhooks.MessageContext{
+			From:      message.From,
+			ID:        message.ID,
+			Timestamp: message.Timestamp,
+			Type:      message.Type,
+			Ctx:       message.Context,
+		}, mediaType, media)
+	})
+}
+
+// Hook is a webhooks.OnMediaMessageHook that saves the media of the message to the store
+// and then calls the OnMediaStoredHook.
+func (inbound *InboundMedia) Hook(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, _ webhooks.MessageType, media *models.MediaInfo,
+) error {
+	object, err := inbound.Save(ctx, nctx, mctx, media)
+	if err != nil {
+		return err
+	}
+
+	if inbound.hook == nil {
+		return nil
+	}
+
+	return inbound.hook(ctx, nctx, mctx, object)
+}
+
+// Save downloads the media of the message and saves it to the store.
+func (inbound *InboundMedia) Save(ctx context.Context, nctx *webhooks.NotificationContext,
+	mctx *webhooks.MessageContext, media *models.MediaInfo,
+) (*mediastore.Object, error) {
+	if media == nil || media.ID == "" {
+		return nil, ErrNoMediaInfo
+	}
+
+	client, err := inbound.clientFor(nctx)
+	if err != nil {
+		return nil, fmt.Errorf("inbound media: %w", err)
+	}
+
+	file, err := os.CreateTemp(inbound.tempDir, "whatsapp-media-*")
+	if err != nil {
+		return nil, fmt.Errorf("inbound media: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	downloaded, err := client.DownloadMediaTo(ctx, media.ID, file)
+	if err != nil {
+		return nil, fmt.Errorf("inbound media: %w", err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("inbound media: %w", err)
+	}
+
+	metadata := &mediastore.Metadata{
+		MediaID:  media.ID,
+		MimeType: downloaded.MimeType,
+		Sha256:   downloaded.Sha256,
+		Size:     downloaded.Size,
+		Filename: media.Filename,
+		Caption:  media.Caption,
+	}
+
+	if mctx != nil {
+		metadata.MessageID, metadata.From = mctx.ID, mctx.From
+		metadata.Type, metadata.Timestamp = mctx.Type, mctx.Timestamp
+	}
+
+	if nctx != nil && nctx.Metadata != nil {
+		metadata.PhoneNumberID = nctx.Metadata.PhoneNumberID
+	}
+
+	object, err := inbound.store.Put(ctx, inbound.key(metadata), metadata, file)
+	if err != nil {
+		return nil, fmt.Errorf("inbound media: %w", err)
+	}
+
+	return object, nil
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piusalfred/whatsapp/mediastore"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestInboundMedia(t *testing.T) {
+	t.Parallel()
+	data := []byte("\xff\xd8\xff\xe0 photo")
+	sum := sha256.Sum256(data)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/v16.0/", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&Media{
+			MessagingProduct: "whatsapp",
+			URL:              server.URL + "/download",
+			MimeType:         "image/jpeg",
+			Sha256:           hex.EncodeToString(sum[:]),
+			FileSize:         int64(len(data)),
+			ID:               strings.TrimPrefix(r.URL.Path, "/v16.0/"),
+		})
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	})
+	client := NewClient(WithBaseURL(server.URL), WithAccessToken("token"))
+
+	dir := t.TempDir()
+	store, err := mediastore.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	var stored *mediastore.Object
+	inbound := NewInboundMedia(client, store, func(_ context.Context, _ *webhooks.NotificationContext,
+		_ *webhooks.MessageContext, object *mediastore.Object,
+	) error {
+		stored = object
+
+		return nil
+	})
+	listener := webhooks.NewEventListener()
+	imageHook := false
+	listener.OnImageMessage(func(context.Context, *webhooks.NotificationContext, *webhooks.MessageContext,
+		*models.MediaInfo,
+	) error {
+		imageHook = true
+
+		return nil
+	})
+	inbound.Attach(listener)
+
+	body, _ := json.Marshal(&webhooks.Notification{
+		Object: "whatsapp_business_account",
+		Entry: []*webhooks.Entry{{ID: "WABA_ID", Changes: []*webhooks.Change{{
+			Field: "messages",
+			Value: &webhooks.Value{
+				MessagingProduct: "whatsapp",
+				Metadata:         &webhooks.Metadata{PhoneNumberID: "phone_number_id"},
+				Messages: []*webhooks.Message{{
+					From: "255712345678", ID: "wamid.1", Timestamp: "1700000000", Type: "image",
+					Image: &models.MediaInfo{ID: "5678", Caption: "receipt", MimeType: "image/jpeg"},
+				}},
+			},
+		}}}},
+	})
+	recorder := httptest.NewRecorder()
+	listener.NotificationHandler().ServeHTTP(recorder,
+		httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusOK || stored == nil || !imageHook {
+		t.Fatalf("status = %d, stored = %v, image hook called = %v, want 200, a stored object and the hook called",
+			recorder.Code, stored, imageHook)
+	}
+
+	want := filepath.Join(dir, "phone_number_id", "255712345678", "5678.jpg")
+	if stored.Location != want || stored.Key != "phone_number_id/255712345678/5678.jpg" {
+		t.Errorf("stored at %s with key %s, want %s", stored.Location, stored.Key, want)
+	}
+
+	metadata := stored.Metadata
+	if metadata.MessageID != "wamid.1" || metadata.Type != "image" || metadata.Caption != "receipt" ||
+		metadata.Size != int64(len(data)) || metadata.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	content, err := os.ReadFile(want)
+	if err != nil || !bytes.Equal(content, data) {
+		t.Errorf("stored content = %q, %v, want %q", content, err, data)
+	}
+
+	if _, err := os.Stat(want + ".json"); err != nil {
+		t.Errorf("metadata file: %v", err)
+	}
+}
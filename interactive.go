@@ -0,0 +1,680 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	whttp "github.com/piusalfred/whatsapp/http"
+	"github.com/piusalfred/whatsapp/models"
+)
+
+// Limits of interactive messages as documented by the Cloud API. The lengths are in characters.
+const (
+	MaxInteractiveBodyLength           = 1024
+	MaxInteractiveFooterLength         = 60
+	MaxInteractiveHeaderTextLength     = 60
+	MaxInteractiveButtons              = 3
+	MaxInteractiveButtonTitleLength    = 20
+	MaxInteractiveButtonIDLength       = 256
+	MaxInteractiveListButtonLength     = 20
+	MaxInteractiveSections             = 10
+	MaxInteractiveSectionTitleLength   = 24
+	MaxInteractiveRows                 = 10
+	MaxInteractiveRowIDLength          = 200
+	MaxInteractiveRowTitleLength       = 24
+	MaxInteractiveRowDescriptionLength = 72
+	MaxInteractiveProducts             = 30
+	MaxInteractiveCTADisplayTextLength = 20
+)
+
+var ErrInvalidInteractiveMessage = errors.New("invalid interactive message")
+
+type SendInteractiveRequest struct {
+	BaseURL       string
+	AccessToken   string
+	PhoneNumberID string
+	ApiVersion    string
+	Recipient     string
+	Interactive   *models.Interactive
+	RetryPolicy   *whttp.RetryPolicy
+}
+
+/*
+SendInteractive sends an interactive message to the recipient. The message is checked with
+ValidateInteractive before the request is made.
+
+Interactive messages are reply buttons (type button), list messages (type list), single product
+messages (type product), multi-product messages (type product_list) and call-to-action URL button
+messages (type cta_url).
+
+Sample request of reply buttons:
+
+	curl -X  POST \
+	 'https://graph.facebook.com/v16.0/FROM_PHONE_NUMBER_ID/messages' \
+	 -H 'Authorization: Bearer ACCESS_TOKEN' \
+	 -H 'Content-Type: application/json' \
+	 -d '{
+	  "messaging_product": "whatsapp",
+	  "recipient_type": "individual",
+	  "to": "PHONE_NUMBER",
+	  "type": "interactive",
+	  "interactive": {
+	    "type": "button",
+	    "body": {
+	      "text": "BUTTON_TEXT"
+	    },
+	    "action": {
+	      "buttons": [
+	        {
+	          "type": "reply",
+	          "reply": {
+	            "id": "UNIQUE_BUTTON_ID_1",
+	            "title": "BUTTON_TITLE_1"
+	          }
+	        }
+	      ]
+	    }
+	  }
+	}'
+*/
+func SendInteractive(ctx context.Context, client *http.Client, req *SendInteractiveRequest) (*ResponseMessage, error) {
+	if req == nil {
+		return nil, fmt.Errorf("send interactive: %w", ErrNilRequest)
+	}
+
+	if err := ValidateInteractive(req.Interactive); err != nil {
+		return nil, fmt.Errorf("send interactive: %w", err)
+	}
+
+	interactive := &models.Message{
+		Product:       "whatsapp",
+		To:            req.Recipient,
+		RecipientType: "individual",
+		Type:          InteractiveMessageType,
+		Interactive:   req.Interactive,
+	}
+
+	reqCtx := &whttp.RequestContext{
+		Name:       "send interactive",
+		BaseURL:    req.BaseURL,
+		ApiVersion: req.ApiVersion,
+		SenderID:   req.PhoneNumberID,
+		Endpoints:  []string{"messages"},
+	}
+
+	params := &whttp.Request{
+		Context: reqCtx,
+		Method:  http.MethodPost,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Bearer:  req.AccessToken,
+		Payload: interactive,
+		Retry:   req.RetryPolicy,
+	}
+
+	var message ResponseMessage
+	err := whttp.Send(ctx, client, params, &message)
+	if err != nil {
+		return nil, fmt.Errorf("send interactive: %w", err)
+	}
+
+	return &message, nil
+}
+
+// ValidateInteractive checks the interactive message against the limits documented by the
+// Cloud API, so that an invalid message is rejected before the request is made. The returned
+// error wraps ErrInvalidInteractiveMessage and describes the first violation found.
+func ValidateInteractive(interactive *models.Interactive) error {
+	if interactive == nil {
+		return fmt.Errorf("%w: interactive is nil", ErrInvalidInteractiveMessage)
+	}
+
+	if interactive.Action == nil {
+		return fmt.Errorf("%w: action is required", ErrInvalidInteractiveMessage)
+	}
+
+	if err := validateInteractiveBodyAndFooter(interactive); err != nil {
+		return err
+	}
+
+	switch interactive.Type {
+	case models.InteractiveMessageButton:
+		return validateReplyButtons(interactive)
+	case models.InteractiveMessageList:
+		return validateList(interactive)
+	case models.InteractiveMessageProduct:
+		return validateProduct(interactive)
+	case models.InteractiveMessageProductList:
+		return validateProductList(interactive)
+	case models.InteractiveMessageCTAURL:
+		return validateCTAURL(interactive)
+	default:
+		return fmt.Errorf("%w: unsupported type %q", ErrInvalidInteractiveMessage, interactive.Type)
+	}
+}
+
+func validateInteractiveBodyAndFooter(interactive *models.Interactive) error {
+	if interactive.Body == nil || interactive.Body.Text == "" {
+		if interactive.Type != models.InteractiveMessageProduct {
+			return fmt.Errorf("%w: body text is required for type %q", ErrInvalidInteractiveMessage,
+				interactive.Type)
+		}
+	} else if err := checkLength("body text", interactive.Body.Text, MaxInteractiveBodyLength); err != nil {
+		return err
+	}
+
+	if interactive.Footer != nil {
+		if err := checkLength("footer text", interactive.Footer.Text, MaxInteractiveFooterLength); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateInteractiveHeader checks the header against the header types allowed.
+func validateInteractiveHeader(header *models.InteractiveHeader, allowed ...string) error {
+	if header == nil {
+		return nil
+	}
+
+	found := false
+	for _, t := range allowed {
+		if header.Type == t {
+			found = true
+
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: header type %q is not allowed, use one of %s", ErrInvalidInteractiveMessage,
+			header.Type, strings.Join(allowed, ", "))
+	}
+
+	var media *models.Media
+	switch header.Type {
+	case "text":
+		if header.Text == "" {
+			return fmt.Errorf("%w: header text is required", ErrInvalidInteractiveMessage)
+		}
+
+		return checkLength("header text", header.Text, MaxInteractiveHeaderTextLength)
+	case "image":
+		media = header.Image
+	case "video":
+		media = header.Video
+	case "document":
+		media = header.Document
+	}
+
+	if media == nil || (media.ID == "" && media.Link == "") {
+		return fmt.Errorf("%w: %s header requires a media id or link", ErrInvalidInteractiveMessage, header.Type)
+	}
+
+	return nil
+}
+
+func validateReplyButtons(interactive *models.Interactive) error {
+	if err := validateInteractiveHeader(interactive.Header, "text", "image", "video", "document"); err != nil {
+		return err
+	}
+
+	buttons := interactive.Action.Buttons
+	if len(buttons) == 0 || len(buttons) > MaxInteractiveButtons {
+		return fmt.Errorf("%w: reply buttons message has %d buttons, want 1 to %d",
+			ErrInvalidInteractiveMessage, len(buttons), MaxInteractiveButtons)
+	}
+
+	ids := make(map[string]bool, len(buttons))
+	titles := make(map[string]bool, len(buttons))
+	for i, button := range buttons {
+		if button == nil {
+			return fmt.Errorf("%w: button %d is nil", ErrInvalidInteractiveMessage, i)
+		}
+
+		if button.Type != "reply" {
+			return fmt.Errorf("%w: button %d has type %q, want reply", ErrInvalidInteractiveMessage, i, button.Type)
+		}
+
+		id, title := button.ID, button.Title
+		if button.Reply != nil {
+			id, title = button.Reply.ID, button.Reply.Title
+		}
+
+		if err := checkRequired(fmt.Sprintf("button %d title", i), title, MaxInteractiveButtonTitleLength); err != nil {
+			return err
+		}
+
+		if err := checkRequired(fmt.Sprintf("button %d id", i), id, MaxInteractiveButtonIDLength); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(id) != id {
+			return fmt.Errorf("%w: button %d id %q has leading or trailing spaces", ErrInvalidInteractiveMessage, i, id)
+		}
+
+		if ids[id] || titles[title] {
+			return fmt.Errorf("%w: button %d id and title must be unique", ErrInvalidInteractiveMessage, i)
+		}
+		ids[id], titles[title] = true, true
+	}
+
+	return nil
+}
+
+func validateList(interactive *models.Interactive) error {
+	if err := validateInteractiveHeader(interactive.Header, "text"); err != nil {
+		return err
+	}
+
+	action := interactive.Action
+	if err := checkRequired("list button", action.Button, MaxInteractiveListButtonLength); err != nil {
+		return err
+	}
+
+	if err := checkSections(action.Sections); err != nil {
+		return err
+	}
+
+	rows := 0
+	ids := make(map[string]bool)
+	for i, section := range action.Sections {
+		if len(section.Rows) == 0 {
+			return fmt.Errorf("%w: section %d has no rows", ErrInvalidInteractiveMessage, i)
+		}
+
+		for j, row := range section.Rows {
+			rows++
+			if row == nil {
+				return fmt.Errorf("%w: section %d row %d is nil", ErrInvalidInteractiveMessage, i, j)
+			}
+
+			name := fmt.Sprintf("section %d row %d", i, j)
+			if err := checkRequired(name+" id", row.ID, MaxInteractiveRowIDLength); err != nil {
+				return err
+			}
+
+			if err := checkRequired(name+" title", row.Title, MaxInteractiveRowTitleLength); err != nil {
+				return err
+			}
+
+			if err := checkLength(name+" description", row.Description, MaxInteractiveRowDescriptionLength); err != nil {
+				return err
+			}
+
+			if ids[row.ID] {
+				return fmt.Errorf("%w: %s id %q is not unique", ErrInvalidInteractiveMessage, name, row.ID)
+			}
+			ids[row.ID] = true
+		}
+	}
+
+	if rows > MaxInteractiveRows {
+		return fmt.Errorf("%w: list message has %d rows, maximum is %d", ErrInvalidInteractiveMessage,
+			rows, MaxInteractiveRows)
+	}
+
+	return nil
+}
+
+func validateProduct(interactive *models.Interactive) error {
+	if interactive.Header != nil {
+		return fmt.Errorf("%w: single product message can not have a header", ErrInvalidInteractiveMessage)
+	}
+
+	if interactive.Action.CatalogID == "" || interactive.Action.ProductRetailerID == "" {
+		return fmt.Errorf("%w: single product message requires catalog id and product retailer id",
+			ErrInvalidInteractiveMessage)
+	}
+
+	return nil
+}
+
+func validateProductList(interactive *models.Interactive) error {
+	if interactive.Header == nil {
+		return fmt.Errorf("%w: multi-product message requires a header", ErrInvalidInteractiveMessage)
+	}
+
+	if err := validateInteractiveHeader(interactive.Header, "text"); err != nil {
+		return err
+	}
+
+	action := interactive.Action
+	if action.CatalogID == "" {
+		return fmt.Errorf("%w: multi-product message requires catalog id", ErrInvalidInteractiveMessage)
+	}
+
+	if err := checkSections(action.Sections); err != nil {
+		return err
+	}
+
+	products := 0
+	for i, section := range action.Sections {
+		if len(section.ProductItems) == 0 {
+			return fmt.Errorf("%w: section %d has no products", ErrInvalidInteractiveMessage, i)
+		}
+
+		for j, product := range section.ProductItems {
+			if product == nil || product.RetailerID == "" {
+				return fmt.Errorf("%w: section %d product %d requires a product retailer id",
+					ErrInvalidInteractiveMessage, i, j)
+			}
+		}
+		products += len(section.ProductItems)
+	}
+
+	if products > MaxInteractiveProducts {
+		return fmt.Errorf("%w: multi-product message has %d products, maximum is %d",
+			ErrInvalidInteractiveMessage, products, MaxInteractiveProducts)
+	}
+
+	return nil
+}
+
+func validateCTAURL(interactive *models.Interactive) error {
+	if err := validateInteractiveHeader(interactive.Header, "text", "image", "video", "document"); err != nil {
+		return err
+	}
+
+	action := interactive.Action
+	if action.Name != models.InteractiveMessageCTAURL {
+		return fmt.Errorf("%w: cta url action name is %q, want %q", ErrInvalidInteractiveMessage,
+			action.Name, models.InteractiveMessageCTAURL)
+	}
+
+	if action.Parameters == nil {
+		return fmt.Errorf("%w: cta url action requires parameters", ErrInvalidInteractiveMessage)
+	}
+
+	displayText := action.Parameters.DisplayText
+	if err := checkRequired("cta display text", displayText, MaxInteractiveCTADisplayTextLength); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(action.Parameters.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: cta url %q is not a valid http(s) url", ErrInvalidInteractiveMessage,
+			action.Parameters.URL)
+	}
+
+	return nil
+}
+
+// checkSections checks the number of sections and their titles which are required when
+// there is more than one section.
+func checkSections(sections []*models.InteractiveSection) error {
+	if len(sections) == 0 || len(sections) > MaxInteractiveSections {
+		return fmt.Errorf("%w: message has %d sections, want 1 to %d", ErrInvalidInteractiveMessage,
+			len(sections), MaxInteractiveSections)
+	}
+
+	for i, section := range sections {
+		if section == nil {
+			return fmt.Errorf("%w: section %d is nil", ErrInvalidInteractiveMessage, i)
+		}
+
+		if len(sections) > 1 && section.Title == "" {
+			return fmt.Errorf("%w: section %d title is required when there is more than one section",
+				ErrInvalidInteractiveMessage, i)
+		}
+
+		name := fmt.Sprintf("section %d title", i)
+		if err := checkLength(name, section.Title, MaxInteractiveSectionTitleLength); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkRequired(name, value string, maxLength int) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s is required", ErrInvalidInteractiveMessage, name)
+	}
+
+	return checkLength(name, value, maxLength)
+}
+
+func checkLength(name, value string, maxLength int) error {
+	if n := utf8.RuneCountInString(value); n > maxLength {
+		return fmt.Errorf("%w: %s is %d characters long, maximum is %d", ErrInvalidInteractiveMessage,
+			name, n, maxLength)
+	}
+
+	return nil
+}
+
+type (
+	// ReplyButtonsMessage is an interactive message with up to 3 reply buttons. The Header is
+	// optional and can be of type text, image, video or document.
+	ReplyButtonsMessage struct {
+		Header  *models.InteractiveHeader
+		Body    string
+		Footer  string
+		Buttons []*models.InteractiveReplyButton
+	}
+
+	// ListMessage is an interactive message with a menu of up to 10 rows grouped in sections.
+	// Button is the text of the button that opens the menu.
+	ListMessage struct {
+		Header   string
+		Body     string
+		Footer   string
+		Button   string
+		Sections []*models.InteractiveSection
+	}
+
+	// ProductMessage is an interactive message about a single product of a catalog.
+	ProductMessage struct {
+		Body              string
+		Footer            string
+		CatalogID         string
+		ProductRetailerID string
+	}
+
+	// ProductListMessage is an interactive message with up to 30 products of a catalog
+	// grouped in sections.
+	ProductListMessage struct {
+		Header    string
+		Body      string
+		Footer    string
+		CatalogID string
+		Sections  []*models.InteractiveSection
+	}
+
+	// CTAURLMessage is an interactive message with a call-to-action button that opens URL.
+	CTAURLMessage struct {
+		Header      *models.InteractiveHeader
+		Body        string
+		Footer      string
+		DisplayText string
+		URL         string
+	}
+)
+
+// Interactive returns the models.Interactive of the reply buttons message.
+func (m *ReplyButtonsMessage) Interactive() *models.Interactive {
+	buttons := make([]*models.InteractiveButton, 0, len(m.Buttons))
+	for _, button := range m.Buttons {
+		buttons = append(buttons, &models.InteractiveButton{Type: "reply", Reply: button})
+	}
+
+	return &models.Interactive{
+		Type:   models.InteractiveMessageButton,
+		Action: &models.InteractiveAction{Buttons: buttons},
+		Body:   interactiveBody(m.Body),
+		Footer: interactiveFooter(m.Footer),
+		Header: m.Header,
+	}
+}
+
+// Interactive returns the models.Interactive of the list message.
+func (m *ListMessage) Interactive() *models.Interactive {
+	return &models.Interactive{
+		Type: models.InteractiveMessageList,
+		Action: &models.InteractiveAction{
+			Button:   m.Button,
+			Sections: m.Sections,
+		},
+		Body:   interactiveBody(m.Body),
+		Footer: interactiveFooter(m.Footer),
+		Header: interactiveTextHeader(m.Header),
+	}
+}
+
+// Interactive returns the models.Interactive of the single product message.
+func (m *ProductMessage) Interactive() *models.Interactive {
+	return &models.Interactive{
+		Type: models.InteractiveMessageProduct,
+		Action: &models.InteractiveAction{
+			CatalogID:         m.CatalogID,
+			ProductRetailerID: m.ProductRetailerID,
+		},
+		Body:   interactiveBody(m.Body),
+		Footer: interactiveFooter(m.Footer),
+	}
+}
+
+// Interactive returns the models.Interactive of the multi-product message.
+func (m *ProductListMessage) Interactive() *models.Interactive {
+	return &models.Interactive{
+		Type: models.InteractiveMessageProductList,
+		Action: &models.InteractiveAction{
+			CatalogID: m.CatalogID,
+			Sections:  m.Sections,
+		},
+		Body:   interactiveBody(m.Body),
+		Footer: interactiveFooter(m.Footer),
+		Header: interactiveTextHeader(m.Header),
+	}
+}
+
+// Interactive returns the models.Interactive of the call-to-action URL message.
+func (m *CTAURLMessage) Interactive() *models.Interactive {
+	return &models.Interactive{
+		Type: models.InteractiveMessageCTAURL,
+		Action: &models.InteractiveAction{
+			Name: models.InteractiveMessageCTAURL,
+			Parameters: &models.InteractiveActionParameters{
+				DisplayText: m.DisplayText,
+				URL:         m.URL,
+			},
+		},
+		Body:   interactiveBody(m.Body),
+		Footer: interactiveFooter(m.Footer),
+		Header: m.Header,
+	}
+}
+
+func interactiveBody(text string) *models.InteractiveBody {
+	if text == "" {
+		return nil
+	}
+
+	return &models.InteractiveBody{Text: text}
+}
+
+func interactiveFooter(text string) *models.InteractiveFooter {
+	if text == "" {
+		return nil
+	}
+
+	return &models.InteractiveFooter{Text: text}
+}
+
+func interactiveTextHeader(text string) *models.InteractiveHeader {
+	if text == "" {
+		return nil
+	}
+
+	return &models.InteractiveHeader{Type: "text", Text: text}
+}
+
+// SendInteractiveMessage sends an interactive message to the recipient. The message is
+// validated before the request is made and before the rate limiter is consulted.
+func (client *Client) SendInteractiveMessage(ctx context.Context, recipient string,
+	interactive *models.Interactive,
+) (*ResponseMessage, error) {
+	if err := ValidateInteractive(interactive); err != nil {
+		return nil, fmt.Errorf("failed to send interactive message: %w", err)
+	}
+
+	resp, err := client.sendMessage(ctx, recipient, "interactive",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &SendInteractiveRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Interactive:   interactive,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return SendInteractive(ctx, client.http, request)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send interactive message: %w", err)
+	}
+
+	return resp, nil
+}
+
+// SendReplyButtons sends an interactive message with reply buttons.
+func (client *Client) SendReplyButtons(ctx context.Context, recipient string, message *ReplyButtonsMessage) (
+	*ResponseMessage, error,
+) {
+	return client.SendInteractiveMessage(ctx, recipient, message.Interactive())
+}
+
+// SendList sends an interactive list message.
+func (client *Client) SendList(ctx context.Context, recipient string, message *ListMessage) (
+	*ResponseMessage, error,
+) {
+	return client.SendInteractiveMessage(ctx, recipient, message.Interactive())
+}
+
+// SendProduct sends an interactive single product message.
+func (client *Client) SendProduct(ctx context.Context, recipient string, message *ProductMessage) (
+	*ResponseMessage, error,
+) {
+	return client.SendInteractiveMessage(ctx, recipient, message.Interactive())
+}
+
+// SendProductList sends an interactive multi-product message.
+func (client *Client) SendProductList(ctx context.Context, recipient string, message *ProductListMessage) (
+	*ResponseMessage, error,
+) {
+	return client.SendInteractiveMessage(ctx, recipient, message.Interactive())
+}
+
+// SendCTAURL sends an interactive call-to-action URL button message.
+func (client *Client) SendCTAURL(ctx context.Context, recipient string, message *CTAURLMessage) (
+	*ResponseMessage, error,
+) {
+	return client.SendInteractiveMessage(ctx, recipient, message.Interactive())
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piusalfred/whatsapp/models"
+)
+
+func TestValidateInteractive(t *testing.T) {
+	t.Parallel()
+	buttons := func(n int) []*models.InteractiveReplyButton {
+		list := make([]*models.InteractiveReplyButton, 0, n)
+		for i := 0; i < n; i++ {
+			id := string(rune('a' + i))
+			list = append(list, &models.InteractiveReplyButton{ID: id, Title: "Title " + id})
+		}
+
+		return list
+	}
+	rows := func(n int) []*models.InteractiveSectionRow {
+		list := make([]*models.InteractiveSectionRow, 0, n)
+		for i := 0; i < n; i++ {
+			list = append(list, &models.InteractiveSectionRow{ID: string(rune('a' + i)), Title: "Row"})
+		}
+
+		return list
+	}
+	tests := []struct {
+		name        string
+		interactive *models.Interactive
+		wantErr     bool
+	}{
+		{
+			name:        "nil interactive",
+			interactive: nil,
+			wantErr:     true,
+		},
+		{
+			name: "valid reply buttons",
+			interactive: (&ReplyButtonsMessage{
+				Body:    "Pick one",
+				Buttons: buttons(3),
+			}).Interactive(),
+		},
+		{
+			name: "too many reply buttons",
+			interactive: (&ReplyButtonsMessage{
+				Body:    "Pick one",
+				Buttons: buttons(4),
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "duplicate reply button ids",
+			interactive: (&ReplyButtonsMessage{
+				Body: "Pick one",
+				Buttons: []*models.InteractiveReplyButton{
+					{ID: "yes", Title: "Yes"},
+					{ID: "yes", Title: "No"},
+				},
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "reply button title too long",
+			interactive: (&ReplyButtonsMessage{
+				Body:    "Pick one",
+				Buttons: []*models.InteractiveReplyButton{{ID: "1", Title: strings.Repeat("é", 21)}},
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "missing body",
+			interactive: (&ReplyButtonsMessage{
+				Buttons: buttons(1),
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "valid list",
+			interactive: (&ListMessage{
+				Header: "Menu",
+				Body:   "Choose",
+				Button: "Open",
+				Sections: []*models.InteractiveSection{
+					{Title: "First", Rows: rows(5)},
+				},
+			}).Interactive(),
+		},
+		{
+			name: "list with too many rows across sections",
+			interactive: (&ListMessage{
+				Body:   "Choose",
+				Button: "Open",
+				Sections: []*models.InteractiveSection{
+					{Title: "First", Rows: rows(6)},
+					{Title: "Second", Rows: rows(5)},
+				},
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "list sections without titles",
+			interactive: (&ListMessage{
+				Body:   "Choose",
+				Button: "Open",
+				Sections: []*models.InteractiveSection{
+					{Rows: rows(1)},
+					{Rows: []*models.InteractiveSectionRow{{ID: "z", Title: "Row"}}},
+				},
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "valid product",
+			interactive: (&ProductMessage{
+				CatalogID:         "catalog",
+				ProductRetailerID: "sku",
+			}).Interactive(),
+		},
+		{
+			name:        "product without catalog",
+			interactive: (&ProductMessage{ProductRetailerID: "sku"}).Interactive(),
+			wantErr:     true,
+		},
+		{
+			name: "valid product list",
+			interactive: (&ProductListMessage{
+				Header:    "Products",
+				Body:      "Our picks",
+				CatalogID: "catalog",
+				Sections: []*models.InteractiveSection{
+					{Title: "Shoes", ProductItems: []*models.Product{{RetailerID: "sku"}}},
+				},
+			}).Interactive(),
+		},
+		{
+			name: "product list without header",
+			interactive: (&ProductListMessage{
+				Body:      "Our picks",
+				CatalogID: "catalog",
+				Sections: []*models.InteractiveSection{
+					{Title: "Shoes", ProductItems: []*models.Product{{RetailerID: "sku"}}},
+				},
+			}).Interactive(),
+			wantErr: true,
+		},
+		{
+			name: "valid cta url",
+			interactive: (&CTAURLMessage{
+				Body:        "See the dates",
+				DisplayText: "See Dates",
+				URL:         "https://www.luckyshrub.com?clickID=kqDGWd24Q5TRwoEQTICY7W1JKoXvaZOXWAS7h1P76s0R7Paec4",
+			}).Interactive(),
+		},
+		{
+			name: "cta url with invalid url",
+			interactive: (&CTAURLMessage{
+				Body:        "See the dates",
+				DisplayText: "See Dates",
+				URL:         "luckyshrub",
+			}).Interactive(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateInteractive(tt.interactive)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateInteractive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidInteractiveMessage) {
+				t.Errorf("ValidateInteractive() error = %v, want %v", err, ErrInvalidInteractiveMessage)
+			}
+		})
+	}
+}
+
+func TestClient_SendReplyButtons(t *testing.T) {
+	t.Parallel()
+	var got models.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v16.0/224225226/messages" {
+			t.Errorf("path = %s, want /v16.0/224225226/messages", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","contacts":[{"input":"255767001828","wa_id":"255767001828"}],"messages":[{"id":"wamid.ID"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithBaseURL(server.URL),
+		WithVersion("v16.0"),
+		WithPhoneNumberID("224225226"),
+		WithAccessToken("token"),
+	)
+
+	resp, err := client.SendReplyButtons(context.TODO(), "255767001828", &ReplyButtonsMessage{
+		Body:    "Do you accept?",
+		Buttons: []*models.InteractiveReplyButton{{ID: "yes", Title: "Yes"}, {ID: "no", Title: "No"}},
+	})
+	if err != nil {
+		t.Fatalf("SendReplyButtons() error = %v", err)
+	}
+
+	if len(resp.Messages) != 1 || resp.Messages[0].ID != "wamid.ID" {
+		t.Errorf("SendReplyButtons() = %+v, want message id wamid.ID", resp)
+	}
+
+	if got.Type != InteractiveMessageType || got.Interactive == nil {
+		t.Fatalf("request type = %q, want %q", got.Type, InteractiveMessageType)
+	}
+
+	if btn := got.Interactive.Action.Buttons[1]; btn.Type != "reply" || btn.Reply == nil || btn.Reply.ID != "no" {
+		t.Errorf("request button = %+v, want reply button with id no", btn)
+	}
+
+	if _, err := client.SendReplyButtons(context.TODO(), "255767001828", &ReplyButtonsMessage{}); err == nil {
+		t.Errorf("SendReplyButtons() with no buttons error = nil, want error")
+	}
+}
@@ -20,15 +20,21 @@
 package whatsapp
 
 import (
-	"bytes"
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	whttp "github.com/piusalfred/whatsapp/http"
 )
@@ -205,22 +211,26 @@ type (
 
 // GetMedia retrieve the media object by using its corresponding media ID.
 func (client *Client) GetMedia(ctx context.Context, mediaID string) (*Media, error) {
-	reqCtx := &whttp.RequestContext{
-		Name:       "get media",
-		BaseURL:    client.baseURL,
-		ApiVersion: client.apiVersion,
-		Endpoints:  []string{mediaID},
-	}
-
-	params := &whttp.Request{
-		Context: reqCtx,
-		Method:  http.MethodGet,
-		Bearer:  client.accessToken,
-		Payload: nil,
-	}
-
-	media := new(Media)
-	err := whttp.Send(ctx, client.http, params, &media)
+	media, err := withToken(ctx, client, func(cctx *clientContext) (*Media, error) {
+		reqCtx := &whttp.RequestContext{
+			Name:       "get media",
+			BaseURL:    cctx.baseURL,
+			ApiVersion: cctx.apiVersion,
+			Endpoints:  []string{mediaID},
+		}
+
+		params := &whttp.Request{
+			Context: reqCtx,
+			Method:  http.MethodGet,
+			Bearer:  cctx.accessToken,
+			Payload: nil,
+			Retry:   cctx.retryPolicy,
+		}
+
+		media := new(Media)
+
+		return media, whttp.Send(ctx, client.http, params, &media)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("get media: %w", err)
 	}
@@ -230,55 +240,142 @@ func (client *Client) GetMedia(ctx context.Context, mediaID string) (*Media, err
 
 // DeleteMedia delete the media by using its corresponding media ID.
 func (client *Client) DeleteMedia(ctx context.Context, mediaID string) (*DeleteMediaResponse, error) {
-	reqCtx := &whttp.RequestContext{
-		Name:       "delete media",
-		BaseURL:    client.baseURL,
-		ApiVersion: client.apiVersion,
-		Endpoints:  []string{mediaID},
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*DeleteMediaResponse, error) {
+		reqCtx := &whttp.RequestContext{
+			Name:       "delete media",
+			BaseURL:    cctx.baseURL,
+			ApiVersion: cctx.apiVersion,
+			Endpoints:  []string{mediaID},
+		}
+
+		params := &whttp.Request{
+			Context: reqCtx,
+			Method:  http.MethodDelete,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Bearer:  cctx.accessToken,
+			Payload: nil,
+			Retry:   cctx.retryPolicy,
+		}
+
+		resp := new(DeleteMediaResponse)
+
+		return resp, whttp.Send(ctx, client.http, params, &resp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("delete media: %w", err)
 	}
 
-	params := &whttp.Request{
-		Context: reqCtx,
-		Method:  http.MethodDelete,
-		Headers: map[string]string{"Content-Type": "application/json"},
-		Bearer:  client.accessToken,
-		Payload: nil,
+	return resp, nil
+}
+
+// UploadMedia uploads the media read from fr and returns its ID. The multipart request body is
+// streamed as fr is read, so the media is never held in memory as a whole.
+//
+// The MIME type is the type of the filename extension when the Cloud API supports it for the
+// media type, otherwise it is detected from the first bytes of the media. The upload fails with
+// ErrMediaTooLarge as soon as more than MediaMaxAllowedSize bytes of the media type are read, or
+// before the request is made when the size of fr is known. Cancelling ctx aborts the upload.
+//
+// When the upload is rejected because the access token has expired it is retried with a refreshed
+// token only if fr is an io.Seeker, since the media has already been consumed.
+func (client *Client) UploadMedia(ctx context.Context, mediaType MediaType, filename string, fr io.Reader,
+	options ...UploadOption,
+) (*UploadMediaResponse, error) {
+	upload := &mediaUpload{
+		mediaType: mediaType,
+		filename:  filename,
+		limit:     int64(MediaMaxAllowedSize(mediaType)),
+		size:      readerSize(fr),
+	}
+	for _, option := range options {
+		option(upload)
 	}
 
-	resp := new(DeleteMediaResponse)
-	err := whttp.Send(ctx, client.http, params, &resp)
+	if upload.limit >= 0 && upload.size > upload.limit {
+		return nil, fmt.Errorf("upload media: %w: %d bytes, the limit for %s is %d bytes",
+			ErrMediaTooLarge, upload.size, mediaType, upload.limit)
+	}
+
+	seeker, _ := fr.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	attempts := 0
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*UploadMediaResponse, error) {
+		attempts++
+		if attempts > 1 {
+			if seeker == nil {
+				return nil, ErrUploadNotReplayable
+			}
+
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+		}
+
+		return client.uploadMedia(ctx, cctx, upload, fr)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("delete media: %w", err)
+		return nil, fmt.Errorf("upload media: %w", err)
 	}
 
 	return resp, nil
 }
 
-func (client *Client) UploadMedia(ctx context.Context, mediaType MediaType, filename string, fr io.Reader) (*UploadMediaResponse, error) {
-	payload, contentType, err := uploadMediaPayload(mediaType, filename, fr)
-	if err != nil {
-		return nil, err
+func (client *Client) uploadMedia(ctx context.Context, cctx *clientContext, upload *mediaUpload, fr io.Reader,
+) (*UploadMediaResponse, error) {
+	content := bufio.NewReaderSize(fr, sniffLen)
+	head, err := content.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("read media: %w", err)
 	}
+	mimeType := detectMimeType(upload.mediaType, upload.filename, head)
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		err := upload.write(ctx, writer, mimeType, content)
+		pw.CloseWithError(err)
+		done <- err
+	}()
 
 	reqCtx := &whttp.RequestContext{
 		Name:       "upload media",
-		BaseURL:    client.baseURL,
-		ApiVersion: client.apiVersion,
-		Endpoints:  []string{client.phoneNumberID, "media"},
+		BaseURL:    cctx.baseURL,
+		ApiVersion: cctx.apiVersion,
+		Endpoints:  []string{cctx.phoneNumberID, "media"},
 	}
 
 	params := &whttp.Request{
 		Context: reqCtx,
 		Method:  http.MethodPost,
-		Headers: map[string]string{"Content-Type": contentType},
-		Bearer:  client.accessToken,
-		Payload: payload,
+		Headers: map[string]string{"Content-Type": writer.FormDataContentType()},
+		Bearer:  cctx.accessToken,
+		Payload: io.Reader(pr),
+		Retry:   cctx.retryPolicy,
 	}
 
 	resp := new(UploadMediaResponse)
 	err = whttp.Send(ctx, client.http, params, &resp)
+
+	// unblock the writer if the request ended before the body was consumed.
+	cancel()
+	pr.CloseWithError(context.Canceled)
+	if werr := <-done; werr != nil && !errors.Is(werr, context.Canceled) && !errors.Is(werr, io.ErrClosedPipe) {
+		return nil, werr
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("upload media: %w", err)
+		return nil, err //nolint:wrapcheck
 	}
 
 	return resp, nil
@@ -286,70 +383,404 @@ func (client *Client) UploadMedia(ctx context.Context, mediaType MediaType, file
 
 // DownloadMedia downloads a media file from the given media ID.
 // It accepts a media url and returns a reader and an error.
+// The content is streamed to the reader as it is read and verified like in DownloadMediaTo,
+// a mismatch is returned by Read at the end of the content. The reader is an io.ReadCloser,
+// the download goes on until it is read to the end, closed or the context is done.
 func (client *Client) DownloadMedia(ctx context.Context, mediaID string) (io.Reader, error) {
-	media, err := client.GetMedia(ctx, mediaID)
+	pr, pw := io.Pipe()
+	writer := &firstWriteNotifier{w: pw, written: make(chan struct{})}
+	done, finished := make(chan error, 1), make(chan struct{})
+	go func() {
+		defer close(finished)
+		_, err := client.DownloadMediaTo(ctx, mediaID, writer)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	// a write blocked on a reader that is not read anymore ends with the context.
+	go func() {
+		select {
+		case <-ctx.Done():
+			pr.CloseWithError(ctx.Err())
+		case <-finished:
+		}
+	}()
+
+	// the errors that come before the content, like the failures to get the media, are
+	// returned here.
+	select {
+	case <-writer.written:
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pr, nil
+}
+
+// firstWriteNotifier closes written when the first write to w starts.
+type firstWriteNotifier struct {
+	w       io.Writer
+	once    sync.Once
+	written chan struct{}
+}
+
+func (n *firstWriteNotifier) Write(p []byte) (int, error) {
+	n.once.Do(func() { close(n.written) })
+
+	return n.w.Write(p) //nolint:wrapcheck
+}
+
+// DownloadMediaTo downloads the media to w. The content is streamed to w while its sha256 digest
+// and size are checked against the ones reported by GetMedia, a mismatch is reported with
+// ErrMediaChecksumMismatch or ErrMediaSizeMismatch once the whole content has been written.
+//
+// The download URL expires MediaDownloadLinkTTL after it has been retrieved. If the download
+// is refused before any content is written, the URL is retrieved again and the download retried.
+func (client *Client) DownloadMediaTo(ctx context.Context, mediaID string, w io.Writer) (*DownloadedMedia, error) {
+	var lastErr error
+	for attempt := 0; attempt < mediaDownloadAttempts; attempt++ {
+		media, err := client.GetMedia(ctx, mediaID)
+		if err != nil {
+			return nil, fmt.Errorf("download media: %w", err)
+		}
+
+		downloaded, err := client.downloadMedia(ctx, media, w)
+		if err == nil {
+			return downloaded, nil
+		}
+
+		if !errors.Is(err, errMediaLinkRefused) {
+			return nil, fmt.Errorf("download media: %w", err)
+		}
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("download media: %w", lastErr)
+}
+
+// DownloadMediaToFile downloads the media to the file at path. The content is written to a
+// temporary file in the same directory that is renamed to path only once it has been verified.
+func (client *Client) DownloadMediaToFile(ctx context.Context, mediaID, path string) (*DownloadedMedia, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, fmt.Errorf("download media: %w", err)
+	}
+	defer os.Remove(file.Name()) //nolint:errcheck
+
+	downloaded, err := client.DownloadMediaTo(ctx, mediaID, file)
+	if cerr := file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("download media: %w", cerr)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, media.URL, nil)
+	if err := os.Rename(file.Name(), path); err != nil {
+		return nil, fmt.Errorf("download media: %w", err)
+	}
+
+	return downloaded, nil
+}
+
+func (client *Client) downloadMedia(ctx context.Context, media *Media, w io.Writer) (*DownloadedMedia, error) {
+	cctx, err := client.context(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.accessToken))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, media.URL, nil)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cctx.accessToken))
 
 	resp, err := client.http.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, err //nolint:wrapcheck
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return nil, fmt.Errorf("%w: status %d", errMediaLinkRefused, resp.StatusCode)
+	default:
 		return nil, fmt.Errorf("failed to download media: status %d", resp.StatusCode)
 	}
 
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, resp.Body)
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, _ := body.Peek(sniffLen)
+	mimeType := media.MimeType
+	if mimeType == "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(head)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), body)
 	if err != nil {
-		return nil, err
+		return nil, err //nolint:wrapcheck
+	}
+
+	downloaded := &DownloadedMedia{
+		ID:        media.ID,
+		MimeType:  mimeType,
+		Extension: MediaExtension(mimeType),
+		Sha256:    hex.EncodeToString(hash.Sum(nil)),
+		Size:      size,
 	}
 
-	return buf, nil
+	if media.FileSize > 0 && size != media.FileSize {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d", ErrMediaSizeMismatch, size, media.FileSize)
+	}
+
+	if media.Sha256 != "" && !strings.EqualFold(downloaded.Sha256, media.Sha256) {
+		return nil, fmt.Errorf("%w: got %s, want %s", ErrMediaChecksumMismatch, downloaded.Sha256, media.Sha256)
+	}
+
+	return downloaded, nil
 }
 
-// uploadMediaPayload creates upload media request payload.
-// If nor error, payload content and request content type is returned.
-func uploadMediaPayload(mediaType MediaType, filename string, fr io.Reader) ([]byte, string, error) {
-	var payload bytes.Buffer
-	writer := multipart.NewWriter(&payload)
+// MediaExtension returns the filename extension, with the leading dot, of the MIME type. The
+// parameters of the type are ignored, "audio/ogg; codecs=opus" gives ".ogg". It returns an empty
+// string if the type has no known extension.
+func MediaExtension(mimeType string) string {
+	base, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
 
-	header := make(textproto.MIMEHeader)
-	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=file; filename="%s"`, filename))
+	if ext, ok := mediaExtensions[base]; ok {
+		return ext
+	}
+
+	if exts, err := mime.ExtensionsByType(base); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ""
+}
+
+// sniffLen is the number of bytes used to detect the MIME type of an upload.
+const sniffLen = 512
+
+// mediaDownloadAttempts is the number of times the download URL of a media is retrieved.
+const mediaDownloadAttempts = 2
+
+var (
+	ErrMediaTooLarge         = errors.New("media exceeds the maximum allowed size")
+	ErrUploadNotReplayable   = errors.New("media upload can not be replayed")
+	ErrMediaChecksumMismatch = errors.New("media sha256 mismatch")
+	ErrMediaSizeMismatch     = errors.New("media size mismatch")
+
+	// errMediaLinkRefused is returned when the download URL has expired or is refused.
+	errMediaLinkRefused = errors.New("media download link refused")
+)
+
+// mediaExtensions are the extensions of the MIME types supported by the Cloud API, for
+// the types with several known extensions.
+var mediaExtensions = map[string]string{
+	"audio/aac":                     ".aac",
+	"audio/amr":                     ".amr",
+	"audio/mpeg":                    ".mp3",
+	"audio/mp4":                     ".m4a",
+	"audio/ogg":                     ".ogg",
+	"image/jpeg":                    ".jpg",
+	"image/png":                     ".png",
+	"image/webp":                    ".webp",
+	"video/mp4":                     ".mp4",
+	"video/3gpp":                    ".3gp",
+	"text/plain":                    ".txt",
+	"application/pdf":               ".pdf",
+	"application/msword":            ".doc",
+	"application/vnd.ms-excel":      ".xls",
+	"application/vnd.ms-powerpoint": ".ppt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
+// mediaTypesByExtension are the MIME types supported by the Cloud API by their extension.
+var mediaTypesByExtension = func() map[string]string {
+	types := map[string]string{".jpeg": "image/jpeg", ".opus": "audio/ogg", ".3gpp": "video/3gpp"}
+	for mimeType, ext := range mediaExtensions {
+		types[ext] = mimeType
+	}
+
+	return types
+}()
+
+type (
+	// UploadProgress is called while a media is uploaded with the number of bytes of the media
+	// sent so far and its total size, -1 when the size is not known in advance.
+	UploadProgress func(uploaded, total int64)
+
+	UploadOption func(*mediaUpload)
+
+	// DownloadedMedia describes a downloaded media. Extension is derived from MimeType and
+	// includes the leading dot.
+	DownloadedMedia struct {
+		ID        string
+		MimeType  string
+		Extension string
+		Sha256    string
+		Size      int64
+	}
+
+	mediaUpload struct {
+		mediaType MediaType
+		filename  string
+		limit     int64
+		size      int64
+		progress  UploadProgress
+	}
+
+	// uploadReader counts the bytes read, enforces the size limit and stops at the
+	// cancellation of the context.
+	uploadReader struct {
+		ctx    context.Context //nolint:containedctx
+		r      io.Reader
+		upload *mediaUpload
+		read   int64
+	}
+)
 
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
-	header.Set("Content-Type", contentType)
+// WithUploadProgress sets the callback that reports the progress of the upload.
+func WithUploadProgress(progress UploadProgress) UploadOption {
+	return func(upload *mediaUpload) {
+		upload.progress = progress
+	}
+}
+
+// WithUploadSizeLimit replaces the MediaMaxAllowedSize limit of the media type, a negative
+// limit disables the check.
+func WithUploadSizeLimit(limit int64) UploadOption {
+	return func(upload *mediaUpload) {
+		upload.limit = limit
+	}
+}
+
+// write writes the multipart form of the upload. The fields come before the file so they are
+// not held back by a large file.
+func (upload *mediaUpload) write(ctx context.Context, writer *multipart.Writer, mimeType string,
+	content io.Reader,
+) error {
+	if err := writer.WriteField("messaging_product", "whatsapp"); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if err := writer.WriteField("type", mimeType); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(upload.filename)))
+	header.Set("Content-Type", mimeType)
 
 	part, err := writer.CreatePart(header)
 	if err != nil {
-		return nil, "", err
+		return err //nolint:wrapcheck
 	}
 
-	_, err = io.Copy(part, fr)
-	if err != nil {
-		return nil, "", err
+	if _, err := io.Copy(part, &uploadReader{ctx: ctx, r: content, upload: upload}); err != nil {
+		return err //nolint:wrapcheck
 	}
 
-	err = writer.WriteField("type", string(mediaType))
-	if err != nil {
-		return nil, "", err
+	return writer.Close() //nolint:wrapcheck
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err //nolint:wrapcheck
 	}
 
-	err = writer.WriteField("messaging_product", "whatsapp")
-	if err != nil {
-		return nil, "", err
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if limit := r.upload.limit; limit >= 0 && r.read > limit {
+		return n, fmt.Errorf("%w: the limit for %s is %d bytes", ErrMediaTooLarge, r.upload.mediaType, limit)
 	}
 
-	writer.Close()
+	if n > 0 && r.upload.progress != nil {
+		r.upload.progress(r.read, r.upload.size)
+	}
 
-	return payload.Bytes(), writer.FormDataContentType(), nil
+	return n, err //nolint:wrapcheck
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// readerSize returns the number of bytes left in r if it can be known without reading it,
+// otherwise -1.
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	default:
+		return -1
+	}
+}
+
+// detectMimeType returns the MIME type of the media. The type of the filename extension is used
+// when it is a type supported by the Cloud API for the media type: the types sniffed from the
+// content are often the container, application/ogg for an opus voice note or video/mp4 for an
+// m4a audio. Otherwise the type is detected from the first bytes of the media, and the generic
+// types that http.DetectContentType returns for many formats, for example application/zip for the
+// office documents, are replaced by the type of the extension when it is known.
+func detectMimeType(mediaType MediaType, filename string, head []byte) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if byExt, ok := mediaTypesByExtension[ext]; ok && supportsMimeType(mediaType, byExt) {
+		return byExt
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mediaType == MediaTypeAudio {
+		switch sniffed {
+		case "application/ogg":
+			return "audio/ogg"
+		case "video/mp4":
+			return "audio/mp4"
+		}
+	}
+
+	switch sniffed {
+	case "application/octet-stream", "text/plain", "application/zip", "":
+		if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+			return byExt
+		}
+	}
+
+	if sniffed == "" {
+		return "application/octet-stream"
+	}
+
+	return sniffed
+}
+
+// supportsMimeType reports whether the Cloud API accepts the MIME type for the media type.
+func supportsMimeType(mediaType MediaType, mimeType string) bool {
+	switch mediaType {
+	case MediaTypeAudio, MediaTypeImage, MediaTypeVideo:
+		return strings.HasPrefix(mimeType, string(mediaType)+"/")
+	case MediaTypeSticker:
+		return mimeType == "image/webp"
+	default:
+		return true
+	}
 }
@@ -20,7 +20,22 @@
 package whatsapp
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/piusalfred/whatsapp/models"
@@ -135,3 +150,324 @@ func BenchmarkBuildPayloadForMediaMessage(b *testing.B) {
 		})
 	}
 }
+
+// uploadServer is a media endpoint that records the uploaded form.
+type uploadServer struct {
+	mu       sync.Mutex
+	requests int
+	mimeType string
+	filename string
+	data     []byte
+}
+
+func (u *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(part)
+		switch part.FormName() {
+		case "type":
+			u.mimeType = string(data)
+		case "file":
+			u.filename, u.data = part.FileName(), data
+		}
+	}
+	_, _ = w.Write([]byte(`{"id":"1234567890"}`))
+}
+
+// unsized hides the Len method of the reader so the size of the media is not known in advance.
+type unsized struct {
+	io.Reader
+}
+
+func TestClient_UploadMedia(t *testing.T) {
+	t.Parallel()
+	png := append([]byte("\x89PNG\x0d\x0a\x1a\x0a"), bytes.Repeat([]byte{1}, 64*1024)...)
+	ctx := context.Background()
+
+	t.Run("streams the media with the detected type", func(t *testing.T) {
+		t.Parallel()
+		upload := &uploadServer{}
+		server := httptest.NewServer(upload)
+		defer server.Close()
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"))
+
+		var last, total int64
+		resp, err := client.UploadMedia(ctx, MediaTypeImage, "photo.bin", unsized{bytes.NewReader(png)},
+			WithUploadProgress(func(uploaded, size int64) { last, total = uploaded, size }))
+		if err != nil {
+			t.Fatalf("UploadMedia() error = %v", err)
+		}
+
+		if resp.ID != "1234567890" || upload.mimeType != "image/png" || upload.filename != "photo.bin" ||
+			!bytes.Equal(upload.data, png) {
+			t.Errorf("UploadMedia() uploaded %q %q (%d bytes), want image/png photo.bin (%d bytes)",
+				upload.mimeType, upload.filename, len(upload.data), len(png))
+		}
+
+		if last != int64(len(png)) || total != -1 {
+			t.Errorf("last progress = %d/%d, want %d/-1", last, total, len(png))
+		}
+	})
+
+	t.Run("extension is used for generic types", func(t *testing.T) {
+		t.Parallel()
+		upload := &uploadServer{}
+		server := httptest.NewServer(upload)
+		defer server.Close()
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"))
+
+		if _, err := client.UploadMedia(ctx, MediaTypeDocument, "report.pdf",
+			bytes.NewReader([]byte("plain words"))); err != nil {
+			t.Fatalf("UploadMedia() error = %v", err)
+		}
+
+		if upload.mimeType != "application/pdf" {
+			t.Errorf("UploadMedia() type = %q, want application/pdf", upload.mimeType)
+		}
+	})
+
+	t.Run("supported extension is preferred to the sniffed container", func(t *testing.T) {
+		t.Parallel()
+		ogg := append([]byte("OggS\x00\x02"), bytes.Repeat([]byte{0}, 64)...)
+		m4a := append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), bytes.Repeat([]byte{0}, 64)...)
+		tests := []struct {
+			name      string
+			mediaType MediaType
+			filename  string
+			content   []byte
+			want      string
+		}{
+			{name: "ogg voice note", mediaType: MediaTypeAudio, filename: "voice.ogg", content: ogg, want: "audio/ogg"},
+			{name: "m4a audio", mediaType: MediaTypeAudio, filename: "song.m4a", content: m4a, want: "audio/mp4"},
+			{name: "ogg without extension", mediaType: MediaTypeAudio, filename: "voice", content: ogg, want: "audio/ogg"},
+			{name: "mp4 video", mediaType: MediaTypeVideo, filename: "clip.m4a", content: m4a, want: "video/mp4"},
+		}
+
+		for _, tt := range tests {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				upload := &uploadServer{}
+				server := httptest.NewServer(upload)
+				defer server.Close()
+				client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"))
+
+				if _, err := client.UploadMedia(ctx, tt.mediaType, tt.filename, bytes.NewReader(tt.content)); err != nil {
+					t.Fatalf("UploadMedia() error = %v", err)
+				}
+
+				if upload.mimeType != tt.want {
+					t.Errorf("UploadMedia() type = %q, want %q", upload.mimeType, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		t.Parallel()
+		upload := &uploadServer{}
+		server := httptest.NewServer(upload)
+		defer server.Close()
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"))
+		sticker := bytes.Repeat([]byte{0}, MaxStickerSize+1)
+
+		_, err := client.UploadMedia(ctx, MediaTypeSticker, "s.webp", bytes.NewReader(sticker))
+		if !errors.Is(err, ErrMediaTooLarge) || upload.requests != 0 {
+			t.Errorf("UploadMedia() error = %v after %d requests, want %v before any request",
+				err, upload.requests, ErrMediaTooLarge)
+		}
+
+		_, err = client.UploadMedia(ctx, MediaTypeSticker, "s.webp", unsized{bytes.NewReader(sticker)})
+		if !errors.Is(err, ErrMediaTooLarge) {
+			t.Errorf("UploadMedia() error = %v, want %v", err, ErrMediaTooLarge)
+		}
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		t.Parallel()
+		upload := &uploadServer{}
+		server := httptest.NewServer(upload)
+		defer server.Close()
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"))
+
+		cctx, cancel := context.WithCancel(ctx)
+		_, err := client.UploadMedia(cctx, MediaTypeImage, "photo.png", unsized{bytes.NewReader(png)},
+			WithUploadProgress(func(int64, int64) { cancel() }))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("UploadMedia() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestClient_DownloadMediaTo(t *testing.T) {
+	t.Parallel()
+	data := []byte("OggS voice note")
+	sum := sha256.Sum256(data)
+	var (
+		mu      sync.Mutex
+		lookups int
+	)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/v16.0/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		digest := hex.EncodeToString(sum[:])
+		if strings.HasSuffix(r.URL.Path, "/corrupted") {
+			digest = strings.Repeat("0", 64)
+		}
+		_ = json.NewEncoder(w).Encode(&Media{
+			MessagingProduct: "whatsapp",
+			// the first link has expired
+			URL:      fmt.Sprintf("%s/download?link=%d", server.URL, lookups),
+			MimeType: "audio/ogg; codecs=opus",
+			Sha256:   digest,
+			FileSize: int64(len(data)),
+			ID:       strings.TrimPrefix(r.URL.Path, "/v16.0/"),
+		})
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("link") == "1" {
+			http.NotFound(w, r)
+
+			return
+		}
+		_, _ = w.Write(data)
+	})
+	client := NewClient(WithBaseURL(server.URL), WithAccessToken("token"))
+
+	var buf bytes.Buffer
+	got, err := client.DownloadMediaTo(context.Background(), "1234", &buf)
+	if err != nil {
+		t.Fatalf("DownloadMediaTo() error = %v", err)
+	}
+
+	want := &DownloadedMedia{
+		ID: "1234", MimeType: "audio/ogg; codecs=opus", Extension: ".ogg",
+		Sha256: hex.EncodeToString(sum[:]), Size: int64(len(data)),
+	}
+	if *got != *want || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("DownloadMediaTo() = %+v, want %+v", got, want)
+	}
+
+	if lookups != 2 {
+		t.Errorf("media url retrieved %d times, want 2", lookups)
+	}
+
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	_, err = client.DownloadMediaToFile(context.Background(), "corrupted", path)
+	if !errors.Is(err, ErrMediaChecksumMismatch) {
+		t.Errorf("DownloadMediaToFile() error = %v, want %v", err, ErrMediaChecksumMismatch)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+		t.Errorf("DownloadMediaToFile() left %d files after a failed download", len(entries))
+	}
+
+	if _, err = client.DownloadMediaToFile(context.Background(), "1234", path); err != nil {
+		t.Fatalf("DownloadMediaToFile() error = %v", err)
+	}
+
+	if content, _ := os.ReadFile(path); !bytes.Equal(content, data) {
+		t.Errorf("DownloadMediaToFile() wrote %q, want %q", content, data)
+	}
+}
+
+func TestClient_DownloadMedia(t *testing.T) {
+	t.Parallel()
+	// the first part is longer than the head sniffed before the content is written
+	data := []byte("%PDF-1.7 " + strings.Repeat("invoice ", 100))
+	sum := sha256.Sum256(data)
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/v16.0/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v16.0/")
+		if id == "missing" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		digest := hex.EncodeToString(sum[:])
+		if id == "corrupted" {
+			digest = strings.Repeat("0", 64)
+		}
+		_ = json.NewEncoder(w).Encode(&Media{
+			MessagingProduct: "whatsapp",
+			URL:              fmt.Sprintf("%s/download?id=%s", server.URL, id),
+			MimeType:         "application/pdf",
+			Sha256:           digest,
+			FileSize:         int64(len(data)),
+			ID:               id,
+		})
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data[:600])
+		w.(http.Flusher).Flush()
+		if r.URL.Query().Get("id") == "1234" {
+			<-release
+		}
+		_, _ = w.Write(data[600:])
+	})
+	client := NewClient(WithBaseURL(server.URL), WithAccessToken("token"))
+	ctx := context.Background()
+
+	// the reader is returned and read before the download is complete
+	reader, err := client.DownloadMedia(ctx, "1234")
+	if err != nil {
+		t.Fatalf("DownloadMedia() error = %v", err)
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(reader, head); err != nil || string(head) != "%PDF" {
+		t.Fatalf("read %q, %v, want %q", head, err, "%PDF")
+	}
+	close(release)
+
+	rest, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(append(head, rest...), data) {
+		t.Errorf("read %q, %v, want %q", append(head, rest...), err, data)
+	}
+
+	reader, err = client.DownloadMedia(ctx, "corrupted")
+	if err != nil {
+		t.Fatalf("DownloadMedia() error = %v", err)
+	}
+
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrMediaChecksumMismatch) {
+		t.Errorf("read error = %v, want %v", err, ErrMediaChecksumMismatch)
+	}
+
+	if _, err := client.DownloadMedia(ctx, "missing"); err == nil {
+		t.Errorf("DownloadMedia() error = nil for a missing media")
+	}
+}
+
+func TestMediaExtension(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"image/jpeg":             ".jpg",
+		"audio/ogg; codecs=opus": ".ogg",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+		"image/gif":        ".gif",
+		"application/x-no": "",
+		"":                 "",
+	}
+	for mimeType, want := range tests {
+		if got := MediaExtension(mimeType); got != want {
+			t.Errorf("MediaExtension(%q) = %q, want %q", mimeType, got, want)
+		}
+	}
+}
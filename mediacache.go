@@ -0,0 +1,262 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	whttp "github.com/piusalfred/whatsapp/http"
+	"github.com/piusalfred/whatsapp/mediacache"
+)
+
+// MediaCacheMargin is how long before its expiry a cached media ID stops being reused, so
+// a message is not sent with a media that is deleted before the recipient downloads it.
+const MediaCacheMargin = 24 * time.Hour
+
+// MediaCacheErrorHook is called with the errors of the mediacache.Store. They do not fail the
+// uploads and the messages: a media whose ID can not be read from the cache is uploaded, and
+// the ID of a media whose entry can not be saved is used all the same.
+type MediaCacheErrorHook func(ctx context.Context, err error)
+
+// WithMediaCache sets the mediacache.Store used by UploadMediaCached and SendMediaCached.
+func WithMediaCache(store mediacache.Store) ClientOption {
+	return func(client *Client) {
+		client.mediaCache = store
+	}
+}
+
+// WithMediaCacheErrorHook sets the hook called with the errors of the media cache, which are
+// ignored otherwise.
+func WithMediaCacheErrorHook(hook MediaCacheErrorHook) ClientOption {
+	return func(client *Client) {
+		client.onMediaCacheError = hook
+	}
+}
+
+// UploadMediaCached uploads the media unless the same content has already been uploaded with
+// the client's phone number and its media ID is still valid, in which case that ID is returned.
+// The content is identified by its sha256 digest, so it is read twice: content is rewound if it
+// is an io.Seeker, otherwise it is copied to a temporary file while it is hashed.
+//
+// Without a cache set by WithMediaCache the media is always uploaded.
+func (client *Client) UploadMediaCached(ctx context.Context, mediaType MediaType, filename string,
+	content io.Reader, options ...UploadOption,
+) (*UploadMediaResponse, error) {
+	cached, err := client.openCachedMedia(ctx, mediaType, filename, content, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cached.cleanup()
+
+	id, _, err := cached.mediaID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadMediaResponse{ID: id}, nil
+}
+
+// SendMediaCached sends the media read from content with the ID returned by UploadMediaCached,
+// the MediaID and MediaLink of the message are ignored. If the API reports that the cached
+// media ID no longer exists, the media is uploaded again and the message sent once more.
+func (client *Client) SendMediaCached(ctx context.Context, recipient string, message *MediaMessage,
+	filename string, content io.Reader, options ...UploadOption,
+) (*ResponseMessage, error) {
+	cached, err := client.openCachedMedia(ctx, message.Type, filename, content, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cached.cleanup()
+
+	id, fromCache, err := cached.mediaID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := *message
+	m.MediaID, m.MediaLink = id, ""
+	resp, err := client.SendMedia(ctx, recipient, &m, nil)
+	if err == nil || !fromCache || !IsMediaNotFoundError(err) {
+		return resp, err
+	}
+
+	if m.MediaID, err = cached.upload(ctx); err != nil {
+		return nil, err
+	}
+
+	return client.SendMedia(ctx, recipient, &m, nil)
+}
+
+// IsMediaNotFoundError reports whether err is returned by the API because a media ID does
+// not exist, for example because it has expired or has been deleted.
+func IsMediaNotFoundError(err error) bool {
+	var re *whttp.ResponseError
+	if !errors.As(err, &re) || re.Err == nil {
+		return false
+	}
+
+	switch re.Err.Code {
+	case 131053: // media upload error
+		return true
+	case 100, 131009: // invalid parameter, subcode 33 is for an object that does not exist
+		if re.Err.Subcode == 33 {
+			return true
+		}
+
+		details := re.Err.Message
+		if re.Err.Data != nil {
+			details += " " + re.Err.Data.Details
+		}
+
+		return strings.Contains(strings.ToLower(details), "media")
+	default:
+		return false
+	}
+}
+
+// cachedMedia is a media being uploaded through the cache.
+type cachedMedia struct {
+	client    *Client
+	store     mediacache.Store
+	onError   MediaCacheErrorHook
+	mediaType MediaType
+	filename  string
+	key       string
+	content   io.ReadSeeker
+	start     int64
+	options   []UploadOption
+	cleanup   func()
+}
+
+func (client *Client) openCachedMedia(ctx context.Context, mediaType MediaType, filename string,
+	content io.Reader, options []UploadOption,
+) (*cachedMedia, error) {
+	client.rwm.RLock()
+	store, onError, phoneNumberID := client.mediaCache, client.onMediaCacheError, client.phoneNumberID
+	client.rwm.RUnlock()
+
+	cached := &cachedMedia{
+		client:    client,
+		store:     store,
+		onError:   onError,
+		mediaType: mediaType,
+		filename:  filename,
+		options:   options,
+		cleanup:   func() {},
+	}
+
+	hash := sha256.New()
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("media cache: %w", err)
+		}
+
+		if _, err := io.Copy(hash, seeker); err != nil {
+			return nil, fmt.Errorf("media cache: %w", err)
+		}
+		cached.content, cached.start = seeker, start
+	} else {
+		file, err := os.CreateTemp("", "whatsapp-media-*")
+		if err != nil {
+			return nil, fmt.Errorf("media cache: %w", err)
+		}
+		cached.cleanup = func() {
+			file.Close()
+			os.Remove(file.Name()) //nolint:errcheck
+		}
+
+		if _, err := io.Copy(io.MultiWriter(file, hash), content); err != nil {
+			cached.cleanup()
+
+			return nil, fmt.Errorf("media cache: %w", err)
+		}
+		cached.content = file
+	}
+
+	if err := ctx.Err(); err != nil {
+		cached.cleanup()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	cached.key = mediacache.Key(phoneNumberID, string(mediaType), hex.EncodeToString(hash.Sum(nil)))
+
+	return cached, nil
+}
+
+// mediaID returns the cached media ID if it is still valid, otherwise it uploads the media.
+// It reports whether the ID comes from the cache.
+func (cached *cachedMedia) mediaID(ctx context.Context) (string, bool, error) {
+	if cached.store != nil {
+		entry, err := cached.store.Get(ctx, cached.key)
+		switch {
+		case err == nil && entry.Valid(time.Now(), MediaCacheMargin):
+			return entry.MediaID, true, nil
+		case err != nil && !errors.Is(err, mediacache.ErrNotFound):
+			cached.fail(ctx, err)
+		}
+	}
+
+	id, err := cached.upload(ctx)
+
+	return id, false, err
+}
+
+// upload uploads the media and caches its ID.
+func (cached *cachedMedia) upload(ctx context.Context) (string, error) {
+	if _, err := cached.content.Seek(cached.start, io.SeekStart); err != nil {
+		return "", fmt.Errorf("media cache: %w", err)
+	}
+
+	uploadedAt := time.Now()
+	resp, err := cached.client.UploadMedia(ctx, cached.mediaType, cached.filename, cached.content, cached.options...)
+	if err != nil {
+		return "", err
+	}
+
+	if cached.store != nil {
+		entry := &mediacache.Entry{
+			MediaID:    resp.ID,
+			UploadedAt: uploadedAt,
+			ExpiresAt:  uploadedAt.Add(UploadedMediaTTL),
+		}
+		if err := cached.store.Put(ctx, cached.key, entry); err != nil {
+			cached.fail(ctx, err)
+		}
+	}
+
+	return resp.ID, nil
+}
+
+// fail reports an error of the cache store to the MediaCacheErrorHook.
+func (cached *cachedMedia) fail(ctx context.Context, err error) {
+	if cached.onError != nil {
+		cached.onError(ctx, fmt.Errorf("media cache: %w", err))
+	}
+}
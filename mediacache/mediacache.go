@@ -0,0 +1,192 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package mediacache stores the IDs of the uploaded media by the hash of their content, so
+// the same file is uploaded once and its media ID reused for as long as it is valid.
+//
+// whatsapp.Client uses a Store set with whatsapp.WithMediaCache in UploadMediaCached and
+// SendMediaCached. MemoryStore keeps the entries in memory and FileStore in a json file so
+// they survive restarts. Any other storage, for example a database shared by several
+// instances, can be used by implementing Store.
+package mediacache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp/internal/atomicfile"
+)
+
+var ErrNotFound = errors.New("mediacache: entry not found")
+
+type (
+	// Entry is a cached media ID. ExpiresAt is when the media is deleted by the Cloud API.
+	Entry struct {
+		MediaID    string    `json:"media_id"`
+		UploadedAt time.Time `json:"uploaded_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+	}
+
+	// Store stores the entries by key. Get returns ErrNotFound if there is no entry for the
+	// key. Implementations must be safe for concurrent use.
+	Store interface {
+		Get(ctx context.Context, key string) (*Entry, error)
+		Put(ctx context.Context, key string, entry *Entry) error
+		Delete(ctx context.Context, key string) error
+	}
+
+	// MemoryStore is a Store that keeps the entries in memory.
+	MemoryStore struct {
+		mu      sync.RWMutex
+		entries map[string]*Entry
+		now     func() time.Time
+	}
+
+	// FileStore is a Store that keeps the entries in memory and saves them to a json file
+	// after every change. The expired entries are dropped when the file is saved.
+	FileStore struct {
+		path  string
+		mu    sync.Mutex
+		store *MemoryStore
+	}
+)
+
+// Key returns the key of the media with the given sha256 digest uploaded with the phone
+// number, media IDs can only be used by the phone number they were uploaded with.
+func Key(phoneNumberID, mediaType, sha256 string) string {
+	return strings.Join([]string{phoneNumberID, mediaType, sha256}, "/")
+}
+
+// Valid reports whether the media can still be used at now, leaving at least margin
+// before its expiry.
+func (e *Entry) Valid(now time.Time, margin time.Duration) bool {
+	return e.MediaID != "" && now.Add(margin).Before(e.ExpiresAt)
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*Entry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e := *entry
+
+	return &e, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, entry *Entry) error {
+	e := *entry
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &e
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.entries)
+}
+
+// snapshot returns the entries that have not expired.
+func (s *MemoryStore) snapshot() map[string]*Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	entries := make(map[string]*Entry, len(s.entries))
+	for key, entry := range s.entries {
+		if now.Before(entry.ExpiresAt) {
+			entries[key] = entry
+		}
+	}
+
+	return entries
+}
+
+// NewFileStore returns a FileStore saving the entries to the file at path, loading the
+// entries already in the file. A missing file is created on the first change.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path, store: NewMemoryStore()}
+	if err := atomicfile.ReadJSON(path, &store.store.entries); err != nil {
+		return nil, fmt.Errorf("mediacache: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (*Entry, error) {
+	return s.store.Get(ctx, key)
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Put(ctx, key, entry); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.store.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// save replaces the store file with the entries that have not expired.
+func (s *FileStore) save() error {
+	if err := atomicfile.WriteJSON(s.path, s.store.snapshot()); err != nil {
+		return fmt.Errorf("mediacache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package mediacache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "media.json")
+	now := time.Now()
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	valid := &Entry{MediaID: "1", UploadedAt: now, ExpiresAt: now.Add(30 * 24 * time.Hour)}
+	expired := &Entry{MediaID: "2", UploadedAt: now.Add(-31 * 24 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	for key, entry := range map[string]*Entry{"valid": valid, "expired": expired, "deleted": valid} {
+		if err := store.Put(ctx, key, entry); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if err := store.Delete(ctx, "deleted"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	got, err := reopened.Get(ctx, "valid")
+	if err != nil || got.MediaID != "1" || !got.ExpiresAt.Equal(valid.ExpiresAt) {
+		t.Errorf("Get() = %+v, %v, want %+v", got, err, valid)
+	}
+
+	for _, key := range []string{"expired", "deleted"} {
+		if _, err := reopened.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) error = %v, want %v", key, err, ErrNotFound)
+		}
+	}
+}
+
+func TestEntry_Valid(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	entry := &Entry{MediaID: "1", ExpiresAt: now.Add(36 * time.Hour)}
+	if !entry.Valid(now, 24*time.Hour) {
+		t.Errorf("Valid() = false for an entry expiring after the margin")
+	}
+
+	if entry.Valid(now.Add(13*time.Hour), 24*time.Hour) {
+		t.Errorf("Valid() = true for an entry expiring within the margin")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp/mediacache"
+	"github.com/piusalfred/whatsapp/models"
+)
+
+// mediaServer accepts uploads and messages, and rejects the messages with a deleted media.
+type mediaServer struct {
+	mu       sync.Mutex
+	uploads  int
+	messages int
+	deleted  map[string]bool
+}
+
+func (m *mediaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if strings.HasSuffix(r.URL.Path, "/media") {
+		_, _ = io.Copy(io.Discard, r.Body)
+		m.uploads++
+		_, _ = fmt.Fprintf(w, `{"id":"media-%d"}`, m.uploads)
+
+		return
+	}
+
+	var message models.Message
+	_ = json.NewDecoder(r.Body).Decode(&message)
+	if message.Document != nil && m.deleted[message.Document.ID] {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"(#100) Invalid parameter","type":"OAuthException",` +
+			`"code":100,"error_data":{"details":"Invalid media id"}}}`))
+
+		return
+	}
+	m.messages++
+	_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+}
+
+func TestClient_SendMediaCached(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	media := &mediaServer{deleted: map[string]bool{}}
+	server := httptest.NewServer(media)
+	defer server.Close()
+	store := mediacache.NewMemoryStore()
+	client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"), WithMediaCache(store))
+	brochure := []byte("%PDF-1.4 brochure")
+
+	for i := 0; i < 3; i++ {
+		// an unseekable reader is spooled to a temporary file
+		resp, err := client.UploadMediaCached(ctx, MediaTypeDocument, "brochure.pdf",
+			io.MultiReader(bytes.NewReader(brochure)))
+		if err != nil || resp.ID != "media-1" {
+			t.Fatalf("UploadMediaCached() = %v, %v, want media-1", resp, err)
+		}
+	}
+
+	if media.uploads != 1 {
+		t.Errorf("uploads = %d, want 1", media.uploads)
+	}
+
+	// the media is deleted by the API: it is uploaded again and the message resent.
+	media.deleted["media-1"] = true
+	message := &MediaMessage{Type: MediaTypeDocument, Filename: "brochure.pdf"}
+	if _, err := client.SendMediaCached(ctx, "255712345678", message, "brochure.pdf",
+		bytes.NewReader(brochure)); err != nil {
+		t.Fatalf("SendMediaCached() error = %v", err)
+	}
+
+	if media.uploads != 2 || media.messages != 1 {
+		t.Errorf("uploads = %d, messages = %d, want 2 and 1", media.uploads, media.messages)
+	}
+
+	// the cached media is about to expire.
+	sum := sha256.Sum256(brochure)
+	key := mediacache.Key("phone_number_id", "document", hex.EncodeToString(sum[:]))
+	entry, err := store.Get(ctx, key)
+	if err != nil || entry.MediaID != "media-2" {
+		t.Fatalf("cache entry = %+v, %v, want media-2", entry, err)
+	}
+	entry.ExpiresAt = time.Now().Add(time.Hour)
+	_ = store.Put(ctx, key, entry)
+
+	resp, err := client.UploadMediaCached(ctx, MediaTypeDocument, "brochure.pdf", bytes.NewReader(brochure))
+	if err != nil || resp.ID != "media-3" {
+		t.Errorf("UploadMediaCached() = %v, %v, want media-3", resp, err)
+	}
+}
+
+// brokenStore is a mediacache.Store that fails to read and write its entries.
+type brokenStore struct{}
+
+func (brokenStore) Get(context.Context, string) (*mediacache.Entry, error) {
+	return nil, errors.New("disk failure")
+}
+
+func (brokenStore) Put(context.Context, string, *mediacache.Entry) error {
+	return errors.New("disk full")
+}
+
+func (brokenStore) Delete(context.Context, string) error {
+	return errors.New("disk failure")
+}
+
+func TestClient_SendMediaCached_StoreErrors(t *testing.T) {
+	t.Parallel()
+	media := &mediaServer{deleted: map[string]bool{}}
+	server := httptest.NewServer(media)
+	defer server.Close()
+	var cacheErrors []string
+	client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"),
+		WithMediaCache(brokenStore{}), WithMediaCacheErrorHook(func(_ context.Context, err error) {
+			cacheErrors = append(cacheErrors, err.Error())
+		}))
+
+	message := &MediaMessage{Type: MediaTypeDocument, Filename: "brochure.pdf"}
+	if _, err := client.SendMediaCached(context.Background(), "255712345678", message, "brochure.pdf",
+		bytes.NewReader([]byte("%PDF-1.4 brochure"))); err != nil {
+		t.Fatalf("SendMediaCached() error = %v", err)
+	}
+
+	if media.uploads != 1 || media.messages != 1 {
+		t.Errorf("uploads = %d, messages = %d, want 1 and 1", media.uploads, media.messages)
+	}
+
+	want := "media cache: disk failure,media cache: disk full"
+	if got := strings.Join(cacheErrors, ","); got != want {
+		t.Errorf("cache errors = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package mediastore saves the media received in webhook notifications. The media sent by
+// customers is only available for a limited time, so it is downloaded as soon as the message
+// is received and saved to a Store.
+//
+// whatsapp.InboundMedia downloads the media and saves it to a Store. FileStore saves it to a
+// directory on the local filesystem and BlobStore to any blob storage, like S3 or GCS, that
+// implements Blob.
+package mediastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/piusalfred/whatsapp/internal/atomicfile"
+)
+
+var ErrInvalidKey = errors.New("mediastore: invalid key")
+
+type (
+	// Metadata describes a media received in a message. Size and Sha256 are of the content
+	// that has been downloaded.
+	Metadata struct {
+		MediaID       string `json:"media_id"`
+		MessageID     string `json:"message_id"`
+		From          string `json:"from"`
+		PhoneNumberID string `json:"phone_number_id"`
+		Type          string `json:"type"`
+		MimeType      string `json:"mime_type"`
+		Sha256        string `json:"sha256"`
+		Size          int64  `json:"size"`
+		Filename      string `json:"filename,omitempty"`
+		Caption       string `json:"caption,omitempty"`
+		Timestamp     string `json:"timestamp,omitempty"`
+	}
+
+	// Object is a media saved to a Store. Location is where the media can be found, a path for
+	// FileStore and whatever the Blob returns for BlobStore.
+	Object struct {
+		Key      string    `json:"key"`
+		Location string    `json:"location"`
+		StoredAt time.Time `json:"stored_at"`
+		Metadata *Metadata `json:"metadata"`
+	}
+
+	// Store saves the content of a media under the key. Keys are slash separated paths.
+	// Implementations must be safe for concurrent use.
+	Store interface {
+		Put(ctx context.Context, key string, metadata *Metadata, content io.Reader) (*Object, error)
+	}
+
+	// Blob is a blob storage. Write saves the content under the key with the metadata and
+	// returns its location, for example a URL.
+	Blob interface {
+		Write(ctx context.Context, key, contentType string, metadata map[string]string, content io.Reader,
+			size int64) (string, error)
+	}
+
+	// BlobStore is a Store that saves the media to a Blob.
+	BlobStore struct {
+		blob Blob
+		now  func() time.Time
+	}
+
+	// FileStore is a Store that saves the media to files in a directory. The metadata is saved
+	// next to the media in a file with the .json extension added to the key.
+	FileStore struct {
+		dir string
+		now func() time.Time
+	}
+)
+
+// NewBlobStore returns a Store that saves the media to the blob.
+func NewBlobStore(blob Blob) *BlobStore {
+	return &BlobStore{blob: blob, now: time.Now}
+}
+
+// Put writes the content to the blob with the metadata as a map.
+func (store *BlobStore) Put(ctx context.Context, key string, metadata *Metadata, content io.Reader) (
+	*Object, error,
+) {
+	location, err := store.blob.Write(ctx, key, metadata.MimeType, metadata.Map(), content, metadata.Size)
+	if err != nil {
+		return nil, fmt.Errorf("mediastore: put %s: %w", key, err)
+	}
+
+	return &Object{Key: key, Location: location, StoredAt: store.now(), Metadata: metadata}, nil
+}
+
+// NewFileStore returns a FileStore that saves the media in dir, creating it if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("mediastore: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return nil, fmt.Errorf("mediastore: %w", err)
+	}
+
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+// Put writes the content to the file of the key and the metadata next to it. The location
+// of the object is the absolute path of the file.
+func (store *FileStore) Put(_ context.Context, key string, metadata *Metadata, content io.Reader) (
+	*Object, error,
+) {
+	path, err := store.Path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd
+		return nil, fmt.Errorf("mediastore: put %s: %w", key, err)
+	}
+
+	object := &Object{Key: key, Location: path, StoredAt: store.now(), Metadata: metadata}
+	meta, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("mediastore: put %s: %w", key, err)
+	}
+
+	if err := atomicfile.Write(path, content); err != nil {
+		return nil, fmt.Errorf("mediastore: put %s: %w", key, err)
+	}
+
+	if err := atomicfile.Write(path+".json", bytes.NewReader(meta)); err != nil {
+		return nil, fmt.Errorf("mediastore: put %s: %w", key, err)
+	}
+
+	return object, nil
+}
+
+// Path returns the path of the file of the key. Keys that are absolute or that would be
+// outside the directory of the store are invalid.
+func (store *FileStore) Path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	return filepath.Join(store.dir, name), nil
+}
+
+// Map returns the non-empty fields of the metadata keyed by their json names, suitable as
+// the user metadata of a blob.
+func (metadata *Metadata) Map() map[string]string {
+	fields := map[string]string{
+		"media_id":        metadata.MediaID,
+		"message_id":      metadata.MessageID,
+		"from":            metadata.From,
+		"phone_number_id": metadata.PhoneNumberID,
+		"type":            metadata.Type,
+		"mime_type":       metadata.MimeType,
+		"sha256":          metadata.Sha256,
+		"size":            strconv.FormatInt(metadata.Size, 10),
+		"filename":        metadata.Filename,
+		"caption":         metadata.Caption,
+		"timestamp":       metadata.Timestamp,
+	}
+
+	for name, value := range fields {
+		if value == "" {
+			delete(fields, name)
+		}
+	}
+
+	return fields
+}
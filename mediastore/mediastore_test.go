@@ -0,0 +1,89 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package mediastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type blob struct {
+	key, contentType, content string
+	metadata                  map[string]string
+}
+
+func (b *blob) Write(_ context.Context, key, contentType string, metadata map[string]string,
+	content io.Reader, _ int64,
+) (string, error) {
+	data, err := io.ReadAll(content)
+	b.key, b.contentType, b.metadata, b.content = key, contentType, metadata, string(data)
+
+	return "s3://bucket/" + key, err
+}
+
+func TestBlobStore(t *testing.T) {
+	t.Parallel()
+	b := &blob{}
+	store := NewBlobStore(b)
+	metadata := &Metadata{MediaID: "5678", MessageID: "wamid.1", MimeType: "audio/ogg", Size: 5}
+
+	object, err := store.Put(context.Background(), "phone/5678.ogg", metadata, strings.NewReader("voice"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if object.Location != "s3://bucket/phone/5678.ogg" || b.contentType != "audio/ogg" || b.content != "voice" {
+		t.Errorf("Put() = %+v, blob = %+v", object, b)
+	}
+
+	want := map[string]string{
+		"media_id": "5678", "message_id": "wamid.1", "mime_type": "audio/ogg", "size": "5",
+	}
+	if len(b.metadata) != len(want) {
+		t.Errorf("blob metadata = %v, want %v", b.metadata, want)
+	}
+	for name, value := range want {
+		if b.metadata[name] != value {
+			t.Errorf("blob metadata[%s] = %q, want %q", name, b.metadata[name], value)
+		}
+	}
+}
+
+func TestFileStore_Path(t *testing.T) {
+	t.Parallel()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "phone/../../outside"} {
+		if _, err := store.Put(context.Background(), key, &Metadata{}, strings.NewReader("")); !errors.Is(err,
+			ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+
+	if _, err := store.Path("phone/255712345678/5678.jpg"); err != nil {
+		t.Errorf("Path() error = %v", err)
+	}
+}
@@ -55,6 +55,7 @@ type SendTextRequest struct {
 	Recipient     string
 	Message       string
 	PreviewURL    bool
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 // SendText sends a text message to the recipient.
@@ -86,6 +87,7 @@ func SendText(ctx context.Context, client *http.Client, req *SendTextRequest) (*
 		Bearer:  req.AccessToken,
 		Form:    nil,
 		Payload: text,
+		Retry:   req.RetryPolicy,
 	}
 
 	var message ResponseMessage
@@ -107,6 +109,7 @@ type SendLocationRequest struct {
 	Address       string
 	Latitude      float64
 	Longitude     float64
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 func SendLocation(ctx context.Context, client *http.Client, req *SendLocationRequest) (*ResponseMessage, error) {
@@ -139,6 +142,7 @@ func SendLocation(ctx context.Context, client *http.Client, req *SendLocationReq
 		Headers: map[string]string{"Content-Type": "application/json"},
 		Bearer:  req.AccessToken,
 		Payload: location,
+		Retry:   req.RetryPolicy,
 	}
 
 	var message ResponseMessage
@@ -158,6 +162,7 @@ type ReactRequest struct {
 	Recipient     string
 	MessageID     string
 	Emoji         string
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 /*
@@ -227,6 +232,7 @@ func React(ctx context.Context, client *http.Client, req *ReactRequest) (*Respon
 		Headers: map[string]string{"Content-Type": "application/json"},
 		Bearer:  req.AccessToken,
 		Payload: reaction,
+		Retry:   req.RetryPolicy,
 	}
 
 	var message ResponseMessage
@@ -245,6 +251,7 @@ type SendContactRequest struct {
 	ApiVersion    string
 	Recipient     string
 	Contacts      *models.Contacts
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 func SendContact(ctx context.Context, client *http.Client, req *SendContactRequest) (*ResponseMessage, error) {
@@ -252,7 +259,7 @@ func SendContact(ctx context.Context, client *http.Client, req *SendContactReque
 		Product:       "whatsapp",
 		To:            req.Recipient,
 		RecipientType: "individual",
-		Type:          "contact",
+		Type:          "contacts",
 		Contacts:      req.Contacts,
 	}
 	reqCtx := &whttp.RequestContext{
@@ -271,6 +278,7 @@ func SendContact(ctx context.Context, client *http.Client, req *SendContactReque
 		Bearer:  req.AccessToken,
 		Form:    nil,
 		Payload: contact,
+		Retry:   req.RetryPolicy,
 	}
 
 	var message ResponseMessage
@@ -293,6 +301,7 @@ type ReplyRequest struct {
 	Context       string // this is ID of the message to reply to
 	MessageType   MessageType
 	Content       any // this is a Text if MessageType is Text
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 // Reply is used to reply to a message. It accepts a ReplyRequest and returns a Response and an error.
@@ -342,6 +351,7 @@ func Reply(ctx context.Context, client *http.Client, request *ReplyRequest) (*Re
 		Bearer:  request.AccessToken,
 		Form:    nil,
 		Payload: payload,
+		Retry:   request.RetryPolicy,
 	}
 
 	var message ResponseMessage
@@ -386,6 +396,7 @@ type SendTemplateRequest struct {
 	TemplateLanguagePolicy string
 	TemplateName           string
 	TemplateComponents     []*models.TemplateComponent
+	RetryPolicy            *whttp.RetryPolicy
 }
 
 func SendTemplate(ctx context.Context, client *http.Client, req *SendTemplateRequest) (*ResponseMessage, error) {
@@ -418,6 +429,7 @@ func SendTemplate(ctx context.Context, client *http.Client, req *SendTemplateReq
 			"Content-Type": "application/json",
 		},
 		Bearer: req.AccessToken,
+		Retry:  req.RetryPolicy,
 	}
 	var message ResponseMessage
 	err := whttp.Send(ctx, client, params, &message)
@@ -492,6 +504,7 @@ type SendMediaRequest struct {
 	Filename      string
 	Provider      string
 	CacheOptions  *CacheOptions
+	RetryPolicy   *whttp.RetryPolicy
 }
 
 /*
@@ -583,6 +596,7 @@ func SendMedia(ctx context.Context, client *http.Client, req *SendMediaRequest)
 		Bearer:  req.AccessToken,
 		Headers: map[string]string{"Content-Type": "application/json"},
 		Payload: payload,
+		Retry:   req.RetryPolicy,
 	}
 
 	if req.CacheOptions != nil {
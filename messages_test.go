@@ -18,3 +18,62 @@
  */
 
 package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piusalfred/whatsapp/models"
+)
+
+func TestSendContact(t *testing.T) {
+	t.Parallel()
+	var body map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := SendContact(context.Background(), http.DefaultClient, &SendContactRequest{
+		BaseURL:       server.URL,
+		PhoneNumberID: "1234",
+		Recipient:     "255700000000",
+		Contacts:      &models.Contacts{Contacts: []*models.Contact{{Name: models.Name{FormattedName: "Pius"}}}},
+	})
+	if err != nil {
+		t.Fatalf("SendContact() error = %v", err)
+	}
+
+	if got := string(body["type"]); got != `"contacts"` {
+		t.Errorf("type = %s, want \"contacts\"", got)
+	}
+}
+
+func TestFormatReplyPayload_Contacts(t *testing.T) {
+	t.Parallel()
+	payload, err := formatReplyPayload(&ReplyRequest{
+		Recipient:   "255700000000",
+		Context:     "wamid.1",
+		MessageType: ContactMessageType,
+		Content:     &models.Contacts{Contacts: []*models.Contact{{Birthday: "2000-01-01"}}},
+	})
+	if err != nil {
+		t.Fatalf("formatReplyPayload() error = %v", err)
+	}
+
+	var body struct {
+		Type     string            `json:"type"`
+		Contacts []*models.Contact `json:"contacts"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		t.Fatalf("payload %s: %v", payload, err)
+	}
+
+	if body.Type != "contacts" || len(body.Contacts) != 1 || body.Contacts[0].Birthday != "2000-01-01" {
+		t.Errorf("payload = %s, want a contacts message", payload)
+	}
+}
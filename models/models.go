@@ -19,11 +19,14 @@
 
 package models
 
+import "encoding/json"
+
 const (
 	InteractiveMessageButton      = "button"
 	InteractiveMessageList        = "list"
 	InteractiveMessageProduct     = "product"
 	InteractiveMessageProductList = "product_list"
+	InteractiveMessageCTAURL      = "cta_url"
 )
 
 type (
@@ -129,7 +132,8 @@ type (
 	}
 
 	// MediaInfo provides information about a media be it an Audio, Video, etc
-	// Animated used with stickers only
+	// Animated used with stickers only and Voice with audio only, true if the audio is a voice
+	// note recorded in WhatsApp.
 	MediaInfo struct {
 		ID       string `json:"id,omitempty"`
 		Caption  string `json:"caption,omitempty"`
@@ -137,6 +141,7 @@ type (
 		Sha256   string `json:"sha256,omitempty"`
 		Filename string `json:"filename,omitempty"`
 		Animated bool   `json:"animated,omitempty"` // used with stickers true if animated
+		Voice    bool   `json:"voice,omitempty"`    // used with audio true if a voice note
 	}
 
 	// Media represents a media object. This object is used to send media messages to WhatsApp users.
@@ -284,15 +289,23 @@ type (
 		  message templates. Captions not supported when used in a media template.
 
 		- Video, video (object) Required when type=video. A media object of type video. Captions not supported when used in a media template.
+
+		- Location, location (object) Required when type=location. A location object for templates with a location header.
+
+		- Payload, payload (string) Required when type=payload. Used in quick_reply button components, the developer-defined
+		  payload is returned when the button is clicked.
 	*/
 	TemplateParameter struct {
-		Type     string            `json:"type,omitempty"`
-		Text     string            `json:"text,omitempty"`
-		Currency *TemplateCurrency `json:"currency,omitempty"`
-		DateTime *TemplateDateTime `json:"date_time,omitempty"`
-		Image    *Media            `json:"image,omitempty"`
-		Document *Media            `json:"document,omitempty"`
-		Video    *Media            `json:"video,omitempty"`
+		Type       string            `json:"type,omitempty"`
+		Text       string            `json:"text,omitempty"`
+		Currency   *TemplateCurrency `json:"currency,omitempty"`
+		DateTime   *TemplateDateTime `json:"date_time,omitempty"`
+		Image      *Media            `json:"image,omitempty"`
+		Document   *Media            `json:"document,omitempty"`
+		Video      *Media            `json:"video,omitempty"`
+		Location   *Location         `json:"location,omitempty"`
+		Payload    string            `json:"payload,omitempty"`
+		CouponCode string            `json:"coupon_code,omitempty"`
 	}
 
 	// TemplateComponent contains information about a template component.
@@ -359,10 +372,29 @@ type (
 	//	  is clicked by the user. Maximum length: 256 characters.
 	//
 	// You can have up to 3 buttons. You cannot have leading or trailing spaces when setting the ID.
+	//
+	// The Cloud API expects the title and the ID of a reply button to be nested in a reply object,
+	// 	{"type": "reply", "reply": {"id": "<ID>", "title": "<TITLE>"}}
+	// which is what Reply is for.
 	InteractiveButton struct {
-		Type  string `json:"type,omitempty"`
-		Title string `json:"title,omitempty"`
+		Type  string                  `json:"type,omitempty"`
+		Title string                  `json:"title,omitempty"`
+		ID    string                  `json:"id,omitempty"`
+		Reply *InteractiveReplyButton `json:"reply,omitempty"`
+	}
+
+	// InteractiveReplyButton is the reply object of an InteractiveButton of type reply.
+	InteractiveReplyButton struct {
 		ID    string `json:"id,omitempty"`
+		Title string `json:"title,omitempty"`
+	}
+
+	// InteractiveActionParameters contains the parameters of a cta_url action.
+	// 	- DisplayText, display_text (string) Required. Button label text. Maximum length: 20 characters.
+	// 	- URL, url (string) Required. URL to load in the device's default web browser when the button is tapped.
+	InteractiveActionParameters struct {
+		DisplayText string `json:"display_text,omitempty"`
+		URL         string `json:"url,omitempty"`
 	}
 
 	// InteractiveSectionRow contains information about a row in an interactive section.
@@ -433,13 +465,19 @@ type (
 
 					- Sections, sections (array of objects) Required for List Messages and Multi-Product Messages. Array of
 		              section objects. Minimum of 1, maximum of 10. See InteractiveSection object.
+
+					- Name, name (string) Required for CTA URL Button Messages. Always cta_url.
+
+					- Parameters, parameters (object) Required for CTA URL Button Messages. See InteractiveActionParameters.
 	*/
 	InteractiveAction struct {
-		Button            string                `json:"button,omitempty"`
-		Buttons           []*InteractiveButton  `json:"buttons,omitempty"`
-		CatalogID         string                `json:"catalog_id,omitempty"`
-		ProductRetailerID string                `json:"product_retailer_id,omitempty"`
-		Sections          []*InteractiveSection `json:"sections,omitempty"`
+		Button            string                       `json:"button,omitempty"`
+		Buttons           []*InteractiveButton         `json:"buttons,omitempty"`
+		CatalogID         string                       `json:"catalog_id,omitempty"`
+		ProductRetailerID string                       `json:"product_retailer_id,omitempty"`
+		Sections          []*InteractiveSection        `json:"sections,omitempty"`
+		Name              string                       `json:"name,omitempty"`
+		Parameters        *InteractiveActionParameters `json:"parameters,omitempty"`
 	}
 
 	/*
@@ -461,8 +499,11 @@ type (
 				- Video, video (object) Required if type is set to video. Contains the media object for this video.
 	*/
 	InteractiveHeader struct {
-		Text string `json:"text,omitempty"`
-		Type string `json:"type,omitempty"`
+		Document *Media `json:"document,omitempty"`
+		Image    *Media `json:"image,omitempty"`
+		Text     string `json:"text,omitempty"`
+		Type     string `json:"type,omitempty"`
+		Video    *Media `json:"video,omitempty"`
 	}
 
 	// InteractiveFooter contains information about an interactive footer.
@@ -494,9 +535,11 @@ type (
 			  You cannot set a header if your interactive object is of product type. See header object for more information.
 
 			- Type, type (string) Required. The type of interactive message you want to send. Supported values:
-				- button: Used for List Messages and Reply Buttons.
+				- button: Used for Reply Buttons.
+				- list: Used for List Messages.
 				- product: Used for Single Product Messages.
 				- product_list: Used for Multi-Product Messages.
+				- cta_url: Used for CTA URL Button Messages.
 	*/
 	Interactive struct {
 		Type   string             `json:"type,omitempty"`
@@ -585,3 +628,50 @@ type (
 		Interactive   *Interactive `json:"interactive,omitempty"`
 	}
 )
+
+// MarshalJSON encodes the component. The index of a button component is always encoded, as it
+// is required by the API, even for the first button whose index is 0.
+func (component TemplateComponent) MarshalJSON() ([]byte, error) {
+	type alias TemplateComponent
+	if component.Type != "button" {
+		return json.Marshal(alias(component))
+	}
+
+	return json.Marshal(struct {
+		alias
+		Index int `json:"index"`
+	}{
+		alias: alias(component),
+		Index: component.Index,
+	})
+}
+
+// MarshalJSON encodes the contacts as the array expected by the API.
+func (contacts Contacts) MarshalJSON() ([]byte, error) {
+	list := contacts.Contacts
+	if list == nil {
+		list = []*Contact{}
+	}
+
+	return json.Marshal(list)
+}
+
+// UnmarshalJSON decodes the contacts from an array, as received in webhooks, or from an object
+// with a contacts field.
+func (contacts *Contacts) UnmarshalJSON(data []byte) error {
+	var list []*Contact
+	if err := json.Unmarshal(data, &list); err == nil {
+		contacts.Contacts = list
+
+		return nil
+	}
+
+	type alias Contacts
+	var value alias
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err //nolint:wrapcheck
+	}
+	*contacts = Contacts(value)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestContacts_JSON(t *testing.T) {
+	t.Parallel()
+	contacts := &Contacts{Contacts: []*Contact{{Name: Name{FormattedName: "Pius Alfred"}}}}
+	data, err := json.Marshal(contacts)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	if len(data) == 0 || data[0] != '[' {
+		t.Errorf("Marshal() = %s, want the array of contacts sent to the API", data)
+	}
+
+	if data, _ := json.Marshal(&Contacts{}); string(data) != "[]" {
+		t.Errorf("Marshal(empty) = %s, want []", data)
+	}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "array", data: string(data)},
+		{name: "object", data: `{"contacts":[{"name":{"formatted_name":"Pius Alfred"}}]}`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var decoded Contacts
+			if err := json.Unmarshal([]byte(tt.data), &decoded); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if len(decoded.Contacts) != 1 || decoded.Contacts[0].Name.FormattedName != "Pius Alfred" {
+				t.Errorf("Unmarshal() = %+v, want one contact", decoded)
+			}
+		})
+	}
+}
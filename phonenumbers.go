@@ -39,12 +39,13 @@ type (
 	// CodeMethod is the method to use to send the code. It can be SMS or VOICE
 	// Language is the language to use for the code. eg. en
 	VerificationCodeRequest struct {
-		Token         string `json:"token"`
-		BaseURL       string `json:"base_url"`
-		ApiVersion    string `json:"api_version"`
-		PhoneNumberID string `json:"phone_number_id"`
-		CodeMethod    string `json:"code_method"`
-		Language      string `json:"language"` // eg. en
+		Token         string             `json:"token"`
+		BaseURL       string             `json:"base_url"`
+		ApiVersion    string             `json:"api_version"`
+		PhoneNumberID string             `json:"phone_number_id"`
+		CodeMethod    string             `json:"code_method"`
+		Language      string             `json:"language"` // eg. en
+		RetryPolicy   *whttp.RetryPolicy `json:"-"`
 	}
 
 	PhoneNumber struct {
@@ -116,6 +117,7 @@ func RequestCode(ctx context.Context, client *http.Client, req *VerificationCode
 		Bearer:  req.Token,
 		Form:    map[string]string{"code_method": req.CodeMethod, "language": req.Language},
 		Payload: nil,
+		Retry:   req.RetryPolicy,
 	}
 	err := whttp.Send(ctx, client, params, nil)
 	if err != nil {
@@ -154,6 +156,7 @@ func VerifyCode(ctx context.Context, client *http.Client, req *VerificationCodeR
 		Query:   nil,
 		Bearer:  req.Token,
 		Form:    map[string]string{"code": code},
+		Retry:   req.RetryPolicy,
 	}
 
 	err := whttp.Send(ctx, client, params, nil)
@@ -175,6 +178,7 @@ type ListPhoneNumbersRequest struct {
 	Token        string
 	BusinessID   string
 	FilterParams []*PhoneNumberFilterParams
+	RetryPolicy  *whttp.RetryPolicy
 }
 
 // ListPhoneNumbers retrieve Phone Numbers that a business has registered for their WhatsApp
@@ -254,6 +258,7 @@ func ListPhoneNumbers(ctx context.Context, client *http.Client, token string, re
 		Context: reqCtx,
 		Method:  http.MethodGet,
 		Query:   map[string]string{"access_token": req.Token},
+		Retry:   req.RetryPolicy,
 	}
 	if req.FilterParams != nil {
 		p := req.FilterParams
@@ -83,6 +83,7 @@ func Create(ctx context.Context, client *http.Client, rtx *RequestContext,
 		Context: reqCtx,
 		Method:  http.MethodPost,
 		Query:   queryParams,
+		Retry:   rtx.RetryPolicy,
 	}
 
 	var response CreateResponse
@@ -108,6 +109,7 @@ func List(ctx context.Context, client *http.Client, rctx *RequestContext) (*List
 		Context: reqCtx,
 		Method:  http.MethodGet,
 		Query:   map[string]string{"access_token": rctx.AccessToken},
+		Retry:   rctx.RetryPolicy,
 	}
 
 	var response ListResponse
@@ -120,10 +122,11 @@ func List(ctx context.Context, client *http.Client, rctx *RequestContext) (*List
 }
 
 type RequestContext struct {
-	BaseURL     string `json:"-"`
-	PhoneID     string `json:"-"`
-	ApiVersion  string `json:"-"`
-	AccessToken string `json:"-"`
+	BaseURL     string             `json:"-"`
+	PhoneID     string             `json:"-"`
+	ApiVersion  string             `json:"-"`
+	AccessToken string             `json:"-"`
+	RetryPolicy *whttp.RetryPolicy `json:"-"`
 }
 
 var ErrNoDataFound = fmt.Errorf("no data found")
@@ -145,6 +148,7 @@ func Get(ctx context.Context, client *http.Client, rctx *RequestContext, qrCodeI
 		Context: reqCtx,
 		Method:  http.MethodGet,
 		Query:   map[string]string{"access_token": rctx.AccessToken},
+		Retry:   rctx.RetryPolicy,
 	}
 
 	err := whttp.Send(ctx, client, req, &list)
@@ -180,6 +184,7 @@ func Update(ctx context.Context, client *http.Client, rtx *RequestContext, qrCod
 			"generate_qr_image": string(req.ImageFormat),
 			"access_token":      rtx.AccessToken,
 		},
+		Retry: rtx.RetryPolicy,
 	}
 
 	var resp SuccessResponse
@@ -204,6 +209,7 @@ func Delete(ctx context.Context, client *http.Client, rtx *RequestContext, qrCod
 		Context: reqCtx,
 		Method:  http.MethodDelete,
 		Query:   map[string]string{"access_token": rtx.AccessToken},
+		Retry:   rtx.RetryPolicy,
 	}
 	var resp SuccessResponse
 	err := whttp.Send(ctx, client, req, &resp)
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+/*
+Package ratelimit provides a client side throughput governor for outbound messages.
+
+The Cloud API limits how many messages a business phone number can send per second (80 by default)
+and how often a business phone number can message the same recipient (the pair rate limit, about
+one message every 6 seconds). Going past these limits results in errors with codes 130429 (rate
+limit hit) and 131056 (pair rate limit hit).
+
+A Limiter enforces both limits before a request leaves the process. Each business phone number ID
+gets its own token bucket refilled at Config.MessagesPerSecond, and each (phone number ID, recipient)
+pair is spaced at least Config.PairInterval apart. In Block mode Wait sleeps until the message can be
+sent, in FailFast mode it returns an error wrapping ErrRateLimited immediately.
+
+A single Limiter is safe for concurrent use and can be shared by many clients.
+*/
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMessagesPerSecond is the default Cloud API throughput of a business phone number.
+	DefaultMessagesPerSecond = 80
+
+	// DefaultPairInterval is the minimum spacing between two messages sent by a business phone
+	// number to the same recipient.
+	DefaultPairInterval = 6 * time.Second
+)
+
+const (
+	// Block makes Wait sleep until the message is allowed or the context is done.
+	Block Mode = iota
+
+	// FailFast makes Wait return an error immediately if the message is not allowed yet.
+	FailFast
+)
+
+// pairsSweepThreshold is the number of tracked pairs past which expired pairs are removed.
+const pairsSweepThreshold = 4096
+
+var ErrRateLimited = errors.New("rate limited")
+
+type (
+	// Mode tells a Limiter what to do when a message is not allowed yet.
+	Mode int
+
+	// Config configures a Limiter.
+	//
+	// MessagesPerSecond is the sustained number of messages allowed per business phone number ID.
+	// Zero or a negative value disables the throughput limit.
+	//
+	// Burst is the maximum number of messages that can be sent at once. It defaults to
+	// MessagesPerSecond rounded up.
+	//
+	// PairInterval is the minimum time between two messages sent to the same recipient from
+	// the same business phone number ID. Zero disables the pair limit.
+	//
+	// Mode selects between Block and FailFast.
+	Config struct {
+		MessagesPerSecond float64
+		Burst             int
+		PairInterval      time.Duration
+		Mode              Mode
+	}
+
+	// Limiter enforces the limits described by a Config.
+	Limiter struct {
+		mu      sync.Mutex
+		config  Config
+		buckets map[string]*bucket
+		pairs   map[pair]time.Time
+		now     func() time.Time
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	pair struct {
+		phoneNumberID string
+		recipient     string
+	}
+
+	// reservation is a slot booked in a bucket and a pair that can be given back.
+	reservation struct {
+		at         time.Time
+		bucket     *bucket
+		pair       *pair
+		pairBefore time.Time
+	}
+)
+
+// DefaultConfig returns a Config with the documented Cloud API defaults in Block mode.
+func DefaultConfig() *Config {
+	return &Config{
+		MessagesPerSecond: DefaultMessagesPerSecond,
+		Burst:             DefaultMessagesPerSecond,
+		PairInterval:      DefaultPairInterval,
+		Mode:              Block,
+	}
+}
+
+// New creates a Limiter. A nil config is replaced by DefaultConfig.
+func New(config *Config) *Limiter {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	cfg := *config
+	if cfg.Burst <= 0 && cfg.MessagesPerSecond > 0 {
+		cfg.Burst = int(math.Ceil(cfg.MessagesPerSecond))
+	}
+
+	return &Limiter{
+		config:  cfg,
+		buckets: make(map[string]*bucket),
+		pairs:   make(map[pair]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Wait blocks until a message from the phone number ID to the recipient is allowed. An empty
+// recipient, like for read receipts, is only subject to the throughput limit.
+//
+// In FailFast mode, or when the context deadline comes before the message would be allowed,
+// Wait returns an error wrapping ErrRateLimited without consuming any capacity.
+func (l *Limiter) Wait(ctx context.Context, phoneNumberID, recipient string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	at := l.readyAt(now, phoneNumberID, recipient)
+	delay := at.Sub(now)
+
+	if delay > 0 {
+		if l.config.Mode == FailFast {
+			l.mu.Unlock()
+
+			return fmt.Errorf("%w: %s to %q: retry in %s", ErrRateLimited, phoneNumberID, recipient, delay)
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(at) {
+			l.mu.Unlock()
+
+			return fmt.Errorf("%w: %s to %q: wait of %s exceeds context deadline",
+				ErrRateLimited, phoneNumberID, recipient, delay)
+		}
+	}
+
+	res := l.reserve(now, at, phoneNumberID, recipient)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.cancel(res)
+		l.mu.Unlock()
+
+		return fmt.Errorf("rate limit wait: %w", ctx.Err())
+	}
+}
+
+// readyAt returns the earliest time a message can be sent. It must be called with l.mu held.
+func (l *Limiter) readyAt(now time.Time, phoneNumberID, recipient string) time.Time {
+	at := now
+	if rate := l.config.MessagesPerSecond; rate > 0 {
+		b := l.bucket(phoneNumberID, now)
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+			at = now.Add(wait)
+		}
+	}
+
+	if interval := l.config.PairInterval; interval > 0 && recipient != "" {
+		if last, ok := l.pairs[pair{phoneNumberID, recipient}]; ok {
+			if next := last.Add(interval); next.After(at) {
+				at = next
+			}
+		}
+	}
+
+	return at
+}
+
+// reserve books a slot at the given time. It must be called with l.mu held.
+func (l *Limiter) reserve(now, at time.Time, phoneNumberID, recipient string) *reservation {
+	res := &reservation{at: at}
+	if l.config.MessagesPerSecond > 0 {
+		res.bucket = l.bucket(phoneNumberID, now)
+		res.bucket.tokens--
+	}
+
+	if l.config.PairInterval > 0 && recipient != "" {
+		if len(l.pairs) > pairsSweepThreshold {
+			l.sweep(now)
+		}
+		key := pair{phoneNumberID, recipient}
+		res.pair = &key
+		res.pairBefore = l.pairs[key]
+		l.pairs[key] = at
+	}
+
+	return res
+}
+
+// cancel gives back a reservation that was not used. It must be called with l.mu held.
+func (l *Limiter) cancel(res *reservation) {
+	if res.bucket != nil {
+		res.bucket.tokens++
+		if burst := float64(l.config.Burst); res.bucket.tokens > burst {
+			res.bucket.tokens = burst
+		}
+	}
+
+	if res.pair != nil && l.pairs[*res.pair].Equal(res.at) {
+		if res.pairBefore.IsZero() {
+			delete(l.pairs, *res.pair)
+		} else {
+			l.pairs[*res.pair] = res.pairBefore
+		}
+	}
+}
+
+// bucket returns the refilled bucket of the phone number ID. It must be called with l.mu held.
+func (l *Limiter) bucket(phoneNumberID string, now time.Time) *bucket {
+	burst := float64(l.config.Burst)
+	b, ok := l.buckets[phoneNumberID]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[phoneNumberID] = b
+
+		return b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*l.config.MessagesPerSecond)
+		b.last = now
+	}
+
+	return b
+}
+
+// sweep removes the pairs that no longer restrict sending. It must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, last := range l.pairs {
+		if now.Sub(last) >= l.config.PairInterval {
+			delete(l.pairs, key)
+		}
+	}
+}
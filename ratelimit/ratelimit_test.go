@@ -0,0 +1,173 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(config *Config) (*Limiter, *clock) {
+	c := &clock{t: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(config)
+	l.now = c.now
+
+	return l, c
+}
+
+func TestLimiter_FailFast(t *testing.T) {
+	t.Parallel()
+	l, c := newTestLimiter(&Config{
+		MessagesPerSecond: 2,
+		Burst:             2,
+		PairInterval:      0,
+		Mode:              FailFast,
+	})
+	ctx := context.TODO()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, "phone", ""); err != nil {
+			t.Fatalf("Wait() #%d error = %v, want nil", i, err)
+		}
+	}
+
+	if err := l.Wait(ctx, "phone", ""); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Wait() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	// buckets are kept per phone number id
+	if err := l.Wait(ctx, "other phone", ""); err != nil {
+		t.Fatalf("Wait() other phone error = %v, want nil", err)
+	}
+
+	c.advance(500 * time.Millisecond)
+	if err := l.Wait(ctx, "phone", ""); err != nil {
+		t.Fatalf("Wait() after refill error = %v, want nil", err)
+	}
+}
+
+func TestLimiter_PairInterval(t *testing.T) {
+	t.Parallel()
+	l, c := newTestLimiter(&Config{
+		MessagesPerSecond: 0,
+		PairInterval:      6 * time.Second,
+		Mode:              FailFast,
+	})
+	ctx := context.TODO()
+
+	if err := l.Wait(ctx, "phone", "255700000000"); err != nil {
+		t.Fatalf("Wait() error = %v, want nil", err)
+	}
+
+	if err := l.Wait(ctx, "phone", "255700000000"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Wait() same recipient error = %v, want %v", err, ErrRateLimited)
+	}
+
+	if err := l.Wait(ctx, "phone", "255711111111"); err != nil {
+		t.Fatalf("Wait() other recipient error = %v, want nil", err)
+	}
+
+	c.advance(6 * time.Second)
+	if err := l.Wait(ctx, "phone", "255700000000"); err != nil {
+		t.Fatalf("Wait() after interval error = %v, want nil", err)
+	}
+}
+
+func TestLimiter_Block(t *testing.T) {
+	t.Parallel()
+	l := New(&Config{
+		MessagesPerSecond: 50,
+		Burst:             1,
+		Mode:              Block,
+	})
+	ctx := context.TODO()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, "phone", "255700000000"); err != nil {
+			t.Fatalf("Wait() #%d error = %v, want nil", i, err)
+		}
+	}
+
+	// the first message goes through immediately, the next two wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Wait() returned after %s, want at least 40ms", elapsed)
+	}
+}
+
+func TestLimiter_BlockDeadline(t *testing.T) {
+	t.Parallel()
+	l := New(&Config{
+		PairInterval: time.Minute,
+		Mode:         Block,
+	})
+
+	if err := l.Wait(context.TODO(), "phone", "255700000000"); err != nil {
+		t.Fatalf("Wait() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := l.Wait(ctx, "phone", "255700000000"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Wait() error = %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestLimiter_CancelReturnsCapacity(t *testing.T) {
+	t.Parallel()
+	l := New(&Config{
+		MessagesPerSecond: 1,
+		Burst:             1,
+		Mode:              Block,
+	})
+
+	if err := l.Wait(context.TODO(), "phone", ""); err != nil {
+		t.Fatalf("Wait() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if err := l.Wait(ctx, "phone", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() error = %v, want %v", err, context.Canceled)
+	}
+
+	l.mu.Lock()
+	tokens := l.buckets["phone"].tokens
+	l.mu.Unlock()
+
+	if tokens < 0 {
+		t.Errorf("bucket tokens = %v after cancellation, want the reservation given back", tokens)
+	}
+}
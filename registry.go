@@ -0,0 +1,193 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/piusalfred/whatsapp/auth"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+var (
+	ErrUnknownTenant = errors.New("unknown tenant")
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
+type (
+	// Tenant holds the credentials of a business served by a Registry. The access token is
+	// taken from TokenSource, or from AccessToken when TokenSource is nil.
+	Tenant struct {
+		Name              string
+		PhoneNumberID     string
+		BusinessAccountID string
+		AccessToken       string
+		TokenSource       auth.TokenSource
+	}
+
+	// Registry holds a Client for each tenant, keyed by the tenant's phone number ID.
+	//
+	// The options passed to NewRegistry are applied to every client, so the clients share the
+	// same http.Client, ratelimit.Limiter and retry policy. The limiter keeps its state per
+	// sender phone number, so the tenants do not throttle each other.
+	//
+	// A Registry resolves the client of the business that received a webhook notification from
+	// its metadata, so replies are sent from the right phone number:
+	//
+	//	listener.OnTextMessage(func(ctx context.Context, nctx *webhooks.NotificationContext,
+	//		mctx *webhooks.MessageContext, text *webhooks.Text,
+	//	) error {
+	//		client, err := registry.ClientFor(nctx)
+	//		if err != nil {
+	//			return err
+	//		}
+	//		_, err = client.SendTextMessage(ctx, mctx.From, &whatsapp.TextMessage{Message: "hello"})
+	//
+	//		return err
+	//	})
+	Registry struct {
+		mu      sync.RWMutex
+		options []ClientOption
+		tenants map[string]*registryEntry
+	}
+
+	registryEntry struct {
+		tenant *Tenant
+		client *Client
+	}
+)
+
+// NewRegistry returns an empty Registry whose clients are created with the given options.
+func NewRegistry(options ...ClientOption) *Registry {
+	return &Registry{
+		options: options,
+		tenants: make(map[string]*registryEntry),
+	}
+}
+
+// Register adds the tenant and returns its client. A tenant already registered with the
+// same phone number ID is replaced, which is how its credentials are changed.
+func (registry *Registry) Register(tenant *Tenant) (*Client, error) {
+	if tenant == nil || tenant.PhoneNumberID == "" {
+		return nil, fmt.Errorf("registry: %w: missing phone number id", ErrInvalidTenant)
+	}
+
+	source := tenant.TokenSource
+	if source == nil {
+		source = auth.StaticTokenSource(tenant.AccessToken)
+	}
+
+	options := make([]ClientOption, 0, len(registry.options)+3)
+	options = append(options, registry.options...)
+	options = append(options,
+		WithPhoneNumberID(tenant.PhoneNumberID),
+		WithBusinessAccountID(tenant.BusinessAccountID),
+		WithTokenSource(source),
+	)
+
+	t := *tenant
+	entry := &registryEntry{tenant: &t, client: NewClient(options...)}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.tenants[tenant.PhoneNumberID] = entry
+
+	return entry.client, nil
+}
+
+// Remove removes the tenant with the phone number ID. It reports whether the tenant was
+// registered.
+func (registry *Registry) Remove(phoneNumberID string) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	_, ok := registry.tenants[phoneNumberID]
+	delete(registry.tenants, phoneNumberID)
+
+	return ok
+}
+
+// Client returns the client of the tenant with the phone number ID.
+func (registry *Registry) Client(phoneNumberID string) (*Client, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	entry, ok := registry.tenants[phoneNumberID]
+	if !ok {
+		return nil, fmt.Errorf("registry: %w: %q", ErrUnknownTenant, phoneNumberID)
+	}
+
+	return entry.client, nil
+}
+
+// Tenant returns a copy of the tenant with the phone number ID.
+func (registry *Registry) Tenant(phoneNumberID string) (*Tenant, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	entry, ok := registry.tenants[phoneNumberID]
+	if !ok {
+		return nil, false
+	}
+	t := *entry.tenant
+
+	return &t, true
+}
+
+// Tenants returns copies of the registered tenants sorted by phone number ID.
+func (registry *Registry) Tenants() []*Tenant {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	tenants := make([]*Tenant, 0, len(registry.tenants))
+	for _, entry := range registry.tenants {
+		t := *entry.tenant
+		tenants = append(tenants, &t)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].PhoneNumberID < tenants[j].PhoneNumberID
+	})
+
+	return tenants
+}
+
+// ClientFor returns the client of the tenant that received the notification, identified by
+// the phone number ID of the notification metadata.
+func (registry *Registry) ClientFor(nctx *webhooks.NotificationContext) (*Client, error) {
+	if nctx == nil {
+		return nil, fmt.Errorf("registry: %w: no notification metadata", ErrUnknownTenant)
+	}
+
+	return registry.ClientForMetadata(nctx.Metadata)
+}
+
+// ClientForMetadata returns the client of the tenant identified by the metadata of a
+// notification value, for use with the generic notification handlers that work with
+// webhooks.Value directly.
+func (registry *Registry) ClientForMetadata(metadata *webhooks.Metadata) (*Client, error) {
+	if metadata == nil {
+		return nil, fmt.Errorf("registry: %w: no notification metadata", ErrUnknownTenant)
+	}
+
+	return registry.Client(metadata.PhoneNumberID)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/piusalfred/whatsapp/auth"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		seen = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// path is /v16.0/<phone number id>/messages
+		seen[strings.Split(r.URL.Path, "/")[2]] = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	registry := NewRegistry(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	if _, err := registry.Register(&Tenant{Name: "shop", PhoneNumberID: "111", AccessToken: "shop-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Register(&Tenant{
+		Name: "bank", PhoneNumberID: "222", TokenSource: auth.StaticTokenSource("bank-token"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Register(&Tenant{Name: "no id"}); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("Register() error = %v, want %v", err, ErrInvalidTenant)
+	}
+
+	for _, id := range []string{"111", "222"} {
+		nctx := &webhooks.NotificationContext{Metadata: &webhooks.Metadata{PhoneNumberID: id}}
+		client, err := registry.ClientFor(nctx)
+		if err != nil {
+			t.Fatalf("ClientFor(%s) error = %v", id, err)
+		}
+
+		if client.http != server.Client() {
+			t.Errorf("ClientFor(%s) does not use the shared http client", id)
+		}
+
+		if _, err := client.SendTextMessage(context.Background(), "255712345678",
+			&TextMessage{Message: "hello"}); err != nil {
+			t.Fatalf("SendTextMessage() error = %v", err)
+		}
+	}
+
+	want := map[string]string{"111": "Bearer shop-token", "222": "Bearer bank-token"}
+	for id, header := range want {
+		if seen[id] != header {
+			t.Errorf("request from %s authorized with %q, want %q", id, seen[id], header)
+		}
+	}
+
+	_, err := registry.ClientFor(&webhooks.NotificationContext{Metadata: &webhooks.Metadata{PhoneNumberID: "333"}})
+	if !errors.Is(err, ErrUnknownTenant) {
+		t.Errorf("ClientFor() error = %v, want %v", err, ErrUnknownTenant)
+	}
+
+	if !registry.Remove("111") || len(registry.Tenants()) != 1 {
+		t.Errorf("Remove() did not remove the tenant, tenants = %v", registry.Tenants())
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// SentMessage is a message accepted by the Cloud API. WaID is the WhatsApp ID of the
+	// recipient, when the API returns it.
+	SentMessage struct {
+		ID            string
+		PhoneNumberID string
+		Recipient     string
+		WaID          string
+		Type          string
+		SentAt        time.Time
+	}
+
+	// MessageSentHook is called for every message accepted by the Cloud API, to correlate
+	// the messages sent with their status notifications for example.
+	MessageSentHook func(ctx context.Context, message *SentMessage)
+)
+
+// WithMessageSentHook sets the hook called after every message sent by the client.
+func WithMessageSentHook(hook MessageSentHook) ClientOption {
+	return func(client *Client) {
+		client.onMessageSent = hook
+	}
+}
+
+// sendMessage sends the message of the type to the recipient with withThrottledToken, and calls
+// the MessageSentHook for the messages in the response. The free-form messages are checked by
+// the WindowGuard first, which may send a template instead.
+func (client *Client) sendMessage(ctx context.Context, recipient, messageType string,
+	send func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error),
+) (*ResponseMessage, error) {
+	if client.windowGuard != nil && messageType != "template" {
+		template, err := client.windowGuard.guard(ctx, recipient, messageType)
+		if err != nil {
+			return nil, err
+		}
+
+		if template != nil {
+			return client.SendTemplate(ctx, recipient, template)
+		}
+	}
+
+	var phoneNumberID string
+	resp, err := withThrottledToken(ctx, client, recipient,
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			phoneNumberID = cctx.phoneNumberID
+
+			return send(ctx, cctx)
+		})
+	if err != nil || resp == nil || client.onMessageSent == nil {
+		return resp, err
+	}
+
+	var waID string
+	if len(resp.Contacts) > 0 {
+		waID = resp.Contacts[0].WhatsappID
+	}
+
+	now := time.Now()
+	for _, message := range resp.Messages {
+		client.onMessageSent(ctx, &SentMessage{
+			ID:            message.ID,
+			PhoneNumberID: phoneNumberID,
+			Recipient:     recipient,
+			WaID:          waID,
+			Type:          messageType,
+			SentAt:        now,
+		})
+	}
+
+	return resp, nil
+}
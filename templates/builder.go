@@ -0,0 +1,507 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/piusalfred/whatsapp/models"
+)
+
+// Parameter types of models.TemplateParameter.
+const (
+	ParameterText     = "text"
+	ParameterCurrency = "currency"
+	ParameterDateTime = "date_time"
+	ParameterImage    = "image"
+	ParameterDocument = "document"
+	ParameterVideo    = "video"
+	ParameterLocation = "location"
+	ParameterPayload  = "payload"
+	ParameterCoupon   = "coupon_code"
+)
+
+// MaxHeaderParameterLength is the maximum length in characters of a text parameter of a header.
+const MaxHeaderParameterLength = 60
+
+// MaxCouponCodeLength is the maximum length in characters of the coupon code of a copy code button.
+const MaxCouponCodeLength = 15
+
+var (
+	// ErrParameterMismatch is returned by Builder.Build when the parameters do not match
+	// the template definition.
+	ErrParameterMismatch = errors.New("template parameters do not match the definition")
+
+	placeholderRegex = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+)
+
+// DecodeTemplate decodes a template definition from JSON, in the same shape returned by Get.
+func DecodeTemplate(r io.Reader) (*Template, error) {
+	var template Template
+	if err := json.NewDecoder(r).Decode(&template); err != nil {
+		return nil, fmt.Errorf("decode template: %w", err)
+	}
+
+	return &template, nil
+}
+
+// Component returns the first component of the given type or nil if the template has none.
+func (template *Template) Component(componentType ComponentType) *Component {
+	for _, component := range template.Components {
+		if component != nil && strings.EqualFold(string(component.Type), string(componentType)) {
+			return component
+		}
+	}
+
+	return nil
+}
+
+// Placeholders returns the number of {{n}} variables of the component text. The variables must
+// be numbered from 1 without gaps, templates with named variables are not supported.
+func Placeholders(text string) (int, error) {
+	seen := map[int]bool{}
+	for _, match := range placeholderRegex.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("%w: unsupported variable %s", ErrParameterMismatch, match[0])
+		}
+		seen[n] = true
+	}
+
+	for i := 1; i <= len(seen); i++ {
+		if !seen[i] {
+			return 0, fmt.Errorf("%w: variables are not numbered from {{1}} to {{%d}}", ErrParameterMismatch,
+				len(seen))
+		}
+	}
+
+	return len(seen), nil
+}
+
+// Builder builds the components of a template message and checks the parameters against the
+// definition of the template. Parameters are set with Header, Body and Button and the message
+// is created with Build.
+//
+//	message, err := templates.NewBuilder(definition).
+//		Header(templates.ImageParameter(&models.Media{Link: "https://example.com/banner.png"})).
+//		Body(templates.TextParameter("Pius"), templates.CurrencyParameter("$10.99", "USD", 10990)).
+//		Button(0, templates.URLParameter("order/12345")).
+//		Build()
+type Builder struct {
+	definition     *Template
+	languagePolicy string
+	header         []*models.TemplateParameter
+	body           []*models.TemplateParameter
+	buttons        map[int]*models.TemplateParameter
+}
+
+// NewBuilder returns a Builder for the template definition.
+func NewBuilder(definition *Template) *Builder {
+	return &Builder{
+		definition: definition,
+		buttons:    map[int]*models.TemplateParameter{},
+	}
+}
+
+// LanguagePolicy sets the language policy of the message, the default policy is deterministic.
+func (b *Builder) LanguagePolicy(policy string) *Builder {
+	b.languagePolicy = policy
+
+	return b
+}
+
+// Header sets the parameters of the header. A text header takes one text parameter per variable,
+// a media header takes a single parameter of its format and a location header a location parameter.
+func (b *Builder) Header(params ...*models.TemplateParameter) *Builder {
+	b.header = params
+
+	return b
+}
+
+// Body sets the parameters of the body, one per variable in order.
+func (b *Builder) Body(params ...*models.TemplateParameter) *Builder {
+	b.body = params
+
+	return b
+}
+
+// Button sets the parameter of the button at the index. URL buttons with a variable take a
+// URLParameter, quick reply buttons take a PayloadParameter and copy code buttons take a
+// CouponCodeParameter.
+func (b *Builder) Button(index int, param *models.TemplateParameter) *Builder {
+	b.buttons[index] = param
+
+	return b
+}
+
+// Build checks the parameters against the definition and returns the template of the message.
+// The error wraps ErrParameterMismatch and names the component and parameter at fault.
+func (b *Builder) Build() (*models.Template, error) {
+	if b.definition == nil {
+		return nil, fmt.Errorf("%w: template definition is nil", ErrParameterMismatch)
+	}
+
+	if b.definition.Name == "" || b.definition.Language == "" {
+		return nil, fmt.Errorf("%w: template definition requires a name and a language", ErrParameterMismatch)
+	}
+
+	var components []*models.TemplateComponent
+
+	header, err := b.buildHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		components = append(components, header)
+	}
+
+	body, err := b.buildBody()
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		components = append(components, body)
+	}
+
+	buttons, err := b.buildButtons()
+	if err != nil {
+		return nil, err
+	}
+	components = append(components, buttons...)
+
+	policy := b.languagePolicy
+	if policy == "" {
+		policy = "deterministic"
+	}
+
+	return &models.Template{
+		Name:       b.definition.Name,
+		Language:   &models.TemplateLanguage{Code: b.definition.Language, Policy: policy},
+		Components: components,
+	}, nil
+}
+
+func (b *Builder) buildHeader() (*models.TemplateComponent, error) {
+	definition := b.definition.Component(ComponentHeader)
+	if definition == nil {
+		if len(b.header) > 0 {
+			return nil, fmt.Errorf("%w: header: template has no header, got %d parameters",
+				ErrParameterMismatch, len(b.header))
+		}
+
+		return nil, nil //nolint:nilnil // no header component.
+	}
+
+	format := definition.Format
+	if format == "" {
+		format = FormatText
+	}
+
+	switch format {
+	case FormatText:
+		n, err := Placeholders(definition.Text)
+		if err != nil {
+			return nil, fmt.Errorf("header: %w", err)
+		}
+
+		if err := checkCount("header", n, len(b.header)); err != nil {
+			return nil, err
+		}
+
+		for i, param := range b.header {
+			if err := checkParameter("header", i, param, ParameterText); err != nil {
+				return nil, err
+			}
+
+			if l := utf8.RuneCountInString(param.Text); l > MaxHeaderParameterLength {
+				return nil, fmt.Errorf("%w: header parameter {{%d}} is %d characters long, maximum is %d",
+					ErrParameterMismatch, i+1, l, MaxHeaderParameterLength)
+			}
+		}
+	case FormatImage, FormatVideo, FormatDocument, FormatLocation:
+		if err := checkCount("header", 1, len(b.header)); err != nil {
+			return nil, err
+		}
+
+		if err := checkParameter("header", 0, b.header[0], strings.ToLower(string(format))); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: header: unsupported format %q", ErrParameterMismatch, format)
+	}
+
+	if len(b.header) == 0 {
+		return nil, nil //nolint:nilnil // header without variables.
+	}
+
+	return &models.TemplateComponent{Type: "header", Parameters: b.header}, nil
+}
+
+func (b *Builder) buildBody() (*models.TemplateComponent, error) {
+	definition := b.definition.Component(ComponentBody)
+	text := ""
+	if definition != nil {
+		text = definition.Text
+	}
+
+	n, err := Placeholders(text)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	if err := checkCount("body", n, len(b.body)); err != nil {
+		return nil, err
+	}
+
+	for i, param := range b.body {
+		if err := checkParameter("body", i, param, ParameterText, ParameterCurrency, ParameterDateTime); err != nil {
+			return nil, err
+		}
+
+		if param.Type == ParameterText {
+			if err := checkBodyText(i, param.Text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(b.body) == 0 {
+		return nil, nil //nolint:nilnil // body without variables.
+	}
+
+	return &models.TemplateComponent{Type: "body", Parameters: b.body}, nil
+}
+
+func (b *Builder) buildButtons() ([]*models.TemplateComponent, error) {
+	var buttons []*Button
+	if definition := b.definition.Component(ComponentButtons); definition != nil {
+		buttons = definition.Buttons
+	}
+
+	indexes := make([]int, 0, len(b.buttons))
+	for index := range b.buttons {
+		if index < 0 || index >= len(buttons) {
+			return nil, fmt.Errorf("%w: button %d: template has %d buttons", ErrParameterMismatch,
+				index, len(buttons))
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for i, button := range buttons {
+		if b.buttons[i] == nil && buttonHasVariable(button) {
+			return nil, fmt.Errorf("%w: button %d (%s): missing url parameter for %s", ErrParameterMismatch,
+				i, button.Type, button.URL)
+		}
+	}
+
+	components := make([]*models.TemplateComponent, 0, len(indexes))
+	for _, index := range indexes {
+		button, param := buttons[index], b.buttons[index]
+		name := fmt.Sprintf("button %d (%s)", index, button.Type)
+
+		var subType string
+		switch button.Type {
+		case ButtonURL, ButtonOTP:
+			if button.Type == ButtonURL && !buttonHasVariable(button) {
+				return nil, fmt.Errorf("%w: %s: url %s has no variable", ErrParameterMismatch, name, button.URL)
+			}
+
+			if err := checkParameter(name, 0, param, ParameterText); err != nil {
+				return nil, err
+			}
+			subType = "url"
+		case ButtonQuickReply:
+			if err := checkParameter(name, 0, param, ParameterPayload); err != nil {
+				return nil, err
+			}
+			subType = "quick_reply"
+		case ButtonCopyCode:
+			if err := checkParameter(name, 0, param, ParameterCoupon); err != nil {
+				return nil, err
+			}
+
+			if utf8.RuneCountInString(param.CouponCode) > MaxCouponCodeLength {
+				return nil, fmt.Errorf("%w: %s: coupon code is longer than %d characters", ErrParameterMismatch,
+					name, MaxCouponCodeLength)
+			}
+			subType = "copy_code"
+		default:
+			return nil, fmt.Errorf("%w: %s: button does not take parameters", ErrParameterMismatch, name)
+		}
+
+		components = append(components, &models.TemplateComponent{
+			Type:       "button",
+			SubType:    subType,
+			Index:      index,
+			Parameters: []*models.TemplateParameter{param},
+		})
+	}
+
+	return components, nil
+}
+
+func buttonHasVariable(button *Button) bool {
+	return button != nil && button.Type == ButtonURL && placeholderRegex.MatchString(button.URL)
+}
+
+func checkCount(component string, want, got int) error {
+	if want != got {
+		return fmt.Errorf("%w: %s: template has %d parameters, got %d", ErrParameterMismatch, component, want, got)
+	}
+
+	return nil
+}
+
+// checkParameter checks that the parameter has one of the allowed types and that the value
+// of its type is set.
+func checkParameter(component string, i int, param *models.TemplateParameter, allowed ...string) error {
+	if param == nil {
+		return fmt.Errorf("%w: %s parameter {{%d}} is nil", ErrParameterMismatch, component, i+1)
+	}
+
+	found := false
+	for _, t := range allowed {
+		found = found || param.Type == t
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s parameter {{%d}} has type %q, want %s", ErrParameterMismatch, component, i+1,
+			param.Type, strings.Join(allowed, " or "))
+	}
+
+	var missing bool
+	switch param.Type {
+	case ParameterText:
+		missing = param.Text == ""
+	case ParameterPayload:
+		missing = param.Payload == ""
+	case ParameterCoupon:
+		missing = param.CouponCode == ""
+	case ParameterCurrency:
+		missing = param.Currency == nil || param.Currency.Code == "" || param.Currency.FallbackValue == ""
+	case ParameterDateTime:
+		missing = param.DateTime == nil || param.DateTime.FallbackValue == ""
+	case ParameterImage:
+		missing = param.Image == nil || (param.Image.ID == "" && param.Image.Link == "")
+	case ParameterDocument:
+		missing = param.Document == nil || (param.Document.ID == "" && param.Document.Link == "")
+	case ParameterVideo:
+		missing = param.Video == nil || (param.Video.ID == "" && param.Video.Link == "")
+	case ParameterLocation:
+		missing = param.Location == nil
+	}
+
+	if missing {
+		return fmt.Errorf("%w: %s parameter {{%d}} of type %s has no value", ErrParameterMismatch, component,
+			i+1, param.Type)
+	}
+
+	return nil
+}
+
+// checkBodyText rejects the text values that the API refuses in body parameters.
+func checkBodyText(i int, text string) error {
+	if strings.ContainsAny(text, "\n\t") {
+		return fmt.Errorf("%w: body parameter {{%d}} contains a new line or tab", ErrParameterMismatch, i+1)
+	}
+
+	if strings.Contains(text, "     ") {
+		return fmt.Errorf("%w: body parameter {{%d}} contains more than 4 consecutive spaces",
+			ErrParameterMismatch, i+1)
+	}
+
+	return nil
+}
+
+// TextParameter returns a text parameter. It is also used for the url suffix of URL buttons,
+// see URLParameter.
+func TextParameter(text string) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterText, Text: text}
+}
+
+// URLParameter returns the parameter of a URL button, suffix replaces the variable of the url.
+func URLParameter(suffix string) *models.TemplateParameter {
+	return TextParameter(suffix)
+}
+
+// PayloadParameter returns the parameter of a quick reply button.
+func PayloadParameter(payload string) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterPayload, Payload: payload}
+}
+
+// CouponCodeParameter returns the parameter of a copy code button, the code copied by the user.
+func CouponCodeParameter(code string) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterCoupon, CouponCode: code}
+}
+
+// CurrencyParameter returns a currency parameter, amount1000 is the amount multiplied by 1000.
+func CurrencyParameter(fallback, code string, amount1000 int) *models.TemplateParameter {
+	return &models.TemplateParameter{
+		Type: ParameterCurrency,
+		Currency: &models.TemplateCurrency{
+			FallbackValue: fallback,
+			Code:          code,
+			Amount1000:    amount1000,
+		},
+	}
+}
+
+// DateTimeParameter returns a date_time parameter for the time t in the gregorian calendar.
+func DateTimeParameter(fallback string, t time.Time) *models.TemplateParameter {
+	return &models.TemplateParameter{
+		Type: ParameterDateTime,
+		DateTime: &models.TemplateDateTime{
+			FallbackValue: fallback,
+			DayOfWeek:     int(t.Weekday()),
+			Year:          t.Year(),
+			Month:         int(t.Month()),
+			DayOfMonth:    t.Day(),
+			Hour:          t.Hour(),
+			Minute:        t.Minute(),
+			Calendar:      "GREGORIAN",
+		},
+	}
+}
+
+func ImageParameter(media *models.Media) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterImage, Image: media}
+}
+
+func DocumentParameter(media *models.Media) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterDocument, Document: media}
+}
+
+func VideoParameter(media *models.Media) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterVideo, Video: media}
+}
+
+func LocationParameter(location *models.Location) *models.TemplateParameter {
+	return &models.TemplateParameter{Type: ParameterLocation, Location: location}
+}
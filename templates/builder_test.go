@@ -0,0 +1,225 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp/models"
+)
+
+const orderTemplate = `{
+  "name": "order_confirmation",
+  "language": "en_US",
+  "status": "APPROVED",
+  "category": "UTILITY",
+  "components": [
+    {"type": "HEADER", "format": "IMAGE", "example": {"header_handle": ["4::aW1hZ2UvcG5n"]}},
+    {"type": "BODY", "text": "Hi {{1}}, your order of {{2}} will arrive on {{3}}."},
+    {"type": "FOOTER", "text": "Lucky Shrub"},
+    {"type": "BUTTONS", "buttons": [
+      {"type": "URL", "text": "Track", "url": "https://www.luckyshrub.com/track/{{1}}"},
+      {"type": "QUICK_REPLY", "text": "Stop promotions"}
+    ]}
+  ]
+}`
+
+func TestBuilder_Build(t *testing.T) {
+	t.Parallel()
+	definition, err := DecodeTemplate(strings.NewReader(orderTemplate))
+	if err != nil {
+		t.Fatalf("DecodeTemplate() error = %v", err)
+	}
+	image := ImageParameter(&models.Media{Link: "https://www.luckyshrub.com/banner.png"})
+	body := []*models.TemplateParameter{
+		TextParameter("Pius"),
+		CurrencyParameter("$10.99", "USD", 10990),
+		DateTimeParameter("March 3", time.Date(2023, time.March, 3, 10, 0, 0, 0, time.UTC)),
+	}
+
+	tests := []struct {
+		name    string
+		builder *Builder
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			builder: NewBuilder(definition).Header(image).Body(body...).Button(0, URLParameter("12345")),
+		},
+		{
+			name:    "missing body parameter",
+			builder: NewBuilder(definition).Header(image).Body(body[:2]...).Button(0, URLParameter("12345")),
+			wantErr: "body: template has 3 parameters, got 2",
+		},
+		{
+			name: "wrong header type",
+			builder: NewBuilder(definition).Header(TextParameter("hello")).Body(body...).
+				Button(0, URLParameter("12345")),
+			wantErr: `header parameter {{1}} has type "text", want image`,
+		},
+		{
+			name:    "missing url parameter",
+			builder: NewBuilder(definition).Header(image).Body(body...),
+			wantErr: "button 0 (URL): missing url parameter",
+		},
+		{
+			name: "quick reply with text",
+			builder: NewBuilder(definition).Header(image).Body(body...).Button(0, URLParameter("12345")).
+				Button(1, TextParameter("stop")),
+			wantErr: `button 1 (QUICK_REPLY) parameter {{1}} has type "text", want payload`,
+		},
+		{
+			name: "button out of range",
+			builder: NewBuilder(definition).Header(image).Body(body...).Button(0, URLParameter("12345")).
+				Button(2, PayloadParameter("stop")),
+			wantErr: "button 2: template has 2 buttons",
+		},
+		{
+			name: "body text with new line",
+			builder: NewBuilder(definition).Header(image).
+				Body(TextParameter("Pius\n"), body[1], body[2]).Button(0, URLParameter("12345")),
+			wantErr: "body parameter {{1}} contains a new line or tab",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.builder.Build()
+			if tt.wantErr != "" {
+				if err == nil || !errors.Is(err, ErrParameterMismatch) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			if len(got.Components) != 3 {
+				t.Fatalf("Build() components = %d, want 3", len(got.Components))
+			}
+
+			data, _ := json.Marshal(got.Components[2])
+			want := `{"type":"button","sub_type":"url","parameters":[{"type":"text","text":"12345"}],"index":0}`
+			if string(data) != want {
+				t.Errorf("button component = %s, want %s", data, want)
+			}
+		})
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		text    string
+		want    int
+		wantErr bool
+	}{
+		{text: "Hello", want: 0},
+		{text: "Hello {{1}}, {{2}} and {{1}} again", want: 2},
+		{text: "Hello {{1}} and {{3}}", wantErr: true},
+		{text: "Hello {{first_name}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Placeholders(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Placeholders(%q) = %d, %v, want %d, wantErr %v", tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBuilder_CopyCode(t *testing.T) {
+	t.Parallel()
+	definition, err := DecodeTemplate(strings.NewReader(`{
+  "name": "coupon_offer",
+  "language": "en_US",
+  "components": [
+    {"type": "BODY", "text": "Use the code to get 25% off."},
+    {"type": "BUTTONS", "buttons": [{"type": "COPY_CODE", "example": "25OFF"}]}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("DecodeTemplate() error = %v", err)
+	}
+
+	button, _ := json.Marshal(definition.Component(ComponentButtons).Buttons[0])
+	if want := `{"type":"COPY_CODE","example":"25OFF"}`; string(button) != want {
+		t.Errorf("button = %s, want %s", button, want)
+	}
+
+	tests := []struct {
+		name    string
+		param   *models.TemplateParameter
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "coupon code",
+			param: CouponCodeParameter("25OFF"),
+			want: `{"type":"button","sub_type":"copy_code","parameters":[{"type":"coupon_code",` +
+				`"coupon_code":"25OFF"}],"index":0}`,
+		},
+		{
+			name:    "text",
+			param:   TextParameter("25OFF"),
+			wantErr: `button 0 (COPY_CODE) parameter {{1}} has type "text", want coupon_code`,
+		},
+		{
+			name:    "empty code",
+			param:   CouponCodeParameter(""),
+			wantErr: "button 0 (COPY_CODE) parameter {{1}} of type coupon_code has no value",
+		},
+		{
+			name:    "long code",
+			param:   CouponCodeParameter("SUMMER2023-25OFF"),
+			wantErr: "button 0 (COPY_CODE): coupon code is longer than 15 characters",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := NewBuilder(definition).Button(0, tt.param).Build()
+			if tt.wantErr != "" {
+				if err == nil || !errors.Is(err, ErrParameterMismatch) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			data, _ := json.Marshal(got.Components[len(got.Components)-1])
+			if string(data) != tt.want {
+				t.Errorf("button component = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package templates manages the message templates of a WhatsApp Business Account through the
+// /{WHATSAPP_BUSINESS_ACCOUNT_ID}/message_templates endpoints. Templates can be created, listed,
+// fetched, edited and deleted. The types are plain JSON so template definitions can be kept in
+// files and deployed with this package.
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	whttp "github.com/piusalfred/whatsapp/http"
+)
+
+const (
+	CategoryMarketing      Category = "MARKETING"
+	CategoryUtility        Category = "UTILITY"
+	CategoryAuthentication Category = "AUTHENTICATION"
+)
+
+const (
+	StatusApproved        Status = "APPROVED"
+	StatusPending         Status = "PENDING"
+	StatusRejected        Status = "REJECTED"
+	StatusPaused          Status = "PAUSED"
+	StatusDisabled        Status = "DISABLED"
+	StatusInAppeal        Status = "IN_APPEAL"
+	StatusPendingDeletion Status = "PENDING_DELETION"
+)
+
+const (
+	ComponentHeader  ComponentType = "HEADER"
+	ComponentBody    ComponentType = "BODY"
+	ComponentFooter  ComponentType = "FOOTER"
+	ComponentButtons ComponentType = "BUTTONS"
+)
+
+const (
+	FormatText     Format = "TEXT"
+	FormatImage    Format = "IMAGE"
+	FormatVideo    Format = "VIDEO"
+	FormatDocument Format = "DOCUMENT"
+	FormatLocation Format = "LOCATION"
+)
+
+const (
+	ButtonQuickReply  ButtonType = "QUICK_REPLY"
+	ButtonURL         ButtonType = "URL"
+	ButtonPhoneNumber ButtonType = "PHONE_NUMBER"
+	ButtonCopyCode    ButtonType = "COPY_CODE"
+	ButtonOTP         ButtonType = "OTP"
+)
+
+var (
+	ErrNilRequest          = errors.New("nil request")
+	ErrMissingTemplateName = errors.New("template name is required")
+)
+
+type (
+	// Category of a template. It determines the pricing of the conversations opened by the
+	// template and is reviewed by Meta.
+	Category string
+
+	// Status is the review status of a template. Only APPROVED templates can be sent.
+	Status string
+
+	ComponentType string
+
+	// Format is the format of a HEADER component.
+	Format string
+
+	ButtonType string
+
+	// RequestContext contains the details needed to call the message templates endpoints.
+	RequestContext struct {
+		BaseURL           string             `json:"-"`
+		ApiVersion        string             `json:"-"`
+		AccessToken       string             `json:"-"`
+		BusinessAccountID string             `json:"-"`
+		RetryPolicy       *whttp.RetryPolicy `json:"-"`
+	}
+
+	// Template is a message template as returned by the API.
+	Template struct {
+		ID              string       `json:"id,omitempty"`
+		Name            string       `json:"name,omitempty"`
+		Language        string       `json:"language,omitempty"`
+		Status          Status       `json:"status,omitempty"`
+		Category        Category     `json:"category,omitempty"`
+		ParameterFormat string       `json:"parameter_format,omitempty"`
+		RejectedReason  string       `json:"rejected_reason,omitempty"`
+		Components      []*Component `json:"components,omitempty"`
+	}
+
+	// Component is a part of a template. A template has at most one HEADER, exactly one BODY,
+	// at most one FOOTER and at most one BUTTONS component.
+	//
+	// Text may contain variables written as {{1}}, {{2}} and so on, in which case Example must
+	// contain sample values for every variable.
+	Component struct {
+		Type    ComponentType `json:"type"`
+		Format  Format        `json:"format,omitempty"`
+		Text    string        `json:"text,omitempty"`
+		Example *Example      `json:"example,omitempty"`
+		Buttons []*Button     `json:"buttons,omitempty"`
+	}
+
+	// Example contains sample values of the variables of a component. HeaderHandle holds the
+	// uploaded media handle of a media HEADER.
+	Example struct {
+		HeaderText   []string   `json:"header_text,omitempty"`
+		HeaderHandle []string   `json:"header_handle,omitempty"`
+		BodyText     [][]string `json:"body_text,omitempty"`
+	}
+
+	// Button is a button of a BUTTONS component. URL may have a single variable at its end
+	// in which case Example contains the sample URL. The Example of a COPY_CODE button is its
+	// sample code, encoded as a string by the API.
+	Button struct {
+		Type        ButtonType `json:"type"`
+		Text        string     `json:"text,omitempty"`
+		URL         string     `json:"url,omitempty"`
+		PhoneNumber string     `json:"phone_number,omitempty"`
+		Example     []string   `json:"example,omitempty"`
+		OTPType     string     `json:"otp_type,omitempty"`
+	}
+
+	// CreateRequest is the definition of a new template. When AllowCategoryChange is true
+	// Meta may assign a different category instead of rejecting the template.
+	CreateRequest struct {
+		Name                string       `json:"name"`
+		Language            string       `json:"language"`
+		Category            Category     `json:"category"`
+		AllowCategoryChange bool         `json:"allow_category_change,omitempty"`
+		Components          []*Component `json:"components"`
+	}
+
+	CreateResponse struct {
+		ID       string   `json:"id"`
+		Status   Status   `json:"status"`
+		Category Category `json:"category"`
+	}
+
+	// EditRequest changes the category or the components of an existing template. Only
+	// approved, rejected and paused templates can be edited.
+	EditRequest struct {
+		Category   Category     `json:"category,omitempty"`
+		Components []*Component `json:"components,omitempty"`
+	}
+
+	// DeleteRequest deletes templates by name. When ID is set only the template with the
+	// given ID is deleted, otherwise templates of all languages with the name are deleted.
+	DeleteRequest struct {
+		Name string
+		ID   string
+	}
+
+	// ListOptions filters and pages the templates returned by List. Empty fields are not sent.
+	// After and Before are the cursors returned in Paging of a previous ListResponse.
+	ListOptions struct {
+		Status   Status
+		Category Category
+		Language string
+		Name     string
+		Fields   []string
+		Limit    int
+		After    string
+		Before   string
+	}
+
+	ListResponse struct {
+		Data   []*Template `json:"data"`
+		Paging *Paging     `json:"paging,omitempty"`
+	}
+
+	Paging struct {
+		Cursors  *Cursors `json:"cursors,omitempty"`
+		Next     string   `json:"next,omitempty"`
+		Previous string   `json:"previous,omitempty"`
+	}
+
+	Cursors struct {
+		Before string `json:"before,omitempty"`
+		After  string `json:"after,omitempty"`
+	}
+
+	SuccessResponse struct {
+		Success bool `json:"success"`
+	}
+)
+
+// MarshalJSON encodes the example of a COPY_CODE button as a string.
+func (button Button) MarshalJSON() ([]byte, error) {
+	type alias Button
+	if button.Type != ButtonCopyCode || len(button.Example) != 1 {
+		return json.Marshal(alias(button)) //nolint:wrapcheck
+	}
+
+	return json.Marshal(struct { //nolint:wrapcheck
+		alias
+		Example string `json:"example"`
+	}{alias: alias(button), Example: button.Example[0]})
+}
+
+// UnmarshalJSON decodes the example of the button from a list or, for COPY_CODE buttons, from
+// a string.
+func (button *Button) UnmarshalJSON(data []byte) error {
+	type alias Button
+	var value struct {
+		alias
+		Example json.RawMessage `json:"example,omitempty"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err //nolint:wrapcheck
+	}
+	*button = Button(value.alias)
+
+	if len(value.Example) == 0 || string(value.Example) == "null" {
+		return nil
+	}
+
+	if value.Example[0] == '"' {
+		var code string
+		if err := json.Unmarshal(value.Example, &code); err != nil {
+			return err //nolint:wrapcheck
+		}
+		button.Example = []string{code}
+
+		return nil
+	}
+
+	return json.Unmarshal(value.Example, &button.Example) //nolint:wrapcheck
+}
+
+// NextCursor returns the cursor of the next page or an empty string if this is the last page.
+func (resp *ListResponse) NextCursor() string {
+	if resp == nil || resp.Paging == nil || resp.Paging.Next == "" || resp.Paging.Cursors == nil {
+		return ""
+	}
+
+	return resp.Paging.Cursors.After
+}
+
+func (opts *ListOptions) query() map[string]string {
+	query := map[string]string{}
+	if opts == nil {
+		return query
+	}
+
+	if opts.Status != "" {
+		query["status"] = string(opts.Status)
+	}
+	if opts.Category != "" {
+		query["category"] = string(opts.Category)
+	}
+	if opts.Language != "" {
+		query["language"] = opts.Language
+	}
+	if opts.Name != "" {
+		query["name"] = opts.Name
+	}
+	if len(opts.Fields) > 0 {
+		query["fields"] = strings.Join(opts.Fields, ",")
+	}
+	if opts.Limit > 0 {
+		query["limit"] = strconv.Itoa(opts.Limit)
+	}
+	if opts.After != "" {
+		query["after"] = opts.After
+	}
+	if opts.Before != "" {
+		query["before"] = opts.Before
+	}
+
+	return query
+}
+
+/*
+Create creates a new message template.
+
+	curl -X POST 'https://graph.facebook.com/v16.0/WHATSAPP_BUSINESS_ACCOUNT_ID/message_templates' \
+	-H 'Authorization: Bearer ACCESS_TOKEN' \
+	-H 'Content-Type: application/json' \
+	-d '{
+	  "name": "seasonal_promotion",
+	  "language": "en_US",
+	  "category": "MARKETING",
+	  "components": [
+	    {
+	      "type": "BODY",
+	      "text": "Shop now through {{1}} and use code {{2}} to get {{3}} off of all merchandise.",
+	      "example": {
+	        "body_text": [["the end of August","25OFF","25%"]]
+	      }
+	    }
+	  ]
+	}'
+
+The response contains the ID, status and category of the template.
+
+	{
+	  "id": "572279198452421",
+	  "status": "PENDING",
+	  "category": "MARKETING"
+	}
+*/
+func Create(ctx context.Context, client *http.Client, rctx *RequestContext, req *CreateRequest) (
+	*CreateResponse, error,
+) {
+	if req == nil {
+		return nil, fmt.Errorf("template create: %w", ErrNilRequest)
+	}
+
+	if req.Name == "" {
+		return nil, fmt.Errorf("template create: %w", ErrMissingTemplateName)
+	}
+
+	request := &whttp.Request{
+		Context: rctx.endpoint("create template"),
+		Method:  http.MethodPost,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Bearer:  rctx.AccessToken,
+		Payload: req,
+		Retry:   rctx.RetryPolicy,
+	}
+
+	var resp CreateResponse
+	if err := whttp.Send(ctx, client, request, &resp); err != nil {
+		return nil, fmt.Errorf("template create (%s): %w", req.Name, err)
+	}
+
+	return &resp, nil
+}
+
+// List returns a page of the templates of the business account that match the options.
+// Use ListResponse.NextCursor as ListOptions.After to fetch the next page, or ListAll to
+// fetch every page.
+func List(ctx context.Context, client *http.Client, rctx *RequestContext, opts *ListOptions) (*ListResponse, error) {
+	request := &whttp.Request{
+		Context: rctx.endpoint("list templates"),
+		Method:  http.MethodGet,
+		Query:   opts.query(),
+		Bearer:  rctx.AccessToken,
+		Retry:   rctx.RetryPolicy,
+	}
+
+	var resp ListResponse
+	if err := whttp.Send(ctx, client, request, &resp); err != nil {
+		return nil, fmt.Errorf("template list: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// ListAll follows the cursors and returns the templates of every page that match the options.
+// The After and Before fields of the options are ignored.
+func ListAll(ctx context.Context, client *http.Client, rctx *RequestContext, opts *ListOptions) ([]*Template, error) {
+	var page ListOptions
+	if opts != nil {
+		page = *opts
+	}
+	page.Before = ""
+	page.After = ""
+
+	var templates []*Template
+	for {
+		resp, err := List(ctx, client, rctx, &page)
+		if err != nil {
+			return templates, err
+		}
+		templates = append(templates, resp.Data...)
+
+		next := resp.NextCursor()
+		if next == "" || len(resp.Data) == 0 {
+			return templates, nil
+		}
+		page.After = next
+	}
+}
+
+// Get returns the template with the given ID.
+func Get(ctx context.Context, client *http.Client, rctx *RequestContext, templateID string) (*Template, error) {
+	request := &whttp.Request{
+		Context: rctx.template("get template", templateID),
+		Method:  http.MethodGet,
+		Bearer:  rctx.AccessToken,
+		Retry:   rctx.RetryPolicy,
+	}
+
+	var resp Template
+	if err := whttp.Send(ctx, client, request, &resp); err != nil {
+		return nil, fmt.Errorf("template get (%s): %w", templateID, err)
+	}
+
+	return &resp, nil
+}
+
+// Edit edits the template with the given ID. Approved templates can be edited up to 10 times
+// in a 30-day window and once in a 24-hour window, the edited template goes through review
+// again.
+func Edit(ctx context.Context, client *http.Client, rctx *RequestContext, templateID string, req *EditRequest) (
+	*SuccessResponse, error,
+) {
+	if req == nil {
+		return nil, fmt.Errorf("template edit: %w", ErrNilRequest)
+	}
+
+	request := &whttp.Request{
+		Context: rctx.template("edit template", templateID),
+		Method:  http.MethodPost,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Bearer:  rctx.AccessToken,
+		Payload: req,
+		Retry:   rctx.RetryPolicy,
+	}
+
+	var resp SuccessResponse
+	if err := whttp.Send(ctx, client, request, &resp); err != nil {
+		return nil, fmt.Errorf("template edit (%s): %w", templateID, err)
+	}
+
+	return &resp, nil
+}
+
+// Delete deletes templates by name, or a single template by name and ID.
+func Delete(ctx context.Context, client *http.Client, rctx *RequestContext, req *DeleteRequest) (
+	*SuccessResponse, error,
+) {
+	if req == nil {
+		return nil, fmt.Errorf("template delete: %w", ErrNilRequest)
+	}
+
+	if req.Name == "" {
+		return nil, fmt.Errorf("template delete: %w", ErrMissingTemplateName)
+	}
+
+	query := map[string]string{"name": req.Name}
+	if req.ID != "" {
+		query["hsm_id"] = req.ID
+	}
+
+	request := &whttp.Request{
+		Context: rctx.endpoint("delete template"),
+		Method:  http.MethodDelete,
+		Query:   query,
+		Bearer:  rctx.AccessToken,
+		Retry:   rctx.RetryPolicy,
+	}
+
+	var resp SuccessResponse
+	if err := whttp.Send(ctx, client, request, &resp); err != nil {
+		return nil, fmt.Errorf("template delete (%s): %w", req.Name, err)
+	}
+
+	return &resp, nil
+}
+
+// endpoint returns the request context of the message_templates endpoint of the business account.
+func (rctx *RequestContext) endpoint(name string) *whttp.RequestContext {
+	return &whttp.RequestContext{
+		Name:       name,
+		BaseURL:    rctx.BaseURL,
+		ApiVersion: rctx.ApiVersion,
+		SenderID:   rctx.BusinessAccountID,
+		Endpoints:  []string{"message_templates"},
+	}
+}
+
+// template returns the request context of a single template node.
+func (rctx *RequestContext) template(name, templateID string) *whttp.RequestContext {
+	return &whttp.RequestContext{
+		Name:       name,
+		BaseURL:    rctx.BaseURL,
+		ApiVersion: rctx.ApiVersion,
+		SenderID:   templateID,
+	}
+}
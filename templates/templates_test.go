@@ -0,0 +1,132 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListAll(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v16.0/102290129340398/message_templates" {
+			t.Errorf("path = %s, want /v16.0/102290129340398/message_templates", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer token")
+		}
+		query := r.URL.Query()
+		if query.Get("status") != "APPROVED" || query.Get("language") != "en_US" || query.Get("limit") != "1" {
+			t.Errorf("query = %v, want status, language and limit filters", query)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch query.Get("after") {
+		case "":
+			_, _ = w.Write([]byte(`{"data":[{"id":"1","name":"hello_world","status":"APPROVED"}],` +
+				`"paging":{"cursors":{"before":"MAZDZD","after":"MjQZD"},"next":"https://graph.facebook.com/next"}}`))
+		case "MjQZD":
+			_, _ = w.Write([]byte(`{"data":[{"id":"2","name":"order_update","status":"APPROVED"}],` +
+				`"paging":{"cursors":{"before":"MjQZD","after":"MjUZD"}}}`))
+		default:
+			t.Errorf("unexpected cursor %q", query.Get("after"))
+		}
+	}))
+	defer server.Close()
+
+	rctx := &RequestContext{
+		BaseURL:           server.URL,
+		ApiVersion:        "v16.0",
+		AccessToken:       "token",
+		BusinessAccountID: "102290129340398",
+	}
+	got, err := ListAll(context.TODO(), server.Client(), rctx, &ListOptions{
+		Status:   StatusApproved,
+		Language: "en_US",
+		Limit:    1,
+	})
+	if err != nil {
+		t.Fatalf("ListAll() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0].Name != "hello_world" || got[1].Name != "order_update" {
+		t.Errorf("ListAll() = %v, want hello_world and order_update", got)
+	}
+}
+
+func TestCreateAndDelete(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			var req CreateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+			if req.Name != "seasonal_promotion" || len(req.Components) != 1 ||
+				req.Components[0].Example.BodyText[0][1] != "25OFF" {
+				t.Errorf("request = %+v, want seasonal_promotion with body example", req)
+			}
+			_, _ = w.Write([]byte(`{"id":"572279198452421","status":"PENDING","category":"MARKETING"}`))
+		case http.MethodDelete:
+			if name, id := r.URL.Query().Get("name"), r.URL.Query().Get("hsm_id"); name != "seasonal_promotion" ||
+				id != "572279198452421" {
+				t.Errorf("delete name = %q, hsm_id = %q", name, id)
+			}
+			_, _ = w.Write([]byte(`{"success":true}`))
+		}
+	}))
+	defer server.Close()
+
+	rctx := &RequestContext{BaseURL: server.URL, ApiVersion: "v16.0", BusinessAccountID: "102290129340398"}
+	created, err := Create(context.TODO(), server.Client(), rctx, &CreateRequest{
+		Name:     "seasonal_promotion",
+		Language: "en_US",
+		Category: CategoryMarketing,
+		Components: []*Component{
+			{
+				Type:    ComponentBody,
+				Text:    "Shop now through {{1}} and use code {{2}} to get {{3}} off of all merchandise.",
+				Example: &Example{BodyText: [][]string{{"the end of August", "25OFF", "25%"}}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if created.Status != StatusPending || created.Category != CategoryMarketing {
+		t.Errorf("Create() = %+v, want PENDING MARKETING", created)
+	}
+
+	deleted, err := Delete(context.TODO(), server.Client(), rctx, &DeleteRequest{Name: "seasonal_promotion", ID: created.ID})
+	if err != nil || !deleted.Success {
+		t.Errorf("Delete() = %v, %v, want success", deleted, err)
+	}
+
+	if _, err := Delete(context.TODO(), server.Client(), rctx, &DeleteRequest{}); err == nil {
+		t.Errorf("Delete() without name error = nil, want error")
+	}
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// Backpressure policies of a WorkerPool, what Submit does when the queue of the job is full.
+const (
+	// BackpressureBlock waits for room in the queue or for the context to be done.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureReject returns ErrQueueFull immediately.
+	BackpressureReject
+)
+
+var (
+	ErrQueueFull         = errors.New("webhooks: worker pool queue is full")
+	ErrWorkerPoolClosed  = errors.New("webhooks: worker pool is shut down")
+	ErrOnAsyncDispatch   = errors.New("error dispatching notification to the worker pool")
+	errInvalidWorkerPool = errors.New("webhooks: worker pool needs at least one worker")
+)
+
+type (
+	// BackpressurePolicy is what a WorkerPool does when the queue of a job is full.
+	BackpressurePolicy int
+
+	// AsyncErrorHandler receives the errors of the hooks called by the worker pool, after the
+	// notification has been acknowledged. The notification contains only the part of the
+	// original notification whose hooks failed.
+	AsyncErrorHandler func(ctx context.Context, notification *Notification, err error)
+
+	WorkerPoolOption func(*WorkerPool)
+
+	// WorkerPool runs jobs on a fixed number of workers. Every worker has its own queue and the
+	// jobs with the same key always go to the same worker, so they run one at a time in the
+	// order they were submitted. The jobs without a key are spread over the workers.
+	WorkerPool struct {
+		queues []chan func(context.Context)
+		policy BackpressurePolicy
+		ctx    context.Context //nolint:containedctx
+		cancel context.CancelFunc
+		next   atomic.Uint32
+		wg     sync.WaitGroup
+		mu     sync.RWMutex
+		closed bool
+
+		// closing is closed by Shutdown to release the blocked Submit calls, which are
+		// counted by submitting so that the queues are closed once they have returned.
+		closing     chan struct{}
+		closingOnce sync.Once
+		submitting  sync.WaitGroup
+	}
+)
+
+// NewWorkerPool starts a WorkerPool with the given number of workers, each with a queue of
+// queueSize jobs.
+func NewWorkerPool(workers, queueSize int, options ...WorkerPoolOption) (*WorkerPool, error) {
+	if workers < 1 {
+		return nil, errInvalidWorkerPool
+	}
+
+	pool := &WorkerPool{
+		queues:  make([]chan func(context.Context), workers),
+		policy:  BackpressureBlock,
+		ctx:     context.Background(),
+		closing: make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(pool)
+	}
+	pool.ctx, pool.cancel = context.WithCancel(pool.ctx)
+
+	for i := range pool.queues {
+		queue := make(chan func(context.Context), queueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go pool.work(queue)
+	}
+
+	return pool, nil
+}
+
+// WithBackpressure sets the backpressure policy, the default is BackpressureBlock.
+func WithBackpressure(policy BackpressurePolicy) WorkerPoolOption {
+	return func(pool *WorkerPool) {
+		pool.policy = policy
+	}
+}
+
+// WithWorkerContext sets the parent of the context the jobs run with, the default is
+// context.Background. The context is canceled when Shutdown gives up waiting.
+func WithWorkerContext(ctx context.Context) WorkerPoolOption {
+	return func(pool *WorkerPool) {
+		pool.ctx = ctx
+	}
+}
+
+// Submit queues the job on the worker of the key. When the queue is full it blocks or
+// returns ErrQueueFull depending on the backpressure policy. ctx only bounds the wait, the
+// job runs with the context of the pool. A blocked Submit returns ErrWorkerPoolClosed when
+// the pool is shut down.
+func (pool *WorkerPool) Submit(ctx context.Context, key string, job func(ctx context.Context)) error {
+	pool.mu.RLock()
+	if pool.closed {
+		pool.mu.RUnlock()
+
+		return ErrWorkerPoolClosed
+	}
+	queue := pool.queues[pool.worker(key)]
+	pool.submitting.Add(1)
+	pool.mu.RUnlock()
+	defer pool.submitting.Done()
+
+	if pool.policy == BackpressureReject {
+		select {
+		case queue <- job:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case queue <- job:
+		return nil
+	case <-pool.closing:
+		return ErrWorkerPoolClosed
+	case <-ctx.Done():
+		return fmt.Errorf("webhooks: submit: %w", ctx.Err())
+	}
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running jobs to finish. If ctx
+// is done first, the context of the jobs is canceled and ctx.Err is returned.
+func (pool *WorkerPool) Shutdown(ctx context.Context) error {
+	pool.closingOnce.Do(func() { close(pool.closing) })
+
+	pool.mu.Lock()
+	if !pool.closed {
+		pool.closed = true
+		// the Submit calls in progress return without waiting once closing is closed.
+		pool.submitting.Wait()
+		for _, queue := range pool.queues {
+			close(queue)
+		}
+	}
+	pool.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		pool.cancel()
+
+		return nil
+	case <-ctx.Done():
+		pool.cancel()
+
+		return fmt.Errorf("webhooks: shutdown: %w", ctx.Err())
+	}
+}
+
+func (pool *WorkerPool) work(queue chan func(context.Context)) {
+	defer pool.wg.Done()
+	for job := range queue {
+		job(pool.ctx)
+	}
+}
+
+func (pool *WorkerPool) worker(key string) int {
+	if key == "" {
+		return int(pool.next.Add(1) % uint32(len(pool.queues)))
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(len(pool.queues)))
+}
+
+// submitNotification splits the notification by sender and submits a job calling the hooks
+// of each part. The parts about the same customer, their messages and the statuses of the
+// messages sent to them, are processed in order.
+func submitNotification(ctx context.Context, pool *WorkerPool, notification *Notification,
+	hooks *HookRegistry, heh HooksErrorHandler, aeh AsyncErrorHandler,
+) error {
+	for _, part := range splitNotification(notification) {
+		part := part
+		err := pool.Submit(ctx, part.key, func(ctx context.Context) {
+			defer func() {
+				if r := recover(); r != nil && aeh != nil {
+					aeh(ctx, part.notification, fmt.Errorf("%w: %v", ErrHookPanic, r))
+				}
+			}()
+
+			err := attachHooksToNotification(ctx, part.notification, hooks, heh)
+			if err != nil && aeh != nil {
+				aeh(ctx, part.notification, err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrOnAsyncDispatch, err)
+		}
+	}
+
+	return nil
+}
+
+type notificationPart struct {
+	key          string
+	notification *Notification
+}
+
+// splitNotification returns a notification for each message and status of the notification
+// keyed by the WhatsApp ID of the customer, and one for each other change.
+func splitNotification(notification *Notification) []*notificationPart {
+	var parts []*notificationPart
+	add := func(entry *Entry, change *Change, key string, value *Value) {
+		part := *change
+		part.Value = value
+		parts = append(parts, &notificationPart{
+			key: key,
+			notification: &Notification{
+				Object: notification.Object,
+				Entry:  []*Entry{{ID: entry.ID, Changes: []*Change{&part}}},
+			},
+		})
+	}
+
+	for _, entry := range notification.Entry {
+		for _, change := range entry.Changes {
+			value := change.Value
+			if value == nil {
+				if event, _ := change.update(); event != "" {
+					add(entry, change, "", nil)
+				}
+
+				continue
+			}
+
+			if len(value.Messages) == 0 && len(value.Statuses) == 0 {
+				add(entry, change, "", value)
+
+				continue
+			}
+
+			if len(value.Errors) > 0 {
+				errs := *value
+				errs.Messages, errs.Statuses = nil, nil
+				add(entry, change, "", &errs)
+			}
+
+			for _, message := range value.Messages {
+				part := *value
+				part.Messages, part.Statuses, part.Errors = []*Message{message}, nil, nil
+				add(entry, change, message.From, &part)
+			}
+
+			for _, status := range value.Statuses {
+				part := *value
+				part.Messages, part.Statuses, part.Errors = nil, []*Status{status}, nil
+				add(entry, change, status.RecipientID, &part)
+			}
+		}
+	}
+
+	return parts
+}
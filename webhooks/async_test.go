@@ -0,0 +1,182 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventListener_Async(t *testing.T) {
+	t.Parallel()
+	pool, err := NewWorkerPool(4, 16)
+	if err != nil {
+		t.Fatalf("NewWorkerPool() error = %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		received = map[string][]string{}
+		release  = make(chan struct{})
+	)
+	listener := NewEventListener(WithAsync(pool, nil))
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, mctx *MessageContext, text *Text) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		received[mctx.From] = append(received[mctx.From], text.Body)
+
+		return nil
+	})
+	handler := listener.NotificationHandler()
+
+	notify := func(messages ...*Message) int {
+		body, _ := json.Marshal(&Notification{Entry: []*Entry{{Changes: []*Change{{
+			Field: "messages",
+			Value: &Value{Messages: messages},
+		}}}}})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+
+		return recorder.Code
+	}
+	text := func(from, body string) *Message {
+		return &Message{From: from, Type: "text", Text: &Text{Body: body}}
+	}
+
+	// the hooks are blocked, the notifications are acknowledged anyway
+	for i, messages := range [][]*Message{
+		{text("alice", "1"), text("bob", "1")},
+		{text("alice", "2")},
+		{text("bob", "2"), text("alice", "3")},
+	} {
+		if code := notify(messages...); code != http.StatusOK {
+			t.Fatalf("notification %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	close(release)
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	want := map[string]string{"alice": "[1 2 3]", "bob": "[1 2]"}
+	for from, bodies := range want {
+		if got := fmt.Sprint(received[from]); got != bodies {
+			t.Errorf("messages from %s = %s, want %s", from, got, bodies)
+		}
+	}
+
+	if err := pool.Submit(context.Background(), "alice", func(context.Context) {}); !errors.Is(err,
+		ErrWorkerPoolClosed) {
+		t.Errorf("Submit() after Shutdown error = %v, want %v", err, ErrWorkerPoolClosed)
+	}
+}
+
+func TestWorkerPool_Backpressure(t *testing.T) {
+	t.Parallel()
+	pool, err := NewWorkerPool(1, 1, WithBackpressure(BackpressureReject))
+	if err != nil {
+		t.Fatalf("NewWorkerPool() error = %v", err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	blocked := func(ctx context.Context) {
+		close(started)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	}
+	if err := pool.Submit(context.Background(), "", blocked); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-started
+
+	// the worker is busy, the job waits in the queue
+	if err := pool.Submit(context.Background(), "", func(context.Context) {}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	if err := pool.Submit(context.Background(), "", func(context.Context) {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() error = %v, want %v", err, ErrQueueFull)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestWorkerPool_ShutdownWithBlockedSubmit(t *testing.T) {
+	t.Parallel()
+	pool, err := NewWorkerPool(1, 1)
+	if err != nil {
+		t.Fatalf("NewWorkerPool() error = %v", err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	if err := pool.Submit(context.Background(), "", func(context.Context) {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-started
+
+	if err := pool.Submit(context.Background(), "", func(context.Context) {}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	// the queue is full and the worker stuck, the submit blocks without a deadline
+	submitted := make(chan error)
+	go func() { submitted <- pool.Submit(context.Background(), "", func(context.Context) {}) }()
+	time.Sleep(10 * time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		shutdown <- pool.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdown:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown() did not return after its deadline")
+	}
+
+	if err := <-submitted; !errors.Is(err, ErrWorkerPoolClosed) {
+		t.Errorf("Submit() error = %v, want %v", err, ErrWorkerPoolClosed)
+	}
+}
@@ -0,0 +1,398 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/piusalfred/whatsapp/internal/atomicfile"
+)
+
+const (
+	DefaultSeenSetCapacity = 100000
+	DefaultSeenSetTTL      = 7 * 24 * time.Hour // Meta retries the deliveries for up to 7 days
+)
+
+type (
+	// SeenSet is the set of the keys of the messages and statuses whose hooks have been called.
+	// Implementations must be safe for concurrent use and may forget keys, after a TTL for
+	// example.
+	//
+	// Reserve atomically adds the key if it is absent and reports whether it did, so a single
+	// request calls the hooks of a message delivered twice at the same time. A reserved key is
+	// either confirmed with Add once the hooks succeed or removed with Release when they fail.
+	SeenSet interface {
+		Contains(ctx context.Context, key string) (bool, error)
+		Add(ctx context.Context, key string) error
+		Reserve(ctx context.Context, key string) (bool, error)
+		Release(ctx context.Context, key string) error
+	}
+
+	// DuplicateFunc is called with the key of every duplicate message or status suppressed.
+	DuplicateFunc func(ctx context.Context, nctx *NotificationContext, key string)
+
+	// Deduplicator suppresses the hooks of the messages and statuses that are delivered more
+	// than once. A message is identified by Message.ID and a status by Status.ID and
+	// Status.StatusValue. They are reserved in the SeenSet before their hooks are called and
+	// released if the hooks fail, so the notifications whose hooks failed are processed again
+	// when they are delivered again.
+	Deduplicator struct {
+		seen        SeenSet
+		onDuplicate DuplicateFunc
+		suppressed  atomic.Uint64
+	}
+
+	// MemorySeenSet is a SeenSet that keeps the most recent keys in memory. The least
+	// recently added keys are evicted when it is full, and the keys expire after the TTL.
+	MemorySeenSet struct {
+		mu       sync.Mutex
+		capacity int
+		ttl      time.Duration
+		order    *list.List
+		keys     map[string]*list.Element
+		now      func() time.Time
+	}
+
+	// FileSeenSet is a MemorySeenSet that appends the keys to a file, so they survive
+	// restarts. The file is compacted when it is opened and when it grows to twice the
+	// capacity.
+	FileSeenSet struct {
+		*MemorySeenSet
+		path  string
+		fmu   sync.Mutex
+		file  *os.File
+		lines int
+	}
+
+	seenKey struct {
+		key      string
+		added    time.Time
+		reserved bool
+	}
+)
+
+// NewDeduplicator returns a Deduplicator using the seen set, onDuplicate can be nil.
+func NewDeduplicator(seen SeenSet, onDuplicate DuplicateFunc) *Deduplicator {
+	return &Deduplicator{seen: seen, onDuplicate: onDuplicate}
+}
+
+// WithDeduplication makes the listener suppress the hooks of the duplicate messages and
+// statuses. The notifications replayed from an Inbox are not deduplicated.
+func WithDeduplication(dedup *Deduplicator) ListenerOption {
+	return func(ls *EventListener) {
+		ls.hooks.dedup = dedup
+	}
+}
+
+// Suppressed returns the number of duplicates suppressed.
+func (dedup *Deduplicator) Suppressed() uint64 {
+	return dedup.suppressed.Load()
+}
+
+// MessageKey returns the key of the message in the SeenSet, empty if the message has no ID.
+func MessageKey(message *Message) string {
+	if message.ID == "" {
+		return ""
+	}
+
+	return "message:" + message.ID
+}
+
+// StatusKey returns the key of the status in the SeenSet, empty if the status has no ID.
+func StatusKey(status *Status) string {
+	if status.ID == "" {
+		return ""
+	}
+
+	return "status:" + status.ID + ":" + status.StatusValue
+}
+
+// duplicate reserves the key and reports whether it has been seen or is reserved by another
+// request, calling the DuplicateFunc if it is. The errors of the SeenSet are ignored, the hooks
+// are rather called twice than not at all.
+func (dedup *Deduplicator) duplicate(ctx context.Context, nctx *NotificationContext, key string) bool {
+	if dedup == nil || key == "" || skipDeduplication(ctx) {
+		return false
+	}
+
+	reserved, err := dedup.seen.Reserve(ctx, key)
+	if err != nil || reserved {
+		return false
+	}
+	dedup.suppressed.Add(1)
+
+	if dedup.onDuplicate != nil {
+		dedup.onDuplicate(ctx, nctx, key)
+	}
+
+	return true
+}
+
+// add confirms the key reserved by duplicate once the hooks succeeded.
+func (dedup *Deduplicator) add(ctx context.Context, key string) {
+	if dedup == nil || key == "" || skipDeduplication(ctx) {
+		return
+	}
+	_ = dedup.seen.Add(ctx, key)
+}
+
+// release removes the key reserved by duplicate after the hooks failed.
+func (dedup *Deduplicator) release(ctx context.Context, key string) {
+	if dedup == nil || key == "" || skipDeduplication(ctx) {
+		return
+	}
+	_ = dedup.seen.Release(ctx, key)
+}
+
+type skipDeduplicationKey struct{}
+
+func withoutDeduplication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipDeduplicationKey{}, true)
+}
+
+func skipDeduplication(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipDeduplicationKey{}).(bool)
+
+	return skip
+}
+
+// NewMemorySeenSet returns a MemorySeenSet holding up to capacity keys for the ttl.
+func NewMemorySeenSet(capacity int, ttl time.Duration) *MemorySeenSet {
+	return &MemorySeenSet{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Contains reports whether the key has been added and has not expired.
+func (set *MemorySeenSet) Contains(_ context.Context, key string) (bool, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	element, ok := set.keys[key]
+	if !ok {
+		return false, nil
+	}
+
+	if set.expired(element.Value.(*seenKey), set.now()) { //nolint:forcetypeassert
+		set.order.Remove(element)
+		delete(set.keys, key)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Add adds the key, evicting the least recently added keys if the set is full.
+func (set *MemorySeenSet) Add(_ context.Context, key string) error {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.add(key, set.now())
+
+	return nil
+}
+
+// Reserve adds the key as reserved if it is absent or has expired, and reports whether it did.
+func (set *MemorySeenSet) Reserve(_ context.Context, key string) (bool, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	now := set.now()
+	if element, ok := set.keys[key]; ok {
+		if !set.expired(element.Value.(*seenKey), now) { //nolint:forcetypeassert
+			return false, nil
+		}
+		set.order.Remove(element)
+		delete(set.keys, key)
+	}
+
+	set.add(key, now)
+	set.keys[key].Value.(*seenKey).reserved = true //nolint:forcetypeassert
+
+	return true, nil
+}
+
+// Release removes the key if it is reserved, the keys added with Add are kept.
+func (set *MemorySeenSet) Release(_ context.Context, key string) error {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if element, ok := set.keys[key]; ok && element.Value.(*seenKey).reserved { //nolint:forcetypeassert
+		set.order.Remove(element)
+		delete(set.keys, key)
+	}
+
+	return nil
+}
+
+// Len returns the number of keys in the set, expired ones included.
+func (set *MemorySeenSet) Len() int {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	return set.order.Len()
+}
+
+func (set *MemorySeenSet) add(key string, added time.Time) {
+	if element, ok := set.keys[key]; ok {
+		seen := element.Value.(*seenKey) //nolint:forcetypeassert
+		seen.added, seen.reserved = added, false
+		set.order.MoveToFront(element)
+
+		return
+	}
+	set.keys[key] = set.order.PushFront(&seenKey{key: key, added: added})
+
+	for set.capacity > 0 && set.order.Len() > set.capacity {
+		oldest := set.order.Back()
+		set.order.Remove(oldest)
+		delete(set.keys, oldest.Value.(*seenKey).key) //nolint:forcetypeassert
+	}
+}
+
+func (set *MemorySeenSet) expired(key *seenKey, now time.Time) bool {
+	return set.ttl > 0 && now.Sub(key.added) >= set.ttl
+}
+
+// snapshot returns the unexpired keys from the least to the most recently added, the reserved
+// keys excluded.
+func (set *MemorySeenSet) snapshot() []*seenKey {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	now := set.now()
+	keys := make([]*seenKey, 0, set.order.Len())
+	for element := set.order.Back(); element != nil; element = element.Prev() {
+		if key := element.Value.(*seenKey); !key.reserved && !set.expired(key, now) { //nolint:forcetypeassert
+			keys = append(keys, &seenKey{key: key.key, added: key.added})
+		}
+	}
+
+	return keys
+}
+
+// NewFileSeenSet opens the FileSeenSet at path, creating it if it does not exist.
+func NewFileSeenSet(path string, capacity int, ttl time.Duration) (*FileSeenSet, error) {
+	set := &FileSeenSet{MemorySeenSet: NewMemorySeenSet(capacity, ttl), path: path}
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("seen set: %w", err)
+	default:
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			added, key, ok := strings.Cut(scanner.Text(), " ")
+			nanos, err := strconv.ParseInt(added, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			set.MemorySeenSet.add(key, time.Unix(0, nanos))
+		}
+		err = scanner.Err()
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("seen set: %w", err)
+		}
+	}
+
+	if err := set.compact(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// Add adds the key and appends it to the file.
+func (set *FileSeenSet) Add(_ context.Context, key string) error {
+	if strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("seen set: invalid key %q", key)
+	}
+
+	added := set.now()
+	set.MemorySeenSet.mu.Lock()
+	set.MemorySeenSet.add(key, added)
+	set.MemorySeenSet.mu.Unlock()
+
+	set.fmu.Lock()
+	defer set.fmu.Unlock()
+	if _, err := fmt.Fprintf(set.file, "%d %s\n", added.UnixNano(), key); err != nil {
+		return fmt.Errorf("seen set: %w", err)
+	}
+	set.lines++
+
+	if set.capacity > 0 && set.lines >= 2*set.capacity {
+		return set.compactLocked()
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (set *FileSeenSet) Close() error {
+	set.fmu.Lock()
+	defer set.fmu.Unlock()
+
+	return set.file.Close() //nolint:wrapcheck
+}
+
+func (set *FileSeenSet) compact() error {
+	set.fmu.Lock()
+	defer set.fmu.Unlock()
+
+	return set.compactLocked()
+}
+
+// compactLocked rewrites the file with the unexpired keys and reopens it for appending. It is
+// called with fmu held.
+func (set *FileSeenSet) compactLocked() error {
+	keys := set.snapshot()
+	var buf bytes.Buffer
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(&buf, "%d %s\n", key.added.UnixNano(), key.key)
+	}
+	if err := atomicfile.Write(set.path, &buf); err != nil {
+		return fmt.Errorf("seen set: %w", err)
+	}
+
+	if set.file != nil {
+		_ = set.file.Close()
+	}
+
+	var err error
+	set.file, err = os.OpenFile(set.path, os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("seen set: %w", err)
+	}
+	set.lines = len(keys)
+
+	return nil
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	t.Parallel()
+	var suppressed []string
+	dedup := NewDeduplicator(NewMemorySeenSet(10, time.Hour), func(_ context.Context, _ *NotificationContext,
+		key string,
+	) {
+		suppressed = append(suppressed, key)
+	})
+	listener := NewEventListener(WithDeduplication(dedup))
+
+	texts, statuses := 0, 0
+	fail := true
+	listener.OnTextMessage(func(context.Context, *NotificationContext, *MessageContext, *Text) error {
+		texts++
+		if fail {
+			fail = false
+
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+	listener.OnMessageStatusChange(func(context.Context, *NotificationContext, *Status) error {
+		statuses++
+
+		return nil
+	})
+
+	handler := listener.NotificationHandler()
+	notify := func(value *Value) {
+		body, _ := json.Marshal(&Notification{Entry: []*Entry{{Changes: []*Change{{Field: "messages", Value: value}}}}})
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+	}
+
+	message := &Message{ID: "wamid.1", Type: "text", Text: &Text{Body: "hi"}}
+	for i := 0; i < 3; i++ {
+		notify(&Value{Messages: []*Message{message}})
+	}
+	notify(&Value{Statuses: []*Status{{ID: "wamid.2", StatusValue: "sent"}}})
+	notify(&Value{Statuses: []*Status{{ID: "wamid.2", StatusValue: "sent"}, {ID: "wamid.2", StatusValue: "read"}}})
+
+	// the first delivery failed, the second succeeded and the third is a duplicate
+	if texts != 2 || statuses != 2 {
+		t.Errorf("text hooks called %d times and status hooks %d times, want 2 and 2", texts, statuses)
+	}
+
+	want := []string{"message:wamid.1", "status:wamid.2:sent"}
+	if len(suppressed) != 2 || suppressed[0] != want[0] || suppressed[1] != want[1] || dedup.Suppressed() != 2 {
+		t.Errorf("suppressed = %v (%d), want %v", suppressed, dedup.Suppressed(), want)
+	}
+}
+
+func TestDeduplicator_Concurrent(t *testing.T) {
+	t.Parallel()
+	dedup := NewDeduplicator(NewMemorySeenSet(10, time.Hour), nil)
+	listener := NewEventListener(WithDeduplication(dedup))
+
+	var texts atomic.Int32
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	listener.OnTextMessage(func(context.Context, *NotificationContext, *MessageContext, *Text) error {
+		if texts.Add(1) == 1 {
+			close(entered)
+			<-proceed
+		}
+
+		return nil
+	})
+
+	handler := listener.NotificationHandler()
+	body, _ := json.Marshal(&Notification{Entry: []*Entry{{Changes: []*Change{{Field: "messages", Value: &Value{
+		Messages: []*Message{{ID: "wamid.1", Type: "text", Text: &Text{Body: "hi"}}},
+	}}}}}})
+	notify := func() int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+
+		return recorder.Code
+	}
+
+	first := make(chan int)
+	go func() { first <- notify() }()
+
+	// the second delivery arrives while the hooks of the first are running
+	<-entered
+	if code := notify(); code != http.StatusOK {
+		t.Errorf("second delivery status = %d, want %d", code, http.StatusOK)
+	}
+	close(proceed)
+
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first delivery status = %d, want %d", code, http.StatusOK)
+	}
+
+	if texts.Load() != 1 || dedup.Suppressed() != 1 {
+		t.Errorf("text hooks called %d times with %d suppressed, want 1 and 1", texts.Load(), dedup.Suppressed())
+	}
+}
+
+func TestMemorySeenSet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	set := NewMemorySeenSet(2, time.Hour)
+	set.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = set.Add(ctx, key)
+	}
+
+	if seen, _ := set.Contains(ctx, "a"); seen {
+		t.Errorf("Contains(a) = true, want the oldest key evicted")
+	}
+
+	if seen, _ := set.Contains(ctx, "c"); !seen {
+		t.Errorf("Contains(c) = false, want true")
+	}
+
+	now = now.Add(time.Hour)
+	if seen, _ := set.Contains(ctx, "c"); seen || set.Len() != 1 {
+		t.Errorf("Contains(c) = true after the ttl, want false")
+	}
+
+	if reserved, _ := set.Reserve(ctx, "d"); !reserved {
+		t.Errorf("Reserve(d) = false, want true")
+	}
+
+	if reserved, _ := set.Reserve(ctx, "d"); reserved {
+		t.Errorf("Reserve(d) of a reserved key = true, want false")
+	}
+
+	_ = set.Release(ctx, "d")
+	if seen, _ := set.Contains(ctx, "d"); seen {
+		t.Errorf("Contains(d) = true after Release, want false")
+	}
+
+	_, _ = set.Reserve(ctx, "e")
+	_ = set.Add(ctx, "e")
+	_ = set.Release(ctx, "e")
+	if seen, _ := set.Contains(ctx, "e"); !seen {
+		t.Errorf("Contains(e) = false, want a confirmed key kept by Release")
+	}
+}
+
+func TestFileSeenSet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "seen")
+	set, err := NewFileSeenSet(path, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileSeenSet() error = %v", err)
+	}
+
+	// the file is compacted after 4 additions
+	for _, key := range []string{"message:1", "message:2", "message:3", "message:4", "message:5"} {
+		if err := set.Add(ctx, key); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	_ = set.Close()
+
+	reopened, err := NewFileSeenSet(path, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileSeenSet() error = %v", err)
+	}
+	defer reopened.Close()
+
+	for key, want := range map[string]bool{"message:1": false, "message:4": true, "message:5": true} {
+		if seen, _ := reopened.Contains(ctx, key); seen != want {
+			t.Errorf("Contains(%s) = %t, want %t", key, seen, want)
+		}
+	}
+
+	// the reserved keys are not saved
+	reserved, err := NewFileSeenSet(filepath.Join(t.TempDir(), "reserved"), 10, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileSeenSet() error = %v", err)
+	}
+	_ = reserved.Add(ctx, "message:1")
+	_, _ = reserved.Reserve(ctx, "message:2")
+	_ = reserved.compact()
+	_ = reserved.Close()
+
+	reserved, err = NewFileSeenSet(reserved.path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFileSeenSet() error = %v", err)
+	}
+	defer reserved.Close()
+
+	for key, want := range map[string]bool{"message:1": true, "message:2": false} {
+		if seen, _ := reserved.Contains(ctx, key); seen != want {
+			t.Errorf("Contains(%s) after reopening = %t, want %t", key, seen, want)
+		}
+	}
+}
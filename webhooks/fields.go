@@ -0,0 +1,445 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Fields of the WhatsApp Business Account the webhooks can be subscribed to, the Change.Field
+// of the notifications.
+const (
+	FieldMessages                    = "messages"
+	FieldMessageTemplateStatusUpdate = "message_template_status_update"
+	FieldPhoneNumberQualityUpdate    = "phone_number_quality_update"
+	FieldPhoneNumberNameUpdate       = "phone_number_name_update"
+	FieldAccountUpdate               = "account_update"
+	FieldAccountAlerts               = "account_alerts"
+	FieldAccountReviewUpdate         = "account_review_update"
+	FieldBusinessCapabilityUpdate    = "business_capability_update"
+	FieldTemplateCategoryUpdate      = "template_category_update"
+	FieldSecurity                    = "security"
+)
+
+// Events of the changes of the fields other than messages.
+const (
+	EventTemplateStatusUpdate     Event = "template_status_update"
+	EventPhoneNumberQualityUpdate Event = "phone_number_quality_update"
+	EventPhoneNumberNameUpdate    Event = "phone_number_name_update"
+	EventAccountUpdate            Event = "account_update"
+	EventAccountAlert             Event = "account_alert"
+	EventAccountReviewUpdate      Event = "account_review_update"
+	EventBusinessCapabilityUpdate Event = "business_capability_update"
+	EventTemplateCategoryUpdate   Event = "template_category_update"
+	EventSecurityUpdate           Event = "security_update"
+)
+
+var ErrOnFieldUpdateHook = errors.New("on field update hook error")
+
+type (
+	// TemplateStatusUpdate is the value of a message_template_status_update change, sent when
+	// the status of a message template changes. Event is the new status, APPROVED, REJECTED,
+	// PENDING, FLAGGED, PAUSED, DISABLED, PENDING_DELETION, IN_APPEAL or REINSTATED. Reason
+	// explains a rejection, INCORRECT_CATEGORY or INVALID_FORMAT for example.
+	TemplateStatusUpdate struct {
+		Event                   string               `json:"event,omitempty"`
+		MessageTemplateID       int64                `json:"message_template_id,omitempty"`
+		MessageTemplateName     string               `json:"message_template_name,omitempty"`
+		MessageTemplateLanguage string               `json:"message_template_language,omitempty"`
+		Reason                  string               `json:"reason,omitempty"`
+		OtherInfo               *TemplateOtherInfo   `json:"other_info,omitempty"`
+		DisableInfo             *TemplateDisableInfo `json:"disable_info,omitempty"`
+	}
+
+	// TemplateOtherInfo describes why a template has been paused.
+	TemplateOtherInfo struct {
+		Title       string `json:"title,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+
+	// TemplateDisableInfo has the date a template is disabled on.
+	TemplateDisableInfo struct {
+		DisableDate string `json:"disable_date,omitempty"`
+	}
+
+	// PhoneNumberQualityUpdate is the value of a phone_number_quality_update change, sent when
+	// the quality rating or the messaging limit of a phone number changes. Event is FLAGGED,
+	// UNFLAGGED, DOWNGRADE or UPGRADE and CurrentLimit the messaging limit tier, TIER_1K for
+	// example.
+	PhoneNumberQualityUpdate struct {
+		DisplayPhoneNumber           string `json:"display_phone_number,omitempty"`
+		Event                        string `json:"event,omitempty"`
+		CurrentLimit                 string `json:"current_limit,omitempty"`
+		OldLimit                     string `json:"old_limit,omitempty"`
+		MaxDailyConversationPerPhone int64  `json:"max_daily_conversation_per_phone,omitempty"`
+	}
+
+	// PhoneNumberNameUpdate is the value of a phone_number_name_update change, sent with the
+	// decision on a requested display name, APPROVED, REJECTED or DEFERRED.
+	PhoneNumberNameUpdate struct {
+		DisplayPhoneNumber    string `json:"display_phone_number,omitempty"`
+		Decision              string `json:"decision,omitempty"`
+		RequestedVerifiedName string `json:"requested_verified_name,omitempty"`
+		RejectionReason       string `json:"rejection_reason,omitempty"`
+	}
+
+	// AccountUpdate is the value of an account_update change, sent when the business account
+	// changes, when it is verified, restricted or banned for example.
+	AccountUpdate struct {
+		PhoneNumber     string             `json:"phone_number,omitempty"`
+		Event           string             `json:"event,omitempty"`
+		BanInfo         *BanInfo           `json:"ban_info,omitempty"`
+		RestrictionInfo []*RestrictionInfo `json:"restriction_info,omitempty"`
+		ViolationInfo   *ViolationInfo     `json:"violation_info,omitempty"`
+	}
+
+	BanInfo struct {
+		WabaBanState []string `json:"waba_ban_state,omitempty"`
+		WabaBanDate  string   `json:"waba_ban_date,omitempty"`
+	}
+
+	RestrictionInfo struct {
+		RestrictionType string `json:"restriction_type,omitempty"`
+		Expiration      string `json:"expiration,omitempty"`
+	}
+
+	ViolationInfo struct {
+		ViolationType string `json:"violation_type,omitempty"`
+	}
+
+	// AccountAlert is the value of an account_alerts change, an alert about the business
+	// account or one of its phone numbers.
+	AccountAlert struct {
+		EntityType string     `json:"entity_type,omitempty"`
+		EntityID   string     `json:"entity_id,omitempty"`
+		AlertInfo  *AlertInfo `json:"alert_info,omitempty"`
+	}
+
+	AlertInfo struct {
+		AlertSeverity    string `json:"alert_severity,omitempty"`
+		AlertStatus      string `json:"alert_status,omitempty"`
+		AlertType        string `json:"alert_type,omitempty"`
+		AlertDescription string `json:"alert_description,omitempty"`
+	}
+
+	// AccountReviewUpdate is the value of an account_review_update change, sent with the
+	// decision of the review of the business account, APPROVED, REJECTED or PENDING.
+	AccountReviewUpdate struct {
+		Decision string `json:"decision,omitempty"`
+	}
+
+	// BusinessCapabilityUpdate is the value of a business_capability_update change, sent when
+	// the limits of the business change.
+	BusinessCapabilityUpdate struct {
+		MaxDailyConversationPerPhone int64 `json:"max_daily_conversation_per_phone,omitempty"`
+		MaxPhoneNumbersPerBusiness   int64 `json:"max_phone_numbers_per_business,omitempty"`
+		MaxPhoneNumbersPerWaba       int64 `json:"max_phone_numbers_per_waba,omitempty"`
+	}
+
+	// TemplateCategoryUpdate is the value of a template_category_update change, sent when the
+	// category of a message template is changed.
+	TemplateCategoryUpdate struct {
+		MessageTemplateID       int64  `json:"message_template_id,omitempty"`
+		MessageTemplateName     string `json:"message_template_name,omitempty"`
+		MessageTemplateLanguage string `json:"message_template_language,omitempty"`
+		PreviousCategory        string `json:"previous_category,omitempty"`
+		NewCategory             string `json:"new_category,omitempty"`
+		CorrectCategory         string `json:"correct_category,omitempty"`
+	}
+
+	// SecurityUpdate is the value of a security change, sent when the security settings of a
+	// phone number change, Event is PIN_CHANGED or PIN_RESET_REQUEST for example.
+	SecurityUpdate struct {
+		DisplayPhoneNumber string `json:"display_phone_number,omitempty"`
+		Event              string `json:"event,omitempty"`
+		Requester          string `json:"requester,omitempty"`
+	}
+
+	OnTemplateStatusUpdateHook     func(ctx context.Context, nctx *NotificationContext, update *TemplateStatusUpdate) error
+	OnPhoneNumberQualityUpdateHook func(ctx context.Context, nctx *NotificationContext, update *PhoneNumberQualityUpdate) error
+	OnPhoneNumberNameUpdateHook    func(ctx context.Context, nctx *NotificationContext, update *PhoneNumberNameUpdate) error
+	OnAccountUpdateHook            func(ctx context.Context, nctx *NotificationContext, update *AccountUpdate) error
+	OnAccountAlertHook             func(ctx context.Context, nctx *NotificationContext, update *AccountAlert) error
+	OnAccountReviewUpdateHook      func(ctx context.Context, nctx *NotificationContext, update *AccountReviewUpdate) error
+	OnBusinessCapabilityUpdateHook func(ctx context.Context, nctx *NotificationContext, update *BusinessCapabilityUpdate) error
+	OnTemplateCategoryUpdateHook   func(ctx context.Context, nctx *NotificationContext, update *TemplateCategoryUpdate) error
+	OnSecurityUpdateHook           func(ctx context.Context, nctx *NotificationContext, update *SecurityUpdate) error
+)
+
+// UnmarshalJSON decodes the value of the change into the field of Change for the Field of the
+// change. The values of messages and of the unknown fields are decoded into Value. Only the
+// value of messages has to be valid, the other values that can not be decoded are kept in
+// RawValue so that they do not prevent the messages of the notification to be handled.
+func (change *Change) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Value json.RawMessage `json:"value"`
+		Field string          `json:"field"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err //nolint:wrapcheck
+	}
+	*change = Change{Field: raw.Field}
+
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+
+	var value any
+	switch raw.Field {
+	case FieldMessageTemplateStatusUpdate:
+		change.TemplateStatusUpdate = &TemplateStatusUpdate{}
+		value = change.TemplateStatusUpdate
+	case FieldPhoneNumberQualityUpdate:
+		change.PhoneNumberQualityUpdate = &PhoneNumberQualityUpdate{}
+		value = change.PhoneNumberQualityUpdate
+	case FieldPhoneNumberNameUpdate:
+		change.PhoneNumberNameUpdate = &PhoneNumberNameUpdate{}
+		value = change.PhoneNumberNameUpdate
+	case FieldAccountUpdate:
+		change.AccountUpdate = &AccountUpdate{}
+		value = change.AccountUpdate
+	case FieldAccountAlerts:
+		change.AccountAlert = &AccountAlert{}
+		value = change.AccountAlert
+	case FieldAccountReviewUpdate:
+		change.AccountReviewUpdate = &AccountReviewUpdate{}
+		value = change.AccountReviewUpdate
+	case FieldBusinessCapabilityUpdate:
+		change.BusinessCapabilityUpdate = &BusinessCapabilityUpdate{}
+		value = change.BusinessCapabilityUpdate
+	case FieldTemplateCategoryUpdate:
+		change.TemplateCategoryUpdate = &TemplateCategoryUpdate{}
+		value = change.TemplateCategoryUpdate
+	case FieldSecurity:
+		change.SecurityUpdate = &SecurityUpdate{}
+		value = change.SecurityUpdate
+	default:
+		change.Value = &Value{}
+		value = change.Value
+	}
+
+	if err := json.Unmarshal(raw.Value, value); err != nil {
+		if raw.Field == FieldMessages {
+			return fmt.Errorf("field %s: %w", raw.Field, err)
+		}
+		*change = Change{Field: raw.Field, RawValue: raw.Value}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the change with the value set for its field as the value.
+func (change *Change) MarshalJSON() ([]byte, error) {
+	type plain struct {
+		Value any    `json:"value,omitempty"`
+		Field string `json:"field,omitempty"`
+	}
+	event, update := change.update()
+	if event == "" && change.RawValue != nil {
+		return json.Marshal(&plain{Value: change.RawValue, Field: change.Field}) //nolint:wrapcheck
+	}
+
+	if event == "" {
+		return json.Marshal(&plain{Value: change.Value, Field: change.Field}) //nolint:wrapcheck
+	}
+
+	return json.Marshal(&plain{Value: update, Field: change.Field}) //nolint:wrapcheck
+}
+
+// update returns the event and the value of a change of a field other than messages, an
+// empty event if the change is not one of them.
+func (change *Change) update() (Event, any) {
+	switch {
+	case change.TemplateStatusUpdate != nil:
+		return EventTemplateStatusUpdate, change.TemplateStatusUpdate
+	case change.PhoneNumberQualityUpdate != nil:
+		return EventPhoneNumberQualityUpdate, change.PhoneNumberQualityUpdate
+	case change.PhoneNumberNameUpdate != nil:
+		return EventPhoneNumberNameUpdate, change.PhoneNumberNameUpdate
+	case change.AccountUpdate != nil:
+		return EventAccountUpdate, change.AccountUpdate
+	case change.AccountAlert != nil:
+		return EventAccountAlert, change.AccountAlert
+	case change.AccountReviewUpdate != nil:
+		return EventAccountReviewUpdate, change.AccountReviewUpdate
+	case change.BusinessCapabilityUpdate != nil:
+		return EventBusinessCapabilityUpdate, change.BusinessCapabilityUpdate
+	case change.TemplateCategoryUpdate != nil:
+		return EventTemplateCategoryUpdate, change.TemplateCategoryUpdate
+	case change.SecurityUpdate != nil:
+		return EventSecurityUpdate, change.SecurityUpdate
+	default:
+		return "", nil
+	}
+}
+
+// attachHooksToUpdate calls the hooks of the change of a field other than messages.
+func attachHooksToUpdate(ctx context.Context, id string, change *Change, hooks *HookRegistry,
+	heh HooksErrorHandler,
+) error {
+	event, update := change.update()
+	if event == "" {
+		return nil
+	}
+
+	err := hooks.Dispatch(ctx, &HookCall{
+		Event:               event,
+		NotificationContext: &NotificationContext{ID: id},
+		Payload:             update,
+	})
+	if err != nil {
+		if IsFatalError(heh(err)) {
+			return err
+		}
+
+		return ErrOnFieldUpdateHook
+	}
+
+	return nil
+}
+
+// OnTemplateStatusUpdate subscribes the hook to EventTemplateStatusUpdate.
+func (registry *HookRegistry) OnTemplateStatusUpdate(hook OnTemplateStatusUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventTemplateStatusUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*TemplateStatusUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnPhoneNumberQualityUpdate subscribes the hook to EventPhoneNumberQualityUpdate.
+func (registry *HookRegistry) OnPhoneNumberQualityUpdate(hook OnPhoneNumberQualityUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventPhoneNumberQualityUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*PhoneNumberQualityUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnPhoneNumberNameUpdate subscribes the hook to EventPhoneNumberNameUpdate.
+func (registry *HookRegistry) OnPhoneNumberNameUpdate(hook OnPhoneNumberNameUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventPhoneNumberNameUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*PhoneNumberNameUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnAccountUpdate subscribes the hook to EventAccountUpdate.
+func (registry *HookRegistry) OnAccountUpdate(hook OnAccountUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventAccountUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*AccountUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnAccountAlert subscribes the hook to EventAccountAlert.
+func (registry *HookRegistry) OnAccountAlert(hook OnAccountAlertHook) Unsubscribe {
+	return registry.Subscribe(EventAccountAlert, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*AccountAlert)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnAccountReviewUpdate subscribes the hook to EventAccountReviewUpdate.
+func (registry *HookRegistry) OnAccountReviewUpdate(hook OnAccountReviewUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventAccountReviewUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*AccountReviewUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnBusinessCapabilityUpdate subscribes the hook to EventBusinessCapabilityUpdate.
+func (registry *HookRegistry) OnBusinessCapabilityUpdate(hook OnBusinessCapabilityUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventBusinessCapabilityUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*BusinessCapabilityUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnTemplateCategoryUpdate subscribes the hook to EventTemplateCategoryUpdate.
+func (registry *HookRegistry) OnTemplateCategoryUpdate(hook OnTemplateCategoryUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventTemplateCategoryUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*TemplateCategoryUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnSecurityUpdate subscribes the hook to EventSecurityUpdate.
+func (registry *HookRegistry) OnSecurityUpdate(hook OnSecurityUpdateHook) Unsubscribe {
+	return registry.Subscribe(EventSecurityUpdate, func(ctx context.Context, call *HookCall) error {
+		update, _ := call.Payload.(*SecurityUpdate)
+
+		return hook(ctx, call.NotificationContext, update)
+	})
+}
+
+// OnTemplateStatusUpdate subscribes the hook to EventTemplateStatusUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnTemplateStatusUpdate(hook OnTemplateStatusUpdateHook) Unsubscribe {
+	return ls.hooks.OnTemplateStatusUpdate(hook)
+}
+
+// OnPhoneNumberQualityUpdate subscribes the hook to EventPhoneNumberQualityUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnPhoneNumberQualityUpdate(hook OnPhoneNumberQualityUpdateHook) Unsubscribe {
+	return ls.hooks.OnPhoneNumberQualityUpdate(hook)
+}
+
+// OnPhoneNumberNameUpdate subscribes the hook to EventPhoneNumberNameUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnPhoneNumberNameUpdate(hook OnPhoneNumberNameUpdateHook) Unsubscribe {
+	return ls.hooks.OnPhoneNumberNameUpdate(hook)
+}
+
+// OnAccountUpdate subscribes the hook to EventAccountUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnAccountUpdate(hook OnAccountUpdateHook) Unsubscribe {
+	return ls.hooks.OnAccountUpdate(hook)
+}
+
+// OnAccountAlert subscribes the hook to EventAccountAlert. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnAccountAlert(hook OnAccountAlertHook) Unsubscribe {
+	return ls.hooks.OnAccountAlert(hook)
+}
+
+// OnAccountReviewUpdate subscribes the hook to EventAccountReviewUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnAccountReviewUpdate(hook OnAccountReviewUpdateHook) Unsubscribe {
+	return ls.hooks.OnAccountReviewUpdate(hook)
+}
+
+// OnBusinessCapabilityUpdate subscribes the hook to EventBusinessCapabilityUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnBusinessCapabilityUpdate(hook OnBusinessCapabilityUpdateHook) Unsubscribe {
+	return ls.hooks.OnBusinessCapabilityUpdate(hook)
+}
+
+// OnTemplateCategoryUpdate subscribes the hook to EventTemplateCategoryUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnTemplateCategoryUpdate(hook OnTemplateCategoryUpdateHook) Unsubscribe {
+	return ls.hooks.OnTemplateCategoryUpdate(hook)
+}
+
+// OnSecurityUpdate subscribes the hook to EventSecurityUpdate. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnSecurityUpdate(hook OnSecurityUpdateHook) Unsubscribe {
+	return ls.hooks.OnSecurityUpdate(hook)
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const fieldsNotification = `{
+  "object": "whatsapp_business_account",
+  "entry": [{
+    "id": "WABA_ID",
+    "time": 1700000000,
+    "changes": [
+      {
+        "field": "message_template_status_update",
+        "value": {
+          "event": "REJECTED",
+          "message_template_id": 1234567890,
+          "message_template_name": "order_update",
+          "message_template_language": "en_US",
+          "reason": "INCORRECT_CATEGORY"
+        }
+      },
+      {
+        "field": "phone_number_quality_update",
+        "value": {
+          "display_phone_number": "15550783881",
+          "event": "DOWNGRADE",
+          "current_limit": "TIER_1K"
+        }
+      },
+      {
+        "field": "account_alerts",
+        "value": {
+          "entity_type": "WABA",
+          "entity_id": "WABA_ID",
+          "alert_info": {"alert_severity": "CRITICAL", "alert_status": "ACTIVE", "alert_type": "OBA_APPROVED"}
+        }
+      },
+      {
+        "field": "messages",
+        "value": {
+          "messaging_product": "whatsapp",
+          "metadata": {"display_phone_number": "15550783881", "phone_number_id": "PHONE_NUMBER_ID"},
+          "messages": [{"from": "16505551234", "id": "wamid.1", "type": "text", "text": {"body": "hi"}}]
+        }
+      }
+    ]
+  }]
+}`
+
+func TestEventListener_Fields(t *testing.T) {
+	t.Parallel()
+	var got []string
+	listener := NewEventListener()
+	listener.OnTemplateStatusUpdate(func(_ context.Context, nctx *NotificationContext,
+		update *TemplateStatusUpdate,
+	) error {
+		got = append(got, nctx.ID+" "+update.MessageTemplateName+" "+update.Event+" "+update.Reason)
+
+		return nil
+	})
+	listener.OnPhoneNumberQualityUpdate(func(_ context.Context, _ *NotificationContext,
+		update *PhoneNumberQualityUpdate,
+	) error {
+		got = append(got, update.DisplayPhoneNumber+" "+update.Event+" "+update.CurrentLimit)
+
+		return nil
+	})
+	listener.OnAccountAlert(func(_ context.Context, _ *NotificationContext, alert *AccountAlert) error {
+		got = append(got, alert.EntityType+" "+alert.AlertInfo.AlertSeverity)
+
+		return nil
+	})
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext, text *Text) error {
+		got = append(got, text.Body)
+
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	listener.NotificationHandler().ServeHTTP(recorder,
+		httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(fieldsNotification)))
+
+	want := "WABA_ID order_update REJECTED INCORRECT_CATEGORY|15550783881 DOWNGRADE TIER_1K|WABA CRITICAL|hi"
+	if recorder.Code != http.StatusOK || strings.Join(got, "|") != want {
+		t.Errorf("status = %d, hooks = %s, want %s", recorder.Code, strings.Join(got, "|"), want)
+	}
+}
+
+func TestChange_MarshalJSON(t *testing.T) {
+	t.Parallel()
+	var notification Notification
+	if err := json.Unmarshal([]byte(fieldsNotification), &notification); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	data, err := json.Marshal(&notification)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var decoded Notification
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	changes := decoded.Entry[0].Changes
+	if update := changes[0].TemplateStatusUpdate; update == nil || update.MessageTemplateID != 1234567890 ||
+		changes[0].Value != nil {
+		t.Errorf("template status update = %+v, value = %+v", update, changes[0].Value)
+	}
+
+	if value := changes[3].Value; value == nil || len(value.Messages) != 1 || value.Messages[0].ID != "wamid.1" {
+		t.Errorf("messages value = %+v", value)
+	}
+
+	if parts := splitNotification(&decoded); len(parts) != 4 {
+		t.Errorf("splitNotification() returned %d parts, want 4", len(parts))
+	}
+}
+
+func TestEventListener_MalformedField(t *testing.T) {
+	t.Parallel()
+	notification := `{"object":"whatsapp_business_account","entry":[` +
+		`{"id":"WABA_ID","changes":[{"field":"account_update","value":{"phone_number":15550783881,` +
+		`"event":"ACCOUNT_VIOLATION"}}]},` +
+		`{"id":"WABA_ID","changes":[{"field":"messages","value":{"messaging_product":"whatsapp",` +
+		`"messages":[{"from":"16505551234","id":"wamid.1","type":"text","text":{"body":"hi"}}]}}]}]}`
+
+	var got []string
+	listener := NewEventListener()
+	listener.OnAccountUpdate(func(_ context.Context, _ *NotificationContext, update *AccountUpdate) error {
+		got = append(got, update.Event)
+
+		return nil
+	})
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext, text *Text) error {
+		got = append(got, text.Body)
+
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	listener.NotificationHandler().ServeHTTP(recorder,
+		httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(notification)))
+
+	if recorder.Code != http.StatusOK || strings.Join(got, "|") != "hi" {
+		t.Errorf("status = %d, hooks = %s, want the text message only", recorder.Code, strings.Join(got, "|"))
+	}
+
+	var decoded Notification
+	if err := json.Unmarshal([]byte(notification), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	change := decoded.Entry[0].Changes[0]
+	if change.AccountUpdate != nil || change.Value != nil {
+		t.Errorf("account update = %+v, value = %+v, want nil", change.AccountUpdate, change.Value)
+	}
+
+	want := `{"value":{"phone_number":15550783881,"event":"ACCOUNT_VIOLATION"},"field":"account_update"}`
+	if data, _ := json.Marshal(change); string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,549 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/models"
+)
+
+// Events the hooks subscribe to, one for each hook type.
+const (
+	EventOrderMessage        Event = "order_message"
+	EventButtonMessage       Event = "button_message"
+	EventLocationMessage     Event = "location_message"
+	EventContactsMessage     Event = "contacts_message"
+	EventMessageReaction     Event = "message_reaction"
+	EventUnknownMessage      Event = "unknown_message"
+	EventProductEnquiry      Event = "product_enquiry"
+	EventInteractiveMessage  Event = "interactive_message"
+	EventMessageErrors       Event = "message_errors"
+	EventTextMessage         Event = "text_message"
+	EventReferralMessage     Event = "referral_message"
+	EventCustomerIDChange    Event = "customer_id_change"
+	EventSystemMessage       Event = "system_message"
+	EventMediaMessage        Event = "media_message"
+	EventImageMessage        Event = "image_message"
+	EventVideoMessage        Event = "video_message"
+	EventAudioMessage        Event = "audio_message"
+	EventDocumentMessage     Event = "document_message"
+	EventStickerMessage      Event = "sticker_message"
+	EventNotificationError   Event = "notification_error"
+	EventMessageStatusChange Event = "message_status_change"
+	EventMessageReceived     Event = "message_received"
+)
+
+var ErrHookPanic = errors.New("webhooks: hook panicked")
+
+type (
+	// HookCall is a call of the hooks subscribed to an event. Payload is the argument specific
+	// to the event, for example the *Text of a text message or the *Status of a status change.
+	// MessageContext and Message are nil for the events that are not about a message.
+	HookCall struct {
+		Event               Event
+		NotificationContext *NotificationContext
+		MessageContext      *MessageContext
+		Message             *Message
+		Payload             any
+	}
+
+	// HookFunc is a hook that receives the call of any event.
+	HookFunc func(ctx context.Context, call *HookCall) error
+
+	// HookMiddleware wraps the hooks, for example to log, time or recover from the panics of
+	// every hook call.
+	HookMiddleware func(next HookFunc) HookFunc
+
+	// Unsubscribe removes a hook from the HookRegistry it was subscribed to. It can be called
+	// more than once.
+	Unsubscribe func()
+
+	// HookRegistry holds the hooks subscribed to each event. An event can have any number of
+	// hooks, they are called in the order they were subscribed and each call is wrapped with
+	// the middlewares. Events without hooks are ignored. It is safe for concurrent use, hooks
+	// can be subscribed and unsubscribed while notifications are being handled.
+	HookRegistry struct {
+		mu          sync.RWMutex
+		subscribers map[Event][]*subscriber
+		middlewares []HookMiddleware
+		lastID      uint64
+		dedup       *Deduplicator
+	}
+
+	subscriber struct {
+		id   uint64
+		hook HookFunc
+	}
+)
+
+// NewHookRegistry returns a HookRegistry without hooks.
+func NewHookRegistry() *HookRegistry {
+	return &HookRegistry{subscribers: make(map[Event][]*subscriber)}
+}
+
+// Use appends middlewares that wrap the hook calls, the first middleware is the outermost.
+func (registry *HookRegistry) Use(middlewares ...HookMiddleware) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.middlewares = append(registry.middlewares, middlewares...)
+}
+
+// Subscribe adds the hook to the hooks called on the event.
+func (registry *HookRegistry) Subscribe(event Event, hook HookFunc) Unsubscribe {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.lastID++
+	id := registry.lastID
+	registry.subscribers[event] = append(registry.subscribers[event], &subscriber{id: id, hook: hook})
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { registry.unsubscribe(event, id) })
+	}
+}
+
+// Subscribed reports whether the event has hooks.
+func (registry *HookRegistry) Subscribed(event Event) bool {
+	if registry == nil {
+		return false
+	}
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return len(registry.subscribers[event]) > 0
+}
+
+// Dispatch calls the hooks of the event of the call in order. All the hooks are called even
+// if some fail, unless a hook returns a fatal error. The errors are returned as a single error.
+func (registry *HookRegistry) Dispatch(ctx context.Context, call *HookCall) error {
+	if registry == nil {
+		return nil
+	}
+
+	registry.mu.RLock()
+	subscribers := registry.subscribers[call.Event]
+	middlewares := registry.middlewares
+	registry.mu.RUnlock()
+
+	var errs []error
+	for _, s := range subscribers {
+		hook := s.hook
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			hook = middlewares[i](hook)
+		}
+
+		if err := hook(ctx, call); err != nil {
+			if IsFatalError(err) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return getEncounteredError(errs)
+}
+
+// SubscribeHooks subscribes the hooks that are set in hooks. The returned Unsubscribe
+// removes all of them.
+func (registry *HookRegistry) SubscribeHooks(hooks *Hooks) Unsubscribe {
+	if hooks == nil {
+		return func() {}
+	}
+
+	var unsubscribes []Unsubscribe
+	if hooks.OnOrderMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnOrderMessage(hooks.OnOrderMessageHook))
+	}
+	if hooks.OnButtonMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnButtonMessage(hooks.OnButtonMessageHook))
+	}
+	if hooks.OnLocationMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnLocationMessage(hooks.OnLocationMessageHook))
+	}
+	if hooks.OnContactsMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnContactsMessage(hooks.OnContactsMessageHook))
+	}
+	if hooks.OnMessageReactionHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnMessageReaction(hooks.OnMessageReactionHook))
+	}
+	if hooks.OnUnknownMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnUnknownMessage(hooks.OnUnknownMessageHook))
+	}
+	if hooks.OnProductEnquiryHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnProductEnquiry(hooks.OnProductEnquiryHook))
+	}
+	if hooks.OnInteractiveMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnInteractiveMessage(hooks.OnInteractiveMessageHook))
+	}
+	if hooks.OnMessageErrorsHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnMessageErrors(hooks.OnMessageErrorsHook))
+	}
+	if hooks.OnTextMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnTextMessage(hooks.OnTextMessageHook))
+	}
+	if hooks.OnReferralMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnReferralMessage(hooks.OnReferralMessageHook))
+	}
+	if hooks.OnCustomerIDChangeHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnCustomerIDChange(hooks.OnCustomerIDChangeHook))
+	}
+	if hooks.OnSystemMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnSystemMessage(hooks.OnSystemMessageHook))
+	}
+	if hooks.OnMediaMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnMediaMessage(hooks.OnMediaMessageHook))
+	}
+	if hooks.OnImageMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnImageMessage(hooks.OnImageMessageHook))
+	}
+	if hooks.OnVideoMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnVideoMessage(hooks.OnVideoMessageHook))
+	}
+	if hooks.OnAudioMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnAudioMessage(hooks.OnAudioMessageHook))
+	}
+	if hooks.OnDocumentMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnDocumentMessage(hooks.OnDocumentMessageHook))
+	}
+	if hooks.OnStickerMessageHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnStickerMessage(hooks.OnStickerMessageHook))
+	}
+	if hooks.OnNotificationErrorHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnNotificationError(hooks.OnNotificationErrorHook))
+	}
+	if hooks.OnMessageStatusChangeHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnMessageStatusChange(hooks.OnMessageStatusChangeHook))
+	}
+	if hooks.OnMessageReceivedHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnMessageReceived(hooks.OnMessageReceivedHook))
+	}
+	if hooks.OnTemplateStatusUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnTemplateStatusUpdate(hooks.OnTemplateStatusUpdateHook))
+	}
+	if hooks.OnPhoneNumberQualityUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnPhoneNumberQualityUpdate(hooks.OnPhoneNumberQualityUpdateHook))
+	}
+	if hooks.OnPhoneNumberNameUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnPhoneNumberNameUpdate(hooks.OnPhoneNumberNameUpdateHook))
+	}
+	if hooks.OnAccountUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnAccountUpdate(hooks.OnAccountUpdateHook))
+	}
+	if hooks.OnAccountAlertHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnAccountAlert(hooks.OnAccountAlertHook))
+	}
+	if hooks.OnAccountReviewUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnAccountReviewUpdate(hooks.OnAccountReviewUpdateHook))
+	}
+	if hooks.OnBusinessCapabilityUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnBusinessCapabilityUpdate(hooks.OnBusinessCapabilityUpdateHook))
+	}
+	if hooks.OnTemplateCategoryUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnTemplateCategoryUpdate(hooks.OnTemplateCategoryUpdateHook))
+	}
+	if hooks.OnSecurityUpdateHook != nil {
+		unsubscribes = append(unsubscribes, registry.OnSecurityUpdate(hooks.OnSecurityUpdateHook))
+	}
+
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// OnOrderMessage subscribes the hook to EventOrderMessage.
+func (registry *HookRegistry) OnOrderMessage(hook OnOrderMessageHook) Unsubscribe {
+	return registry.Subscribe(EventOrderMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Order)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnButtonMessage subscribes the hook to EventButtonMessage.
+func (registry *HookRegistry) OnButtonMessage(hook OnButtonMessageHook) Unsubscribe {
+	return registry.Subscribe(EventButtonMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Button)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnLocationMessage subscribes the hook to EventLocationMessage.
+func (registry *HookRegistry) OnLocationMessage(hook OnLocationMessageHook) Unsubscribe {
+	return registry.Subscribe(EventLocationMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.Location)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnContactsMessage subscribes the hook to EventContactsMessage.
+func (registry *HookRegistry) OnContactsMessage(hook OnContactsMessageHook) Unsubscribe {
+	return registry.Subscribe(EventContactsMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.Contacts)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnMessageReaction subscribes the hook to EventMessageReaction.
+func (registry *HookRegistry) OnMessageReaction(hook OnMessageReactionHook) Unsubscribe {
+	return registry.Subscribe(EventMessageReaction, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.Reaction)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnUnknownMessage subscribes the hook to EventUnknownMessage.
+func (registry *HookRegistry) OnUnknownMessage(hook OnUnknownMessageHook) Unsubscribe {
+	return registry.Subscribe(EventUnknownMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.([]*werrors.Error)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnProductEnquiry subscribes the hook to EventProductEnquiry.
+func (registry *HookRegistry) OnProductEnquiry(hook OnProductEnquiryHook) Unsubscribe {
+	return registry.Subscribe(EventProductEnquiry, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Text)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnInteractiveMessage subscribes the hook to EventInteractiveMessage.
+func (registry *HookRegistry) OnInteractiveMessage(hook OnInteractiveMessageHook) Unsubscribe {
+	return registry.Subscribe(EventInteractiveMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Interactive)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnMessageErrors subscribes the hook to EventMessageErrors.
+func (registry *HookRegistry) OnMessageErrors(hook OnMessageErrorsHook) Unsubscribe {
+	return registry.Subscribe(EventMessageErrors, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.([]*werrors.Error)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnTextMessage subscribes the hook to EventTextMessage.
+func (registry *HookRegistry) OnTextMessage(hook OnTextMessageHook) Unsubscribe {
+	return registry.Subscribe(EventTextMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Text)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnReferralMessage subscribes the hook to EventReferralMessage.
+func (registry *HookRegistry) OnReferralMessage(hook OnReferralMessageHook) Unsubscribe {
+	return registry.Subscribe(EventReferralMessage, func(ctx context.Context, call *HookCall) error {
+		referral, _ := call.Payload.(*Referral)
+		var text *Text
+		if call.Message != nil {
+			text = call.Message.Text
+		}
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, text, referral)
+	})
+}
+
+// OnCustomerIDChange subscribes the hook to EventCustomerIDChange.
+func (registry *HookRegistry) OnCustomerIDChange(hook OnCustomerIDChangeMessageHook) Unsubscribe {
+	return registry.Subscribe(EventCustomerIDChange, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Identity)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnSystemMessage subscribes the hook to EventSystemMessage.
+func (registry *HookRegistry) OnSystemMessage(hook OnSystemMessageHook) Unsubscribe {
+	return registry.Subscribe(EventSystemMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*System)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnMediaMessage subscribes the hook to EventMediaMessage.
+func (registry *HookRegistry) OnMediaMessage(hook OnMediaMessageHook) Unsubscribe {
+	return registry.Subscribe(EventMediaMessage, func(ctx context.Context, call *HookCall) error {
+		media, _ := call.Payload.(*models.MediaInfo)
+		var mediaType MessageType
+		if call.MessageContext != nil {
+			mediaType = ParseMessageType(call.MessageContext.Type)
+		}
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, mediaType, media)
+	})
+}
+
+// OnImageMessage subscribes the hook to EventImageMessage.
+func (registry *HookRegistry) OnImageMessage(hook OnImageMessageHook) Unsubscribe {
+	return registry.Subscribe(EventImageMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.MediaInfo)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnVideoMessage subscribes the hook to EventVideoMessage.
+func (registry *HookRegistry) OnVideoMessage(hook OnVideoMessageHook) Unsubscribe {
+	return registry.Subscribe(EventVideoMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.MediaInfo)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnAudioMessage subscribes the hook to EventAudioMessage.
+func (registry *HookRegistry) OnAudioMessage(hook OnAudioMessageHook) Unsubscribe {
+	return registry.Subscribe(EventAudioMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.MediaInfo)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnDocumentMessage subscribes the hook to EventDocumentMessage.
+func (registry *HookRegistry) OnDocumentMessage(hook OnDocumentMessageHook) Unsubscribe {
+	return registry.Subscribe(EventDocumentMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.MediaInfo)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnStickerMessage subscribes the hook to EventStickerMessage.
+func (registry *HookRegistry) OnStickerMessage(hook OnStickerMessageHook) Unsubscribe {
+	return registry.Subscribe(EventStickerMessage, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*models.MediaInfo)
+
+		return hook(ctx, call.NotificationContext, call.MessageContext, payload)
+	})
+}
+
+// OnNotificationError subscribes the hook to EventNotificationError.
+func (registry *HookRegistry) OnNotificationError(hook OnNotificationErrorHook) Unsubscribe {
+	return registry.Subscribe(EventNotificationError, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*werrors.Error)
+
+		return hook(ctx, call.NotificationContext, payload)
+	})
+}
+
+// OnMessageStatusChange subscribes the hook to EventMessageStatusChange.
+func (registry *HookRegistry) OnMessageStatusChange(hook OnMessageStatusChangeHook) Unsubscribe {
+	return registry.Subscribe(EventMessageStatusChange, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Status)
+
+		return hook(ctx, call.NotificationContext, payload)
+	})
+}
+
+// OnMessageReceived subscribes the hook to EventMessageReceived.
+func (registry *HookRegistry) OnMessageReceived(hook OnMessageReceivedHook) Unsubscribe {
+	return registry.Subscribe(EventMessageReceived, func(ctx context.Context, call *HookCall) error {
+		payload, _ := call.Payload.(*Message)
+
+		return hook(ctx, call.NotificationContext, payload)
+	})
+}
+
+// RecoveryMiddleware recovers from the panics of the hooks and returns them as errors
+// wrapping ErrHookPanic.
+func RecoveryMiddleware() HookMiddleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, call *HookCall) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %s: %v", ErrHookPanic, call.Event, r)
+				}
+			}()
+
+			return next(ctx, call)
+		}
+	}
+}
+
+// LoggingMiddleware logs every hook call and its error with logf, log.Printf for example.
+func LoggingMiddleware(logf func(format string, args ...any)) HookMiddleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, call *HookCall) error {
+			var messageID string
+			if call.MessageContext != nil {
+				messageID = call.MessageContext.ID
+			}
+
+			err := next(ctx, call)
+			if err != nil {
+				logf("webhooks: hook %s (message %q) failed: %v", call.Event, messageID, err)
+			} else {
+				logf("webhooks: hook %s (message %q) done", call.Event, messageID)
+			}
+
+			return err
+		}
+	}
+}
+
+// TimingMiddleware calls observe with the duration and the error of every hook call.
+func TimingMiddleware(observe func(call *HookCall, elapsed time.Duration, err error)) HookMiddleware {
+	return func(next HookFunc) HookFunc {
+		return func(ctx context.Context, call *HookCall) error {
+			start := time.Now()
+			err := next(ctx, call)
+			observe(call, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+func (registry *HookRegistry) unsubscribe(event Event, id uint64) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	subscribers := registry.subscribers[event]
+	for i, s := range subscribers {
+		if s.id == id {
+			// copy so the dispatches in progress keep their snapshot intact
+			kept := make([]*subscriber, 0, len(subscribers)-1)
+			kept = append(kept, subscribers[:i]...)
+			registry.subscribers[event] = append(kept, subscribers[i+1:]...)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookRegistry(t *testing.T) {
+	t.Parallel()
+	var calls []string
+	listener := NewEventListener(WithHookMiddlewares(
+		func(next HookFunc) HookFunc {
+			return func(ctx context.Context, call *HookCall) error {
+				calls = append(calls, "before:"+string(call.Event))
+
+				return next(ctx, call)
+			}
+		},
+		RecoveryMiddleware(),
+	))
+
+	var panicErr error
+	listener.HooksErrorHandler(func(err error) error {
+		panicErr = err
+
+		return err
+	})
+
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext, text *Text) error {
+		calls = append(calls, "analytics:"+text.Body)
+
+		return nil
+	})
+	unsubscribe := listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext,
+		_ *Text,
+	) error {
+		panic("bot crashed")
+	})
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext, text *Text) error {
+		calls = append(calls, "bot:"+text.Body)
+
+		return nil
+	})
+
+	handler := listener.NotificationHandler()
+	notify := func(message *Message) int {
+		body, _ := json.Marshal(&Notification{Entry: []*Entry{{Changes: []*Change{{
+			Field: "messages",
+			Value: &Value{Messages: []*Message{message}},
+		}}}}})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body)))
+
+		return recorder.Code
+	}
+
+	notify(&Message{ID: "1", Type: "text", Text: &Text{Body: "hi"}})
+	want := "before:text_message analytics:hi before:text_message before:text_message bot:hi"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+
+	if !errors.Is(panicErr, ErrHookPanic) {
+		t.Errorf("hooks error = %v, want %v", panicErr, ErrHookPanic)
+	}
+
+	calls = nil
+	unsubscribe()
+	unsubscribe()
+	notify(&Message{ID: "2", Type: "text", Text: &Text{Body: "again"}})
+	want = "before:text_message analytics:again before:text_message bot:again"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("calls after unsubscribe = %s, want %s", got, want)
+	}
+
+	// no hooks are subscribed to the other events
+	calls = nil
+	for _, message := range []*Message{
+		{Type: "order", Order: &Order{}},
+		{Type: "button", Button: &Button{}},
+		{Type: "interactive", Interactive: &Interactive{}},
+		{Type: "text", Text: &Text{}, Referral: &Referral{}},
+	} {
+		if code := notify(message); code != http.StatusOK {
+			t.Errorf("%s message: status = %d, want %d", message.Type, code, http.StatusOK)
+		}
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("calls = %v, want none", calls)
+	}
+}
+
+func TestHookRegistry_Dispatch(t *testing.T) {
+	t.Parallel()
+	registry := NewHookRegistry()
+	errHook := errors.New("hook failed")
+	var called []int
+	var elapsed []time.Duration
+	registry.Use(TimingMiddleware(func(_ *HookCall, d time.Duration, _ error) {
+		elapsed = append(elapsed, d)
+	}))
+	registry.Subscribe(EventMessageStatusChange, func(context.Context, *HookCall) error {
+		called = append(called, 1)
+
+		return errHook
+	})
+	registry.Subscribe(EventMessageStatusChange, func(context.Context, *HookCall) error {
+		called = append(called, 2)
+
+		return NewFatalError(errHook, "stop")
+	})
+	registry.Subscribe(EventMessageStatusChange, func(context.Context, *HookCall) error {
+		called = append(called, 3)
+
+		return nil
+	})
+
+	err := registry.Dispatch(context.Background(), &HookCall{Event: EventMessageStatusChange, Payload: &Status{}})
+	if !IsFatalError(err) || len(called) != 2 || len(elapsed) != 2 {
+		t.Errorf("Dispatch() error = %v, called = %v, timed %d calls, want a fatal error after 2 hooks",
+			err, called, len(elapsed))
+	}
+
+	if err := (*HookRegistry)(nil).Dispatch(context.Background(), &HookCall{Event: EventTextMessage}); err != nil {
+		t.Errorf("Dispatch() on a nil registry error = %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultInboxMaxAttempts  = 5
+	DefaultInboxRetryBackoff = time.Second
+	DefaultInboxPollInterval = time.Second
+	inboxBatchSize           = 100
+)
+
+var (
+	ErrOnInboxAppend     = errors.New("error saving notification to the inbox")
+	ErrInboxNotAttached  = errors.New("webhooks: inbox is not attached to a listener")
+	ErrInboxInvalidEntry = errors.New("webhooks: invalid inbox entry")
+	ErrInboxCorruptLog   = errors.New("webhooks: corrupt inbox log")
+)
+
+type (
+	// InboxEntry is a notification saved to the inbox as it was received, with the signature
+	// from the X-Hub-Signature-256 header. Seq is assigned by the store, starting at 1.
+	InboxEntry struct {
+		Seq        uint64    `json:"seq"`
+		ReceivedAt time.Time `json:"received_at"`
+		Payload    []byte    `json:"payload"`
+		Signature  string    `json:"signature,omitempty"`
+		Attempts   int       `json:"attempts,omitempty"`
+		LastError  string    `json:"last_error,omitempty"`
+	}
+
+	// NotificationStore is the durable storage of an Inbox. Append must only return once the
+	// entry is persisted. Read returns at most limit entries with a Seq greater than after in
+	// order, and Range the entries received in [from, to). The checkpoint is the Seq of the
+	// last entry processed. Implementations must be safe for concurrent use.
+	NotificationStore interface {
+		Append(ctx context.Context, entry *InboxEntry) (uint64, error)
+		Read(ctx context.Context, after uint64, limit int) ([]*InboxEntry, error)
+		Range(ctx context.Context, from, to time.Time) ([]*InboxEntry, error)
+		Checkpoint(ctx context.Context) (uint64, error)
+		SetCheckpoint(ctx context.Context, seq uint64) error
+		DeadLetter(ctx context.Context, entry *InboxEntry) error
+		DeadLetters(ctx context.Context) ([]*InboxEntry, error)
+	}
+
+	// NotificationCompactor is implemented by the stores that can remove the entries that have
+	// been processed. Compact removes the entries up to the checkpoint received before the
+	// given time and returns how many were removed.
+	NotificationCompactor interface {
+		Compact(ctx context.Context, before time.Time) (int, error)
+	}
+
+	InboxOption func(*Inbox)
+
+	// Inbox makes the processing of the notifications durable. The NotificationHandler of a
+	// listener with an inbox saves the notifications to the store before acknowledging them,
+	// and Run calls the hooks of the saved notifications in order, at least once.
+	//
+	// A notification whose hooks fail is retried, and moved to the dead letters once it has
+	// failed the maximum number of attempts or a hook returns a fatal error. The hooks are
+	// called again for a retried or replayed notification, so they should be idempotent.
+	//
+	// The notifications are processed one at a time in the order they were received, so a
+	// failing notification holds back the ones after it until it succeeds or is dead lettered:
+	// with the defaults the retries wait 1+2+4+8 seconds, about 15 seconds. Lower the attempts
+	// with WithInboxMaxAttempts or the backoff with WithInboxRetryBackoff when the hooks of the
+	// following notifications should not wait that long.
+	Inbox struct {
+		store        NotificationStore
+		process      func(ctx context.Context, notification *Notification) error
+		maxAttempts  int
+		backoff      time.Duration
+		pollInterval time.Duration
+		retention    time.Duration
+		appended     chan struct{}
+		now          func() time.Time
+	}
+)
+
+// NewInbox returns an Inbox that saves the notifications to the store. Attach it to a
+// listener with WithInbox.
+func NewInbox(store NotificationStore, options ...InboxOption) *Inbox {
+	inbox := &Inbox{
+		store:        store,
+		maxAttempts:  DefaultInboxMaxAttempts,
+		backoff:      DefaultInboxRetryBackoff,
+		pollInterval: DefaultInboxPollInterval,
+		appended:     make(chan struct{}, 1),
+		now:          time.Now,
+	}
+
+	for _, option := range options {
+		option(inbox)
+	}
+
+	return inbox
+}
+
+// WithInboxMaxAttempts sets the number of times the hooks of a notification are called
+// before it is dead lettered.
+func WithInboxMaxAttempts(attempts int) InboxOption {
+	return func(inbox *Inbox) {
+		inbox.maxAttempts = attempts
+	}
+}
+
+// WithInboxRetryBackoff sets the wait before the first retry, it doubles on every retry.
+func WithInboxRetryBackoff(backoff time.Duration) InboxOption {
+	return func(inbox *Inbox) {
+		inbox.backoff = backoff
+	}
+}
+
+// WithInboxPollInterval sets how often Run checks the store for notifications saved by
+// other processes sharing it.
+func WithInboxPollInterval(interval time.Duration) InboxOption {
+	return func(inbox *Inbox) {
+		inbox.pollInterval = interval
+	}
+}
+
+// WithInboxRetention makes Run remove the processed notifications older than retention from
+// the store when it implements NotificationCompactor, they can no longer be replayed. Zero,
+// the default, keeps them forever.
+func WithInboxRetention(retention time.Duration) InboxOption {
+	return func(inbox *Inbox) {
+		inbox.retention = retention
+	}
+}
+
+// WithInbox makes the NotificationHandler save the notifications to the inbox and
+// acknowledge them, their hooks are called by Inbox.Run. It takes precedence over WithAsync.
+//
+// The errors of saving a notification, wrapping ErrOnInboxAppend, are passed to the
+// NotificationErrorHandler that should respond with a status other than 200 for the
+// notification to be delivered again.
+func WithInbox(inbox *Inbox) ListenerOption {
+	return func(ls *EventListener) {
+		ls.inbox = inbox
+		inbox.process = func(ctx context.Context, notification *Notification) error {
+			return attachHooksToNotification(ctx, notification, ls.hooks, ls.hef)
+		}
+	}
+}
+
+// Store returns the NotificationStore of the inbox, to list the dead letters for example.
+func (inbox *Inbox) Store() NotificationStore {
+	return inbox.store
+}
+
+// Run processes the saved notifications from the checkpoint until ctx is done.
+func (inbox *Inbox) Run(ctx context.Context) error {
+	if inbox.process == nil {
+		return ErrInboxNotAttached
+	}
+
+	ticker := time.NewTicker(inbox.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := inbox.Drain(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			continue
+		}
+
+		if err := inbox.compact(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck
+		case <-inbox.appended:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain processes the notifications saved after the checkpoint and returns how many were
+// processed, dead lettered ones included.
+func (inbox *Inbox) Drain(ctx context.Context) (int, error) {
+	if inbox.process == nil {
+		return 0, ErrInboxNotAttached
+	}
+
+	total := 0
+	for {
+		checkpoint, err := inbox.store.Checkpoint(ctx)
+		if err != nil {
+			return total, fmt.Errorf("inbox: %w", err)
+		}
+
+		entries, err := inbox.store.Read(ctx, checkpoint, inboxBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("inbox: %w", err)
+		}
+
+		if len(entries) == 0 {
+			return total, nil
+		}
+
+		for _, entry := range entries {
+			if err := inbox.deliver(ctx, entry); err != nil {
+				return total, err
+			}
+
+			if err := inbox.store.SetCheckpoint(ctx, entry.Seq); err != nil {
+				return total, fmt.Errorf("inbox: %w", err)
+			}
+			total++
+		}
+	}
+}
+
+// Replay calls the hooks of the notifications received in [from, to) once, whether they
+// have been processed or dead lettered, and returns how many were replayed. The checkpoint
+// is left as it is.
+func (inbox *Inbox) Replay(ctx context.Context, from, to time.Time) (int, error) {
+	if inbox.process == nil {
+		return 0, ErrInboxNotAttached
+	}
+
+	entries, err := inbox.store.Range(ctx, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("inbox: replay: %w", err)
+	}
+
+	var errs []error
+	ctx = withoutDeduplication(ctx)
+	for _, entry := range entries {
+		if err := inbox.processEntry(ctx, entry); err != nil {
+			errs = append(errs, fmt.Errorf("entry %d: %w", entry.Seq, err))
+		}
+	}
+
+	if err := getEncounteredError(errs); err != nil {
+		return len(entries), fmt.Errorf("inbox: replay: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// compact removes the notifications older than the retention from the store.
+func (inbox *Inbox) compact(ctx context.Context) error {
+	compactor, ok := inbox.store.(NotificationCompactor)
+	if !ok || inbox.retention <= 0 {
+		return nil
+	}
+
+	if _, err := compactor.Compact(ctx, inbox.now().Add(-inbox.retention)); err != nil {
+		return fmt.Errorf("inbox: %w", err)
+	}
+
+	return nil
+}
+
+// deliver processes the entry until it succeeds or is dead lettered, the entries after it wait
+// meanwhile. It only returns an error when ctx is done or the entry could not be dead lettered.
+func (inbox *Inbox) deliver(ctx context.Context, entry *InboxEntry) error {
+	backoff := inbox.backoff
+	for {
+		err := inbox.processEntry(ctx, entry)
+		if err == nil {
+			return nil
+		}
+		entry.Attempts++
+		entry.LastError = err.Error()
+
+		if IsFatalError(err) || errors.Is(err, ErrInboxInvalidEntry) || entry.Attempts >= inbox.maxAttempts {
+			if err := inbox.store.DeadLetter(ctx, entry); err != nil {
+				return fmt.Errorf("inbox: dead letter %d: %w", entry.Seq, err)
+			}
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (inbox *Inbox) processEntry(ctx context.Context, entry *InboxEntry) error {
+	var notification Notification
+	if err := json.Unmarshal(entry.Payload, &notification); err != nil {
+		return fmt.Errorf("%w: %w", ErrInboxInvalidEntry, err)
+	}
+
+	return inbox.process(ctx, &notification)
+}
+
+// dispatch saves the notification to the store and wakes Run up.
+func (inbox *Inbox) dispatch(ctx context.Context, _ *Notification, payload []byte, header http.Header) error {
+	signature, _ := ExtractSignatureFromHeader(header)
+	entry := &InboxEntry{
+		ReceivedAt: inbox.now(),
+		Payload:    append([]byte(nil), payload...),
+		Signature:  signature,
+	}
+
+	if _, err := inbox.store.Append(ctx, entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrOnInboxAppend, err)
+	}
+
+	select {
+	case inbox.appended <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInbox(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileNotificationStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileNotificationStore() error = %v", err)
+	}
+	defer store.Close()
+
+	inbox := NewInbox(store, WithInboxMaxAttempts(2), WithInboxRetryBackoff(time.Millisecond))
+	listener := NewEventListener(WithInbox(inbox), WithHandlerOptions(&HandlerOptions{
+		ValidateSignature: true, Secret: "secret",
+	}))
+
+	calls := map[string]int{}
+	listener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext, text *Text) error {
+		calls[text.Body]++
+		switch {
+		case text.Body == "flaky" && calls[text.Body] == 1:
+			return errors.New("temporary failure")
+		case text.Body == "broken":
+			return errors.New("permanent failure")
+		default:
+			return nil
+		}
+	})
+
+	start := time.Now()
+	handler := listener.NotificationHandler()
+	for _, body := range []string{"hello", "flaky", "broken"} {
+		payload, _ := json.Marshal(&Notification{Entry: []*Entry{{Changes: []*Change{{
+			Field: "messages",
+			Value: &Value{Messages: []*Message{{From: "alice", Type: "text", Text: &Text{Body: body}}}},
+		}}}}})
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(payload)
+		request := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(payload))
+		request.Header.Set(SignatureHeaderKey, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+	}
+
+	if len(calls) != 0 {
+		t.Fatalf("hooks called before the inbox is drained: %v", calls)
+	}
+
+	n, err := inbox.Drain(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("Drain() = %d, %v, want 3", n, err)
+	}
+
+	if calls["hello"] != 1 || calls["flaky"] != 2 || calls["broken"] != 2 {
+		t.Errorf("calls = %v, want hello 1, flaky 2 and broken 2", calls)
+	}
+
+	dead, err := store.DeadLetters(ctx)
+	if err != nil || len(dead) != 1 || dead[0].Seq != 3 || dead[0].Attempts != 2 ||
+		dead[0].LastError == "" {
+		t.Errorf("DeadLetters() = %+v, %v, want entry 3 after 2 attempts", dead, err)
+	}
+
+	// the store is reopened after a crash during an append
+	log, _ := os.OpenFile(filepath.Join(dir, inboxLogFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = log.WriteString(`{"seq":4,"payl`)
+	_ = log.Close()
+
+	reopened, err := NewFileNotificationStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileNotificationStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if checkpoint, err := reopened.Checkpoint(ctx); err != nil || checkpoint != 3 {
+		t.Errorf("Checkpoint() = %d, %v, want 3", checkpoint, err)
+	}
+
+	entries, err := reopened.Read(ctx, 0, 2)
+	if err != nil || len(entries) != 2 || entries[1].Seq != 2 || entries[0].Signature == "" {
+		t.Errorf("Read() = %+v, %v, want the 2 first signed entries", entries, err)
+	}
+
+	if seq, err := reopened.Append(ctx, &InboxEntry{ReceivedAt: time.Now(), Payload: []byte("{}")}); err != nil ||
+		seq != 4 {
+		t.Errorf("Append() = %d, %v, want 4", seq, err)
+	}
+
+	replay := NewInbox(reopened)
+	replayListener := NewEventListener(WithInbox(replay))
+	var replayed []string
+	replayListener.OnTextMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext,
+		text *Text,
+	) error {
+		replayed = append(replayed, text.Body)
+
+		return nil
+	})
+
+	n, err = replay.Replay(ctx, start, time.Now())
+	if err != nil || n != 4 || len(replayed) != 3 {
+		t.Errorf("Replay() = %d, %v, replayed %v, want 4 entries and 3 messages", n, err, replayed)
+	}
+
+	if n, err := replay.Replay(ctx, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)); err != nil || n != 0 {
+		t.Errorf("Replay() of the future = %d, %v, want 0", n, err)
+	}
+}
+
+func TestFileNotificationStore_Compact(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileNotificationStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileNotificationStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, err := store.Append(ctx, &InboxEntry{ReceivedAt: start.Add(time.Duration(i) * time.Hour),
+			Payload: []byte("{}")}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	_ = store.SetCheckpoint(ctx, 2)
+
+	// the third entry is old enough but has not been processed yet
+	if n, err := store.Compact(ctx, start.Add(3*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("Compact() = %d, %v, want 2", n, err)
+	}
+
+	if entries, err := store.Read(ctx, 0, 10); err != nil || len(entries) != 1 || entries[0].Seq != 3 {
+		t.Errorf("Read() after compaction = %+v, %v, want entry 3", entries, err)
+	}
+
+	if entries, err := store.Range(ctx, start, start.Add(3*time.Hour)); err != nil || len(entries) != 1 {
+		t.Errorf("Range() after compaction = %+v, %v, want entry 3", entries, err)
+	}
+
+	if seq, err := store.Append(ctx, &InboxEntry{ReceivedAt: start, Payload: []byte("{}")}); err != nil || seq != 4 {
+		t.Errorf("Append() after compaction = %d, %v, want 4", seq, err)
+	}
+
+	_ = store.SetCheckpoint(ctx, 4)
+	if n, err := store.Compact(ctx, start.Add(3*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("Compact() = %d, %v, want 2", n, err)
+	}
+
+	// the Seq continue after the checkpoint when the whole log has been compacted
+	reopened, err := NewFileNotificationStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileNotificationStore() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+
+	if seq, err := reopened.Append(ctx, &InboxEntry{ReceivedAt: time.Now(), Payload: []byte("{}")}); err != nil ||
+		seq != 5 {
+		t.Errorf("Append() after reopening = %d, %v, want 5", seq, err)
+	}
+
+	if entries, err := reopened.Read(ctx, 4, 10); err != nil || len(entries) != 1 || entries[0].Seq != 5 {
+		t.Errorf("Read() after reopening = %+v, %v, want entry 5", entries, err)
+	}
+}
+
+func TestInbox_Retention(t *testing.T) {
+	t.Parallel()
+	store, err := NewFileNotificationStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileNotificationStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	inbox := NewInbox(store, WithInboxRetention(time.Hour))
+	_ = NewEventListener(WithInbox(inbox))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _ = store.Append(ctx, &InboxEntry{ReceivedAt: time.Now().Add(-2 * time.Hour), Payload: []byte("{}")})
+	_, _ = store.Append(ctx, &InboxEntry{ReceivedAt: time.Now(), Payload: []byte("{}")})
+
+	if err := inbox.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	entries, err := store.Read(context.Background(), 0, 10)
+	if err != nil || len(entries) != 1 || entries[0].Seq != 2 {
+		t.Errorf("Read() = %+v, %v, want only the recent entry 2", entries, err)
+	}
+}
+
+func TestFileNotificationStore_Load(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		corrupt func(log []byte) []byte
+		want    int
+		wantErr error
+	}{
+		{
+			name: "entry partially written",
+			corrupt: func(log []byte) []byte {
+				return append(log, `{"seq":4,"rece`...)
+			},
+			want: 3,
+		},
+		{
+			name: "corrupt entry before the last one",
+			corrupt: func(log []byte) []byte {
+				lines := bytes.SplitAfter(log, []byte("\n"))
+				lines[1] = []byte("{\"seq\":2,\x00\x00\n")
+
+				return bytes.Join(lines, nil)
+			},
+			wantErr: ErrInboxCorruptLog,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			dir := t.TempDir()
+			store, err := NewFileNotificationStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileNotificationStore() error = %v", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				if _, err := store.Append(ctx, &InboxEntry{ReceivedAt: time.Now(), Payload: []byte("{}")}); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			_ = store.Close()
+
+			path := filepath.Join(dir, inboxLogFile)
+			log, _ := os.ReadFile(path)
+			corrupted := tt.corrupt(log)
+			if err := os.WriteFile(path, corrupted, 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			reopened, err := NewFileNotificationStore(dir)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NewFileNotificationStore() error = %v, want %v", err, tt.wantErr)
+				}
+
+				// the acknowledged entries after the corrupt one are kept
+				if content, _ := os.ReadFile(path); !bytes.Equal(content, corrupted) {
+					t.Errorf("log changed to %q, want %q", content, corrupted)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewFileNotificationStore() error = %v", err)
+			}
+			defer func() { _ = reopened.Close() }()
+
+			if entries, err := reopened.Read(ctx, 0, 10); err != nil || len(entries) != tt.want {
+				t.Errorf("Read() = %d entries, %v, want %d", len(entries), err, tt.want)
+			}
+		})
+	}
+}
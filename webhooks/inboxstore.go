@@ -0,0 +1,379 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp/internal/atomicfile"
+)
+
+const (
+	inboxLogFile        = "inbox.log"
+	inboxCheckpointFile = "checkpoint"
+	inboxDeadLetterFile = "deadletter.log"
+)
+
+var (
+	_ NotificationStore     = (*FileNotificationStore)(nil)
+	_ NotificationCompactor = (*FileNotificationStore)(nil)
+)
+
+// FileNotificationStore is a NotificationStore that appends the entries, one json object per
+// line, to a log file in a directory. The checkpoint and the dead letters are kept in their
+// own files next to it. Every append is synced to disk before it returns.
+//
+// An entry partially written when the process crashed, the last line when it does not end
+// with a new line, is dropped when the store is opened. Any other line that is not valid json
+// makes NewFileNotificationStore fail with ErrInboxCorruptLog and leaves the log untouched.
+// The log grows until it is compacted with Compact, see WithInboxRetention.
+type FileNotificationStore struct {
+	dir     string
+	mu      sync.Mutex
+	log     *os.File
+	base    uint64
+	offsets []int64
+	size    int64
+}
+
+// NewFileNotificationStore opens the store in dir, creating it if it does not exist.
+func NewFileNotificationStore(dir string) (*FileNotificationStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd
+		return nil, fmt.Errorf("inbox store: %w", err)
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, inboxLogFile), os.O_CREATE|os.O_RDWR, 0o644) //nolint:gomnd
+	if err != nil {
+		return nil, fmt.Errorf("inbox store: %w", err)
+	}
+
+	store := &FileNotificationStore{dir: dir, log: log}
+	if err := store.load(); err != nil {
+		_ = log.Close()
+
+		return nil, fmt.Errorf("inbox store: %w", err)
+	}
+
+	return store, nil
+}
+
+// Close closes the log file.
+func (store *FileNotificationStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.log.Close() //nolint:wrapcheck
+}
+
+// Append assigns the next Seq to the entry and writes it to the log.
+func (store *FileNotificationStore) Append(_ context.Context, entry *InboxEntry) (uint64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry.Seq = store.base + uint64(len(store.offsets)) + 1
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, fmt.Errorf("inbox store: append: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := store.log.WriteAt(line, store.size); err != nil {
+		return 0, fmt.Errorf("inbox store: append: %w", err)
+	}
+
+	if err := store.log.Sync(); err != nil {
+		return 0, fmt.Errorf("inbox store: append: %w", err)
+	}
+	store.offsets = append(store.offsets, store.size)
+	store.size += int64(len(line))
+
+	return entry.Seq, nil
+}
+
+// Read returns at most limit entries after the Seq.
+func (store *FileNotificationStore) Read(_ context.Context, after uint64, limit int) ([]*InboxEntry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var first uint64
+	if after > store.base {
+		first = after - store.base
+	}
+
+	if first >= uint64(len(store.offsets)) {
+		return nil, nil
+	}
+
+	start, end := store.offsets[first], store.size
+	if last := first + uint64(limit); limit > 0 && last < uint64(len(store.offsets)) {
+		end = store.offsets[last]
+	}
+
+	entries, err := readEntries(io.NewSectionReader(store.log, start, end-start))
+	if err != nil {
+		return nil, fmt.Errorf("inbox store: read: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Range returns the entries received in [from, to). The log is read one entry at a time, only
+// the matching entries are held in memory.
+func (store *FileNotificationStore) Range(_ context.Context, from, to time.Time) ([]*InboxEntry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var matches []*InboxEntry
+	decoder := json.NewDecoder(io.NewSectionReader(store.log, 0, store.size))
+	for {
+		var entry InboxEntry
+		if err := decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			return matches, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("inbox store: range: %w", err)
+		}
+
+		if !entry.ReceivedAt.Before(from) && entry.ReceivedAt.Before(to) {
+			matches = append(matches, &entry)
+		}
+	}
+}
+
+// Compact removes the entries received before the time from the log, up to the checkpoint:
+// the entries that have not been processed yet are kept whatever their age. The log is
+// rewritten without them and the Seq of the remaining entries are unchanged. It returns the
+// number of entries removed.
+func (store *FileNotificationStore) Compact(ctx context.Context, before time.Time) (int, error) {
+	checkpoint, err := store.Checkpoint(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	removed := 0
+	decoder := json.NewDecoder(io.NewSectionReader(store.log, 0, store.size))
+	for removed < len(store.offsets) {
+		var entry InboxEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return 0, fmt.Errorf("inbox store: compact: %w", err)
+		}
+
+		if entry.Seq > checkpoint || !entry.ReceivedAt.Before(before) {
+			break
+		}
+		removed++
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := store.rewrite(removed); err != nil {
+		return 0, fmt.Errorf("inbox store: compact: %w", err)
+	}
+
+	return removed, nil
+}
+
+// rewrite replaces the log with a copy without its n first entries.
+func (store *FileNotificationStore) rewrite(n int) error {
+	start := store.size
+	if n < len(store.offsets) {
+		start = store.offsets[n]
+	}
+
+	path := filepath.Join(store.dir, inboxLogFile)
+	if err := atomicfile.Write(path, io.NewSectionReader(store.log, start, store.size-start)); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	log, err := os.OpenFile(path, os.O_RDWR, 0o644) //nolint:gomnd
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	_ = store.log.Close()
+	store.log = log
+
+	offsets := make([]int64, 0, len(store.offsets)-n)
+	for _, offset := range store.offsets[n:] {
+		offsets = append(offsets, offset-start)
+	}
+	store.base += uint64(n)
+	store.offsets = offsets
+	store.size -= start
+
+	return nil
+}
+
+// Checkpoint returns the Seq of the last processed entry, 0 if none has been processed.
+func (store *FileNotificationStore) Checkpoint(context.Context) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(store.dir, inboxCheckpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("inbox store: checkpoint: %w", err)
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("inbox store: checkpoint: %w", err)
+	}
+
+	return seq, nil
+}
+
+// SetCheckpoint saves the Seq of the last processed entry.
+func (store *FileNotificationStore) SetCheckpoint(_ context.Context, seq uint64) error {
+	path := filepath.Join(store.dir, inboxCheckpointFile)
+	if err := atomicfile.Write(path, strings.NewReader(strconv.FormatUint(seq, 10))); err != nil {
+		return fmt.Errorf("inbox store: checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// DeadLetter appends the entry to the dead letters.
+func (store *FileNotificationStore) DeadLetter(_ context.Context, entry *InboxEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("inbox store: dead letter: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	file, err := os.OpenFile(filepath.Join(store.dir, inboxDeadLetterFile),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("inbox store: dead letter: %w", err)
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("inbox store: dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// DeadLetters returns the dead lettered entries in the order they were dead lettered.
+func (store *FileNotificationStore) DeadLetters(context.Context) ([]*InboxEntry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	file, err := os.Open(filepath.Join(store.dir, inboxDeadLetterFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("inbox store: dead letters: %w", err)
+	}
+	defer file.Close()
+
+	entries, err := readEntries(file)
+	if err != nil {
+		return nil, fmt.Errorf("inbox store: dead letters: %w", err)
+	}
+
+	return entries, nil
+}
+
+// load indexes the entries of the log and truncates it after the last complete entry. The Seq
+// of the entry before the first one is the base, or the checkpoint when the whole log has
+// been compacted.
+func (store *FileNotificationStore) load() error {
+	reader := bufio.NewReader(store.log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if !json.Valid(bytes.TrimSpace(line)) {
+			return fmt.Errorf("%w: invalid entry at offset %d", ErrInboxCorruptLog, offset)
+		}
+		store.offsets = append(store.offsets, offset)
+		offset += int64(len(line))
+	}
+	store.size = offset
+
+	if err := store.log.Truncate(offset); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(store.offsets) == 0 {
+		checkpoint, err := store.Checkpoint(context.Background())
+		store.base = checkpoint
+
+		return err
+	}
+
+	var first InboxEntry
+	if err := json.NewDecoder(io.NewSectionReader(store.log, 0, store.size)).Decode(&first); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if first.Seq > 0 {
+		store.base = first.Seq - 1
+	}
+
+	return nil
+}
+
+func readEntries(r io.Reader) ([]*InboxEntry, error) {
+	var entries []*InboxEntry
+	decoder := json.NewDecoder(r)
+	for {
+		var entry InboxEntry
+		if err := decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		entries = append(entries, &entry)
+	}
+}
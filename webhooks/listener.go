@@ -21,6 +21,7 @@ package webhooks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,7 +31,7 @@ import (
 
 // EventListener wraps all the parts needed to listen and respond to incoming events
 // to registered webhooks.
-// It contains unexported *Hooks, *HandlerOptions, HooksErrorHandler, NotificationErrorHandler
+// It contains unexported *HookRegistry, *HandlerOptions, HooksErrorHandler, NotificationErrorHandler
 // SubscriptionVerifier and GenericNotificationHandler.
 // All these can be set via exported ListenerOption functions like WithBeforeFunc and
 // Setter methods like GenericNotificationHandler which sets the GenericNotificationHandler.
@@ -67,22 +68,25 @@ import (
 //	  using a generic handler
 //	  handler := listener.GenericNotificationHandler()
 type EventListener struct {
-	h       *Hooks
+	hooks   *HookRegistry
 	hef     HooksErrorHandler
 	neh     NotificationErrorHandler
 	v       SubscriptionVerifier
 	options *HandlerOptions
 	g       GenericNotificationHandler
+	pool    *WorkerPool
+	aeh     AsyncErrorHandler
+	inbox   *Inbox
 }
 
 type ListenerOption func(*EventListener)
 
 func NewEventListener(options ...ListenerOption) *EventListener {
 	listener := &EventListener{
-		h:   nil,
-		hef: NoOpHooksErrorHandler,
-		neh: NoOpNotificationErrorHandler,
-		v:   nil,
+		hooks: NewHookRegistry(),
+		hef:   NoOpHooksErrorHandler,
+		neh:   NoOpNotificationErrorHandler,
+		v:     nil,
 		options: &HandlerOptions{
 			BeforeFunc:        nil,
 			AfterFunc:         nil,
@@ -115,123 +119,124 @@ func (ls *EventListener) HooksErrorHandler(handler HooksErrorHandler) {
 	ls.hef = handler
 }
 
-func (ls *EventListener) OnOrderMessage(hook OnOrderMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnOrderMessageHook = hook
+// Hooks returns the HookRegistry of the listener, to subscribe a HookFunc to any event.
+func (ls *EventListener) Hooks() *HookRegistry {
+	return ls.hooks
 }
 
-func (ls *EventListener) OnButtonMessage(hook OnButtonMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnButtonMessageHook = hook
+// Use appends middlewares that wrap every hook call, see HookRegistry.Use.
+func (ls *EventListener) Use(middlewares ...HookMiddleware) {
+	ls.hooks.Use(middlewares...)
 }
 
-func (ls *EventListener) OnLocationMessage(hook OnLocationMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnLocationMessageHook = hook
+// OnOrderMessage subscribes the hook to EventOrderMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnOrderMessage(hook OnOrderMessageHook) Unsubscribe {
+	return ls.hooks.OnOrderMessage(hook)
 }
 
-func (ls *EventListener) OnContactsMessage(hook OnContactsMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnContactsMessageHook = hook
+// OnButtonMessage subscribes the hook to EventButtonMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnButtonMessage(hook OnButtonMessageHook) Unsubscribe {
+	return ls.hooks.OnButtonMessage(hook)
 }
 
-func (ls *EventListener) OnMessageReaction(hook OnMessageReactionHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnMessageReactionHook = hook
+// OnLocationMessage subscribes the hook to EventLocationMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnLocationMessage(hook OnLocationMessageHook) Unsubscribe {
+	return ls.hooks.OnLocationMessage(hook)
 }
 
-func (ls *EventListener) OnUnknownMessage(hook OnUnknownMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnUnknownMessageHook = hook
+// OnContactsMessage subscribes the hook to EventContactsMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnContactsMessage(hook OnContactsMessageHook) Unsubscribe {
+	return ls.hooks.OnContactsMessage(hook)
 }
 
-func (ls *EventListener) OnProductEnquiry(hook OnProductEnquiryHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnProductEnquiryHook = hook
+// OnMessageReaction subscribes the hook to EventMessageReaction. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnMessageReaction(hook OnMessageReactionHook) Unsubscribe {
+	return ls.hooks.OnMessageReaction(hook)
 }
 
-func (ls *EventListener) OnInteractiveMessage(hook OnInteractiveMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnInteractiveMessageHook = hook
+// OnUnknownMessage subscribes the hook to EventUnknownMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnUnknownMessage(hook OnUnknownMessageHook) Unsubscribe {
+	return ls.hooks.OnUnknownMessage(hook)
 }
 
-func (ls *EventListener) OnMessageErrors(hook OnMessageErrorsHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnMessageErrorsHook = hook
+// OnProductEnquiry subscribes the hook to EventProductEnquiry. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnProductEnquiry(hook OnProductEnquiryHook) Unsubscribe {
+	return ls.hooks.OnProductEnquiry(hook)
 }
 
-func (ls *EventListener) OnTextMessage(hook OnTextMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnTextMessageHook = hook
+// OnInteractiveMessage subscribes the hook to EventInteractiveMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnInteractiveMessage(hook OnInteractiveMessageHook) Unsubscribe {
+	return ls.hooks.OnInteractiveMessage(hook)
 }
 
-func (ls *EventListener) OnReferralMessage(hook OnReferralMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnReferralMessageHook = hook
+// OnMessageErrors subscribes the hook to EventMessageErrors. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnMessageErrors(hook OnMessageErrorsHook) Unsubscribe {
+	return ls.hooks.OnMessageErrors(hook)
 }
 
-func (ls *EventListener) OnCustomerIDChange(hook OnCustomerIDChangeMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnCustomerIDChangeHook = hook
+// OnTextMessage subscribes the hook to EventTextMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnTextMessage(hook OnTextMessageHook) Unsubscribe {
+	return ls.hooks.OnTextMessage(hook)
 }
 
-func (ls *EventListener) OnSystemMessage(hook OnSystemMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnSystemMessageHook = hook
+// OnReferralMessage subscribes the hook to EventReferralMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnReferralMessage(hook OnReferralMessageHook) Unsubscribe {
+	return ls.hooks.OnReferralMessage(hook)
 }
 
-func (ls *EventListener) OnMediaMessage(hook OnMediaMessageHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnMediaMessageHook = hook
+// OnCustomerIDChange subscribes the hook to EventCustomerIDChange. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnCustomerIDChange(hook OnCustomerIDChangeMessageHook) Unsubscribe {
+	return ls.hooks.OnCustomerIDChange(hook)
 }
 
-func (ls *EventListener) OnNotificationError(hook OnNotificationErrorHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnNotificationErrorHook = hook
+// OnSystemMessage subscribes the hook to EventSystemMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnSystemMessage(hook OnSystemMessageHook) Unsubscribe {
+	return ls.hooks.OnSystemMessage(hook)
 }
 
-func (ls *EventListener) OnMessageStatusChange(hook OnMessageStatusChangeHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnMessageStatusChangeHook = hook
+// OnMediaMessage subscribes the hook to EventMediaMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnMediaMessage(hook OnMediaMessageHook) Unsubscribe {
+	return ls.hooks.OnMediaMessage(hook)
 }
 
-func (ls *EventListener) OnMessageReceived(hook OnMessageReceivedHook) {
-	if ls.h == nil {
-		ls.h = &Hooks{}
-	}
-	ls.h.OnMessageReceivedHook = hook
+// OnImageMessage subscribes the hook to EventImageMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnImageMessage(hook OnImageMessageHook) Unsubscribe {
+	return ls.hooks.OnImageMessage(hook)
+}
+
+// OnVideoMessage subscribes the hook to EventVideoMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnVideoMessage(hook OnVideoMessageHook) Unsubscribe {
+	return ls.hooks.OnVideoMessage(hook)
+}
+
+// OnAudioMessage subscribes the hook to EventAudioMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnAudioMessage(hook OnAudioMessageHook) Unsubscribe {
+	return ls.hooks.OnAudioMessage(hook)
+}
+
+// OnDocumentMessage subscribes the hook to EventDocumentMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnDocumentMessage(hook OnDocumentMessageHook) Unsubscribe {
+	return ls.hooks.OnDocumentMessage(hook)
+}
+
+// OnStickerMessage subscribes the hook to EventStickerMessage. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnStickerMessage(hook OnStickerMessageHook) Unsubscribe {
+	return ls.hooks.OnStickerMessage(hook)
+}
+
+// OnNotificationError subscribes the hook to EventNotificationError. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnNotificationError(hook OnNotificationErrorHook) Unsubscribe {
+	return ls.hooks.OnNotificationError(hook)
+}
+
+// OnMessageStatusChange subscribes the hook to EventMessageStatusChange. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnMessageStatusChange(hook OnMessageStatusChangeHook) Unsubscribe {
+	return ls.hooks.OnMessageStatusChange(hook)
+}
+
+// OnMessageReceived subscribes the hook to EventMessageReceived. Hooks are called in the order they are subscribed.
+func (ls *EventListener) OnMessageReceived(hook OnMessageReceivedHook) Unsubscribe {
+	return ls.hooks.OnMessageReceived(hook)
 }
 
 func WithGenericNotificationHandler(g GenericNotificationHandler) ListenerOption {
@@ -240,9 +245,17 @@ func WithGenericNotificationHandler(g GenericNotificationHandler) ListenerOption
 	}
 }
 
+// WithHooks subscribes the hooks that are set in hooks.
 func WithHooks(hooks *Hooks) ListenerOption {
 	return func(ls *EventListener) {
-		ls.h = hooks
+		ls.hooks.SubscribeHooks(hooks)
+	}
+}
+
+// WithHookMiddlewares sets the middlewares that wrap every hook call.
+func WithHookMiddlewares(middlewares ...HookMiddleware) ListenerOption {
+	return func(ls *EventListener) {
+		ls.hooks.Use(middlewares...)
 	}
 }
 
@@ -288,9 +301,39 @@ func WithAfterFunc(afterFunc AfterFunc) ListenerOption {
 	}
 }
 
+// WithAsync makes the NotificationHandler acknowledge the notifications as soon as they are
+// decoded and their signature validated, and call the hooks on the worker pool. The messages
+// from a customer and the statuses of the messages sent to them are processed in order.
+//
+// The errors of the hooks are passed to the AsyncErrorHandler, which can be nil, after they
+// have been through the HooksErrorHandler. The errors of submitting to the pool, wrapping
+// ErrOnAsyncDispatch and ErrQueueFull or ErrWorkerPoolClosed, are passed to the
+// NotificationErrorHandler, that should respond with a status other than 200 for the
+// notification to be delivered again. A notification is split by customer before it is
+// submitted, so some of its parts may already have been queued when a part is rejected.
+//
+// Shut the pool down after the http server to process the acknowledged notifications.
+func WithAsync(pool *WorkerPool, aeh AsyncErrorHandler) ListenerOption {
+	return func(ls *EventListener) {
+		ls.pool = pool
+		ls.aeh = aeh
+	}
+}
+
 // NotificationHandler returns a http.Handler that can be used to handle the notification
 func (ls *EventListener) NotificationHandler() http.Handler {
-	return NotificationHandler(ls.h, ls.neh, ls.hef, ls.options)
+	if ls.inbox != nil {
+		return notificationHandler(ls.inbox.dispatch, ls.neh, ls.options)
+	}
+
+	if ls.pool != nil {
+		return notificationHandler(func(ctx context.Context, notification *Notification, _ []byte, _ http.Header,
+		) error {
+			return submitNotification(ctx, ls.pool, notification, ls.hooks, ls.hef, ls.aeh)
+		}, ls.neh, ls.options)
+	}
+
+	return notificationHandler(syncDispatch(ls.hooks, ls.hef), ls.neh, ls.options)
 }
 
 // GenericHandler returns a http.Handler that handles all type of notification in one function.
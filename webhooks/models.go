@@ -20,6 +20,8 @@
 package webhooks
 
 import (
+	"encoding/json"
+
 	werrors "github.com/piusalfred/whatsapp/errors"
 	"github.com/piusalfred/whatsapp/models"
 )
@@ -121,7 +123,7 @@ type (
 		Timestamp    int              `json:"timestamp,omitempty"`
 		Conversation *Conversation    `json:"conversation,omitempty"`
 		Pricing      *Pricing         `json:"pricing,omitempty"`
-		Errors       []*werrors.Error `json:"werrors,omitempty"`
+		Errors       []*werrors.Error `json:"errors,omitempty"`
 	}
 
 	// Event is the type of event that occurred and leads to the notification being sent.
@@ -137,6 +139,8 @@ type (
 	//  - Updates their profile information such as their phone number
 	//  - Asks for information about a specific product
 	//  - Orders products being sold by the business
+	//
+	// The hooks of a HookRegistry subscribe to events, the constants like EventTextMessage.
 	Event string
 
 	Metadata struct {
@@ -159,7 +163,7 @@ type (
 		Button      *Button           `json:"button,omitempty"`
 		Context     *Context          `json:"context,omitempty"`
 		Document    *models.MediaInfo `json:"document,omitempty"`
-		Errors      []*werrors.Error  `json:"werrors,omitempty"`
+		Errors      []*werrors.Error  `json:"errors,omitempty"`
 		From        string            `json:"from,omitempty"`
 		ID          string            `json:"id,omitempty"`
 		Identity    *Identity         `json:"identity,omitempty"`
@@ -204,14 +208,10 @@ type (
 		Body string `json:"body,omitempty"`
 	}
 
-	// Interactive represent the interactive template.
+	// Interactive is the reply of a user to an interactive message. Type is either button_reply,
+	// with the reply button selected in ButtonReply, or list_reply with the row selected in ListReply.
 	Interactive struct {
-		Type *InteractiveType `json:"type,omitempty"`
-	}
-
-	// InteractiveType represent an item sent to user. It can be a reply button
-	// (ButtonReply) or a list reply containing a list of items (ListReply).
-	InteractiveType struct {
+		Type        string       `json:"type,omitempty"`
 		ButtonReply *ButtonReply `json:"button_reply,omitempty"`
 		ListReply   *ListReply   `json:"list_reply,omitempty"`
 	}
@@ -362,15 +362,30 @@ type (
 	Value struct {
 		MessagingProduct string           `json:"messaging_product,omitempty"`
 		Metadata         *Metadata        `json:"metadata,omitempty"`
-		Errors           []*werrors.Error `json:"werrors,omitempty"`
+		Errors           []*werrors.Error `json:"errors,omitempty"`
 		Contacts         []*Contact       `json:"contacts,omitempty"`
 		Messages         []*Message       `json:"messages,omitempty"`
 		Statuses         []*Status        `json:"statuses,omitempty"`
 	}
 
+	// Change is a change of a field of the business account. The value of the messages field
+	// is in Value, the value of the other fields in the field of their type, TemplateStatusUpdate
+	// for message_template_status_update for example, with Value nil. The value of a field other
+	// than messages that does not decode into its type is kept as is in RawValue, no hook is
+	// called for it.
 	Change struct {
-		Value *Value `json:"value,omitempty"`
-		Field string `json:"field,omitempty"`
+		Value                    *Value                    `json:"value,omitempty"`
+		Field                    string                    `json:"field,omitempty"`
+		TemplateStatusUpdate     *TemplateStatusUpdate     `json:"-"`
+		PhoneNumberQualityUpdate *PhoneNumberQualityUpdate `json:"-"`
+		PhoneNumberNameUpdate    *PhoneNumberNameUpdate    `json:"-"`
+		AccountUpdate            *AccountUpdate            `json:"-"`
+		AccountAlert             *AccountAlert             `json:"-"`
+		AccountReviewUpdate      *AccountReviewUpdate      `json:"-"`
+		BusinessCapabilityUpdate *BusinessCapabilityUpdate `json:"-"`
+		TemplateCategoryUpdate   *TemplateCategoryUpdate   `json:"-"`
+		SecurityUpdate           *SecurityUpdate           `json:"-"`
+		RawValue                 json.RawMessage           `json:"-"`
 	}
 
 	Entry struct {
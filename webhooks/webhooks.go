@@ -141,9 +141,21 @@ type (
 		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, system *System) error
 
 	// OnMediaMessageHook is a hook that is called when a media message is received. This is when Message.Type is
-	// image, audio, video or document or sticker.
+	// image, audio, video or document or sticker. It is the fallback of the hooks of the specific media types
+	// and is only called when the hook of the media type is not set.
 	OnMediaMessageHook func(ctx context.Context, nctx *NotificationContext, mctx *MessageContext,
-		media *models.MediaInfo) error
+		mediaType MessageType, media *models.MediaInfo) error
+
+	OnImageMessageHook func(
+		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, image *models.MediaInfo) error
+	OnVideoMessageHook func(
+		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, video *models.MediaInfo) error
+	OnAudioMessageHook func(
+		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, audio *models.MediaInfo) error
+	OnDocumentMessageHook func(
+		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, document *models.MediaInfo) error
+	OnStickerMessageHook func(
+		ctx context.Context, nctx *NotificationContext, mctx *MessageContext, sticker *models.MediaInfo) error
 
 	// OnNotificationErrorHook is a hook that is called when an error is received in a notification.
 	// This is called when an error is received in a notification. This is not called when an error
@@ -169,24 +181,41 @@ type (
 	// notification about a message status change.
 	// M is the OnMessageReceivedHook called when a message is received.
 	// H is the MessageHooks called when a message is received.
+	//
+	// Hooks holds one hook per event, the hooks that are set are subscribed to a HookRegistry
+	// with HookRegistry.SubscribeHooks or WithHooks, that supports many hooks per event.
 	Hooks struct {
-		OnOrderMessageHook        OnOrderMessageHook
-		OnButtonMessageHook       OnButtonMessageHook
-		OnLocationMessageHook     OnLocationMessageHook
-		OnContactsMessageHook     OnContactsMessageHook
-		OnMessageReactionHook     OnMessageReactionHook
-		OnUnknownMessageHook      OnUnknownMessageHook
-		OnProductEnquiryHook      OnProductEnquiryHook
-		OnInteractiveMessageHook  OnInteractiveMessageHook
-		OnMessageErrorsHook       OnMessageErrorsHook
-		OnTextMessageHook         OnTextMessageHook
-		OnReferralMessageHook     OnReferralMessageHook
-		OnCustomerIDChangeHook    OnCustomerIDChangeMessageHook
-		OnSystemMessageHook       OnSystemMessageHook
-		OnMediaMessageHook        OnMediaMessageHook
-		OnNotificationErrorHook   OnNotificationErrorHook
-		OnMessageStatusChangeHook OnMessageStatusChangeHook
-		OnMessageReceivedHook     OnMessageReceivedHook
+		OnOrderMessageHook             OnOrderMessageHook
+		OnButtonMessageHook            OnButtonMessageHook
+		OnLocationMessageHook          OnLocationMessageHook
+		OnContactsMessageHook          OnContactsMessageHook
+		OnMessageReactionHook          OnMessageReactionHook
+		OnUnknownMessageHook           OnUnknownMessageHook
+		OnProductEnquiryHook           OnProductEnquiryHook
+		OnInteractiveMessageHook       OnInteractiveMessageHook
+		OnMessageErrorsHook            OnMessageErrorsHook
+		OnTextMessageHook              OnTextMessageHook
+		OnReferralMessageHook          OnReferralMessageHook
+		OnCustomerIDChangeHook         OnCustomerIDChangeMessageHook
+		OnSystemMessageHook            OnSystemMessageHook
+		OnMediaMessageHook             OnMediaMessageHook
+		OnImageMessageHook             OnImageMessageHook
+		OnVideoMessageHook             OnVideoMessageHook
+		OnAudioMessageHook             OnAudioMessageHook
+		OnDocumentMessageHook          OnDocumentMessageHook
+		OnStickerMessageHook           OnStickerMessageHook
+		OnNotificationErrorHook        OnNotificationErrorHook
+		OnMessageStatusChangeHook      OnMessageStatusChangeHook
+		OnMessageReceivedHook          OnMessageReceivedHook
+		OnTemplateStatusUpdateHook     OnTemplateStatusUpdateHook
+		OnPhoneNumberQualityUpdateHook OnPhoneNumberQualityUpdateHook
+		OnPhoneNumberNameUpdateHook    OnPhoneNumberNameUpdateHook
+		OnAccountUpdateHook            OnAccountUpdateHook
+		OnAccountAlertHook             OnAccountAlertHook
+		OnAccountReviewUpdateHook      OnAccountReviewUpdateHook
+		OnBusinessCapabilityUpdateHook OnBusinessCapabilityUpdateHook
+		OnTemplateCategoryUpdateHook   OnTemplateCategoryUpdateHook
+		OnSecurityUpdateHook           OnSecurityUpdateHook
 	}
 
 	// MessageStatus is the status of a message.
@@ -326,6 +355,18 @@ func NoOpNotificationErrorHandler(_ context.Context, _ *http.Request, err error)
 //	}
 func AttachHooksToNotification(ctx context.Context, notification *Notification,
 	hooks *Hooks, heh HooksErrorHandler,
+) error {
+	if hooks == nil {
+		return nil
+	}
+	registry := NewHookRegistry()
+	registry.SubscribeHooks(hooks)
+
+	return attachHooksToNotification(ctx, notification, registry, heh)
+}
+
+func attachHooksToNotification(ctx context.Context, notification *Notification,
+	hooks *HookRegistry, heh HooksErrorHandler,
 ) error {
 	if notification == nil || hooks == nil {
 		return nil
@@ -342,13 +383,17 @@ func AttachHooksToNotification(ctx context.Context, notification *Notification,
 	return nil
 }
 
-func attachHooksToEntry(ctx context.Context, entry *Entry, hooks *Hooks, heh HooksErrorHandler) error {
+func attachHooksToEntry(ctx context.Context, entry *Entry, hooks *HookRegistry, heh HooksErrorHandler) error {
 	eid := entry.ID
 	changes := entry.Changes
 	for _, change := range changes {
 		change := change
 		value := change.Value
 		if value == nil {
+			if err := attachHooksToUpdate(ctx, eid, change, hooks, heh); err != nil {
+				return err
+			}
+
 			continue
 		}
 
@@ -367,7 +412,7 @@ var (
 	ErrOnGlobalMessageHook       = errors.New("on global message hook error")
 )
 
-func attachHooksToValue(ctx context.Context, id string, value *Value, hooks *Hooks,
+func attachHooksToValue(ctx context.Context, id string, value *Value, hooks *HookRegistry,
 	hooksErrorHandler HooksErrorHandler,
 ) error {
 	if hooks == nil {
@@ -385,48 +430,73 @@ func attachHooksToValue(ctx context.Context, id string, value *Value, hooks *Hoo
 	nonFatalErrors := make([]error, 0, 4)
 
 	// call the Hooks
-	if value.Errors != nil && hooks.OnNotificationErrorHook != nil {
-		for _, ev := range value.Errors {
-			ev := ev
-			if err := hooks.OnNotificationErrorHook(ctx, notificationCtx, ev); err != nil {
-				if IsFatalError(hooksErrorHandler(err)) {
-					return err
-				}
-				nonFatalErrors = append(nonFatalErrors, ErrOnNotificationErrorHook)
+	for _, ev := range value.Errors {
+		err := hooks.Dispatch(ctx, &HookCall{
+			Event: EventNotificationError, NotificationContext: notificationCtx, Payload: ev,
+		})
+		if err != nil {
+			if IsFatalError(hooksErrorHandler(err)) {
+				return err
 			}
+			nonFatalErrors = append(nonFatalErrors, ErrOnNotificationErrorHook)
 		}
 	}
 
-	if value.Statuses != nil && hooks.OnMessageStatusChangeHook != nil {
-		for _, sv := range value.Statuses {
-			sv := sv
-			if err := hooks.OnMessageStatusChangeHook(ctx, notificationCtx, sv); err != nil {
-				if IsFatalError(hooksErrorHandler(err)) {
-					return err
-				}
-				nonFatalErrors = append(nonFatalErrors, ErrOnMessageStatusChangeHook)
+	for _, sv := range value.Statuses {
+		key := StatusKey(sv)
+		if hooks.dedup.duplicate(ctx, notificationCtx, key) {
+			continue
+		}
+
+		err := hooks.Dispatch(ctx, &HookCall{
+			Event: EventMessageStatusChange, NotificationContext: notificationCtx, Payload: sv,
+		})
+		if err != nil {
+			hooks.dedup.release(ctx, key)
+			if IsFatalError(hooksErrorHandler(err)) {
+				return err
 			}
+			nonFatalErrors = append(nonFatalErrors, ErrOnMessageStatusChangeHook)
+
+			continue
 		}
+		hooks.dedup.add(ctx, key)
 	}
 
-	if value.Messages != nil {
-		for _, mv := range value.Messages {
-			mv := mv
-			if hooks.OnMessageReceivedHook != nil {
-				if err := hooks.OnMessageReceivedHook(ctx, notificationCtx, mv); err != nil {
-					if IsFatalError(hooksErrorHandler(err)) {
-						return err
-					}
-					nonFatalErrors = append(nonFatalErrors, ErrOnGlobalMessageHook)
-				}
+	for _, mv := range value.Messages {
+		key := MessageKey(mv)
+		if hooks.dedup.duplicate(ctx, notificationCtx, key) {
+			continue
+		}
+
+		failed := false
+		err := hooks.Dispatch(ctx, &HookCall{
+			Event: EventMessageReceived, NotificationContext: notificationCtx, Message: mv, Payload: mv,
+		})
+		if err != nil {
+			if IsFatalError(hooksErrorHandler(err)) {
+				hooks.dedup.release(ctx, key)
+
+				return err
 			}
+			nonFatalErrors = append(nonFatalErrors, ErrOnGlobalMessageHook)
+			failed = true
+		}
 
-			if err := attachHooksToMessage(ctx, notificationCtx, hooks, mv); err != nil {
-				if IsFatalError(hooksErrorHandler(err)) {
-					return err
-				}
-				nonFatalErrors = append(nonFatalErrors, ErrOnMessageHooks)
+		if err := attachHooksToMessage(ctx, notificationCtx, hooks, mv); err != nil {
+			if IsFatalError(hooksErrorHandler(err)) {
+				hooks.dedup.release(ctx, key)
+
+				return err
 			}
+			nonFatalErrors = append(nonFatalErrors, ErrOnMessageHooks)
+			failed = true
+		}
+
+		if failed {
+			hooks.dedup.release(ctx, key)
+		} else {
+			hooks.dedup.add(ctx, key)
 		}
 	}
 
@@ -449,9 +519,11 @@ func getEncounteredError(errs []error) error {
 
 var ErrFailedToAttachHookToMessage = errors.New("could not attach hooks to message")
 
-func attachHooksToMessage(ctx context.Context, nctx *NotificationContext, hooks *Hooks, message *Message) error {
-	if hooks == nil || message == nil {
-		return fmt.Errorf("hooks or message is nil")
+func attachHooksToMessage(ctx context.Context, nctx *NotificationContext, hooks *HookRegistry,
+	message *Message,
+) error {
+	if message == nil {
+		return fmt.Errorf("message is nil")
 	}
 	mctx := &MessageContext{
 		From:      message.From,
@@ -460,63 +532,105 @@ func attachHooksToMessage(ctx context.Context, nctx *NotificationContext, hooks
 		Type:      message.Type,
 		Ctx:       message.Context,
 	}
+	dispatch := func(event Event, payload any) error {
+		return hooks.Dispatch(ctx, &HookCall{
+			Event:               event,
+			NotificationContext: nctx,
+			MessageContext:      mctx,
+			Message:             message,
+			Payload:             payload,
+		})
+	}
 	messageType := ParseMessageType(message.Type)
 	switch messageType {
 	case OrderMessageType:
-		return hooks.OnOrderMessageHook(ctx, nctx, mctx, message.Order)
+		return dispatch(EventOrderMessage, message.Order)
 
 	case ButtonMessageType:
-		return hooks.OnButtonMessageHook(ctx, nctx, mctx, message.Button)
+		return dispatch(EventButtonMessage, message.Button)
 
 	case AudioMessageType, VideoMessageType, ImageMessageType, DocumentMessageType, StickerMessageType:
-		return hooks.OnMediaMessageHook(ctx, nctx, mctx, message.Audio)
+		// the hooks of the media type take precedence over the media message hooks
+		if event := mediaEvents[messageType]; hooks.Subscribed(event) {
+			return dispatch(event, message.Media(messageType))
+		}
+
+		return dispatch(EventMediaMessage, message.Media(messageType))
 
 	case InteractiveMessageType:
-		return hooks.OnInteractiveMessageHook(ctx, nctx, mctx, message.Interactive)
+		return dispatch(EventInteractiveMessage, message.Interactive)
 
 	case SystemMessageType:
-		return hooks.OnSystemMessageHook(ctx, nctx, mctx, message.System)
+		return dispatch(EventSystemMessage, message.System)
 
 	case UnknownMessageType:
-		return hooks.OnMessageErrorsHook(ctx, nctx, mctx, message.Errors)
+		return dispatch(EventMessageErrors, message.Errors)
 
 	case TextMessageType:
 		if message.Referral != nil {
-			return hooks.OnReferralMessageHook(ctx, nctx, mctx, message.Text, message.Referral)
+			return dispatch(EventReferralMessage, message.Referral)
 		}
 		if mctx.Ctx != nil {
-			return hooks.OnProductEnquiryHook(ctx, nctx, mctx, message.Text)
+			return dispatch(EventProductEnquiry, message.Text)
 		}
 
-		return hooks.OnTextMessageHook(ctx, nctx, mctx, message.Text)
+		return dispatch(EventTextMessage, message.Text)
 
 	case ReactionMessageType:
-		return hooks.OnMessageReactionHook(ctx, nctx, mctx, message.Reaction)
+		return dispatch(EventMessageReaction, message.Reaction)
 
 	case LocationMessageType:
-		return hooks.OnLocationMessageHook(ctx, nctx, mctx, message.Location)
+		return dispatch(EventLocationMessage, message.Location)
 
 	case ContactMessageType:
-		return hooks.OnContactsMessageHook(ctx, nctx, mctx, message.Contacts)
+		return dispatch(EventContactsMessage, message.Contacts)
 
 	default:
 		if message.Contacts != nil {
 			if len(message.Contacts.Contacts) > 0 {
-				return hooks.OnContactsMessageHook(ctx, nctx, mctx, message.Contacts)
+				return dispatch(EventContactsMessage, message.Contacts)
 			}
 		}
 		if message.Location != nil {
-			return hooks.OnLocationMessageHook(ctx, nctx, mctx, message.Location)
+			return dispatch(EventLocationMessage, message.Location)
 		}
 
 		if message.Identity != nil {
-			return hooks.OnCustomerIDChangeHook(ctx, nctx, mctx, message.Identity)
+			return dispatch(EventCustomerIDChange, message.Identity)
 		}
 
 		return ErrFailedToAttachHookToMessage
 	}
 }
 
+// mediaEvents are the events of the hooks of each media type.
+var mediaEvents = map[MessageType]Event{
+	ImageMessageType:    EventImageMessage,
+	VideoMessageType:    EventVideoMessage,
+	AudioMessageType:    EventAudioMessage,
+	DocumentMessageType: EventDocumentMessage,
+	StickerMessageType:  EventStickerMessage,
+}
+
+// Media returns the media of the message of the given media type, nil if the message has no
+// media of that type.
+func (message *Message) Media(mediaType MessageType) *models.MediaInfo {
+	switch mediaType { //nolint:exhaustive
+	case ImageMessageType:
+		return message.Image
+	case VideoMessageType:
+		return message.Video
+	case AudioMessageType:
+		return message.Audio
+	case DocumentMessageType:
+		return message.Document
+	case StickerMessageType:
+		return message.Sticker
+	default:
+		return nil
+	}
+}
+
 var (
 	ErrOnBeforeFuncHook          = errors.New("error on before func hook")
 	ErrOnAttachNotificationHooks = errors.New("error during attaching hooks to a notification")
@@ -534,6 +648,28 @@ var (
 // response status code is set to http.StatusInternalServerError.
 func NotificationHandler(
 	hooks *Hooks, neh NotificationErrorHandler, heh HooksErrorHandler, options *HandlerOptions,
+) http.Handler {
+	registry := NewHookRegistry()
+	registry.SubscribeHooks(hooks)
+
+	return notificationHandler(syncDispatch(registry, heh), neh, options)
+}
+
+// dispatchFunc calls the hooks of a decoded and validated notification, or schedules the call.
+// payload is the request body and header the request headers.
+type dispatchFunc func(ctx context.Context, notification *Notification, payload []byte, header http.Header) error
+
+func syncDispatch(hooks *HookRegistry, heh HooksErrorHandler) dispatchFunc {
+	return func(ctx context.Context, notification *Notification, _ []byte, _ http.Header) error {
+		if err := attachHooksToNotification(ctx, notification, hooks, heh); err != nil {
+			return fmt.Errorf("%w: %w", ErrOnAttachNotificationHooks, err)
+		}
+
+		return nil
+	}
+}
+
+func notificationHandler(dispatch dispatchFunc, neh NotificationErrorHandler, options *HandlerOptions,
 ) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		var (
@@ -559,7 +695,8 @@ func NotificationHandler(
 		}
 		request.Body = io.NopCloser(&buff)
 
-		if err = json.NewDecoder(&buff).Decode(notification); err != nil && !errors.Is(err, io.EOF) {
+		if err = json.NewDecoder(bytes.NewReader(buff.Bytes())).Decode(notification); err != nil &&
+			!errors.Is(err, io.EOF) {
 			writer.WriteHeader(http.StatusInternalServerError)
 
 			return
@@ -583,8 +720,7 @@ func NotificationHandler(
 			}
 		}
 		// Apply the Hooks
-		if err = AttachHooksToNotification(ctx, notification, hooks, heh); err != nil {
-			err = fmt.Errorf("%w: %w", ErrOnAttachNotificationHooks, err)
+		if err = dispatch(ctx, notification, buff.Bytes(), request.Header); err != nil {
 			if handleError(ctx, writer, request, neh, err) {
 				return
 			}
@@ -655,6 +791,8 @@ func VerifySubscriptionHandler(verifier SubscriptionVerifier) http.Handler {
 			Token:     token,
 		}); err != nil {
 			writer.WriteHeader(http.StatusBadRequest)
+
+			return
 		}
 		writer.WriteHeader(http.StatusOK)
 		_, _ = writer.Write([]byte(challenge))
@@ -22,11 +22,16 @@ package webhooks
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/piusalfred/whatsapp/models"
 )
 
 func Example_newEventListener() {
@@ -361,3 +366,153 @@ func TestExtractSignatureFromHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestNotificationHandler_Signature(t *testing.T) {
+	t.Parallel()
+	body := []byte(`{"object":"whatsapp_business_account","entry":[]}`)
+	mac := hmac.New(sha256.New, []byte("app-secret"))
+	mac.Write(body)
+	valid := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	testcases := []struct {
+		name       string
+		signature  string
+		wantStatus int
+	}{
+		{name: "valid signature", signature: valid, wantStatus: http.StatusOK},
+		{name: "invalid signature", signature: "sha256=abcdef", wantStatus: http.StatusUnauthorized},
+		{name: "missing signature", signature: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range testcases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			neh := func(ctx context.Context, r *http.Request, err error) *Response {
+				return &Response{StatusCode: http.StatusUnauthorized}
+			}
+			h := NotificationHandler(&Hooks{}, neh, NoOpHooksErrorHandler, &HandlerOptions{
+				ValidateSignature: true,
+				Secret:            "app-secret",
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+			req.Header.Set(SignatureHeaderKey, tt.signature)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAttachHooksToMessage_Media(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		message  *Message
+		wantHook string
+		wantID   string
+	}{
+		{
+			name:     "image hook",
+			message:  &Message{Type: "image", Image: &models.MediaInfo{ID: "image", Caption: "receipt"}},
+			wantHook: "image",
+			wantID:   "image",
+		},
+		{
+			name:     "voice note",
+			message:  &Message{Type: "audio", Audio: &models.MediaInfo{ID: "audio", Voice: true}},
+			wantHook: "audio",
+			wantID:   "audio",
+		},
+		{
+			name:     "document fallback",
+			message:  &Message{Type: "document", Document: &models.MediaInfo{ID: "document", Filename: "a.pdf"}},
+			wantHook: "media:document",
+			wantID:   "document",
+		},
+		{
+			name:     "sticker fallback",
+			message:  &Message{Type: "sticker", Sticker: &models.MediaInfo{ID: "sticker", Animated: true}},
+			wantHook: "media:sticker",
+			wantID:   "sticker",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var gotHook, gotID string
+			listener := NewEventListener()
+			listener.OnImageMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext,
+				image *models.MediaInfo,
+			) error {
+				gotHook, gotID = "image", image.ID
+
+				return nil
+			})
+			listener.OnAudioMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext,
+				audio *models.MediaInfo,
+			) error {
+				gotHook, gotID = "audio", audio.ID
+
+				return nil
+			})
+			listener.OnMediaMessage(func(_ context.Context, _ *NotificationContext, _ *MessageContext,
+				mediaType MessageType, media *models.MediaInfo,
+			) error {
+				gotHook, gotID = "media:"+string(mediaType), media.ID
+
+				return nil
+			})
+
+			if err := attachHooksToMessage(context.Background(), &NotificationContext{}, listener.hooks,
+				tt.message); err != nil {
+				t.Fatalf("attachHooksToMessage() error = %v", err)
+			}
+
+			if gotHook != tt.wantHook || gotID != tt.wantID {
+				t.Errorf("hook %s called with media %s, want %s with %s", gotHook, gotID, tt.wantHook, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestVerifySubscriptionHandler(t *testing.T) {
+	t.Parallel()
+	handler := VerifySubscriptionHandler(func(_ context.Context, request *VerificationRequest) error {
+		if request.Token != "verify-me" {
+			return errors.New("invalid verify token")
+		}
+
+		return nil
+	})
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{name: "valid token", token: "verify-me", wantCode: http.StatusOK, wantBody: "1158201444"},
+		{name: "invalid token", token: "wrong", wantCode: http.StatusBadRequest, wantBody: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+				"/webhooks?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token="+tt.token, nil))
+			if recorder.Code != tt.wantCode || recorder.Body.String() != tt.wantBody {
+				t.Errorf("verify = %d %q, want %d %q", recorder.Code, recorder.Body.String(), tt.wantCode,
+					tt.wantBody)
+			}
+		})
+	}
+}
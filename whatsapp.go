@@ -27,9 +27,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/piusalfred/whatsapp/auth"
 	whttp "github.com/piusalfred/whatsapp/http"
+	"github.com/piusalfred/whatsapp/mediacache"
 	"github.com/piusalfred/whatsapp/models"
 	"github.com/piusalfred/whatsapp/qrcodes"
+	"github.com/piusalfred/whatsapp/ratelimit"
+	"github.com/piusalfred/whatsapp/templates"
 )
 
 var ErrNilRequest = errors.New("nil request")
@@ -45,7 +49,7 @@ const (
 	ReactionMessageType    = "reaction"
 	MediaMessageType       = "media"
 	LocationMessageType    = "location"
-	ContactMessageType     = "contact"
+	ContactMessageType     = "contacts"
 	InteractiveMessageType = "interactive"
 )
 
@@ -137,12 +141,24 @@ type (
 		http              *http.Client
 		baseURL           string
 		apiVersion        string
-		accessToken       string
+		tokenSource       auth.TokenSource
+		onTokenExpiry     *tokenExpiry
 		phoneNumberID     string
 		businessAccountID string
+		retryPolicy       *whttp.RetryPolicy
+		rateLimiter       *ratelimit.Limiter
+		mediaCache        mediacache.Store
+		onMediaCacheError MediaCacheErrorHook
+		onMessageSent     MessageSentHook
+		windowGuard       *WindowGuard
 	}
 
 	ClientOption func(*Client)
+
+	tokenExpiry struct {
+		within   time.Duration
+		callback auth.ExpiryCallback
+	}
 )
 
 func WithHTTPClient(http *http.Client) ClientOption {
@@ -165,7 +181,27 @@ func WithVersion(version string) ClientOption {
 
 func WithAccessToken(accessToken string) ClientOption {
 	return func(client *Client) {
-		client.accessToken = accessToken
+		client.tokenSource = auth.StaticTokenSource(accessToken)
+	}
+}
+
+// WithTokenSource sets the auth.TokenSource that provides the access token of every request
+// made by the client. It replaces the token set by WithAccessToken.
+//
+// When a request fails because the token has expired or has been invalidated (error code 190)
+// and the source implements auth.Refresher, the token is refreshed and the request is retried once.
+func WithTokenSource(source auth.TokenSource) ClientOption {
+	return func(client *Client) {
+		client.tokenSource = source
+	}
+}
+
+// WithTokenExpiryCallback sets a callback called once for each token that expires in less
+// than within, when the client is about to use it. Tokens with an unknown expiry, like the
+// ones set by WithAccessToken, never trigger it.
+func WithTokenExpiryCallback(within time.Duration, callback auth.ExpiryCallback) ClientOption {
+	return func(client *Client) {
+		client.onTokenExpiry = &tokenExpiry{within: within, callback: callback}
 	}
 }
 
@@ -181,13 +217,29 @@ func WithBusinessAccountID(whatsappBusinessAccountID string) ClientOption {
 	}
 }
 
+// WithRetryPolicy sets the whttp.RetryPolicy applied to every request made by the client.
+// Requests are sent only once if no policy is set.
+func WithRetryPolicy(policy *whttp.RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.retryPolicy = policy
+	}
+}
+
+// WithRateLimiter sets the ratelimit.Limiter consulted before every message sent by the client.
+// The same limiter can be shared by several clients.
+func WithRateLimiter(limiter *ratelimit.Limiter) ClientOption {
+	return func(client *Client) {
+		client.rateLimiter = limiter
+	}
+}
+
 func NewClient(opts ...ClientOption) *Client {
 	client := &Client{
 		rwm:               &sync.RWMutex{},
 		http:              http.DefaultClient,
 		baseURL:           BaseURL,
 		apiVersion:        "v16.0",
-		accessToken:       "",
+		tokenSource:       auth.StaticTokenSource(""),
 		phoneNumberID:     "",
 		businessAccountID: "",
 	}
@@ -196,34 +248,128 @@ func NewClient(opts ...ClientOption) *Client {
 		opt(client)
 	}
 
+	client.tokenSource = client.withExpiryCallback(client.tokenSource)
+
 	return client
 }
 
+// withExpiryCallback wraps the source with the token expiry callback, if any.
+func (client *Client) withExpiryCallback(source auth.TokenSource) auth.TokenSource {
+	if client.onTokenExpiry == nil {
+		return source
+	}
+
+	return auth.NotifyExpiry(source, client.onTokenExpiry.within, client.onTokenExpiry.callback)
+}
+
 type clientContext struct {
 	baseURL           string
 	apiVersion        string
 	accessToken       string
+	tokenSource       auth.TokenSource
 	phoneNumberID     string
 	businessAccountID string
+	retryPolicy       *whttp.RetryPolicy
+	rateLimiter       *ratelimit.Limiter
 }
 
-func (client *Client) context() *clientContext {
+// context returns a snapshot of the client settings with the access token obtained from
+// the token source.
+func (client *Client) context(ctx context.Context) (*clientContext, error) {
 	client.rwm.RLock()
-	defer client.rwm.RUnlock()
-
-	return &clientContext{
+	cctx := &clientContext{
 		baseURL:           client.baseURL,
 		apiVersion:        client.apiVersion,
-		accessToken:       client.accessToken,
+		tokenSource:       client.tokenSource,
 		phoneNumberID:     client.phoneNumberID,
 		businessAccountID: client.businessAccountID,
+		retryPolicy:       client.retryPolicy,
+		rateLimiter:       client.rateLimiter,
+	}
+	client.rwm.RUnlock()
+
+	token, err := cctx.tokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("access token: %w", err)
+	}
+	cctx.accessToken = token.AccessToken
+
+	return cctx, nil
+}
+
+// withToken calls send with the client context. If the request fails because the access token
+// has expired or has been invalidated and the token source can be refreshed, send is called
+// once more with the refreshed token.
+func withToken[T any](ctx context.Context, client *Client, send func(cctx *clientContext) (T, error)) (T, error) {
+	var zero T
+	cctx, err := client.context(ctx)
+	if err != nil {
+		return zero, err
+	}
+
+	resp, err := send(cctx)
+	if err == nil || !auth.IsInvalidTokenError(err) {
+		return resp, err
+	}
+
+	token, rerr := auth.Refresh(ctx, cctx.tokenSource, cctx.accessToken)
+	if rerr != nil || token.AccessToken == cctx.accessToken {
+		return resp, err
+	}
+	cctx.accessToken = token.AccessToken
+
+	return send(cctx)
+}
+
+// withThrottledToken is withToken for the requests that count against the rate limiter. The
+// limiter is waited for once, before the first attempt: the attempt made again after a token
+// refresh is the same message, that the API rejected before sending it. send is called with a
+// context that makes the retries of whttp.Send wait for the limiter.
+func withThrottledToken[T any](ctx context.Context, client *Client, recipient string,
+	send func(ctx context.Context, cctx *clientContext) (T, error),
+) (T, error) {
+	throttled := false
+
+	return withToken(ctx, client, func(cctx *clientContext) (T, error) {
+		if !throttled {
+			throttled = true
+			if err := cctx.throttle(ctx, recipient); err != nil {
+				var zero T
+
+				return zero, err
+			}
+		}
+
+		if cctx.rateLimiter == nil {
+			return send(ctx, cctx)
+		}
+
+		return send(whttp.WithThrottle(ctx, func(ctx context.Context) error {
+			return cctx.throttle(ctx, recipient)
+		}), cctx)
+	})
+}
+
+// throttle waits for the rate limiter, if any, to allow a message from the client's
+// phone number to the recipient.
+func (cctx *clientContext) throttle(ctx context.Context, recipient string) error {
+	if cctx.rateLimiter == nil {
+		return nil
 	}
+
+	return cctx.rateLimiter.Wait(ctx, cctx.phoneNumberID, recipient)
 }
 
 func (client *Client) SetAccessToken(accessToken string) {
+	client.SetTokenSource(auth.StaticTokenSource(accessToken))
+}
+
+// SetTokenSource replaces the auth.TokenSource of the client.
+func (client *Client) SetTokenSource(source auth.TokenSource) {
+	source = client.withExpiryCallback(source)
 	client.rwm.Lock()
 	defer client.rwm.Unlock()
-	client.accessToken = accessToken
+	client.tokenSource = source
 }
 
 func (client *Client) SetPhoneNumberID(phoneNumberID string) {
@@ -238,6 +384,18 @@ func (client *Client) SetBusinessAccountID(businessAccountID string) {
 	client.businessAccountID = businessAccountID
 }
 
+func (client *Client) SetRetryPolicy(policy *whttp.RetryPolicy) {
+	client.rwm.Lock()
+	defer client.rwm.Unlock()
+	client.retryPolicy = policy
+}
+
+func (client *Client) SetRateLimiter(limiter *ratelimit.Limiter) {
+	client.rwm.Lock()
+	defer client.rwm.Unlock()
+	client.rateLimiter = limiter
+}
+
 type TextMessage struct {
 	Message    string
 	PreviewURL bool
@@ -247,17 +405,21 @@ type TextMessage struct {
 func (client *Client) SendTextMessage(ctx context.Context, recipient string,
 	message *TextMessage,
 ) (*ResponseMessage, error) {
-	cctx := client.context()
-	request := &SendTextRequest{
-		BaseURL:       cctx.baseURL,
-		AccessToken:   cctx.accessToken,
-		PhoneNumberID: cctx.phoneNumberID,
-		ApiVersion:    cctx.apiVersion,
-		Recipient:     recipient,
-		Message:       message.Message,
-		PreviewURL:    message.PreviewURL,
-	}
-	resp, err := SendText(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, "text",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &SendTextRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Message:       message.Message,
+				PreviewURL:    message.PreviewURL,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return SendText(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("failed to send text message: %w", err)
 	}
@@ -269,19 +431,23 @@ func (client *Client) SendTextMessage(ctx context.Context, recipient string,
 func (client *Client) SendLocationMessage(ctx context.Context, recipient string,
 	message *models.Location,
 ) (*ResponseMessage, error) {
-	request := &SendLocationRequest{
-		BaseURL:       client.baseURL,
-		AccessToken:   client.accessToken,
-		PhoneNumberID: client.phoneNumberID,
-		ApiVersion:    client.apiVersion,
-		Recipient:     recipient,
-		Name:          message.Name,
-		Address:       message.Address,
-		Latitude:      message.Latitude,
-		Longitude:     message.Longitude,
-	}
-
-	resp, err := SendLocation(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, "location",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &SendLocationRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Name:          message.Name,
+				Address:       message.Address,
+				Latitude:      message.Latitude,
+				Longitude:     message.Longitude,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return SendLocation(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("failed to send location message: %w", err)
 	}
@@ -295,18 +461,21 @@ type ReactMessage struct {
 }
 
 func (client *Client) React(ctx context.Context, recipient string, req *ReactMessage) (*ResponseMessage, error) {
-	cctx := client.context()
-	request := &ReactRequest{
-		BaseURL:       cctx.baseURL,
-		AccessToken:   cctx.accessToken,
-		PhoneNumberID: cctx.phoneNumberID,
-		ApiVersion:    cctx.apiVersion,
-		Recipient:     recipient,
-		MessageID:     req.MessageID,
-		Emoji:         req.Emoji,
-	}
-
-	resp, err := React(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, "reaction",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &ReactRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				MessageID:     req.MessageID,
+				Emoji:         req.Emoji,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return React(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("react: %w", err)
 	}
@@ -327,23 +496,26 @@ type MediaMessage struct {
 func (client *Client) SendMedia(ctx context.Context, recipient string, req *MediaMessage,
 	cacheOptions *CacheOptions,
 ) (*ResponseMessage, error) {
-	cctx := client.context()
-	request := &SendMediaRequest{
-		BaseURL:       cctx.baseURL,
-		AccessToken:   cctx.accessToken,
-		PhoneNumberID: cctx.phoneNumberID,
-		ApiVersion:    cctx.apiVersion,
-		Recipient:     recipient,
-		Type:          req.Type,
-		MediaID:       req.MediaID,
-		MediaLink:     req.MediaLink,
-		Caption:       req.Caption,
-		Filename:      req.Filename,
-		Provider:      req.Provider,
-		CacheOptions:  cacheOptions,
-	}
-
-	resp, err := SendMedia(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, string(req.Type),
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &SendMediaRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Type:          req.Type,
+				MediaID:       req.MediaID,
+				MediaLink:     req.MediaLink,
+				Caption:       req.Caption,
+				Filename:      req.Filename,
+				Provider:      req.Provider,
+				CacheOptions:  cacheOptions,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return SendMedia(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("client send media: %w", err)
 	}
@@ -361,19 +533,22 @@ type ReplyMessage struct {
 }
 
 func (client *Client) Reply(ctx context.Context, recipient string, req *ReplyMessage) (*ResponseMessage, error) {
-	cctx := client.context()
-	request := &ReplyRequest{
-		BaseURL:       cctx.baseURL,
-		AccessToken:   cctx.accessToken,
-		PhoneNumberID: cctx.phoneNumberID,
-		ApiVersion:    cctx.apiVersion,
-		Recipient:     recipient,
-		Context:       req.Context,
-		MessageType:   req.Type,
-		Content:       req.Content,
-	}
-
-	resp, err := Reply(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, string(req.Type),
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &ReplyRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Context:       req.Context,
+				MessageType:   req.Type,
+				Content:       req.Content,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return Reply(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("client reply: %w", err)
 	}
@@ -384,17 +559,20 @@ func (client *Client) Reply(ctx context.Context, recipient string, req *ReplyMes
 func (client *Client) SendContacts(ctx context.Context, recipient string, contacts *models.Contacts) (
 	*ResponseMessage, error,
 ) {
-	cctx := client.context()
-	req := &SendContactRequest{
-		BaseURL:       cctx.baseURL,
-		AccessToken:   cctx.accessToken,
-		PhoneNumberID: cctx.phoneNumberID,
-		ApiVersion:    cctx.apiVersion,
-		Recipient:     recipient,
-		Contacts:      contacts,
-	}
-
-	resp, err := SendContact(ctx, client.http, req)
+	resp, err := client.sendMessage(ctx, recipient, "contacts",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			req := &SendContactRequest{
+				BaseURL:       cctx.baseURL,
+				AccessToken:   cctx.accessToken,
+				PhoneNumberID: cctx.phoneNumberID,
+				ApiVersion:    cctx.apiVersion,
+				Recipient:     recipient,
+				Contacts:      contacts,
+				RetryPolicy:   cctx.retryPolicy,
+			}
+
+			return SendContact(ctx, client.http, req)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -410,31 +588,38 @@ func (client *Client) MarkMessageRead(ctx context.Context, messageID string) (*S
 		MessageID:        messageID,
 	}
 
-	cctx := client.context()
-
-	reqCtx := &whttp.RequestContext{
-		Name:       "mark read",
-		BaseURL:    cctx.baseURL,
-		ApiVersion: cctx.apiVersion,
-		SenderID:   cctx.phoneNumberID,
-		Endpoints:  []string{"/messages"},
-	}
-
-	params := &whttp.Request{
-		Context: reqCtx,
-		Method:  http.MethodPost,
-		Headers: map[string]string{"Content-Type": "application/json"},
-		Bearer:  cctx.accessToken,
-		Payload: reqBody,
-	}
-
-	var success StatusResponse
-	err := whttp.Send(ctx, client.http, params, &success)
+	resp, err := withThrottledToken(ctx, client, "", func(ctx context.Context, cctx *clientContext) (
+		*StatusResponse, error,
+	) {
+		reqCtx := &whttp.RequestContext{
+			Name:       "mark read",
+			BaseURL:    cctx.baseURL,
+			ApiVersion: cctx.apiVersion,
+			SenderID:   cctx.phoneNumberID,
+			Endpoints:  []string{"/messages"},
+		}
+
+		params := &whttp.Request{
+			Context: reqCtx,
+			Method:  http.MethodPost,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Bearer:  cctx.accessToken,
+			Payload: reqBody,
+			Retry:   cctx.retryPolicy,
+		}
+
+		var success StatusResponse
+		if err := whttp.Send(ctx, client.http, params, &success); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return &success, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
 
-	return &success, nil
+	return resp, nil
 }
 
 type Template struct {
@@ -446,20 +631,23 @@ type Template struct {
 
 // SendTemplate sends a template message to the recipient.
 func (client *Client) SendTemplate(ctx context.Context, recipient string, req *Template) (*ResponseMessage, error) {
-	cctx := client.context()
-	request := &SendTemplateRequest{
-		BaseURL:                cctx.baseURL,
-		AccessToken:            cctx.accessToken,
-		PhoneNumberID:          cctx.phoneNumberID,
-		ApiVersion:             cctx.apiVersion,
-		Recipient:              recipient,
-		TemplateLanguageCode:   req.LanguageCode,
-		TemplateLanguagePolicy: req.LanguagePolicy,
-		TemplateName:           req.Name,
-		TemplateComponents:     req.Components,
-	}
-
-	resp, err := SendTemplate(ctx, client.http, request)
+	resp, err := client.sendMessage(ctx, recipient, "template",
+		func(ctx context.Context, cctx *clientContext) (*ResponseMessage, error) {
+			request := &SendTemplateRequest{
+				BaseURL:                cctx.baseURL,
+				AccessToken:            cctx.accessToken,
+				PhoneNumberID:          cctx.phoneNumberID,
+				ApiVersion:             cctx.apiVersion,
+				Recipient:              recipient,
+				TemplateLanguageCode:   req.LanguageCode,
+				TemplateLanguagePolicy: req.LanguagePolicy,
+				TemplateName:           req.Name,
+				TemplateComponents:     req.Components,
+				RetryPolicy:            cctx.retryPolicy,
+			}
+
+			return SendTemplate(ctx, client.http, request)
+		})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -467,8 +655,38 @@ func (client *Client) SendTemplate(ctx context.Context, recipient string, req *T
 	return resp, nil
 }
 
+// SendTemplateMessage sends the template message built by templates.Builder to the recipient.
+func (client *Client) SendTemplateMessage(ctx context.Context, recipient string, template *models.Template) (
+	*ResponseMessage, error,
+) {
+	if template == nil {
+		return nil, fmt.Errorf("client: %w", ErrNilRequest)
+	}
+
+	req := &Template{
+		Name:       template.Name,
+		Components: template.Components,
+	}
+	if template.Language != nil {
+		req.LanguageCode = template.Language.Code
+		req.LanguagePolicy = template.Language.Policy
+	}
+
+	return client.SendTemplate(ctx, recipient, req)
+}
+
 ////////////// QrCode
 
+func (cctx *clientContext) qrCodesRequestContext() *qrcodes.RequestContext {
+	return &qrcodes.RequestContext{
+		BaseURL:     cctx.baseURL,
+		PhoneID:     cctx.phoneNumberID,
+		ApiVersion:  cctx.apiVersion,
+		AccessToken: cctx.accessToken,
+		RetryPolicy: cctx.retryPolicy,
+	}
+}
+
 func (client *Client) CreateQrCode(ctx context.Context, message *qrcodes.CreateRequest) (
 	*qrcodes.CreateResponse, error,
 ) {
@@ -477,15 +695,31 @@ func (client *Client) CreateQrCode(ctx context.Context, message *qrcodes.CreateR
 		ImageFormat:      message.ImageFormat,
 	}
 
-	cctx := client.context()
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*qrcodes.CreateResponse, error) {
+		return qrcodes.Create(ctx, client.http, cctx.qrCodesRequestContext(), request)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
 
-	rctx := &qrcodes.RequestContext{
-		BaseURL:     cctx.baseURL,
-		PhoneID:     cctx.phoneNumberID,
-		ApiVersion:  cctx.apiVersion,
-		AccessToken: client.accessToken,
+	return resp, nil
+}
+
+func (client *Client) ListQrCodes(ctx context.Context) (*qrcodes.ListResponse, error) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*qrcodes.ListResponse, error) {
+		return qrcodes.List(ctx, client.http, cctx.qrCodesRequestContext())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
 	}
-	resp, err := qrcodes.Create(ctx, client.http, rctx, request)
+
+	return resp, nil
+}
+
+func (client *Client) GetQrCode(ctx context.Context, qrCodeID string) (*qrcodes.Information, error) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*qrcodes.Information, error) {
+		return qrcodes.Get(ctx, client.http, cctx.qrCodesRequestContext(), qrCodeID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -493,16 +727,22 @@ func (client *Client) CreateQrCode(ctx context.Context, message *qrcodes.CreateR
 	return resp, nil
 }
 
-func (client *Client) ListQrCodes(ctx context.Context) (*qrcodes.ListResponse, error) {
-	cctx := client.context()
-	rctx := &qrcodes.RequestContext{
-		BaseURL:     cctx.baseURL,
-		PhoneID:     cctx.phoneNumberID,
-		ApiVersion:  cctx.apiVersion,
-		AccessToken: cctx.accessToken,
+func (client *Client) UpdateQrCode(ctx context.Context, qrCodeID string, request *qrcodes.CreateRequest,
+) (*qrcodes.SuccessResponse, error) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*qrcodes.SuccessResponse, error) {
+		return qrcodes.Update(ctx, client.http, cctx.qrCodesRequestContext(), qrCodeID, request)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
 	}
 
-	resp, err := qrcodes.List(ctx, client.http, rctx)
+	return resp, nil
+}
+
+func (client *Client) DeleteQrCode(ctx context.Context, qrCodeID string) (*qrcodes.SuccessResponse, error) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*qrcodes.SuccessResponse, error) {
+		return qrcodes.Delete(ctx, client.http, cctx.qrCodesRequestContext(), qrCodeID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -510,16 +750,59 @@ func (client *Client) ListQrCodes(ctx context.Context) (*qrcodes.ListResponse, e
 	return resp, nil
 }
 
-func (client *Client) GetQrCode(ctx context.Context, qrCodeID string) (*qrcodes.Information, error) {
-	cctx := client.context()
-	rctx := &qrcodes.RequestContext{
-		BaseURL:     cctx.baseURL,
-		PhoneID:     cctx.phoneNumberID,
-		ApiVersion:  cctx.apiVersion,
-		AccessToken: cctx.accessToken,
+////// PHONE NUMBERS
+
+func (client *Client) RequestVerificationCode(ctx context.Context, codeMethod string, language string) error {
+	_, err := withToken(ctx, client, func(cctx *clientContext) (any, error) {
+		return nil, RequestCode(ctx, client.http, &VerificationCodeRequest{
+			Token:         cctx.accessToken,
+			BaseURL:       cctx.baseURL,
+			ApiVersion:    cctx.apiVersion,
+			PhoneNumberID: cctx.phoneNumberID,
+			CodeMethod:    codeMethod,
+			Language:      language,
+			RetryPolicy:   cctx.retryPolicy,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("client: %w", err)
 	}
 
-	resp, err := qrcodes.Get(ctx, client.http, rctx, qrCodeID)
+	return nil
+}
+
+// VerifyCode verifies the client's phone number with the code received after RequestVerificationCode.
+func (client *Client) VerifyCode(ctx context.Context, code string) error {
+	_, err := withToken(ctx, client, func(cctx *clientContext) (any, error) {
+		return nil, VerifyCode(ctx, client.http, &VerificationCodeRequest{
+			Token:         cctx.accessToken,
+			BaseURL:       cctx.baseURL,
+			ApiVersion:    cctx.apiVersion,
+			PhoneNumberID: cctx.phoneNumberID,
+			RetryPolicy:   cctx.retryPolicy,
+		}, code)
+	})
+	if err != nil {
+		return fmt.Errorf("client: %w", err)
+	}
+
+	return nil
+}
+
+// ListPhoneNumbers lists the phone numbers registered in the client's business account.
+func (client *Client) ListPhoneNumbers(ctx context.Context, filters ...*PhoneNumberFilterParams) (
+	*PhoneNumbersList, error,
+) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*PhoneNumbersList, error) {
+		return ListPhoneNumbers(ctx, client.http, cctx.accessToken, &ListPhoneNumbersRequest{
+			BaseURL:      cctx.baseURL,
+			ApiVersion:   cctx.apiVersion,
+			Token:        cctx.accessToken,
+			BusinessID:   cctx.businessAccountID,
+			FilterParams: filters,
+			RetryPolicy:  cctx.retryPolicy,
+		})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -527,17 +810,25 @@ func (client *Client) GetQrCode(ctx context.Context, qrCodeID string) (*qrcodes.
 	return resp, nil
 }
 
-func (client *Client) UpdateQrCode(ctx context.Context, qrCodeID string, request *qrcodes.CreateRequest,
-) (*qrcodes.SuccessResponse, error) {
-	cctx := client.context()
-	rctx := &qrcodes.RequestContext{
-		BaseURL:     cctx.baseURL,
-		PhoneID:     cctx.phoneNumberID,
-		ApiVersion:  cctx.apiVersion,
-		AccessToken: cctx.accessToken,
+////// TEMPLATES
+
+func (cctx *clientContext) templatesRequestContext() *templates.RequestContext {
+	return &templates.RequestContext{
+		BaseURL:           cctx.baseURL,
+		ApiVersion:        cctx.apiVersion,
+		AccessToken:       cctx.accessToken,
+		BusinessAccountID: cctx.businessAccountID,
+		RetryPolicy:       cctx.retryPolicy,
 	}
+}
 
-	resp, err := qrcodes.Update(ctx, client.http, rctx, qrCodeID, request)
+// CreateTemplate creates a message template in the client's business account.
+func (client *Client) CreateTemplate(ctx context.Context, request *templates.CreateRequest) (
+	*templates.CreateResponse, error,
+) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*templates.CreateResponse, error) {
+		return templates.Create(ctx, client.http, cctx.templatesRequestContext(), request)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -545,16 +836,27 @@ func (client *Client) UpdateQrCode(ctx context.Context, qrCodeID string, request
 	return resp, nil
 }
 
-func (client *Client) DeleteQrCode(ctx context.Context, qrCodeID string) (*qrcodes.SuccessResponse, error) {
-	cctx := client.context()
-	rctx := &qrcodes.RequestContext{
-		BaseURL:     cctx.baseURL,
-		PhoneID:     cctx.phoneNumberID,
-		ApiVersion:  cctx.apiVersion,
-		AccessToken: cctx.accessToken,
+// ListTemplates returns a page of the templates in the client's business account.
+func (client *Client) ListTemplates(ctx context.Context, opts *templates.ListOptions) (
+	*templates.ListResponse, error,
+) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*templates.ListResponse, error) {
+		return templates.List(ctx, client.http, cctx.templatesRequestContext(), opts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
 	}
 
-	resp, err := qrcodes.Delete(ctx, client.http, rctx, qrCodeID)
+	return resp, nil
+}
+
+// ListAllTemplates returns the templates of every page in the client's business account.
+func (client *Client) ListAllTemplates(ctx context.Context, opts *templates.ListOptions) (
+	[]*templates.Template, error,
+) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) ([]*templates.Template, error) {
+		return templates.ListAll(ctx, client.http, cctx.templatesRequestContext(), opts)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("client: %w", err)
 	}
@@ -562,20 +864,42 @@ func (client *Client) DeleteQrCode(ctx context.Context, qrCodeID string) (*qrcod
 	return resp, nil
 }
 
-////// PHONE NUMBERS
+func (client *Client) GetTemplate(ctx context.Context, templateID string) (*templates.Template, error) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*templates.Template, error) {
+		return templates.Get(ctx, client.http, cctx.templatesRequestContext(), templateID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
 
-func (client *Client) RequestVerificationCode(ctx context.Context, codeMethod string, language string) error {
-	cctx := client.context()
-	if err := RequestCode(ctx, client.http, &VerificationCodeRequest{
-		Token:         cctx.accessToken,
-		BaseURL:       cctx.baseURL,
-		ApiVersion:    cctx.apiVersion,
-		PhoneNumberID: cctx.phoneNumberID,
-		CodeMethod:    codeMethod,
-		Language:      language,
-	}); err != nil {
-		return fmt.Errorf("client: %w", err)
+	return resp, nil
+}
+
+func (client *Client) EditTemplate(ctx context.Context, templateID string, request *templates.EditRequest) (
+	*templates.SuccessResponse, error,
+) {
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*templates.SuccessResponse, error) {
+		return templates.Edit(ctx, client.http, cctx.templatesRequestContext(), templateID, request)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
 	}
 
-	return nil
+	return resp, nil
+}
+
+// DeleteTemplate deletes the templates with the given name, or only the one with the given
+// name and ID when templateID is not empty.
+func (client *Client) DeleteTemplate(ctx context.Context, name, templateID string) (
+	*templates.SuccessResponse, error,
+) {
+	request := &templates.DeleteRequest{Name: name, ID: templateID}
+	resp, err := withToken(ctx, client, func(cctx *clientContext) (*templates.SuccessResponse, error) {
+		return templates.Delete(ctx, client.http, cctx.templatesRequestContext(), request)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+
+	return resp, nil
 }
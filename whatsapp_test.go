@@ -20,9 +20,17 @@
 package whatsapp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp/auth"
+	"github.com/piusalfred/whatsapp/ratelimit"
 )
 
 func ExampleNewClient() {
@@ -39,7 +47,12 @@ func ExampleNewClient() {
 	client.SetPhoneNumberID("myexamplephoneid")
 	client.SetBusinessAccountID("businessaccountID")
 
-	cctx := client.context()
+	cctx, err := client.context(context.Background())
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
 
 	fmt.Printf("base url: %s\napi version: %s\ntoken: %s\nphone id: %s\nbusiness id: %s\n",
 		cctx.baseURL, cctx.apiVersion, cctx.accessToken, cctx.phoneNumberID, cctx.businessAccountID)
@@ -89,3 +102,105 @@ func TestMediaMaxAllowedSize(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_TokenRefresh(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"Error validating access token: Session has expired",` +
+				`"type":"OAuthException","code":190,"error_subcode":463}}`))
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		source       auth.TokenSource
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name: "refreshed and retried once",
+			source: auth.NewRefreshingTokenSource(&auth.Token{AccessToken: "expired-token"},
+				func(context.Context, *auth.Token) (*auth.Token, error) {
+					return &auth.Token{AccessToken: "fresh-token", ExpiresAt: time.Now().Add(time.Hour)}, nil
+				}),
+			wantRequests: 2,
+		},
+		{
+			name:         "static token is not retried",
+			source:       auth.StaticTokenSource("expired-token"),
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name: "refresh returning the same token is not retried",
+			source: auth.NewRefreshingTokenSource(&auth.Token{AccessToken: "expired-token"},
+				func(context.Context, *auth.Token) (*auth.Token, error) {
+					return &auth.Token{AccessToken: "expired-token"}, nil
+				}),
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"),
+			WithTokenSource(tt.source))
+		_, err := client.SendTextMessage(context.Background(), "255712345678", &TextMessage{Message: "hello"})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SendTextMessage() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+
+		if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+			t.Errorf("%s: requests = %d, want %d", tt.name, got, tt.wantRequests)
+		}
+	}
+}
+
+func TestClient_TokenRefreshWithRateLimiter(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"Error validating access token: Session has expired",` +
+				`"type":"OAuthException","code":190,"error_subcode":463}}`))
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	// a second Wait for the same pair fails immediately, so the retry after the refresh
+	// must not take another slot.
+	limiter := ratelimit.New(&ratelimit.Config{MessagesPerSecond: 80, PairInterval: time.Hour, Mode: ratelimit.FailFast})
+	source := auth.NewRefreshingTokenSource(&auth.Token{AccessToken: "expired-token"},
+		func(context.Context, *auth.Token) (*auth.Token, error) {
+			return &auth.Token{AccessToken: "fresh-token", ExpiresAt: time.Now().Add(time.Hour)}, nil
+		})
+	client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("phone_number_id"),
+		WithTokenSource(source), WithRateLimiter(limiter))
+
+	if _, err := client.SendTextMessage(context.Background(), "255712345678", &TextMessage{Message: "hello"}); err != nil {
+		t.Fatalf("SendTextMessage() error = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	_, err := client.SendTextMessage(context.Background(), "255712345678", &TextMessage{Message: "again"})
+	if !errors.Is(err, ratelimit.ErrRateLimited) {
+		t.Errorf("second SendTextMessage() error = %v, want %v", err, ratelimit.ErrRateLimited)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapptest
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+)
+
+// The errors returned by the server have the codes and messages of the Cloud API errors.
+
+func errInvalidAccessToken() *werrors.Error {
+	return &werrors.Error{
+		Message:   "Invalid OAuth access token - Cannot parse access token",
+		Type:      "OAuthException",
+		Code:      190,
+		FBTraceID: traceID(),
+	}
+}
+
+func errUnsupported(method, id string) *werrors.Error {
+	return &werrors.Error{
+		Message: fmt.Sprintf("Unsupported %s request. Object with ID '%s' does not exist, cannot be loaded "+
+			"due to missing permissions, or does not support this operation.", strings.ToLower(method), id),
+		Type:      "GraphMethodException",
+		Code:      100,
+		Subcode:   33,
+		FBTraceID: traceID(),
+	}
+}
+
+func errUnknownPath(path string) *werrors.Error {
+	return &werrors.Error{
+		Message:   fmt.Sprintf("Unknown path components: %s", path),
+		Type:      "OAuthException",
+		Code:      2500,
+		FBTraceID: traceID(),
+	}
+}
+
+func errInvalidParameter(details string) *werrors.Error {
+	return &werrors.Error{
+		Message:   "(#100) Invalid parameter",
+		Type:      "OAuthException",
+		Code:      100,
+		Data:      &werrors.ErrorData{MessagingProduct: "whatsapp", Details: details},
+		FBTraceID: traceID(),
+	}
+}
+
+func errRequiredParameter(name string) *werrors.Error {
+	return &werrors.Error{
+		Message:   "(#131008) Required parameter is missing",
+		Type:      "OAuthException",
+		Code:      131008,
+		Data:      &werrors.ErrorData{MessagingProduct: "whatsapp", Details: fmt.Sprintf("The parameter %s is required.", name)},
+		FBTraceID: traceID(),
+	}
+}
+
+func errTemplateNotFound(name, language string) *werrors.Error {
+	return &werrors.Error{
+		Message: "(#132001) Template name does not exist in the translation",
+		Type:    "OAuthException",
+		Code:    132001,
+		Data: &werrors.ErrorData{
+			MessagingProduct: "whatsapp",
+			Details:          fmt.Sprintf("template name (%s) does not exist in %s", name, language),
+		},
+		FBTraceID: traceID(),
+	}
+}
+
+func errTemplateExists(name, language string) *werrors.Error {
+	return &werrors.Error{
+		Message:   "Invalid parameter",
+		Type:      "OAuthException",
+		Code:      100,
+		Subcode:   2388024,
+		UserTitle: "Content in this language already exists",
+		UserMsg:   fmt.Sprintf("%s already has content in %s.", name, language),
+		FBTraceID: traceID(),
+	}
+}
+
+const alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+func randomString(n int, alphabet string) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))] //nolint:gosec
+	}
+
+	return string(b)
+}
+
+func traceID() string {
+	return randomString(23, alphanumeric+"-_")
+}
+
+// numericID returns a 15 or 16 digits ID like the IDs of media, templates and phone numbers.
+func numericID() string {
+	return strconv.FormatInt(100000000000000+rand.Int63n(8999999999999999), 10) //nolint:gosec
+}
+
+func messageID() string {
+	return "wamid.HBgL" + randomString(48, alphanumeric) + "=="
+}
+
+func qrCode() string {
+	return randomString(14, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func parseInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
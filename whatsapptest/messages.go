@@ -0,0 +1,384 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapptest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/templates"
+)
+
+func (server *Server) sendMessage(w http.ResponseWriter, phoneNumberID string, body []byte) {
+	var receipt struct {
+		Product   string `json:"messaging_product"`
+		Status    string `json:"status"`
+		MessageID string `json:"message_id"`
+	}
+	if err := json.Unmarshal(body, &receipt); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+
+	if receipt.Product != "whatsapp" {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("messaging_product"))
+
+		return
+	}
+
+	if receipt.Status != "" {
+		if receipt.Status != "read" || receipt.MessageID == "" {
+			writeError(w, http.StatusBadRequest, errInvalidParameter("status must be read and message_id is required"))
+
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+
+		return
+	}
+
+	var message models.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+
+	if message.To == "" {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("to"))
+
+		return
+	}
+
+	category, werr := server.checkMessage(&message)
+	if werr != nil {
+		writeError(w, http.StatusBadRequest, werr)
+
+		return
+	}
+
+	sent := &SentMessage{
+		ID:            messageID(),
+		PhoneNumberID: phoneNumberID,
+		WaID:          waID(message.To),
+		Message:       &message,
+		Time:          time.Now(),
+	}
+	server.messages = append(server.messages, sent)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"messaging_product": "whatsapp",
+		"contacts":          []map[string]string{{"input": message.To, "wa_id": sent.WaID}},
+		"messages":          []map[string]string{{"id": sent.ID}},
+	})
+
+	server.emitStatuses(sent, category)
+}
+
+// checkMessage checks that the message has the object of its type and returns the pricing
+// category of the conversation the message belongs to.
+func (server *Server) checkMessage(message *models.Message) (string, *werrors.Error) {
+	var present bool
+	switch message.Type {
+	case "text":
+		present = message.Text != nil && message.Text.Body != ""
+	case "image":
+		present = message.Image != nil
+	case "audio":
+		present = message.Audio != nil
+	case "video":
+		present = message.Video != nil
+	case "document":
+		present = message.Document != nil
+	case "sticker":
+		present = message.Sticker != nil
+	case "reaction":
+		present = message.Reaction != nil
+	case "location":
+		present = message.Location != nil
+	case "contacts":
+		present = message.Contacts != nil && len(message.Contacts.Contacts) > 0
+	case "interactive":
+		present = message.Interactive != nil
+	case "template":
+		return server.checkTemplate(message.Template)
+	default:
+		return "", errInvalidParameter("type " + strconv.Quote(message.Type) + " is not supported")
+	}
+
+	if !present {
+		return "", errRequiredParameter(message.Type)
+	}
+
+	for _, media := range []*models.Media{message.Image, message.Audio, message.Video, message.Document, message.Sticker} {
+		if media == nil {
+			continue
+		}
+
+		if media.ID == "" && media.Link == "" {
+			return "", errRequiredParameter(message.Type + "['id'] or " + message.Type + "['link']")
+		}
+
+		if _, ok := server.media[media.ID]; media.ID != "" && !ok {
+			return "", errInvalidParameter("invalid media id " + media.ID)
+		}
+	}
+
+	return "service", nil
+}
+
+func (server *Server) checkTemplate(template *models.Template) (string, *werrors.Error) {
+	if template == nil || template.Name == "" {
+		return "", errRequiredParameter("template['name']")
+	}
+
+	if template.Language == nil || template.Language.Code == "" {
+		return "", errRequiredParameter("template['language']['code']")
+	}
+
+	for _, t := range server.templates {
+		if t.Name == template.Name && t.Language == template.Language.Code && t.Status == templates.StatusApproved {
+			return strings.ToLower(string(t.Category)), nil
+		}
+	}
+
+	return "", errTemplateNotFound(template.Name, template.Language.Code)
+}
+
+func (server *Server) messageTemplates(w http.ResponseWriter, r *http.Request, businessAccountID string, body []byte) {
+	if businessAccountID != server.businessAccountID {
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, businessAccountID))
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		server.listTemplates(w, r)
+	case http.MethodPost:
+		server.createTemplate(w, body)
+	case http.MethodDelete:
+		server.deleteTemplate(w, r)
+	default:
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, businessAccountID+"/message_templates"))
+	}
+}
+
+func (server *Server) createTemplate(w http.ResponseWriter, body []byte) {
+	var req templates.CreateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+
+	switch {
+	case req.Name == "":
+		writeError(w, http.StatusBadRequest, errRequiredParameter("name"))
+
+		return
+	case req.Language == "":
+		writeError(w, http.StatusBadRequest, errRequiredParameter("language"))
+
+		return
+	case req.Category == "":
+		writeError(w, http.StatusBadRequest, errRequiredParameter("category"))
+
+		return
+	case len(req.Components) == 0:
+		writeError(w, http.StatusBadRequest, errRequiredParameter("components"))
+
+		return
+	}
+
+	for _, t := range server.templates {
+		if t.Name == req.Name && t.Language == req.Language {
+			writeError(w, http.StatusBadRequest, errTemplateExists(req.Name, req.Language))
+
+			return
+		}
+	}
+
+	template := &templates.Template{
+		ID:         numericID(),
+		Name:       req.Name,
+		Language:   req.Language,
+		Status:     server.templateStatus,
+		Category:   req.Category,
+		Components: req.Components,
+	}
+	server.templates = append(server.templates, template)
+
+	writeJSON(w, http.StatusOK, &templates.CreateResponse{
+		ID:       template.ID,
+		Status:   template.Status,
+		Category: template.Category,
+	})
+}
+
+func (server *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var matches []*templates.Template
+	for _, t := range server.templates {
+		if status := query.Get("status"); status != "" && string(t.Status) != status {
+			continue
+		}
+		if category := query.Get("category"); category != "" && string(t.Category) != category {
+			continue
+		}
+		if language := query.Get("language"); language != "" && t.Language != language {
+			continue
+		}
+		if name := query.Get("name"); name != "" && !strings.Contains(t.Name, name) {
+			continue
+		}
+		matches = append(matches, t)
+	}
+
+	start := 0
+	if after := query.Get("after"); after != "" {
+		start = decodeCursor(after)
+	}
+	if start > len(matches) {
+		start = len(matches)
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 25
+	}
+
+	end := start + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	page := &templates.ListResponse{Data: matches[start:end]}
+	if page.Data == nil {
+		page.Data = []*templates.Template{}
+	}
+
+	if len(page.Data) > 0 {
+		page.Paging = &templates.Paging{
+			Cursors: &templates.Cursors{Before: encodeCursor(start), After: encodeCursor(end)},
+		}
+		if end < len(matches) {
+			next := *r.URL
+			q := next.Query()
+			q.Set("after", encodeCursor(end))
+			next.RawQuery = q.Encode()
+			page.Paging.Next = server.URL + next.RequestURI()
+		}
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (server *Server) templateByID(id string) *templates.Template {
+	for _, t := range server.templates {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) editTemplate(w http.ResponseWriter, template *templates.Template, body []byte) {
+	var req templates.EditRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+
+	if req.Category != "" {
+		template.Category = req.Category
+	}
+
+	if len(req.Components) > 0 {
+		template.Components = req.Components
+	}
+	template.Status = server.templateStatus
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (server *Server) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name, id := r.URL.Query().Get("name"), r.URL.Query().Get("hsm_id")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("name"))
+
+		return
+	}
+
+	kept := server.templates[:0]
+	deleted := 0
+	for _, t := range server.templates {
+		if t.Name == name && (id == "" || t.ID == id) {
+			deleted++
+
+			continue
+		}
+		kept = append(kept, t)
+	}
+	server.templates = kept
+
+	if deleted == 0 {
+		writeError(w, http.StatusBadRequest, errTemplateNotFound(name, "any language"))
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func encodeCursor(n int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(n)))
+}
+
+func decodeCursor(cursor string) int {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(b))
+
+	return n
+}
+
+// waID returns the WhatsApp ID of the phone number, its digits.
+func waID(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
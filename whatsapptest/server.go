@@ -0,0 +1,696 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package whatsapptest provides a fake Cloud API server for testing code that uses the whatsapp
+// package. The Server keeps state in memory: sent messages, uploaded media, QR codes, templates
+// and phone numbers, and records every request it receives.
+//
+//	server := whatsapptest.NewServer()
+//	defer server.Close()
+//
+//	client := whatsapp.NewClient(
+//		whatsapp.WithBaseURL(server.URL),
+//		whatsapp.WithHTTPClient(server.Client()),
+//		whatsapp.WithAccessToken(whatsapptest.DefaultAccessToken),
+//		whatsapp.WithPhoneNumberID(whatsapptest.DefaultPhoneNumberID),
+//		whatsapp.WithBusinessAccountID(whatsapptest.DefaultBusinessAccountID),
+//	)
+//
+// When a webhook handler is configured with WithWebhook, the server emits signed status
+// notifications for every message sent, the way the Cloud API does.
+package whatsapptest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/templates"
+)
+
+const (
+	DefaultAccessToken        = "whatsapptest-access-token"
+	DefaultPhoneNumberID      = "106540352242922"
+	DefaultDisplayPhoneNumber = "+1 555-025-3483"
+	DefaultVerifiedName       = "Test Business"
+	DefaultBusinessAccountID  = "102290129340398"
+	DefaultVerificationCode   = "123456"
+	DefaultMediaURLTTL        = 5 * time.Minute
+)
+
+// attachmentsPath is the path of the media download URLs returned by the server.
+const attachmentsPath = "/whatsapp_business/attachments/"
+
+type (
+	// Server is a fake Cloud API server. It embeds *httptest.Server so URL, Client and Close
+	// are available on it.
+	Server struct {
+		*httptest.Server
+
+		mu                sync.Mutex
+		accessToken       string
+		businessAccountID string
+		verificationCode  string
+		templateStatus    templates.Status
+		mediaURLTTL       time.Duration
+		phoneNumbers      []*PhoneNumber
+		requests          []*Request
+		messages          []*SentMessage
+		media             map[string]*Media
+		qrCodes           map[string]*QrCode
+		templates         []*templates.Template
+		failures          []*failure
+		verified          map[string]bool
+		webhook           *webhook
+		deliveries        []*Delivery
+		pending           sync.WaitGroup
+	}
+
+	Option func(*Server)
+
+	// Request is a request received by the server.
+	Request struct {
+		Method string
+		Path   string
+		Query  url.Values
+		Header http.Header
+		Body   []byte
+		Time   time.Time
+	}
+
+	// SentMessage is a message accepted by the /messages endpoint.
+	SentMessage struct {
+		ID            string
+		PhoneNumberID string
+		WaID          string
+		Message       *models.Message
+		Time          time.Time
+	}
+
+	// Media is a media file uploaded to the server.
+	Media struct {
+		ID            string
+		PhoneNumberID string
+		Filename      string
+		MimeType      string
+		Sha256        string
+		Data          []byte
+	}
+
+	PhoneNumber struct {
+		ID                 string `json:"id"`
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		VerifiedName       string `json:"verified_name"`
+		QualityRating      string `json:"quality_rating"`
+	}
+
+	QrCode struct {
+		Code             string `json:"code"`
+		PrefilledMessage string `json:"prefilled_message"`
+		DeepLinkURL      string `json:"deep_link_url"`
+		QRImageURL       string `json:"qr_image_url,omitempty"`
+	}
+
+	failure struct {
+		status int
+		err    *werrors.Error
+	}
+)
+
+// WithAccessToken sets the access token the requests must carry, either as a bearer token or
+// as the access_token query parameter. An empty token disables the check.
+func WithAccessToken(token string) Option {
+	return func(server *Server) {
+		server.accessToken = token
+	}
+}
+
+func WithBusinessAccountID(id string) Option {
+	return func(server *Server) {
+		server.businessAccountID = id
+	}
+}
+
+// WithPhoneNumber registers a phone number of the business account. When no phone number is
+// registered the server has DefaultPhoneNumberID.
+func WithPhoneNumber(id, displayPhoneNumber, verifiedName string) Option {
+	return func(server *Server) {
+		server.phoneNumbers = append(server.phoneNumbers, &PhoneNumber{
+			ID:                 id,
+			DisplayPhoneNumber: displayPhoneNumber,
+			VerifiedName:       verifiedName,
+			QualityRating:      "GREEN",
+		})
+	}
+}
+
+// WithVerificationCode sets the code accepted by the verify_code endpoint.
+func WithVerificationCode(code string) Option {
+	return func(server *Server) {
+		server.verificationCode = code
+	}
+}
+
+// WithTemplates adds templates to the business account. Template messages are only accepted
+// for approved templates that exist on the server.
+func WithTemplates(list ...*templates.Template) Option {
+	return func(server *Server) {
+		for _, template := range list {
+			t := *template
+			if t.ID == "" {
+				t.ID = numericID()
+			}
+			server.templates = append(server.templates, &t)
+		}
+	}
+}
+
+// WithTemplateReviewStatus sets the status given to created and edited templates. The default
+// is APPROVED so templates can be sent right after they are created.
+func WithTemplateReviewStatus(status templates.Status) Option {
+	return func(server *Server) {
+		server.templateStatus = status
+	}
+}
+
+// WithMediaURLTTL sets how long the download URLs returned for media are valid.
+func WithMediaURLTTL(ttl time.Duration) Option {
+	return func(server *Server) {
+		server.mediaURLTTL = ttl
+	}
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished.
+func NewServer(options ...Option) *Server {
+	server := &Server{
+		accessToken:       DefaultAccessToken,
+		businessAccountID: DefaultBusinessAccountID,
+		verificationCode:  DefaultVerificationCode,
+		templateStatus:    templates.StatusApproved,
+		mediaURLTTL:       DefaultMediaURLTTL,
+		media:             map[string]*Media{},
+		qrCodes:           map[string]*QrCode{},
+		verified:          map[string]bool{},
+	}
+
+	for _, option := range options {
+		option(server)
+	}
+
+	if len(server.phoneNumbers) == 0 {
+		WithPhoneNumber(DefaultPhoneNumberID, DefaultDisplayPhoneNumber, DefaultVerifiedName)(server)
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+
+	return server
+}
+
+// Close waits for the pending webhook notifications and shuts down the server.
+func (server *Server) Close() {
+	server.Wait()
+	server.Server.Close()
+}
+
+// FailNext makes the next request fail with the status code and error. Failures are queued,
+// calling FailNext twice fails the next two requests.
+func (server *Server) FailNext(status int, err *werrors.Error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.failures = append(server.failures, &failure{status: status, err: err})
+}
+
+// SetAccessToken changes the access token the requests must carry, the requests with the
+// previous token fail with the error code 190 as if it had expired.
+func (server *Server) SetAccessToken(token string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.accessToken = token
+}
+
+// Requests returns the requests received by the server in order.
+func (server *Server) Requests() []*Request {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]*Request(nil), server.requests...)
+}
+
+// Messages returns the messages sent through the server in order. Read receipts are not included.
+func (server *Server) Messages() []*SentMessage {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]*SentMessage(nil), server.messages...)
+}
+
+// Media returns the uploaded media with the given ID.
+func (server *Server) Media(id string) (*Media, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	media, ok := server.media[id]
+
+	return media, ok
+}
+
+// AddMedia stores the data as media of the default phone number, as if it was received from
+// a customer, and returns its ID.
+func (server *Server) AddMedia(mimeType string, data []byte) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	sum := sha256.Sum256(data)
+	media := &Media{
+		ID:            numericID(),
+		PhoneNumberID: server.phoneNumbers[0].ID,
+		MimeType:      mimeType,
+		Sha256:        hex.EncodeToString(sum[:]),
+		Data:          append([]byte(nil), data...),
+	}
+	server.media[media.ID] = media
+
+	return media.ID
+}
+
+// Templates returns the templates of the business account.
+func (server *Server) Templates() []*templates.Template {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]*templates.Template(nil), server.templates...)
+}
+
+// Verified reports whether the phone number was verified with the verify_code endpoint.
+func (server *Server) Verified(phoneNumberID string) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.verified[phoneNumberID]
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter("could not read the request body"))
+
+		return
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.requests = append(server.requests, &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	})
+
+	if len(server.failures) > 0 {
+		f := server.failures[0]
+		server.failures = server.failures[1:]
+		writeError(w, f.status, f.err)
+
+		return
+	}
+
+	if !server.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errInvalidAccessToken())
+
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, attachmentsPath) {
+		server.download(w, r)
+
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "v") {
+		writeError(w, http.StatusBadRequest, errUnknownPath(r.URL.Path))
+
+		return
+	}
+
+	server.route(w, r, parts[1], parts[2:], body)
+}
+
+func (server *Server) route(w http.ResponseWriter, r *http.Request, id string, endpoints []string, body []byte) {
+	if len(endpoints) == 0 {
+		server.node(w, r, id, body)
+
+		return
+	}
+
+	endpoint := endpoints[0]
+	switch {
+	case endpoint == "phone_numbers" && r.Method == http.MethodGet:
+		server.listPhoneNumbers(w, id)
+	case endpoint == "message_templates":
+		server.messageTemplates(w, r, id, body)
+	case server.phoneNumber(id) == nil:
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id))
+	case endpoint == "messages" && r.Method == http.MethodPost:
+		server.sendMessage(w, id, body)
+	case endpoint == "media" && r.Method == http.MethodPost:
+		server.uploadMedia(w, r, id, body)
+	case endpoint == "message_qrdls":
+		server.qrCodeEndpoint(w, r, id, endpoints[1:])
+	case endpoint == "request_code" && r.Method == http.MethodPost:
+		server.requestCode(w, r, body)
+	case endpoint == "verify_code" && r.Method == http.MethodPost:
+		server.verifyCode(w, id, body)
+	default:
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id+"/"+strings.Join(endpoints, "/")))
+	}
+}
+
+// node serves the requests made to a single object: media, templates and phone numbers.
+func (server *Server) node(w http.ResponseWriter, r *http.Request, id string, body []byte) {
+	if media, ok := server.media[id]; ok {
+		switch r.Method {
+		case http.MethodGet:
+			if pid := r.URL.Query().Get("phone_number_id"); pid != "" && pid != media.PhoneNumberID {
+				writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id))
+
+				return
+			}
+			writeJSON(w, http.StatusOK, server.mediaInfo(media))
+		case http.MethodDelete:
+			delete(server.media, id)
+			writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+		default:
+			writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id))
+		}
+
+		return
+	}
+
+	if template := server.templateByID(id); template != nil {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, template)
+		case http.MethodPost:
+			server.editTemplate(w, template, body)
+		default:
+			writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id))
+		}
+
+		return
+	}
+
+	if phone := server.phoneNumber(id); phone != nil && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, phone)
+
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, errUnsupported(r.Method, id))
+}
+
+func (server *Server) authorized(r *http.Request) bool {
+	if server.accessToken == "" {
+		return true
+	}
+
+	if r.Header.Get("Authorization") == "Bearer "+server.accessToken {
+		return true
+	}
+
+	return r.URL.Query().Get("access_token") == server.accessToken
+}
+
+func (server *Server) phoneNumber(id string) *PhoneNumber {
+	for _, phone := range server.phoneNumbers {
+		if phone.ID == id {
+			return phone
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) listPhoneNumbers(w http.ResponseWriter, businessAccountID string) {
+	if businessAccountID != server.businessAccountID {
+		writeError(w, http.StatusBadRequest, errUnsupported(http.MethodGet, businessAccountID))
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data":    server.phoneNumbers,
+		"summary": map[string]int{"total_count": len(server.phoneNumbers)},
+	})
+}
+
+func (server *Server) requestCode(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		writeError(w, http.StatusBadRequest, errInvalidParameter("code_method and language must be form fields"))
+
+		return
+	}
+
+	method := form.Get("code_method")
+	if method != "SMS" && method != "VOICE" {
+		writeError(w, http.StatusBadRequest, errInvalidParameter("code_method must be SMS or VOICE"))
+
+		return
+	}
+
+	if form.Get("language") == "" {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("language"))
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (server *Server) verifyCode(w http.ResponseWriter, phoneNumberID string, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("code"))
+
+		return
+	}
+
+	if form.Get("code") != server.verificationCode {
+		writeError(w, http.StatusBadRequest, &werrors.Error{
+			Message:   "(#136025) Verify code error",
+			Type:      "OAuthException",
+			Code:      136025,
+			Data:      &werrors.ErrorData{MessagingProduct: "whatsapp", Details: "Code couldn't be verified."},
+			FBTraceID: traceID(),
+		})
+
+		return
+	}
+
+	server.verified[phoneNumberID] = true
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (server *Server) uploadMedia(w http.ResponseWriter, r *http.Request, phoneNumberID string, body []byte) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		writeError(w, http.StatusBadRequest, errInvalidParameter("the request must be multipart/form-data"))
+
+		return
+	}
+
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(int64(len(body)) + 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+	defer form.RemoveAll() //nolint:errcheck
+
+	if product := form.Value["messaging_product"]; len(product) == 0 || product[0] != "whatsapp" {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("messaging_product"))
+
+		return
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, errRequiredParameter("file"))
+
+		return
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidParameter(err.Error()))
+
+		return
+	}
+
+	mimeType := files[0].Header.Get("Content-Type")
+	if types := form.Value["type"]; len(types) > 0 && types[0] != "" {
+		mimeType = types[0]
+	}
+
+	sum := sha256.Sum256(data)
+	media := &Media{
+		ID:            numericID(),
+		PhoneNumberID: phoneNumberID,
+		Filename:      files[0].Filename,
+		MimeType:      mimeType,
+		Sha256:        hex.EncodeToString(sum[:]),
+		Data:          data,
+	}
+	server.media[media.ID] = media
+
+	writeJSON(w, http.StatusOK, map[string]string{"id": media.ID})
+}
+
+func (server *Server) mediaInfo(media *Media) map[string]any {
+	query := url.Values{}
+	query.Set("mid", media.ID)
+	query.Set("ext", formatInt(time.Now().Add(server.mediaURLTTL).Unix()))
+	query.Set("hash", media.Sha256[:16])
+
+	return map[string]any{
+		"messaging_product": "whatsapp",
+		"url":               server.URL + attachmentsPath + "?" + query.Encode(),
+		"mime_type":         media.MimeType,
+		"sha256":            media.Sha256,
+		"file_size":         len(media.Data),
+		"id":                media.ID,
+	}
+}
+
+func (server *Server) download(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	media, ok := server.media[query.Get("mid")]
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if expiry, err := parseInt(query.Get("ext")); err != nil || time.Now().Unix() > expiry {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", media.MimeType)
+	w.Header().Set("Content-Length", formatInt(int64(len(media.Data))))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(media.Data)
+}
+
+func (server *Server) qrCodeEndpoint(w http.ResponseWriter, r *http.Request, phoneNumberID string, path []string) {
+	query := r.URL.Query()
+	if len(path) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			list := make([]*QrCode, 0, len(server.qrCodes))
+			for _, code := range server.qrCodes {
+				list = append(list, &QrCode{
+					Code:             code.Code,
+					PrefilledMessage: code.PrefilledMessage,
+					DeepLinkURL:      code.DeepLinkURL,
+				})
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"data": list})
+		case http.MethodPost:
+			if query.Get("prefilled_message") == "" {
+				writeError(w, http.StatusBadRequest, errRequiredParameter("prefilled_message"))
+
+				return
+			}
+			code := &QrCode{
+				Code:             qrCode(),
+				PrefilledMessage: query.Get("prefilled_message"),
+			}
+			code.DeepLinkURL = "https://wa.me/message/" + code.Code
+			if format := query.Get("generate_qr_image"); format != "" {
+				code.QRImageURL = server.URL + "/qr/" + code.Code + "." + strings.ToLower(format)
+			}
+			server.qrCodes[code.Code] = code
+			writeJSON(w, http.StatusOK, code)
+		default:
+			writeError(w, http.StatusBadRequest, errUnsupported(r.Method, phoneNumberID+"/message_qrdls"))
+		}
+
+		return
+	}
+
+	code, ok := server.qrCodes[path[0]]
+	if !ok {
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, path[0]))
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"data": []*QrCode{{
+			Code:             code.Code,
+			PrefilledMessage: code.PrefilledMessage,
+			DeepLinkURL:      code.DeepLinkURL,
+		}}})
+	case http.MethodPost:
+		if message := query.Get("prefilled_message"); message != "" {
+			code.PrefilledMessage = message
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	case http.MethodDelete:
+		delete(server.qrCodes, code.Code)
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	default:
+		writeError(w, http.StatusBadRequest, errUnsupported(r.Method, code.Code))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err *werrors.Error) {
+	writeJSON(w, status, map[string]*werrors.Error{"error": err})
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/piusalfred/whatsapp"
+	werrors "github.com/piusalfred/whatsapp/errors"
+	whttp "github.com/piusalfred/whatsapp/http"
+	"github.com/piusalfred/whatsapp/models"
+	"github.com/piusalfred/whatsapp/templates"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func newClient(server *Server, options ...whatsapp.ClientOption) *whatsapp.Client {
+	options = append([]whatsapp.ClientOption{
+		whatsapp.WithBaseURL(server.URL),
+		whatsapp.WithHTTPClient(server.Client()),
+		whatsapp.WithAccessToken(DefaultAccessToken),
+		whatsapp.WithPhoneNumberID(DefaultPhoneNumberID),
+		whatsapp.WithBusinessAccountID(DefaultBusinessAccountID),
+	}, options...)
+
+	return whatsapp.NewClient(options...)
+}
+
+func TestServer_Webhooks(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		statuses []string
+		texts    []string
+	)
+	listener := webhooks.NewEventListener(
+		webhooks.WithHandlerOptions(&webhooks.HandlerOptions{ValidateSignature: true, Secret: "app-secret"}),
+		webhooks.WithNotificationErrorHandler(func(ctx context.Context, r *http.Request, err error) *webhooks.Response {
+			return &webhooks.Response{StatusCode: http.StatusUnauthorized}
+		}),
+	)
+	listener.OnMessageStatusChange(func(ctx context.Context, nctx *webhooks.NotificationContext, status *webhooks.Status) error {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = append(statuses, status.StatusValue)
+
+		return nil
+	})
+	listener.OnTextMessage(func(ctx context.Context, nctx *webhooks.NotificationContext, mctx *webhooks.MessageContext,
+		text *webhooks.Text,
+	) error {
+		mu.Lock()
+		defer mu.Unlock()
+		texts = append(texts, mctx.From+": "+text.Body)
+
+		return nil
+	})
+
+	server := NewServer(WithWebhook(listener.NotificationHandler(), "app-secret"))
+	defer server.Close()
+	client := newClient(server)
+
+	resp, err := client.SendTextMessage(context.TODO(), "+255 767 001 828", &whatsapp.TextMessage{Message: "Hello"})
+	if err != nil {
+		t.Fatalf("SendTextMessage() error = %v", err)
+	}
+
+	if resp.Contacts[0].WhatsappID != "255767001828" {
+		t.Errorf("SendTextMessage() wa_id = %q, want 255767001828", resp.Contacts[0].WhatsappID)
+	}
+
+	if _, err := server.ReceiveText(context.TODO(), "255767001828", "Pius", "Hi back"); err != nil {
+		t.Fatalf("ReceiveText() error = %v", err)
+	}
+	server.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(statuses) != 3 || statuses[0] != StatusSent || statuses[2] != StatusRead {
+		t.Errorf("statuses = %v, want [sent delivered read]", statuses)
+	}
+
+	if len(texts) != 1 || texts[0] != "255767001828: Hi back" {
+		t.Errorf("texts = %v, want the received text", texts)
+	}
+
+	for _, delivery := range server.Deliveries() {
+		if delivery.StatusCode != http.StatusOK {
+			t.Errorf("delivery status code = %d, want %d", delivery.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestServer_Media(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	defer server.Close()
+	client := newClient(server)
+	ctx := context.TODO()
+
+	uploaded, err := client.UploadMedia(ctx, whatsapp.MediaTypeImage, "pic.png", bytes.NewReader([]byte("png data")))
+	if err != nil {
+		t.Fatalf("UploadMedia() error = %v", err)
+	}
+
+	media, err := client.GetMedia(ctx, uploaded.ID)
+	if err != nil {
+		t.Fatalf("GetMedia() error = %v", err)
+	}
+
+	if media.FileSize != 8 || media.ID != uploaded.ID {
+		t.Errorf("GetMedia() = %+v, want size 8 and id %s", media, uploaded.ID)
+	}
+
+	reader, err := client.DownloadMedia(ctx, uploaded.ID)
+	if err != nil {
+		t.Fatalf("DownloadMedia() error = %v", err)
+	}
+
+	if data, _ := io.ReadAll(reader); string(data) != "png data" {
+		t.Errorf("DownloadMedia() = %q, want %q", data, "png data")
+	}
+
+	if _, err := client.SendMedia(ctx, "255767001828", &whatsapp.MediaMessage{
+		Type:    whatsapp.MediaTypeImage,
+		MediaID: "404",
+	}, nil); err == nil {
+		t.Errorf("SendMedia() with unknown media error = nil, want error")
+	}
+
+	if _, err := client.DeleteMedia(ctx, uploaded.ID); err != nil {
+		t.Fatalf("DeleteMedia() error = %v", err)
+	}
+
+	if _, ok := server.Media(uploaded.ID); ok {
+		t.Errorf("Media(%s) exists after delete", uploaded.ID)
+	}
+}
+
+func TestServer_Templates(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	defer server.Close()
+	client := newClient(server)
+	ctx := context.TODO()
+
+	template := &whatsapp.Template{Name: "order_update", LanguageCode: "en_US"}
+	_, err := client.SendTemplate(ctx, "255767001828", template)
+	var rerr *whttp.ResponseError
+	if !errors.As(err, &rerr) || rerr.Err.Code != 132001 {
+		t.Fatalf("SendTemplate() with unknown template error = %v, want code 132001", err)
+	}
+
+	if _, err := client.CreateTemplate(ctx, &templates.CreateRequest{
+		Name:       "order_update",
+		Language:   "en_US",
+		Category:   templates.CategoryUtility,
+		Components: []*templates.Component{{Type: templates.ComponentBody, Text: "Your order has shipped"}},
+	}); err != nil {
+		t.Fatalf("CreateTemplate() error = %v", err)
+	}
+
+	if _, err := client.SendTemplate(ctx, "255767001828", template); err != nil {
+		t.Fatalf("SendTemplate() error = %v", err)
+	}
+
+	list, err := client.ListAllTemplates(ctx, &templates.ListOptions{Category: templates.CategoryUtility})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListAllTemplates() = %v, %v, want one template", list, err)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	defer server.Close()
+	ctx := context.TODO()
+
+	_, err := newClient(server, whatsapp.WithAccessToken("wrong")).SendTextMessage(ctx, "255767001828",
+		&whatsapp.TextMessage{Message: "Hello"})
+	var rerr *whttp.ResponseError
+	if !errors.As(err, &rerr) || rerr.Code != http.StatusUnauthorized || rerr.Err.Code != 190 {
+		t.Errorf("SendTextMessage() with wrong token error = %v, want code 190", err)
+	}
+
+	server.FailNext(http.StatusTooManyRequests, &werrors.Error{Code: 130429, Message: "Rate limit hit"})
+	policy := &whttp.RetryPolicy{MaxAttempts: 2}
+	client := newClient(server, whatsapp.WithRetryPolicy(policy))
+	if _, err := client.SendTextMessage(ctx, "255767001828", &whatsapp.TextMessage{Message: "Hello"}); err != nil {
+		t.Errorf("SendTextMessage() after one failure error = %v, want nil", err)
+	}
+
+	if err := client.RequestVerificationCode(ctx, "SMS", "en"); err != nil {
+		t.Errorf("RequestVerificationCode() error = %v", err)
+	}
+
+	if err := whatsapp.VerifyCode(ctx, server.Client(), &whatsapp.VerificationCodeRequest{
+		Token:         DefaultAccessToken,
+		BaseURL:       server.URL,
+		ApiVersion:    "v16.0",
+		PhoneNumberID: DefaultPhoneNumberID,
+	}, DefaultVerificationCode); err != nil || !server.Verified(DefaultPhoneNumberID) {
+		t.Errorf("VerifyCode() error = %v, want verified", err)
+	}
+
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("Messages() = %d, want 1", n)
+	}
+
+	if _, err := client.SendContacts(ctx, "255767001828", &models.Contacts{}); err == nil {
+		t.Errorf("SendContacts() without contacts error = nil, want error")
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapptest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	werrors "github.com/piusalfred/whatsapp/errors"
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// Message statuses emitted to the webhook handler.
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusFailed    = "failed"
+)
+
+var ErrNoWebhook = errors.New("whatsapptest: no webhook handler configured")
+
+type (
+	webhook struct {
+		handler  http.Handler
+		secret   string
+		statuses []string
+	}
+
+	// Delivery is a notification delivered to the webhook handler and the status code
+	// the handler responded with.
+	Delivery struct {
+		Notification *webhooks.Notification
+		Body         []byte
+		StatusCode   int
+	}
+)
+
+// WithWebhook sets the handler, usually webhooks.EventListener.NotificationHandler, that receives
+// the notifications of the server. The notifications are signed with the app secret in the
+// X-Hub-Signature-256 header, an empty secret leaves them unsigned.
+//
+// A sent, delivered and read status is emitted for every message sent through the server,
+// use WithStatuses to change that.
+func WithWebhook(handler http.Handler, appSecret string) Option {
+	return func(server *Server) {
+		statuses := []string{StatusSent, StatusDelivered, StatusRead}
+		if server.webhook != nil {
+			statuses = server.webhook.statuses
+		}
+		server.webhook = &webhook{handler: handler, secret: appSecret, statuses: statuses}
+	}
+}
+
+// WithStatuses sets the statuses emitted, in order, for every message sent. No status is
+// emitted when called without statuses.
+func WithStatuses(statuses ...string) Option {
+	return func(server *Server) {
+		if server.webhook == nil {
+			server.webhook = &webhook{}
+		}
+		server.webhook.statuses = statuses
+	}
+}
+
+// Wait blocks until the status notifications of the messages sent so far are delivered.
+func (server *Server) Wait() {
+	server.pending.Wait()
+}
+
+// Deliveries returns the notifications delivered to the webhook handler in order.
+func (server *Server) Deliveries() []*Delivery {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]*Delivery(nil), server.deliveries...)
+}
+
+// Notify signs the notification and delivers it to the webhook handler.
+func (server *Server) Notify(ctx context.Context, notification *webhooks.Notification) (*Delivery, error) {
+	server.mu.Lock()
+	hook := server.webhook
+	server.mu.Unlock()
+
+	if hook == nil || hook.handler == nil {
+		return nil, ErrNoWebhook
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return nil, fmt.Errorf("whatsapptest: notify: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/webhooks", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("whatsapptest: notify: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if hook.secret != "" {
+		request.Header.Set(webhooks.SignatureHeaderKey, "sha256="+Sign(body, hook.secret))
+	}
+
+	recorder := httptest.NewRecorder()
+	hook.handler.ServeHTTP(recorder, request)
+
+	delivery := &Delivery{Notification: notification, Body: body, StatusCode: recorder.Code}
+	server.mu.Lock()
+	server.deliveries = append(server.deliveries, delivery)
+	server.mu.Unlock()
+
+	return delivery, nil
+}
+
+// SendStatus delivers a status notification for the message sent through the server. The
+// errors are included in failed statuses.
+func (server *Server) SendStatus(ctx context.Context, messageID, status string, errs ...*werrors.Error) (
+	*Delivery, error,
+) {
+	server.mu.Lock()
+	var sent *SentMessage
+	for _, message := range server.messages {
+		if message.ID == messageID {
+			sent = message
+		}
+	}
+	server.mu.Unlock()
+
+	if sent == nil {
+		return nil, fmt.Errorf("whatsapptest: send status: unknown message %q", messageID)
+	}
+
+	category := "service"
+	if sent.Message.Type == "template" {
+		server.mu.Lock()
+		category, _ = server.checkTemplate(sent.Message.Template)
+		server.mu.Unlock()
+	}
+
+	return server.Notify(ctx, server.statusNotification(sent, category, status, errs))
+}
+
+// ReceiveMessage delivers a notification of a message sent by the customer from to the first
+// phone number of the server. The ID and the timestamp of the message are set if empty.
+func (server *Server) ReceiveMessage(ctx context.Context, from, name string, message *webhooks.Message) (
+	*Delivery, error,
+) {
+	if message.ID == "" {
+		message.ID = messageID()
+	}
+
+	if message.Timestamp == "" {
+		message.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	message.From = from
+
+	server.mu.Lock()
+	value := server.value()
+	server.mu.Unlock()
+
+	value.Contacts = []*webhooks.Contact{{Profile: &webhooks.Profile{Name: name}, WaID: from}}
+	value.Messages = []*webhooks.Message{message}
+
+	return server.Notify(ctx, server.notification(value))
+}
+
+// ReceiveText delivers a notification of a text message sent by the customer.
+func (server *Server) ReceiveText(ctx context.Context, from, name, text string) (*Delivery, error) {
+	return server.ReceiveMessage(ctx, from, name, &webhooks.Message{
+		Type: "text",
+		Text: &webhooks.Text{Body: text},
+	})
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the payload, as found after sha256= in
+// the X-Hub-Signature-256 header.
+func Sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// emitStatuses delivers the configured statuses of the sent message in the background. It is
+// called with the server lock held.
+func (server *Server) emitStatuses(sent *SentMessage, category string) {
+	if server.webhook == nil || server.webhook.handler == nil || len(server.webhook.statuses) == 0 {
+		return
+	}
+
+	statuses := server.webhook.statuses
+	server.pending.Add(1)
+	go func() {
+		defer server.pending.Done()
+		for _, status := range statuses {
+			_, _ = server.Notify(context.Background(), server.statusNotification(sent, category, status, nil))
+		}
+	}()
+}
+
+func (server *Server) statusNotification(sent *SentMessage, category, status string, errs []*werrors.Error,
+) *webhooks.Notification {
+	now := time.Now()
+	value := &webhooks.Value{
+		MessagingProduct: "whatsapp",
+		Metadata:         &webhooks.Metadata{PhoneNumberID: sent.PhoneNumberID},
+	}
+
+	server.mu.Lock()
+	if phone := server.phoneNumber(sent.PhoneNumberID); phone != nil {
+		value.Metadata.DisplayPhoneNumber = waID(phone.DisplayPhoneNumber)
+	}
+	server.mu.Unlock()
+
+	s := &webhooks.Status{
+		ID:          sent.ID,
+		RecipientID: sent.WaID,
+		StatusValue: status,
+		Timestamp:   int(now.Unix()),
+		Errors:      errs,
+	}
+
+	if status == StatusSent || status == StatusDelivered {
+		s.Conversation = &webhooks.Conversation{
+			ID:     conversationID(sent),
+			Origin: &webhooks.ConversationOrigin{Type: category},
+			Expiry: int(sent.Time.Add(24 * time.Hour).Unix()),
+		}
+		s.Pricing = &webhooks.Pricing{Billable: true, Category: category, PricingModel: "CBP"}
+	}
+	value.Statuses = []*webhooks.Status{s}
+
+	return server.notification(value)
+}
+
+// value returns a value with the metadata of the first phone number. It is called with the
+// server lock held.
+func (server *Server) value() *webhooks.Value {
+	phone := server.phoneNumbers[0]
+
+	return &webhooks.Value{
+		MessagingProduct: "whatsapp",
+		Metadata: &webhooks.Metadata{
+			DisplayPhoneNumber: waID(phone.DisplayPhoneNumber),
+			PhoneNumberID:      phone.ID,
+		},
+	}
+}
+
+func (server *Server) notification(value *webhooks.Value) *webhooks.Notification {
+	return &webhooks.Notification{
+		Object: "whatsapp_business_account",
+		Entry: []*webhooks.Entry{{
+			ID:      server.businessAccountID,
+			Changes: []*webhooks.Change{{Field: "messages", Value: value}},
+		}},
+	}
+}
+
+// conversationID returns the same conversation ID for the messages sent to a recipient on the
+// same day.
+func conversationID(sent *SentMessage) string {
+	sum := sha256.Sum256([]byte(sent.PhoneNumberID + sent.WaID + sent.Time.Format("2006-01-02")))
+
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+// CustomerServiceWindow is how long after the last message of a customer the business can
+// send free-form messages. Later messages must be templates, otherwise the Cloud API fails
+// with the error 131047.
+const CustomerServiceWindow = 24 * time.Hour
+
+var ErrWindowClosed = errors.New("customer service window closed")
+
+type (
+	// InboundStore stores the time of the last message received from each customer, by wa_id.
+	// LastInbound returns the zero time for a customer that never sent a message.
+	// Implementations must be safe for concurrent use. conversation.Store is an InboundStore.
+	InboundStore interface {
+		LastInbound(ctx context.Context, waID string) (time.Time, error)
+		SetLastInbound(ctx context.Context, waID string, at time.Time) error
+	}
+
+	// WindowClosedError is returned by the free-form sends of a client with a WindowGuard when
+	// the customer service window with the recipient is closed. It matches ErrWindowClosed.
+	WindowClosedError struct {
+		Recipient   string
+		MessageType string
+		LastInbound time.Time
+	}
+
+	// FallbackTemplateFunc returns the template sent instead of a free-form message of the type
+	// when the customer service window with the recipient is closed. A nil template fails the
+	// send with a WindowClosedError.
+	FallbackTemplateFunc func(ctx context.Context, recipient, messageType string) (*Template, error)
+
+	// WindowGuard keeps the clients from sending free-form messages outside the customer
+	// service window. It learns when each customer last messaged from the messages received by
+	// a webhooks.EventListener:
+	//
+	//	guard := whatsapp.NewWindowGuard(whatsapp.NewMemoryInboundStore())
+	//	guard.Attach(listener)
+	//	client := whatsapp.NewClient(whatsapp.WithWindowGuard(guard))
+	//
+	// conversation.Tracker records the windows with a WindowGuard over its store, returned by
+	// its WindowGuard method.
+	WindowGuard struct {
+		mu       sync.Mutex
+		store    InboundStore
+		window   time.Duration
+		fallback FallbackTemplateFunc
+		now      func() time.Time
+	}
+
+	WindowGuardOption func(guard *WindowGuard)
+
+	// MemoryInboundStore is an InboundStore that keeps the times in memory.
+	MemoryInboundStore struct {
+		mu      sync.RWMutex
+		inbound map[string]time.Time
+	}
+)
+
+func (e *WindowClosedError) Error() string {
+	if e.LastInbound.IsZero() {
+		return fmt.Sprintf("%s: %s message to %s, no message received from the recipient",
+			ErrWindowClosed, e.MessageType, e.Recipient)
+	}
+
+	return fmt.Sprintf("%s: %s message to %s, last message received at %s", ErrWindowClosed,
+		e.MessageType, e.Recipient, e.LastInbound.Format(time.RFC3339))
+}
+
+func (e *WindowClosedError) Is(target error) bool {
+	return target == ErrWindowClosed
+}
+
+// WithFallbackTemplate sets the template sent instead of the free-form messages when the
+// window is closed.
+func WithFallbackTemplate(fallback FallbackTemplateFunc) WindowGuardOption {
+	return func(guard *WindowGuard) {
+		guard.fallback = fallback
+	}
+}
+
+// WithWindow sets the length of the window, CustomerServiceWindow by default.
+func WithWindow(window time.Duration) WindowGuardOption {
+	return func(guard *WindowGuard) {
+		guard.window = window
+	}
+}
+
+// WithWindowGuard sets the guard of the free-form messages sent by the client.
+func WithWindowGuard(guard *WindowGuard) ClientOption {
+	return func(client *Client) {
+		client.windowGuard = guard
+	}
+}
+
+// NewWindowGuard returns a WindowGuard that keeps the times of the last messages received in
+// the store.
+func NewWindowGuard(store InboundStore, options ...WindowGuardOption) *WindowGuard {
+	guard := &WindowGuard{
+		store:  store,
+		window: CustomerServiceWindow,
+		now:    time.Now,
+	}
+	for _, option := range options {
+		option(guard)
+	}
+
+	return guard
+}
+
+// Attach subscribes the guard to the messages received by the listener.
+func (guard *WindowGuard) Attach(listener *webhooks.EventListener) webhooks.Unsubscribe {
+	return listener.OnMessageReceived(guard.MessageReceived)
+}
+
+// MessageReceived records the message as the last received from its sender, it is a
+// webhooks.OnMessageReceivedHook.
+func (guard *WindowGuard) MessageReceived(ctx context.Context, _ *webhooks.NotificationContext,
+	message *webhooks.Message,
+) error {
+	if message.From == "" {
+		return nil
+	}
+
+	at := guard.now()
+	if seconds, err := strconv.ParseInt(message.Timestamp, 10, 64); err == nil {
+		at = time.Unix(seconds, 0)
+	}
+
+	return guard.Received(ctx, message.From, at)
+}
+
+// Received records a message received from the customer at the time, unless a later one is
+// already recorded.
+func (guard *WindowGuard) Received(ctx context.Context, waID string, at time.Time) error {
+	waID = normalizeWaID(waID)
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	last, err := guard.store.LastInbound(ctx, waID)
+	if err != nil {
+		return fmt.Errorf("window guard: last inbound: %w", err)
+	}
+
+	if !at.After(last) {
+		return nil
+	}
+
+	if err := guard.store.SetLastInbound(ctx, waID, at); err != nil {
+		return fmt.Errorf("window guard: set last inbound: %w", err)
+	}
+
+	return nil
+}
+
+// Expiry returns when the window with the customer closes, or closed, and the zero time if the
+// customer never sent a message.
+func (guard *WindowGuard) Expiry(ctx context.Context, waID string) (time.Time, error) {
+	last, err := guard.store.LastInbound(ctx, normalizeWaID(waID))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("window guard: last inbound: %w", err)
+	}
+
+	if last.IsZero() {
+		return time.Time{}, nil
+	}
+
+	return last.Add(guard.window), nil
+}
+
+// Check returns a WindowClosedError if the window with the recipient is closed.
+func (guard *WindowGuard) Check(ctx context.Context, recipient, messageType string) error {
+	expiry, err := guard.Expiry(ctx, recipient)
+	if err != nil {
+		return err
+	}
+
+	if guard.now().Before(expiry) {
+		return nil
+	}
+
+	var last time.Time
+	if !expiry.IsZero() {
+		last = expiry.Add(-guard.window)
+	}
+
+	return &WindowClosedError{Recipient: recipient, MessageType: messageType, LastInbound: last}
+}
+
+// guard checks the window before a free-form message is sent. It returns the template to
+// send instead, or the error that fails the send.
+func (guard *WindowGuard) guard(ctx context.Context, recipient, messageType string) (*Template, error) {
+	err := guard.Check(ctx, recipient, messageType)
+	if err == nil || !errors.Is(err, ErrWindowClosed) || guard.fallback == nil {
+		return nil, err
+	}
+
+	template, ferr := guard.fallback(ctx, recipient, messageType)
+	if ferr != nil {
+		return nil, fmt.Errorf("window guard: fallback template: %w", ferr)
+	}
+
+	if template == nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// normalizeWaID returns the WhatsApp ID of a phone number, its digits.
+func normalizeWaID(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+
+		return -1
+	}, phone)
+}
+
+// NewMemoryInboundStore returns an empty MemoryInboundStore.
+func NewMemoryInboundStore() *MemoryInboundStore {
+	return &MemoryInboundStore{inbound: make(map[string]time.Time)}
+}
+
+// LastInbound returns the time of the last message received from the customer.
+func (store *MemoryInboundStore) LastInbound(_ context.Context, waID string) (time.Time, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.inbound[waID], nil
+}
+
+// SetLastInbound sets the time of the last message received from the customer.
+func (store *MemoryInboundStore) SetLastInbound(_ context.Context, waID string, at time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.inbound[waID] = at
+
+	return nil
+}
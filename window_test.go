@@ -0,0 +1,141 @@
+/*
+ * Copyright 2023 Pius Alfred <me.pius1102@gmail.com>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this software
+ * and associated documentation files (the “Software”), to deal in the Software without restriction,
+ * including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+ * and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all copies or substantial
+ * portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED “AS IS”, WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+ * LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+ * IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piusalfred/whatsapp/webhooks"
+)
+
+func TestWindowGuard(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Type string `json:"type"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.Type)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"messaging_product":"whatsapp","messages":[{"id":"wamid.1"}]}`))
+	}))
+	defer server.Close()
+
+	store := NewMemoryInboundStore()
+	guard := NewWindowGuard(store)
+	fallback := NewWindowGuard(store, WithFallbackTemplate(
+		func(_ context.Context, _, messageType string) (*Template, error) {
+			if messageType == "reaction" {
+				return nil, nil
+			}
+
+			return &Template{Name: "reopen", LanguageCode: "en_US"}, nil
+		}))
+
+	for from, at := range map[string]time.Time{
+		"255700000001": now.Add(-time.Hour),
+		"255700000002": now.Add(-25 * time.Hour),
+	} {
+		err := guard.MessageReceived(context.Background(), nil, &webhooks.Message{
+			From: from, Timestamp: strconv.FormatInt(at.Unix(), 10),
+		})
+		if err != nil {
+			t.Fatalf("MessageReceived() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		guard     *WindowGuard
+		recipient string
+		send      func(client *Client, recipient string) error
+		wantErr   bool
+		wantSent  string
+	}{
+		{
+			name: "open window", guard: guard, recipient: "+255700000001", send: sendText, wantSent: "text",
+		},
+		{
+			name: "closed window", guard: guard, recipient: "255700000002", send: sendText, wantErr: true,
+		},
+		{
+			name: "never messaged", guard: guard, recipient: "255700000003", send: sendText, wantErr: true,
+		},
+		{
+			name: "template is not guarded", guard: guard, recipient: "255700000002", wantSent: "template",
+			send: func(client *Client, recipient string) error {
+				_, err := client.SendTemplate(context.Background(), recipient, &Template{Name: "hello"})
+
+				return err
+			},
+		},
+		{
+			name: "fallback template", guard: fallback, recipient: "255700000002", send: sendText,
+			wantSent: "template",
+		},
+		{
+			name: "no fallback template", guard: fallback, recipient: "255700000002", wantErr: true,
+			send: func(client *Client, recipient string) error {
+				_, err := client.React(context.Background(), recipient, &ReactMessage{MessageID: "wamid.1", Emoji: "👍"})
+
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mu.Lock()
+		sent = nil
+		mu.Unlock()
+		client := NewClient(WithBaseURL(server.URL), WithPhoneNumberID("1234"), WithAccessToken("token"),
+			WithWindowGuard(tt.guard))
+		err := tt.send(client, tt.recipient)
+		var closed *WindowClosedError
+		if tt.wantErr != (errors.Is(err, ErrWindowClosed) && errors.As(err, &closed)) {
+			t.Errorf("%s: send error = %v, want window closed %v", tt.name, err, tt.wantErr)
+		}
+
+		mu.Lock()
+		if (tt.wantSent == "" && len(sent) != 0) || (tt.wantSent != "" && (len(sent) != 1 || sent[0] != tt.wantSent)) {
+			t.Errorf("%s: sent %v, want %q", tt.name, sent, tt.wantSent)
+		}
+		mu.Unlock()
+	}
+}
+
+func sendText(client *Client, recipient string) error {
+	_, err := client.SendTextMessage(context.Background(), recipient, &TextMessage{Message: "hi"})
+
+	return err //nolint:wrapcheck
+}